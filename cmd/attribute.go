@@ -0,0 +1,413 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// attributeValues returns the custom attribute values set with the
+// attribute flag, name=value, which can be repeated
+func attributeValues() (map[string][]string, error) {
+	assignments := viper.GetStringSlice("attribute")
+	if len(assignments) == 0 {
+		return nil, nil
+	}
+	return models.ParseAttributeAssignments(assignments)
+}
+
+// printAttributeValues prints the custom attributes of a user or a group
+func printAttributeValues(cmd *cobra.Command, attributes map[string][]string) {
+	if len(attributes) == 0 {
+		return
+	}
+
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Attributes:\n")
+	for _, name := range names {
+		fmt.Fprintf(cmd.OutOrStdout(), " * %s: %s\n", name, strings.Join(attributes[name], ", "))
+	}
+}
+
+// ListAttributesCmd - TODO comment
+func ListAttributesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List custom attributes",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/attributes", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]models.AttributeInfo{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]models.AttributeInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-6s %-20s %-16s %-6s %-10s %-7s %-9s\n",
+				"ID",
+				"NAME",
+				"SYNTAX",
+				"MULTI",
+				"VISIBILITY",
+				"FOR",
+				"EDITABLE",
+			)
+
+			for _, result := range *results {
+				fmt.Fprintf(cmd.OutOrStdout(), "%-6d %-20s %-16s %-6v %-10s %-7s %-9v\n",
+					result.ID,
+					truncate(result.Name, 20),
+					result.Syntax,
+					result.MultiValued,
+					result.Visibility,
+					result.AppliesTo,
+					result.UserEditable,
+				)
+			}
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// NewAttributeCmd - TODO comment
+func NewAttributeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Define a custom attribute for users and groups",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			multiValued := viper.GetBool("multi-valued")
+			userEditable := viper.GetBool("user-editable")
+			body := models.JSONAttributeBody{
+				Name:         viper.GetString("name"),
+				OID:          viper.GetString("oid"),
+				Syntax:       viper.GetString("syntax"),
+				MultiValued:  &multiValued,
+				Visibility:   viper.GetString("visibility"),
+				AppliesTo:    viper.GetString("applies-to"),
+				UserEditable: &userEditable,
+			}
+			if pattern := viper.GetString("pattern"); pattern != "" {
+				body.Pattern = &pattern
+			}
+			if description := viper.GetString("description"); description != "" {
+				body.Description = &description
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/attributes", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(body).
+				SetResult(models.AttributeInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Attribute created", jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().StringP("name", "n", "", "LDAP attribute name e.g: telephoneNumber")
+	cmd.Flags().String("oid", "", "LDAP object identifier of the attribute e.g: 2.5.4.20")
+	cmd.Flags().String("syntax", "directoryString", fmt.Sprintf("syntax of the values, one of %s", strings.Join(models.AttributeSyntaxes(), ", ")))
+	cmd.Flags().Bool("multi-valued", false, "users and groups can have several values")
+	cmd.Flags().String("pattern", "", "regular expression values must match e.g: ^[0-9]{6}$")
+	cmd.Flags().String("visibility", "public", "public or private, private values are only shown to managers and readonly accounts")
+	cmd.Flags().String("applies-to", "users", "entries that can have the attribute: users, groups or all")
+	cmd.Flags().Bool("user-editable", false, "users can set their own values")
+	cmd.Flags().StringP("description", "d", "", "attribute description")
+	cmd.MarkFlagRequired("name")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// UpdateAttributeCmd - TODO comment
+func UpdateAttributeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update a custom attribute",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var trueValue = true
+			var falseValue = false
+
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("attribute id required")
+			}
+
+			if viper.GetBool("multi-valued") && viper.GetBool("single-valued") {
+				return fmt.Errorf("multi-valued and single-valued flags are mutually exclusive")
+			}
+
+			if viper.GetBool("user-editable") && viper.GetBool("not-user-editable") {
+				return fmt.Errorf("user-editable and not-user-editable flags are mutually exclusive")
+			}
+
+			body := models.JSONAttributeBody{
+				Name:       viper.GetString("name"),
+				OID:        viper.GetString("oid"),
+				Syntax:     viper.GetString("syntax"),
+				Visibility: viper.GetString("visibility"),
+				AppliesTo:  viper.GetString("applies-to"),
+			}
+			if viper.GetBool("multi-valued") {
+				body.MultiValued = &trueValue
+			}
+			if viper.GetBool("single-valued") {
+				body.MultiValued = &falseValue
+			}
+			if viper.GetBool("user-editable") {
+				body.UserEditable = &trueValue
+			}
+			if viper.GetBool("not-user-editable") {
+				body.UserEditable = &falseValue
+			}
+			if cmd.Flags().Changed("pattern") {
+				pattern := viper.GetString("pattern")
+				body.Pattern = &pattern
+			}
+			if cmd.Flags().Changed("description") {
+				description := viper.GetString("description")
+				body.Description = &description
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/attributes/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(body).
+				SetResult(models.AttributeInfo{}).
+				SetError(&types.APIError{}).
+				Put(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Attribute updated", jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().Uint("id", 0, "attribute id")
+	cmd.Flags().StringP("name", "n", "", "LDAP attribute name")
+	cmd.Flags().String("oid", "", "LDAP object identifier of the attribute")
+	cmd.Flags().String("syntax", "", fmt.Sprintf("syntax of the values, one of %s", strings.Join(models.AttributeSyntaxes(), ", ")))
+	cmd.Flags().Bool("multi-valued", false, "users and groups can have several values")
+	cmd.Flags().Bool("single-valued", false, "users and groups can only have one value")
+	cmd.Flags().String("pattern", "", "regular expression values must match, an empty pattern removes it")
+	cmd.Flags().String("visibility", "", "public or private, private values are only shown to managers and readonly accounts")
+	cmd.Flags().String("applies-to", "", "entries that can have the attribute: users, groups or all")
+	cmd.Flags().Bool("user-editable", false, "users can set their own values")
+	cmd.Flags().Bool("not-user-editable", false, "only managers can set values")
+	cmd.Flags().StringP("description", "d", "", "attribute description")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// DeleteAttributeCmd - TODO comment
+func DeleteAttributeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Remove a custom attribute and its values",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("attribute id required")
+			}
+
+			if !viper.GetBool("force") {
+				confirm := prompter.YesNo("Do you really want to delete this attribute and the values users and groups have?", false)
+				if !confirm {
+					return fmt.Errorf("ok, attribute wasn't deleted")
+				}
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/attributes/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Attribute deleted", jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().Uint("id", 0, "attribute id")
+	cmd.Flags().BoolP("force", "f", false, "force delete and don't ask for confirmation")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// attributeCmd represents the attribute command
+var attributeCmd = &cobra.Command{
+	Use:   "attribute",
+	Short: "Manage the custom attributes of users and groups",
+}
+
+func init() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	rootCmd.AddCommand(attributeCmd)
+	attributeCmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	attributeCmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	attributeCmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	attributeCmd.AddCommand(ListAttributesCmd())
+	attributeCmd.AddCommand(NewAttributeCmd())
+	attributeCmd.AddCommand(UpdateAttributeCmd())
+	attributeCmd.AddCommand(DeleteAttributeCmd())
+}
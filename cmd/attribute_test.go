@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAttributeCmd(t *testing.T) {
+	dbPath := uuid.New()
+	e := testSetup(t, dbPath.String(), false)
+	defer testCleanUp(dbPath.String())
+
+	// Launch testing server
+	go func() {
+		e.Start(":51025")
+	}()
+
+	waitForTestServer(t, ":51025")
+
+	testCases := []CmdTestCase{
+		{
+			name:           "login successful",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--username", "admin", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "new group",
+			cmd:            NewGroupCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--group", "devel", "--members", "saul"},
+			errorMessage:   "",
+			successMessage: "Group created\n",
+		},
+		{
+			name:           "new attribute",
+			cmd:            NewAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--name", "roomNumber", "--syntax", "integer", "--user-editable"},
+			errorMessage:   "",
+			successMessage: "Attribute created\n",
+		},
+		{
+			name:           "attribute already exists",
+			cmd:            NewAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--name", "roomnumber"},
+			errorMessage:   "attribute already exists",
+			successMessage: "",
+		},
+		{
+			name:           "built-in attributes can't be defined",
+			cmd:            NewAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--name", "mail"},
+			errorMessage:   "invalid attribute: mail is a built-in attribute",
+			successMessage: "",
+		},
+		{
+			name:           "list attributes",
+			cmd:            ListAttributesCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--json"},
+			errorMessage:   "",
+			successMessage: "[{\"id\":1,\"name\":\"roomNumber\",\"syntax\":\"integer\",\"syntax_oid\":\"1.3.6.1.4.1.1466.115.121.1.27\",\"multi_valued\":false,\"visibility\":\"public\",\"applies_to\":\"users\",\"user_editable\":true}]\n",
+		},
+		{
+			name:           "set attribute value",
+			cmd:            UpdateUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--attribute", "roomNumber=12"},
+			errorMessage:   "",
+			successMessage: "User updated\n",
+		},
+		{
+			name:           "value must match the syntax",
+			cmd:            UpdateUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--attribute", "roomNumber=twelve"},
+			errorMessage:   "invalid attribute: twelve is not a valid integer value for roomNumber",
+			successMessage: "",
+		},
+		{
+			name:           "single-valued attributes",
+			cmd:            UpdateUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--attribute", "roomNumber=12", "--attribute", "roomNumber=13"},
+			errorMessage:   "invalid attribute: roomNumber is single-valued",
+			successMessage: "",
+		},
+		{
+			name:           "attribute must be name=value",
+			cmd:            UpdateUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--attribute", "roomNumber"},
+			errorMessage:   "invalid attribute: roomNumber must be name=value",
+			successMessage: "",
+		},
+		{
+			name:           "read user attributes",
+			cmd:            ListUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--json"},
+			errorMessage:   "",
+			successMessage: "{\"uid\":3,\"username\":\"saul\",\"name\":\"\",\"firstname\":\"\",\"lastname\":\"\",\"email\":\"\",\"ssh_public_key\":\"\",\"jpeg_photo\":\"\",\"manager\":false,\"readonly\":false,\"memberOf\":[{\"gid\":1,\"name\":\"devel\",\"description\":\"\",\"guac_config_protocol\":\"\",\"guac_config_parameters\":\"\",\"gid_number\":30000}],\"locked\":false,\"uid_number\":10002,\"gid_number\":10002,\"home_directory\":\"/home/saul\",\"login_shell\":\"/bin/bash\",\"attributes\":{\"roomNumber\":[\"12\"]}}\n",
+		},
+		{
+			name:           "attribute doesn't apply to groups",
+			cmd:            UpdateGroupCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--gid", "1", "--attribute", "roomNumber=12"},
+			errorMessage:   "invalid attribute: roomNumber can't be used with groups",
+			successMessage: "",
+		},
+		{
+			name:           "update attribute",
+			cmd:            UpdateAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--id", "1", "--applies-to", "all", "--not-user-editable"},
+			errorMessage:   "",
+			successMessage: "Attribute updated\n",
+		},
+		{
+			name:           "attribute id required",
+			cmd:            UpdateAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--name", "room"},
+			errorMessage:   "attribute id required",
+			successMessage: "",
+		},
+		{
+			name:           "set group attribute value",
+			cmd:            UpdateGroupCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--gid", "1", "--attribute", "roomNumber=12"},
+			errorMessage:   "",
+			successMessage: "Group updated\n",
+		},
+		{
+			name:           "login successful as saul",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--username", "saul", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "saul can't update a not user-editable attribute",
+			cmd:            UpdateUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--attribute", "roomNumber=13"},
+			errorMessage:   "only managers can update the roomNumber attribute",
+			successMessage: "",
+		},
+		{
+			name:           "saul can't define attributes",
+			cmd:            NewAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--name", "title"},
+			errorMessage:   "user has no proper permissions",
+			successMessage: "",
+		},
+		{
+			name:           "login successful as admin",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--username", "admin", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "delete attribute",
+			cmd:            DeleteAttributeCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--id", "1", "--force"},
+			errorMessage:   "",
+			successMessage: "Attribute deleted\n",
+		},
+		{
+			name:           "values are deleted with the attribute",
+			cmd:            ListUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51025", "--uid", "3", "--json"},
+			errorMessage:   "",
+			successMessage: "{\"uid\":3,\"username\":\"saul\",\"name\":\"\",\"firstname\":\"\",\"lastname\":\"\",\"email\":\"\",\"ssh_public_key\":\"\",\"jpeg_photo\":\"\",\"manager\":false,\"readonly\":false,\"memberOf\":[{\"gid\":1,\"name\":\"devel\",\"description\":\"\",\"guac_config_protocol\":\"\",\"guac_config_parameters\":\"\",\"gid_number\":30000}],\"locked\":false,\"uid_number\":10002,\"gid_number\":10002,\"home_directory\":\"/home/saul\",\"login_shell\":\"/bin/bash\"}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/doncicuto/glim/models"
 	"github.com/gocarina/gocsv"
@@ -27,7 +28,7 @@ import (
 	"github.com/spf13/viper"
 )
 
-func checkCSVHeader(header string) error {
+func checkCSVHeader(headers ...string) error {
 	file := viper.GetString("file")
 	csvFile, err := os.Open(file)
 	if err != nil {
@@ -42,13 +43,15 @@ func checkCSVHeader(header string) error {
 		return err
 	}
 
-	if header != string(line) {
-		return fmt.Errorf("wrong header")
+	for _, header := range headers {
+		if header == string(line) {
+			return nil
+		}
 	}
-	return nil
+	return fmt.Errorf("wrong header")
 }
 
-func readUsersFromCSV(jsonOutput bool, header string) ([]*models.User, error) {
+func readUsersFromCSV(jsonOutput bool, headers ...string) ([]*models.User, error) {
 	// Read and open file
 	file := viper.GetString("file")
 	csvFile, err := os.Open(file)
@@ -58,7 +61,7 @@ func readUsersFromCSV(jsonOutput bool, header string) ([]*models.User, error) {
 	defer csvFile.Close()
 
 	// Try to read first row and check if row is valid
-	err = checkCSVHeader(header)
+	err = checkCSVHeader(headers...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +74,7 @@ func readUsersFromCSV(jsonOutput bool, header string) ([]*models.User, error) {
 	return users, nil
 }
 
-func readGroupsFromCSV(jsonOutput bool, header string) ([]*models.Group, error) {
+func readGroupsFromCSV(jsonOutput bool, headers ...string) ([]*models.Group, error) {
 	// Read and open file
 	file := viper.GetString("file")
 	csvFile, err := os.Open(file)
@@ -81,7 +84,7 @@ func readGroupsFromCSV(jsonOutput bool, header string) ([]*models.Group, error)
 	defer csvFile.Close()
 
 	// Try to read first row and check if row is valid
-	err = checkCSVHeader(header)
+	err = checkCSVHeader(headers...)
 	if err != nil {
 		return nil, err
 	}
@@ -94,6 +97,15 @@ func readGroupsFromCSV(jsonOutput bool, header string) ([]*models.Group, error)
 	return groups, nil
 }
 
+// csvAttributeValues parses the attributes column, name=value pairs separated
+// by semicolons e.g: telephoneNumber=555-1234;roomNumber=12
+func csvAttributeValues(column *string) (map[string][]string, error) {
+	if column == nil || *column == "" {
+		return nil, nil
+	}
+	return models.ParseAttributeAssignments(strings.Split(*column, ";"))
+}
+
 // importCmd represents the import command
 var csvCmd = &cobra.Command{
 	Use:   "csv",
@@ -40,7 +40,12 @@ func CsvCreateGroupsCmd() *cobra.Command {
 			messages := []string{}
 
 			// Read and open file
-			groups, err := readGroupsFromCSV(jsonOutput, "name,description,members,guac_config_protocol,guac_config_parameters")
+			groups, err := readGroupsFromCSV(jsonOutput,
+				"name,description,members,guac_config_protocol,guac_config_parameters",
+				"name,description,members,guac_config_protocol,guac_config_parameters,gid_number",
+				"name,description,members,guac_config_protocol,guac_config_parameters,member_groups",
+				"name,description,members,guac_config_protocol,guac_config_parameters,gid_number,member_groups",
+				"name,description,members,guac_config_protocol,guac_config_parameters,gid_number,member_groups,attributes")
 			if err != nil {
 				return err
 			}
@@ -63,8 +68,16 @@ func CsvCreateGroupsCmd() *cobra.Command {
 			// Rest API authentication
 			client := RestClient(token.AccessToken)
 
+			// Groups are nested once every group in the file has been created
+			created := map[string]uint32{}
 			for _, group := range groups {
 				name := *group.Name
+				attributes, err := csvAttributeValues(group.GroupAttributes)
+				if err != nil {
+					messages = append(messages, fmt.Sprintf("%s: skipped, %v", name, err))
+					continue
+				}
+
 				resp, err := client.R().
 					SetHeader("Content-Type", "application/json").
 					SetBody(models.JSONGroupBody{
@@ -73,7 +86,10 @@ func CsvCreateGroupsCmd() *cobra.Command {
 						Members:                   *group.GroupMembers,
 						GuacamoleConfigProtocol:   *group.GuacamoleConfigProtocol,
 						GuacamoleConfigParameters: *group.GuacamoleConfigParameters,
+						GIDNumber:                 group.GIDNumber,
+						Attributes:                attributes,
 					}).
+					SetResult(models.GroupInfo{}).
 					SetError(&types.APIError{}).
 					Post(endpoint)
 
@@ -86,6 +102,33 @@ func CsvCreateGroupsCmd() *cobra.Command {
 					continue
 				}
 				messages = append(messages, fmt.Sprintf("%s: successfully created", name))
+				created[name] = resp.Result().(*models.GroupInfo).ID
+			}
+
+			for _, group := range groups {
+				name := *group.Name
+				gid, ok := created[name]
+				if !ok || group.GroupMemberGroups == nil || *group.GroupMemberGroups == "" {
+					continue
+				}
+
+				resp, err := client.R().
+					SetHeader("Content-Type", "application/json").
+					SetBody(models.GroupMembers{
+						MemberGroups: *group.GroupMemberGroups,
+					}).
+					SetError(&types.APIError{}).
+					Post(fmt.Sprintf("%s/%d/members", endpoint, gid))
+
+				if err != nil {
+					return fmt.Errorf("can't connect with Glim: %v", err)
+				}
+
+				if resp.IsError() {
+					messages = append(messages, fmt.Sprintf("%s: member groups skipped, %v", name, resp.Error().(*types.APIError).Message))
+					continue
+				}
+				messages = append(messages, fmt.Sprintf("%s: member groups successfully added", name))
 			}
 
 			printCSVMessages(cmd, messages, jsonOutput)
@@ -138,7 +138,7 @@ func TestCsvCreateGuacamoleGroups(t *testing.T) {
 			cmd:            ListGroupCmd(),
 			args:           []string{"--server", "http://127.0.0.1:50033", "--gid", "1", "--json"},
 			errorMessage:   "",
-			successMessage: `{"gid":1,"name":"programmers","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost"}` + "\n",
+			successMessage: `{"gid":1,"name":"programmers","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost","gid_number":30000}` + "\n",
 		},
 		{
 			name:           "repeat file, groups should be skipped",
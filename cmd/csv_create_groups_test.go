@@ -77,6 +77,27 @@ func prepareGroupTestFiles() error {
 	}
 	f.Sync()
 
+	// File with nested groups
+	f, err = os.Create("/tmp/file5.csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("name,description,members,guac_config_protocol,guac_config_parameters,member_groups\n")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(`"staff","Staff","saul",,,"ops,devel"` + "\n")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(`"ops","Operations","mike",,,"staff"` + "\n")
+	if err != nil {
+		return err
+	}
+	f.Sync()
+
 	return nil
 }
 
@@ -85,6 +106,7 @@ func deleteGroupTestingFiles() {
 	os.Remove("/tmp/file2.csv")
 	os.Remove("/tmp/file3.csv")
 	os.Remove("/tmp/file4.csv")
+	os.Remove("/tmp/file5.csv")
 }
 
 func TestCsvCreateGroups(t *testing.T) {
@@ -133,7 +155,7 @@ func TestCsvCreateGroups(t *testing.T) {
 			cmd:            ListGroupCmd(),
 			args:           []string{"--server", "http://127.0.0.1:50043", "--gid", "1", "--json"},
 			errorMessage:   "",
-			successMessage: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}],"guac_config_protocol":"","guac_config_parameters":""}` + "\n",
+			successMessage: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}` + "\n",
 		},
 		{
 			name:           "repeat file, groups should be skipped",
@@ -163,6 +185,20 @@ func TestCsvCreateGroups(t *testing.T) {
 			errorMessage:   "",
 			successMessage: ": skipped, required group name\nCreate from CSV finished!\n",
 		},
+		{
+			name:           "create nested groups, cycles should be skipped",
+			cmd:            CsvCreateGroupsCmd(),
+			args:           []string{"--server", "http://127.0.0.1:50043", "--file", "/tmp/file5.csv"},
+			errorMessage:   "",
+			successMessage: "staff: successfully created\nops: successfully created\nstaff: member groups successfully added\nops: member groups skipped, group membership would create a cycle\nCreate from CSV finished!\n",
+		},
+		{
+			name:           "group staff transitive detail",
+			cmd:            ListGroupCmd(),
+			args:           []string{"--server", "http://127.0.0.1:50043", "--group", "staff", "--transitive", "--json"},
+			errorMessage:   "",
+			successMessage: `{"gid":3,"name":"staff","description":"Staff","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}],"member_groups":[{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000},{"gid":4,"name":"ops","description":"Operations","guac_config_protocol":"","guac_config_parameters":"","gid_number":30003}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30002}` + "\n",
+		},
 	}
 
 	for _, tc := range testCases {
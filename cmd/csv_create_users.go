@@ -43,7 +43,10 @@ func CsvCreateUsersCmd() *cobra.Command {
 			messages := []string{}
 
 			// Read and open file
-			users, err := readUsersFromCSV(jsonOutput, "username,firstname,lastname,email,password,ssh_public_key,jpeg_photo,manager,readonly,locked,groups")
+			users, err := readUsersFromCSV(jsonOutput,
+				"username,firstname,lastname,email,password,ssh_public_key,jpeg_photo,manager,readonly,locked,groups",
+				"username,firstname,lastname,email,password,ssh_public_key,jpeg_photo,manager,readonly,locked,groups,uid_number,gid_number,home_directory,login_shell",
+				"username,firstname,lastname,email,password,ssh_public_key,jpeg_photo,manager,readonly,locked,groups,uid_number,gid_number,home_directory,login_shell,attributes")
 			if err != nil {
 				return err
 			}
@@ -98,22 +101,41 @@ func CsvCreateUsersCmd() *cobra.Command {
 					jpegPhoto = *photo
 				}
 
+				attributes, err := csvAttributeValues(user.UserAttributes)
+				if err != nil {
+					messages = append(messages, fmt.Sprintf("%s: skipped, %v\n", username, err))
+					continue
+				}
+
+				userBody := models.JSONUserBody{
+					Username:     username,
+					Password:     password,
+					Name:         strings.Join([]string{*user.GivenName, *user.Surname}, " "),
+					GivenName:    *user.GivenName,
+					Surname:      *user.Surname,
+					Email:        *user.Email,
+					SSHPublicKey: *user.SSHPublicKey,
+					MemberOf:     *user.Groups,
+					JPEGPhoto:    jpegPhoto,
+					Manager:      &manager,
+					Readonly:     &readonly,
+					Locked:       &locked,
+					UIDNumber:    user.UIDNumber,
+					GIDNumber:    user.GIDNumber,
+					Attributes:   attributes,
+				}
+
+				if user.HomeDirectory != nil {
+					userBody.HomeDirectory = *user.HomeDirectory
+				}
+
+				if user.LoginShell != nil {
+					userBody.LoginShell = *user.LoginShell
+				}
+
 				resp, err := client.R().
 					SetHeader("Content-Type", "application/json").
-					SetBody(models.JSONUserBody{
-						Username:     username,
-						Password:     password,
-						Name:         strings.Join([]string{*user.GivenName, *user.Surname}, " "),
-						GivenName:    *user.GivenName,
-						Surname:      *user.Surname,
-						Email:        *user.Email,
-						SSHPublicKey: *user.SSHPublicKey,
-						MemberOf:     *user.Groups,
-						JPEGPhoto:    jpegPhoto,
-						Manager:      &manager,
-						Readonly:     &readonly,
-						Locked:       &locked,
-					}).
+					SetBody(userBody).
 					SetError(&types.APIError{}).
 					Post(endpoint)
 
@@ -85,6 +85,27 @@ func prepareTestFiles() error {
 	}
 	f.Sync()
 
+	// File with POSIX attributes
+	f, err = os.Create("/tmp/file5.csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("username,firstname,lastname,email,password,ssh_public_key,jpeg_photo,manager,readonly,locked,groups,uid_number,gid_number,home_directory,login_shell\n")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(`"darwin","Darwin","Watterson","darwin@example.org","test",,,false,false,false,,20000,30000,"/srv/darwin","/bin/zsh"` + "\n")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(`"richard","Richard","Watterson","richard@example.org","test",,,false,false,false,,,,,` + "\n")
+	if err != nil {
+		return err
+	}
+	f.Sync()
+
 	return nil
 }
 
@@ -93,6 +114,7 @@ func deleteTestingFiles() {
 	os.Remove("/tmp/file2.csv")
 	os.Remove("/tmp/file3.csv")
 	os.Remove("/tmp/file4.csv")
+	os.Remove("/tmp/file5.csv")
 }
 
 func TestCsvCreateUsers(t *testing.T) {
@@ -148,7 +170,7 @@ func TestCsvCreateUsers(t *testing.T) {
 			cmd:            ListGroupCmd(),
 			args:           []string{"--server", "http://127.0.0.1:50032", "--gid", "1", "--json"},
 			errorMessage:   "",
-			successMessage: `{"gid":1,"name":"test","description":"test","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":6,"username":"gumball","name":"Gumball Watterson","firstname":"Gumball","lastname":"Watterson","email":"gumbal@example.org","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":7,"username":"anais","name":"Anais Watterson","firstname":"Anais","lastname":"Watterson","email":"anais@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":true}],"guac_config_protocol":"","guac_config_parameters":""}` + "\n",
+			successMessage: `{"gid":1,"name":"test","description":"test","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":6,"username":"gumball","name":"Gumball Watterson","firstname":"Gumball","lastname":"Watterson","email":"gumbal@example.org","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10005,"gid_number":10005,"home_directory":"/home/gumball","login_shell":"/bin/bash"},{"uid":7,"username":"anais","name":"Anais Watterson","firstname":"Anais","lastname":"Watterson","email":"anais@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":true,"uid_number":10006,"gid_number":10006,"home_directory":"/home/anais","login_shell":"/bin/bash"}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}` + "\n",
 		},
 		{
 			name:           "repeat file, users should be skipped",
@@ -178,6 +200,27 @@ func TestCsvCreateUsers(t *testing.T) {
 			errorMessage:   "",
 			successMessage: "test1: skipped, cannot be both manager and readonly at the same time\n\ntest1: skipped, email should have a valid format\n\ntest1: skipped, could not convert JPEG photo to Base64 open /tmp/nonexistent: no such file or directory\n\nCreate from CSV finished!\n",
 		},
+		{
+			name:           "create users with POSIX attributes",
+			cmd:            CsvCreateUsersCmd(),
+			args:           []string{"--server", "http://127.0.0.1:50032", "--file", "/tmp/file5.csv"},
+			errorMessage:   "",
+			successMessage: "darwin: successfully created\nrichard: successfully created\nCreate from CSV finished!\n",
+		},
+		{
+			name:           "darwin has the POSIX attributes from the file",
+			cmd:            ListUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:50032", "--username", "darwin", "--json"},
+			errorMessage:   "",
+			successMessage: `{"uid":8,"username":"darwin","name":"Darwin Watterson","firstname":"Darwin","lastname":"Watterson","email":"darwin@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":20000,"gid_number":30000,"home_directory":"/srv/darwin","login_shell":"/bin/zsh"}` + "\n",
+		},
+		{
+			name:           "richard gets POSIX attributes assigned",
+			cmd:            ListUserCmd(),
+			args:           []string{"--server", "http://127.0.0.1:50032", "--username", "richard", "--json"},
+			errorMessage:   "",
+			successMessage: `{"uid":9,"username":"richard","name":"Richard Watterson","firstname":"Richard","lastname":"Watterson","email":"richard@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":20001,"gid_number":20001,"home_directory":"/home/richard","login_shell":"/bin/bash"}` + "\n",
+		},
 	}
 
 	for _, tc := range testCases {
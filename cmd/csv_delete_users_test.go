@@ -141,7 +141,7 @@ func TestCsvDeleteUsers(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:50035", "--json"},
 			errorMessage:   "",
-			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}]` + "\n",
+			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10000,"gid_number":10000,"home_directory":"/home/admin","login_shell":"/bin/bash"},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false,"uid_number":10001,"gid_number":10001,"home_directory":"/home/search","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}]` + "\n",
 		},
 		{
 			name:           "repeat file, users should be skipped",
@@ -52,15 +52,32 @@ func NewGroupCmd() *cobra.Command {
 			// Rest API authentication
 			client := RestClient(token.AccessToken)
 
+			groupBody := models.JSONGroupBody{
+				Name:                      viper.GetString("group"),
+				Description:               viper.GetString("description"),
+				Members:                   viper.GetString("members"),
+				MemberGroups:              viper.GetString("member-groups"),
+				GuacamoleConfigProtocol:   viper.GetString("guacamole-protocol"),
+				GuacamoleConfigParameters: viper.GetString("guacamole-parameters"),
+			}
+
+			if n := viper.GetUint32("gid-number"); n != 0 {
+				groupBody.GIDNumber = &n
+			}
+
+			groupBody.Attributes, err = attributeValues()
+			if err != nil {
+				return err
+			}
+
+			if viper.GetBool("require-mfa") {
+				requireMFA := true
+				groupBody.RequireMFA = &requireMFA
+			}
+
 			resp, err := client.R().
 				SetHeader("Content-Type", "application/json").
-				SetBody(models.JSONGroupBody{
-					Name:                      viper.GetString("group"),
-					Description:               viper.GetString("description"),
-					Members:                   viper.GetString("members"),
-					GuacamoleConfigProtocol:   viper.GetString("guacamole-protocol"),
-					GuacamoleConfigParameters: viper.GetString("guacamole-parameters"),
-				}).
+				SetBody(groupBody).
 				SetError(&types.APIError{}).
 				Post(endpoint)
 
@@ -86,6 +103,10 @@ func NewGroupCmd() *cobra.Command {
 	cmd.Flags().StringP("group", "g", "", "our group name")
 	cmd.Flags().StringP("description", "d", "", "our group description")
 	cmd.Flags().StringP("members", "m", "", "comma-separated list of usernames e.g: admin,tux")
+	cmd.Flags().String("member-groups", "", "comma-separated list of group names to be nested in the group e.g: devel,ops")
+	cmd.Flags().Uint32("gid-number", 0, "POSIX gidNumber, the next free number is assigned if not set")
+	cmd.Flags().Bool("require-mfa", false, "members must use two-factor authentication to log in")
+	cmd.Flags().StringArray("attribute", []string{}, "custom attribute value as name=value (can be repeated)")
 
 	cmd.MarkFlagRequired("group")
 	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
@@ -52,7 +52,7 @@ func TestDeleteCmd(t *testing.T) {
 			cmd:            ListGroupCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51013", "--json"},
 			errorMessage:   "",
-			successMessage: `[{"gid":1,"name":"test","description":"test","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}],"guac_config_protocol":"","guac_config_parameters":""}]` + "\n",
+			successMessage: `[{"gid":1,"name":"test","description":"test","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}]` + "\n",
 		},
 		{
 			name:           "try to delete non-existent group",
@@ -53,6 +53,9 @@ func getGroup(cmd *cobra.Command, id uint, jsonOutput bool) error {
 	// Glim server URL
 	url := viper.GetString("server")
 	endpoint := fmt.Sprintf("%s/v1/groups/%d", url, id)
+	if viper.GetBool("transitive") {
+		endpoint += "?transitive=true"
+	}
 
 	// Get credentials
 	token, err := GetCredentials(url)
@@ -84,6 +87,7 @@ func getGroup(cmd *cobra.Command, id uint, jsonOutput bool) error {
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100s\n", "Group:", result.Name)
 		fmt.Fprintf(cmd.OutOrStdout(), "====\n")
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100d\n", " GID:", result.ID)
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100d\n", " GID Number:", result.GIDNumber)
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100s\n\n", " Description:", result.Description)
 
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s\n", "Members:")
@@ -94,6 +98,16 @@ func getGroup(cmd *cobra.Command, id uint, jsonOutput bool) error {
 			fmt.Fprintf(cmd.OutOrStdout(), "----\n")
 		}
 
+		if len(result.MemberGroups) > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%-15s\n", "Member groups:")
+			fmt.Fprintf(cmd.OutOrStdout(), "====\n")
+			for _, memberGroup := range result.MemberGroups {
+				fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100d\n", " GID:", memberGroup.ID)
+				fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100s\n", " Group:", memberGroup.Name)
+				fmt.Fprintf(cmd.OutOrStdout(), "----\n")
+			}
+		}
+
 		// Support for Apache Guacamole LDAP config schema
 		if result.GuacamoleConfigProtocol != "" && result.GuacamoleConfigParameters != "" {
 			fmt.Fprintf(cmd.OutOrStdout(), "\n%-15s\n", "Apache Guacamole Configuration:")
@@ -108,6 +122,8 @@ func getGroup(cmd *cobra.Command, id uint, jsonOutput bool) error {
 			}
 			fmt.Fprintf(cmd.OutOrStdout(), "----\n")
 		}
+
+		printAttributeValues(cmd, result.Attributes)
 	}
 	return nil
 }
@@ -116,6 +132,9 @@ func getGroups(cmd *cobra.Command, jsonOutput bool) error {
 	// Glim server URL
 	url := viper.GetString("server")
 	endpoint := fmt.Sprintf("%s/v1/groups", url)
+	if viper.GetBool("transitive") {
+		endpoint += "?transitive=true"
+	}
 
 	// Get credentials
 	token, err := GetCredentials(url)
@@ -255,6 +274,7 @@ func ListGroupCmd() *cobra.Command {
 
 	cmd.Flags().UintP("gid", "i", 0, "group id")
 	cmd.Flags().StringP("group", "g", "", "group name")
+	cmd.Flags().Bool("transitive", false, "include the members of nested groups")
 	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
 	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
 	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
@@ -66,16 +66,39 @@ func UpdateGroupCmd() *cobra.Command {
 
 			endpoint := fmt.Sprintf("%s/v1/groups/%d", url, gid)
 
+			groupBody := models.JSONGroupBody{
+				Name:                      viper.GetString("group"),
+				Description:               viper.GetString("description"),
+				Members:                   viper.GetString("members"),
+				MemberGroups:              viper.GetString("member-groups"),
+				ReplaceMembers:            viper.GetBool("replace"),
+				GuacamoleConfigProtocol:   viper.GetString("guacamole-protocol"),
+				GuacamoleConfigParameters: viper.GetString("guacamole-parameters"),
+			}
+
+			if n := viper.GetUint32("gid-number"); n != 0 {
+				groupBody.GIDNumber = &n
+			}
+
+			groupBody.Attributes, err = attributeValues()
+			if err != nil {
+				return err
+			}
+
+			trueValue := true
+			falseValue := false
+
+			if viper.GetBool("require-mfa") {
+				groupBody.RequireMFA = &trueValue
+			}
+
+			if viper.GetBool("optional-mfa") {
+				groupBody.RequireMFA = &falseValue
+			}
+
 			resp, err := client.R().
 				SetHeader("Content-Type", "application/json").
-				SetBody(models.JSONGroupBody{
-					Name:                      viper.GetString("group"),
-					Description:               viper.GetString("description"),
-					Members:                   viper.GetString("members"),
-					ReplaceMembers:            viper.GetBool("replace"),
-					GuacamoleConfigProtocol:   viper.GetString("guacamole-protocol"),
-					GuacamoleConfigParameters: viper.GetString("guacamole-parameters"),
-				}).
+				SetBody(groupBody).
 				SetError(&types.APIError{}).
 				Put(endpoint)
 
@@ -102,7 +125,12 @@ func UpdateGroupCmd() *cobra.Command {
 	cmd.Flags().StringP("group", "g", "", "our group name")
 	cmd.Flags().StringP("description", "d", "", "our group description")
 	cmd.Flags().StringP("members", "m", "", "comma-separated list of usernames e.g: admin,tux")
-	cmd.Flags().Bool("replace", false, "Replace group members with those specified with -m. Usernames are appended to members by default")
+	cmd.Flags().String("member-groups", "", "comma-separated list of group names to be nested in the group e.g: devel,ops")
+	cmd.Flags().Bool("replace", false, "Replace group members with those specified with -m and --member-groups. Usernames and groups are appended to members by default")
+	cmd.Flags().Uint32("gid-number", 0, "POSIX gidNumber")
+	cmd.Flags().Bool("require-mfa", false, "members must use two-factor authentication to log in")
+	cmd.Flags().Bool("optional-mfa", false, "members are not required to use two-factor authentication")
+	cmd.Flags().StringArray("attribute", []string{}, "custom attribute value as name=value, name= removes the attribute (can be repeated)")
 	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
 	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
 	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/antelman107/net-wait-go/wait"
+	"github.com/doncicuto/glim/models"
 	"github.com/doncicuto/glim/server/api/handlers"
 	"github.com/doncicuto/glim/server/db"
 	"github.com/doncicuto/glim/server/kv/badgerdb"
@@ -25,12 +26,27 @@ func newTestDatabase(dbPath string) (*gorm.DB, error) {
 	var dbInit = types.DBInit{
 		AdminPasswd:   "test",
 		SearchPasswd:  "test",
-		Users:         "saul,kim,mike",
+		Users:         "search,saul,kim,mike",
 		DefaultPasswd: "test",
 		UseSqlite:     true,
 	}
 	sqlLog := false
-	return db.Initialize(fmt.Sprintf("/tmp/%s.db", dbPath), sqlLog, dbInit)
+	newDb, err := db.Initialize(fmt.Sprintf("/tmp/%s.db", dbPath), sqlLog, dbInit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The search bind account is a service account, tests use a readonly
+	// user with the same name to cover the read-only role
+	err = newDb.Model(&models.User{}).Where("username = ?", "search").Updates(map[string]interface{}{
+		"given_name": "Read-Only",
+		"surname":    "Account",
+		"readonly":   true,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return newDb, nil
 }
 
 func newTestKV(dbPath string) (badgerdb.Store, error) {
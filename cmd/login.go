@@ -27,6 +27,7 @@ import (
 
 	"github.com/Songmu/prompter"
 	"github.com/doncicuto/glim/types"
+	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -101,19 +102,37 @@ func LoginCmd() *cobra.Command {
 			// Rest API authentication
 			client := RestClient("")
 
-			resp, err := client.R().
-				SetHeader("Content-Type", "application/json").
-				SetBody(types.Credentials{
-					Username: username,
-					Password: password,
-				}).
-				SetError(&types.APIError{}).
-				Post(fmt.Sprintf("%s/v1/login", url))
+			totpCode := viper.GetString("totp-code")
+			login := func() (*resty.Response, error) {
+				return client.R().
+					SetHeader("Content-Type", "application/json").
+					SetBody(types.Credentials{
+						Username: username,
+						Password: password,
+						TOTPCode: totpCode,
+					}).
+					SetError(&types.APIError{}).
+					Post(fmt.Sprintf("%s/v1/login", url))
+			}
 
+			resp, err := login()
 			if err != nil {
 				return fmt.Errorf("can't connect with Glim: %v", err)
 			}
 
+			// Two-factor authentication is enabled for this account, ask for a code and try again
+			if resp.IsError() && totpCode == "" && resp.Error().(*types.APIError).Message == types.TOTPCodeRequired {
+				totpCode = prompter.Prompt("Two-factor authentication code", "")
+				if totpCode == "" {
+					return errors.New("two-factor authentication code required")
+				}
+
+				resp, err = login()
+				if err != nil {
+					return fmt.Errorf("can't connect with Glim: %v", err)
+				}
+			}
+
 			if resp.IsError() {
 				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
 			}
@@ -150,6 +169,7 @@ func LoginCmd() *cobra.Command {
 	cmd.Flags().StringP("username", "u", "", "Username")
 	cmd.Flags().StringP("password", "p", "", "Password")
 	cmd.Flags().Bool("password-stdin", false, "Take the password from stdin")
+	cmd.Flags().String("totp-code", "", "Two-factor authentication code or recovery code")
 
 	return cmd
 }
@@ -0,0 +1,318 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Songmu/prompter"
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func printOIDCClient(cmd *cobra.Command, result *models.OIDCClientInfo, jsonOutput bool) {
+	if jsonOutput {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.Encode(result)
+		return
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Client ID: %s\n", result.ClientID)
+	if result.ClientSecret != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Client secret: %s\n", result.ClientSecret)
+		fmt.Fprintf(cmd.OutOrStdout(), "Copy it now, you won't be able to see it again\n")
+	}
+}
+
+// ListOIDCClientsCmd - TODO comment
+func ListOIDCClientsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List OIDC clients",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/oidc/clients", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]models.OIDCClientInfo{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]models.OIDCClientInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-6s %-20s %-36s %-7s %-40s\n",
+				"ID",
+				"NAME",
+				"CLIENT ID",
+				"PUBLIC",
+				"REDIRECT URIS",
+			)
+
+			for _, result := range *results {
+				fmt.Fprintf(cmd.OutOrStdout(), "%-6d %-20s %-36s %-7v %-40s\n",
+					result.ID,
+					truncate(result.Name, 20),
+					result.ClientID,
+					result.Public,
+					truncate(result.RedirectURIs, 40),
+				)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// NewOIDCClientCmd - TODO comment
+func NewOIDCClientCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Register a web application as an OIDC client",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			public := viper.GetBool("public")
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/oidc/clients", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONOIDCClientBody{
+					Name:         viper.GetString("name"),
+					RedirectURIs: viper.GetString("redirect-uris"),
+					Public:       &public,
+				}).
+				SetResult(models.OIDCClientInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printOIDCClient(cmd, resp.Result().(*models.OIDCClientInfo), jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("name", "n", "", "OIDC client name e.g: wiki")
+	cmd.Flags().String("redirect-uris", "", "comma-separated list of redirect URIs e.g: https://wiki.example.org/oauth2/callback")
+	cmd.Flags().Bool("public", false, "public client such as a single-page app, it gets no client secret and must use PKCE")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("redirect-uris")
+	return cmd
+}
+
+// UpdateOIDCClientCmd - TODO comment
+func UpdateOIDCClientCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update an OIDC client",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("oidc client id required")
+			}
+
+			if viper.GetBool("public") && viper.GetBool("confidential") {
+				return fmt.Errorf("public and confidential flags are mutually exclusive")
+			}
+
+			body := models.JSONOIDCClientBody{
+				Name:         viper.GetString("name"),
+				RedirectURIs: viper.GetString("redirect-uris"),
+				ResetSecret:  viper.GetBool("reset-secret"),
+			}
+			if viper.GetBool("public") {
+				public := true
+				body.Public = &public
+			}
+			if viper.GetBool("confidential") {
+				public := false
+				body.Public = &public
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/oidc/clients/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(body).
+				SetResult(models.OIDCClientInfo{}).
+				SetError(&types.APIError{}).
+				Put(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printOIDCClient(cmd, resp.Result().(*models.OIDCClientInfo), jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint("id", 0, "OIDC client id")
+	cmd.Flags().StringP("name", "n", "", "OIDC client name")
+	cmd.Flags().String("redirect-uris", "", "comma-separated list of redirect URIs that replaces the current list")
+	cmd.Flags().Bool("public", false, "turn into a public client without client secret")
+	cmd.Flags().Bool("confidential", false, "turn into a confidential client with a client secret")
+	cmd.Flags().Bool("reset-secret", false, "generate a new client secret")
+	return cmd
+}
+
+// DeleteOIDCClientCmd - TODO comment
+func DeleteOIDCClientCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Remove an OIDC client",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("oidc client id required")
+			}
+
+			if !viper.GetBool("force") {
+				confirm := prompter.YesNo("Do you really want to delete this OIDC client?", false)
+				if !confirm {
+					return fmt.Errorf("ok, OIDC client wasn't deleted")
+				}
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/oidc/clients/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "OIDC client deleted", jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint("id", 0, "OIDC client id")
+	cmd.Flags().BoolP("force", "f", false, "force delete and don't ask for confirmation")
+	return cmd
+}
+
+// oidcCmd represents the oidc command
+var oidcCmd = &cobra.Command{
+	Use:   "oidc",
+	Short: "Manage Glim as an OpenID Connect provider",
+}
+
+// oidcClientCmd represents the oidc client command
+var oidcClientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Manage the web applications that log users in with Glim",
+}
+
+func init() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	rootCmd.AddCommand(oidcCmd)
+	oidcCmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	oidcCmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	oidcCmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	oidcCmd.AddCommand(oidcClientCmd)
+	oidcClientCmd.AddCommand(ListOIDCClientsCmd())
+	oidcClientCmd.AddCommand(NewOIDCClientCmd())
+	oidcClientCmd.AddCommand(UpdateOIDCClientCmd())
+	oidcClientCmd.AddCommand(DeleteOIDCClientCmd())
+}
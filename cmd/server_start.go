@@ -19,6 +19,7 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -28,9 +29,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/doncicuto/glim/server/jwks"
 	"github.com/doncicuto/glim/server/kv/badgerdb"
 	"github.com/doncicuto/glim/server/kv/redis"
 	"github.com/doncicuto/glim/server/ldap"
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/doncicuto/glim/server/peercred"
+	"github.com/doncicuto/glim/server/ratelimit"
 	"github.com/doncicuto/glim/types"
 
 	"github.com/doncicuto/glim/server/api"
@@ -51,6 +58,12 @@ var serverStartCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		// TOTP secrets are encrypted at rest, fall back to the API secret if no key is set
+		totpSecretKey := viper.GetString("totp-secret-key")
+		if totpSecretKey == "" {
+			totpSecretKey = apiSecret
+		}
+
 		tlscert := viper.GetString("tlscert")
 		tlskey := viper.GetString("tlskey")
 
@@ -182,6 +195,34 @@ var serverStartCmd = &cobra.Command{
 			PostgresSSLClientKey:  postgresSSLClientKey,
 		}
 
+		// Password hashing
+		err := models.ConfigureHasher(types.PasswordHashSettings{
+			Algorithm:     viper.GetString("password-hash-algorithm"),
+			BcryptCost:    viper.GetInt("bcrypt-cost"),
+			Argon2Memory:  viper.GetUint32("argon2-memory"),
+			Argon2Time:    viper.GetUint32("argon2-time"),
+			Argon2Threads: uint8(viper.GetUint("argon2-threads")),
+			RehashOnLogin: viper.GetBool("rehash-on-login"),
+		})
+		if err != nil {
+			fmt.Printf("%s [Glim] ⇨ wrong password hashing settings. %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+			os.Exit(1)
+		}
+
+		// POSIX accounts
+		err = models.ConfigurePOSIX(types.POSIXSettings{
+			UIDMin:        viper.GetUint32("posix-uid-min"),
+			UIDMax:        viper.GetUint32("posix-uid-max"),
+			GIDMin:        viper.GetUint32("posix-gid-min"),
+			GIDMax:        viper.GetUint32("posix-gid-max"),
+			HomeDirectory: viper.GetString("posix-home-directory"),
+			LoginShell:    viper.GetString("posix-login-shell"),
+		})
+		if err != nil {
+			fmt.Printf("%s [Glim] ⇨ wrong POSIX settings. %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+			os.Exit(1)
+		}
+
 		database, err := db.Initialize(dbName, sqlLog, dbInit)
 		if err != nil {
 			fmt.Printf("%s [Glim] ⇨ could not connect to database. %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
@@ -236,6 +277,80 @@ var serverStartCmd = &cobra.Command{
 		if viper.GetBool("guacamole") {
 			fmt.Printf("%s [Glim] ⇨ enabled support for Apache Guacamole...\n", time.Now().Format(time.RFC3339))
 		}
+
+		// JWT signing keys, retired keys are kept until the tokens they signed expire
+		accessTokenExpiry := viper.GetUint("api-access-token-expiry-time")
+		refreshTokenExpiry := viper.GetUint("api-refresh-token-expiry-time")
+		tokenLifetime := time.Duration(refreshTokenExpiry) * time.Second
+		if accessTokenExpiry > refreshTokenExpiry {
+			tokenLifetime = time.Duration(accessTokenExpiry) * time.Second
+		}
+
+		signingKeys, err := jwks.NewKeySet(viper.GetString("jwt-algorithm"), viper.GetString("jwt-keys-dir"), apiSecret, tokenLifetime)
+		if err != nil {
+			fmt.Printf("%s [Glim] ⇨ wrong JWT signing settings. %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+			os.Exit(1)
+		}
+
+		// OpenID Connect provider, ID tokens must be verifiable by clients with
+		// our published keys so the API secret can't be used to sign them
+		oidcIssuer := viper.GetString("oidc-issuer")
+		if oidcIssuer == "" {
+			fmt.Printf("%s [Glim] ⇨ OpenID Connect provider is disabled...\n", time.Now().Format(time.RFC3339))
+		} else {
+			issuerURL, err := url.Parse(oidcIssuer)
+			if err != nil || (issuerURL.Scheme != "https" && issuerURL.Scheme != "http") || issuerURL.Host == "" {
+				fmt.Printf("%s [Glim] ⇨ wrong OpenID Connect issuer URL %s. Exiting now...\n", time.Now().Format(time.RFC3339), oidcIssuer)
+				os.Exit(1)
+			}
+			if signingKeys.Algorithm() == jwks.HS256 {
+				fmt.Printf("%s [Glim] ⇨ OpenID Connect provider requires an asymmetric JWT algorithm (RS256, ES256 or EdDSA). Exiting now...\n", time.Now().Format(time.RFC3339))
+				os.Exit(1)
+			}
+		}
+
+		keyRotation := viper.GetDuration("jwt-key-rotation")
+		if signingKeys.Algorithm() != jwks.HS256 && keyRotation > 0 {
+			go rotateSigningKeys(signingKeys, keyRotation)
+		}
+
+		// Failed logins and binds throttling, counters are kept in the key-value store
+		rateLimiter := ratelimit.New(blacklist, viper.GetInt("rate-limit-burst"), viper.GetDuration("rate-limit-window"))
+		if rateLimiter == nil {
+			fmt.Printf("%s [Glim] ⇨ rate limiting is disabled...\n", time.Now().Format(time.RFC3339))
+		}
+
+		// REST API network policies
+		apiNetworkPolicies := netpolicy.Policies{}
+		for _, rule := range viper.GetStringSlice("api-network-rule") {
+			if err := apiNetworkPolicies.Add(rule); err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+		}
+
+		// Proxies allowed to tell us the client address with X-Forwarded-For
+		trustedProxies, err := netpolicy.ParseNetworks(viper.GetStringSlice("api-trusted-proxies"))
+		if err != nil {
+			fmt.Printf("%s [Glim] ⇨ wrong trusted proxies. %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+			os.Exit(1)
+		}
+
+		// REST API client certificates
+		clientCertMode := viper.GetString("api-client-cert")
+		if !clientcert.ValidMode(clientCertMode) {
+			fmt.Printf("%s [Glim] ⇨ wrong REST API client certificates mode %s. Exiting now...\n", time.Now().Format(time.RFC3339), clientCertMode)
+			os.Exit(1)
+		}
+		var clientCertMapping *clientcert.Mapping
+		if clientCertMode != clientcert.ModeNone {
+			clientCertMapping, err = clientcert.ParseMapping(viper.GetString("api-client-cert-user"))
+			if err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+		}
+
 		// Preparing API server settings
 		apiSettings := types.APISettings{
 			DB:                 database,
@@ -244,10 +359,19 @@ var serverStartCmd = &cobra.Command{
 			TLSKey:             tlskey,
 			Address:            fmt.Sprintf("%s:%d", restAddress, restPort),
 			APISecret:          apiSecret,
-			AccessTokenExpiry:  viper.GetUint("api-access-token-expiry-time"),
-			RefreshTokenExpiry: viper.GetUint("api-refresh-token-expiry-time"),
+			AccessTokenExpiry:  accessTokenExpiry,
+			RefreshTokenExpiry: refreshTokenExpiry,
 			MaxDaysWoRelogin:   viper.GetInt("api-max-days-relogin"),
 			Guacamole:          viper.GetBool("guacamole"),
+			TOTPSecretKey:      totpSecretKey,
+			Keys:               signingKeys,
+			OIDCIssuer:         oidcIssuer,
+			RateLimiter:        rateLimiter,
+			NetworkPolicies:    apiNetworkPolicies,
+			TrustedProxies:     trustedProxies,
+			ClientCertMode:     clientCertMode,
+			ClientCA:           viper.GetString("api-client-ca"),
+			ClientCertMapping:  clientCertMapping,
 		}
 
 		ldapAddress := viper.GetString("ldap-addr")
@@ -257,20 +381,102 @@ var serverStartCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		// LDAP applications and OTP policies
+		ldapOTPPolicy := viper.GetString("ldap-otp-policy")
+		if !ldap.ValidOTPPolicy(ldapOTPPolicy) {
+			fmt.Printf("%s [Glim] ⇨ wrong LDAP OTP policy %s. Exiting now...\n", time.Now().Format(time.RFC3339), ldapOTPPolicy)
+			os.Exit(1)
+		}
+
+		ldapApplications := []types.LDAPApplication{}
+		for _, definition := range viper.GetStringSlice("ldap-app") {
+			app, err := ldap.ParseApplication(definition)
+			if err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+			ldapApplications = append(ldapApplications, app)
+		}
+
+		// LDAP network policies
+		ldapNetworkPolicies := netpolicy.Policies{}
+		for _, rule := range viper.GetStringSlice("ldap-network-rule") {
+			if err := ldapNetworkPolicies.Add(rule); err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+		}
+
+		// LDAPS client certificates for SASL EXTERNAL binds
+		ldapClientCertMode := viper.GetString("ldap-client-cert")
+		if !clientcert.ValidMode(ldapClientCertMode) {
+			fmt.Printf("%s [Glim] ⇨ wrong LDAP client certificates mode %s. Exiting now...\n", time.Now().Format(time.RFC3339), ldapClientCertMode)
+			os.Exit(1)
+		}
+		if ldapClientCertMode != clientcert.ModeNone && viper.GetBool("ldap-no-tls") {
+			fmt.Printf("%s [Glim] ⇨ LDAP client certificates require TLS. Exiting now...\n", time.Now().Format(time.RFC3339))
+			os.Exit(1)
+		}
+		var ldapClientCertMapping *clientcert.Mapping
+		if ldapClientCertMode != clientcert.ModeNone {
+			ldapClientCertMapping, err = clientcert.ParseMapping(viper.GetString("ldap-client-cert-user"))
+			if err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+		}
+
+		// ldapi socket for local clients, mapped to users with SASL EXTERNAL
+		ldapiMapping := peercred.Mapping{}
+		for _, rule := range viper.GetStringSlice("ldapi-map") {
+			if err := ldapiMapping.Add(rule); err != nil {
+				fmt.Printf("%s [Glim] ⇨ %v. Exiting now...\n", time.Now().Format(time.RFC3339), err)
+				os.Exit(1)
+			}
+		}
+		ldapiSocketMode, err := strconv.ParseUint(viper.GetString("ldapi-socket-mode"), 8, 32)
+		if err != nil || ldapiSocketMode > 0777 {
+			fmt.Printf("%s [Glim] ⇨ wrong ldapi socket mode %s. Exiting now...\n", time.Now().Format(time.RFC3339), viper.GetString("ldapi-socket-mode"))
+			os.Exit(1)
+		}
+
+		// Bind names accepted besides DNs
+		bindNameRules := viper.GetStringSlice("ldap-bind-names")
+		for _, rule := range bindNameRules {
+			if !ldap.ValidBindNameRule(rule) {
+				fmt.Printf("%s [Glim] ⇨ wrong LDAP bind name rule %s, expected uid, mail, upn or netbios. Exiting now...\n", time.Now().Format(time.RFC3339), rule)
+				os.Exit(1)
+			}
+		}
+
 		ldapSizeLimit := viper.GetInt("ldap-size-limit")
 		domain := viper.GetString("ldap-domain")
 
 		// Preparing LDAP server settings
 		ldapSettings := types.LDAPSettings{
-			KV:          blacklist,
-			DB:          database,
-			TLSDisabled: viper.GetBool("ldap-no-tls"),
-			TLSCert:     tlscert,
-			TLSKey:      tlskey,
-			Address:     fmt.Sprintf("%s:%d", ldapAddress, ldapPort),
-			Domain:      ldap.GetDomain(domain),
-			SizeLimit:   ldapSizeLimit,
-			Guacamole:   viper.GetBool("guacamole"),
+			KV:                blacklist,
+			DB:                database,
+			TLSDisabled:       viper.GetBool("ldap-no-tls"),
+			TLSCert:           tlscert,
+			TLSKey:            tlskey,
+			Address:           fmt.Sprintf("%s:%d", ldapAddress, ldapPort),
+			Domain:            ldap.GetDomain(domain),
+			SizeLimit:         ldapSizeLimit,
+			Guacamole:         viper.GetBool("guacamole"),
+			TOTPSecretKey:     totpSecretKey,
+			OTPSeparator:      viper.GetString("ldap-otp-separator"),
+			OTPPolicy:         ldapOTPPolicy,
+			Applications:      ldapApplications,
+			RateLimiter:       rateLimiter,
+			NetworkPolicies:   ldapNetworkPolicies,
+			ClientCertMode:    ldapClientCertMode,
+			ClientCA:          viper.GetString("ldap-client-ca"),
+			ClientCertMapping: ldapClientCertMapping,
+			LDAPISocket:       viper.GetString("ldapi-socket"),
+			LDAPISocketMode:   os.FileMode(ldapiSocketMode),
+			PeerCredMapping:   ldapiMapping,
+			BindNameRules:     bindNameRules,
+			NetBIOSDomain:     viper.GetString("ldap-netbios-domain"),
 		}
 
 		// get current PID and store it in glim.pid at our tmp directory
@@ -310,6 +516,32 @@ var serverStartCmd = &cobra.Command{
 	},
 }
 
+// rotateSigningKeys periodically reloads the JWT signing keys, so keys added
+// by other Glim servers sharing the directory are known, and rotates the
+// current key once it's older than maxAge
+func rotateSigningKeys(keys *jwks.KeySet, maxAge time.Duration) {
+	interval := time.Minute
+	if maxAge < interval {
+		interval = maxAge
+	}
+
+	for {
+		if err := keys.Load(); err != nil {
+			fmt.Printf("%s [Glim] ⇨ could not load JWT signing keys. %v\n", time.Now().Format(time.RFC3339), err)
+		}
+
+		rotated, err := keys.RotateIfOlderThan(maxAge)
+		if err != nil {
+			fmt.Printf("%s [Glim] ⇨ could not rotate JWT signing key. %v\n", time.Now().Format(time.RFC3339), err)
+		}
+		if rotated {
+			fmt.Printf("%s [Glim] ⇨ rotated JWT signing key, new key id %s...\n", time.Now().Format(time.RFC3339), keys.Current().ID)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
 func init() {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -322,6 +554,7 @@ func init() {
 	defaultCertKeyFilePath := filepath.Join(homeDir, ".glim", "server.key")
 	defaultDbPath := filepath.Join(homeDir, ".glim", "glim.db")
 	defaultKvPath := filepath.Join(homeDir, ".glim", "kv")
+	defaultJWTKeysPath := filepath.Join(homeDir, ".glim", "jwt-keys")
 
 	// LDAP Server
 	serverStartCmd.Flags().Bool("ldap-no-tls", false, "Don't use TLS with LDAP server")
@@ -329,6 +562,18 @@ func init() {
 	serverStartCmd.Flags().Int("ldap-port", 1636, "LDAP server port")
 	serverStartCmd.Flags().Int("ldap-size-limit", 500, "LDAP server maximum number of entries that should be returned from the search")
 	serverStartCmd.Flags().String("ldap-domain", "example.org", "LDAP domain")
+	serverStartCmd.Flags().String("ldap-otp-separator", ldap.DefaultOTPSeparator, "separator between the password and the TOTP code in LDAP binds e.g password+123456")
+	serverStartCmd.Flags().String("ldap-otp-policy", ldap.OTPPolicyOptional, "OTP policy for LDAP binds from clients not matching any application: required, optional or disabled")
+	serverStartCmd.Flags().StringArray("ldap-app", []string{}, "LDAP application defined as name:otp-policy:cidr[,cidr...] e.g vpn:required:10.0.0.0/8 (can be repeated)")
+	serverStartCmd.Flags().String("ldap-client-cert", clientcert.ModeNone, "LDAPS client certificates mode for SASL EXTERNAL binds: none, request (verified if sent) or require")
+	serverStartCmd.Flags().String("ldap-client-ca", "", "path of the PEM file containing the CA certificates used to verify LDAPS client certificates")
+	serverStartCmd.Flags().String("ldap-client-cert-user", clientcert.FieldCN, "rule mapping LDAPS client certificates to users as field[:regexp], see api-client-cert-user")
+	serverStartCmd.Flags().StringSlice("ldap-bind-names", []string{}, "comma-separated list of bind names accepted besides DNs: uid (alice), mail (alice@example.com), upn (alice@<ldap-domain>) and netbios (DOMAIN\\alice)")
+	serverStartCmd.Flags().String("ldap-netbios-domain", "", "NetBIOS domain name for DOMAIN\\username bind names, by default the first label of ldap-domain in upper case")
+	serverStartCmd.Flags().String("ldapi-socket", "", "path of a Unix domain socket where the LDAP server also listens for local clients (disabled if empty)")
+	serverStartCmd.Flags().String("ldapi-socket-mode", fmt.Sprintf("%o", ldap.DefaultLDAPISocketMode), "permissions of the ldapi socket in octal")
+	serverStartCmd.Flags().StringArray("ldapi-map", []string{}, "rule mapping local ldapi clients to users for SASL EXTERNAL binds as user=username or @group=username where user and group are OS names or ids e.g root=admin (can be repeated)")
+	serverStartCmd.Flags().StringArray("ldap-network-rule", []string{}, "LDAP network rule defined as operation:allow|deny:cidr[,cidr...] where operation is anonymous (connections), user or manager (binds) e.g anonymous:allow:10.0.0.0/8 (can be repeated)")
 
 	// REST API
 	serverStartCmd.Flags().String("api-addr", "", "REST API server IP address to listen (for example: 127.0.0.1)")
@@ -337,6 +582,22 @@ func init() {
 	serverStartCmd.Flags().Uint("api-access-token-expiry-time", 3600, "access token refresh expiry time in seconds")
 	serverStartCmd.Flags().Uint("api-refresh-token-expiry-time", 259200, "refresh token refresh expiry time in seconds")
 	serverStartCmd.Flags().Int("api-max-days-relogin", 7, "number of days that we can use refresh tokens without log in again")
+	serverStartCmd.Flags().String("jwt-algorithm", jwks.HS256, "algorithm used to sign JWT tokens: HS256 (uses the API secret), RS256, ES256 or EdDSA")
+	serverStartCmd.Flags().String("jwt-keys-dir", defaultJWTKeysPath, "directory where JWT signing private keys are stored (not used with HS256)")
+	serverStartCmd.Flags().Duration("jwt-key-rotation", 0, "rotate the JWT signing key when it's older than this duration e.g 720h (0 disables rotation)")
+	serverStartCmd.Flags().String("api-client-cert", clientcert.ModeNone, "REST API client certificates mode: none, request (verified if sent) or require")
+	serverStartCmd.Flags().String("api-client-ca", "", "path of the PEM file containing the CA certificates used to verify REST API client certificates")
+	serverStartCmd.Flags().String("api-client-cert-user", clientcert.FieldCN, "rule mapping client certificates to users as field[:regexp] where field is cn, email, dns or uri and the regexp first capture group is the username e.g email:^(.+)@example\\.org$ (email without regexp is compared with users' email)")
+	serverStartCmd.Flags().StringArray("api-network-rule", []string{}, "REST API network rule defined as operation:allow|deny:cidr[,cidr...] where operation is anonymous (any request), user (authenticated requests) or manager (manager only requests) e.g manager:allow:10.0.1.0/24 (can be repeated)")
+	serverStartCmd.Flags().StringSlice("api-trusted-proxies", []string{}, "comma-separated list of reverse proxy addresses or CIDRs allowed to set the client address with the X-Forwarded-For header e.g 10.0.0.5 (by default the header is ignored)")
+	serverStartCmd.Flags().String("oidc-issuer", "", "OpenID Connect issuer URL e.g https://glim.example.org:1323, the OpenID Connect provider is only enabled if it's set and requires an asymmetric JWT algorithm")
+
+	// Rate limiting
+	serverStartCmd.Flags().Int("rate-limit-burst", 10, "failed REST API logins and LDAP binds allowed for a source IP or username within the rate limit window (0 disables rate limiting)")
+	serverStartCmd.Flags().Duration("rate-limit-window", 5*time.Minute, "rate limit window, clients exceeding the burst are blocked for this duration")
+
+	// Two-factor authentication
+	serverStartCmd.Flags().String("totp-secret-key", "", "key used to encrypt TOTP secrets stored in the database (defaults to the API secret)")
 
 	// TLS
 	serverStartCmd.Flags().String("tlscert", defaultCertPEMFilePath, "TLS server certificate path")
@@ -347,6 +608,22 @@ func init() {
 	serverStartCmd.Flags().String("autocert-path", path, "filesystem path where Glim's auto-generated certificates and private keys files will be created")
 	serverStartCmd.Flags().Int("autocert-years", 1, "number of years that we want Glim's auto-generated to be valid.")
 
+	// Password hashing
+	serverStartCmd.Flags().String("password-hash-algorithm", "bcrypt", "algorithm used to hash new passwords: bcrypt or argon2id (bcrypt truncates passwords longer than 72 bytes)")
+	serverStartCmd.Flags().Int("bcrypt-cost", 10, "bcrypt cost factor (4-31)")
+	serverStartCmd.Flags().Uint32("argon2-memory", 65536, "argon2id memory in KiB")
+	serverStartCmd.Flags().Uint32("argon2-time", 3, "argon2id number of iterations")
+	serverStartCmd.Flags().Uint8("argon2-threads", 2, "argon2id degree of parallelism")
+	serverStartCmd.Flags().Bool("rehash-on-login", false, "upgrade stored password hashes to the current algorithm and parameters when users log in")
+
+	// POSIX accounts
+	serverStartCmd.Flags().Uint32("posix-uid-min", 10000, "first uidNumber automatically assigned to new users")
+	serverStartCmd.Flags().Uint32("posix-uid-max", 29999, "last uidNumber automatically assigned to new users")
+	serverStartCmd.Flags().Uint32("posix-gid-min", 30000, "first gidNumber automatically assigned to new groups")
+	serverStartCmd.Flags().Uint32("posix-gid-max", 49999, "last gidNumber automatically assigned to new groups")
+	serverStartCmd.Flags().String("posix-home-directory", "/home/{username}", "home directory template for new users, {username} and {uidNumber} are replaced")
+	serverStartCmd.Flags().String("posix-login-shell", "/bin/bash", "default login shell for new users")
+
 	// Badger
 	serverStartCmd.Flags().String("badgerdb-store", defaultKvPath, "directory path for BadgerDB KV store")
 
@@ -0,0 +1,488 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// printServiceAccountPassword prints a generated service account password,
+// it's only shown once
+func printServiceAccountPassword(cmd *cobra.Command, result *models.ServiceAccountInfo, jsonOutput bool) {
+	if jsonOutput {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.Encode(result)
+		return
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Service account password: %s\n", result.Password)
+	fmt.Fprintf(cmd.OutOrStdout(), "Copy it now, you won't be able to see it again\n")
+}
+
+// ListServiceAccountsCmd - TODO comment
+func ListServiceAccountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List service accounts",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/service-accounts", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]models.ServiceAccountInfo{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]models.ServiceAccountInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-6s %-20s %-6s %-7s %-8s %-20s %-8s %-20s\n",
+				"ID",
+				"NAME",
+				"USERS",
+				"GROUPS",
+				"PRIVATE",
+				"RESTRICTED TO",
+				"LOCKED",
+				"LAST BIND",
+			)
+
+			for _, result := range *results {
+				lastBind := "never"
+				if result.LastBindAt != nil {
+					lastBind = result.LastBindAt.Format("2006-01-02 15:04:05")
+				}
+				restrictedTo := "any"
+				if result.GroupsOnly {
+					restrictedTo = strings.Join(result.Groups, ",")
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "%-6d %-20s %-6v %-7v %-8v %-20s %-8v %-20s\n",
+					result.ID,
+					truncate(result.Name, 20),
+					result.SearchUsers,
+					result.SearchGroups,
+					result.ReadPrivate,
+					truncate(restrictedTo, 20),
+					result.Locked,
+					lastBind,
+				)
+			}
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// NewServiceAccountCmd - TODO comment
+func NewServiceAccountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a service account for an application that binds to Glim's LDAP server",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			searchUsers := !viper.GetBool("no-search-users")
+			searchGroups := !viper.GetBool("no-search-groups")
+			readPrivate := viper.GetBool("read-private")
+			proxyAuthz := viper.GetBool("proxy-authz")
+			locked := viper.GetBool("lock")
+			description := viper.GetString("description")
+			groups := viper.GetString("groups")
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/service-accounts", url)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONServiceAccountBody{
+					Name:         viper.GetString("name"),
+					Description:  &description,
+					SearchUsers:  &searchUsers,
+					SearchGroups: &searchGroups,
+					ReadPrivate:  &readPrivate,
+					ProxyAuthz:   &proxyAuthz,
+					Groups:       &groups,
+					Locked:       &locked,
+				}).
+				SetResult(models.ServiceAccountInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printServiceAccountPassword(cmd, resp.Result().(*models.ServiceAccountInfo), jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().StringP("name", "n", "", "service account name, the application binds as cn=name,ou=Services followed by Glim's domain")
+	cmd.Flags().StringP("description", "d", "", "service account description")
+	cmd.Flags().Bool("no-search-users", false, "don't allow searching users")
+	cmd.Flags().Bool("no-search-groups", false, "don't allow searching groups")
+	cmd.Flags().Bool("read-private", false, "allow reading private custom attributes")
+	cmd.Flags().Bool("proxy-authz", false, "allow the service account to use the LDAP proxied authorization control")
+	cmd.Flags().StringP("groups", "g", "", "only allow searching these groups and their members using a comma-separated list of group names e.g: devel,ops")
+	cmd.Flags().Bool("lock", false, "lock service account (cannot bind)")
+	cmd.MarkFlagRequired("name")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// UpdateServiceAccountCmd - TODO comment
+func UpdateServiceAccountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update a service account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var trueValue = true
+			var falseValue = false
+
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("service account id required")
+			}
+
+			for _, flags := range [][]string{
+				{"search-users", "no-search-users"},
+				{"search-groups", "no-search-groups"},
+				{"read-private", "no-read-private"},
+				{"proxy-authz", "no-proxy-authz"},
+				{"lock", "unlock"},
+			} {
+				if viper.GetBool(flags[0]) && viper.GetBool(flags[1]) {
+					return fmt.Errorf("%s and %s flags are mutually exclusive", flags[0], flags[1])
+				}
+			}
+
+			body := models.JSONServiceAccountBody{
+				Name: viper.GetString("name"),
+			}
+			if cmd.Flags().Changed("description") {
+				description := viper.GetString("description")
+				body.Description = &description
+			}
+			if cmd.Flags().Changed("groups") {
+				groups := viper.GetString("groups")
+				body.Groups = &groups
+			}
+			if viper.GetBool("search-users") {
+				body.SearchUsers = &trueValue
+			}
+			if viper.GetBool("no-search-users") {
+				body.SearchUsers = &falseValue
+			}
+			if viper.GetBool("search-groups") {
+				body.SearchGroups = &trueValue
+			}
+			if viper.GetBool("no-search-groups") {
+				body.SearchGroups = &falseValue
+			}
+			if viper.GetBool("read-private") {
+				body.ReadPrivate = &trueValue
+			}
+			if viper.GetBool("no-read-private") {
+				body.ReadPrivate = &falseValue
+			}
+			if viper.GetBool("proxy-authz") {
+				body.ProxyAuthz = &trueValue
+			}
+			if viper.GetBool("no-proxy-authz") {
+				body.ProxyAuthz = &falseValue
+			}
+			if viper.GetBool("lock") {
+				body.Locked = &trueValue
+			}
+			if viper.GetBool("unlock") {
+				body.Locked = &falseValue
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/service-accounts/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(body).
+				SetResult(models.ServiceAccountInfo{}).
+				SetError(&types.APIError{}).
+				Put(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Service account updated", jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().Uint("id", 0, "service account id")
+	cmd.Flags().StringP("name", "n", "", "service account name")
+	cmd.Flags().StringP("description", "d", "", "service account description")
+	cmd.Flags().Bool("search-users", false, "allow searching users")
+	cmd.Flags().Bool("no-search-users", false, "don't allow searching users")
+	cmd.Flags().Bool("search-groups", false, "allow searching groups")
+	cmd.Flags().Bool("no-search-groups", false, "don't allow searching groups")
+	cmd.Flags().Bool("read-private", false, "allow reading private custom attributes")
+	cmd.Flags().Bool("no-read-private", false, "don't allow reading private custom attributes")
+	cmd.Flags().Bool("proxy-authz", false, "allow the service account to use the LDAP proxied authorization control")
+	cmd.Flags().Bool("no-proxy-authz", false, "don't allow the service account to use the LDAP proxied authorization control")
+	cmd.Flags().StringP("groups", "g", "", "replace the groups searches are restricted to using a comma-separated list of group names, an empty list removes the restriction")
+	cmd.Flags().Bool("lock", false, "lock service account (cannot bind)")
+	cmd.Flags().Bool("unlock", false, "unlock service account (can bind)")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// RotateServiceAccountCmd - TODO comment
+func RotateServiceAccountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Generate a new password for a service account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("service account id required")
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/service-accounts/%d/rotate", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONServiceAccountRotateBody{
+					GracePeriod: viper.GetString("grace-period"),
+				}).
+				SetResult(models.ServiceAccountInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printServiceAccountPassword(cmd, resp.Result().(*models.ServiceAccountInfo), jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().Uint("id", 0, "service account id")
+	cmd.Flags().String("grace-period", "", "keep accepting the previous password for this long e.g: 24h, it stops working immediately if not set")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// DeleteServiceAccountCmd - TODO comment
+func DeleteServiceAccountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Remove a service account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("service account id required")
+			}
+
+			if !viper.GetBool("force") {
+				confirm := prompter.YesNo("Do you really want to delete this service account? Applications using it won't be able to bind", false)
+				if !confirm {
+					return fmt.Errorf("ok, service account wasn't deleted")
+				}
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			endpoint := fmt.Sprintf("%s/v1/service-accounts/%d", url, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Service account deleted", jsonOutput)
+			return nil
+		},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.Flags().Uint("id", 0, "service account id")
+	cmd.Flags().BoolP("force", "f", false, "force delete and don't ask for confirmation")
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	return cmd
+}
+
+// serviceAccountCmd represents the service-account command
+var serviceAccountCmd = &cobra.Command{
+	Use:   "service-account",
+	Short: "Manage the accounts applications use to bind to Glim's LDAP server",
+}
+
+func init() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	rootCmd.AddCommand(serviceAccountCmd)
+	serviceAccountCmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	serviceAccountCmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	serviceAccountCmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	serviceAccountCmd.AddCommand(ListServiceAccountsCmd())
+	serviceAccountCmd.AddCommand(NewServiceAccountCmd())
+	serviceAccountCmd.AddCommand(UpdateServiceAccountCmd())
+	serviceAccountCmd.AddCommand(RotateServiceAccountCmd())
+	serviceAccountCmd.AddCommand(DeleteServiceAccountCmd())
+}
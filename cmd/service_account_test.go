@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestServiceAccountCmd(t *testing.T) {
+	dbPath := uuid.New()
+	e := testSetup(t, dbPath.String(), false)
+	defer testCleanUp(dbPath.String())
+
+	// Launch testing server
+	go func() {
+		e.Start(":51026")
+	}()
+
+	waitForTestServer(t, ":51026")
+
+	testCases := []CmdTestCase{
+		{
+			name:           "login successful",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--username", "admin", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "new group",
+			cmd:            NewGroupCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--group", "devel", "--members", "saul"},
+			errorMessage:   "",
+			successMessage: "Group created\n",
+		},
+		{
+			name:           "invalid service account name",
+			cmd:            NewServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--name", "next cloud"},
+			errorMessage:   "service account name may only have letters, digits, dots, hyphens and underscores",
+			successMessage: "",
+		},
+		{
+			name:           "unknown group",
+			cmd:            NewServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--name", "wiki", "--groups", "ops"},
+			errorMessage:   "group ops not found",
+			successMessage: "",
+		},
+		{
+			name:           "new service account",
+			cmd:            NewServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--name", "wiki", "--groups", "devel", "--no-search-groups"},
+			errorMessage:   "",
+			successMessage: "",
+		},
+		{
+			name:           "service account already exists",
+			cmd:            NewServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--name", "Wiki"},
+			errorMessage:   "service account already exists",
+			successMessage: "",
+		},
+		{
+			name:           "list service accounts",
+			cmd:            ListServiceAccountsCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026"},
+			errorMessage:   "",
+			successMessage: "ID     NAME                 USERS  GROUPS  PRIVATE  RESTRICTED TO        LOCKED   LAST BIND           \n1      search               true   true    true     any                  false    never               \n2      wiki                 true   false   false    devel                false    never               \n",
+		},
+		{
+			name:           "service account id required",
+			cmd:            UpdateServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--lock"},
+			errorMessage:   "service account id required",
+			successMessage: "",
+		},
+		{
+			name:           "lock and unlock are mutually exclusive",
+			cmd:            UpdateServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--id", "2", "--lock", "--unlock"},
+			errorMessage:   "lock and unlock flags are mutually exclusive",
+			successMessage: "",
+		},
+		{
+			name:           "update service account",
+			cmd:            UpdateServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--id", "2", "--groups", "", "--read-private", "--lock"},
+			errorMessage:   "",
+			successMessage: "Service account updated\n",
+		},
+		{
+			name:           "list updated service accounts",
+			cmd:            ListServiceAccountsCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026"},
+			errorMessage:   "",
+			successMessage: "ID     NAME                 USERS  GROUPS  PRIVATE  RESTRICTED TO        LOCKED   LAST BIND           \n1      search               true   true    true     any                  false    never               \n2      wiki                 true   false   true     any                  true     never               \n",
+		},
+		{
+			name:           "invalid grace period",
+			cmd:            RotateServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--id", "2", "--grace-period", "tomorrow"},
+			errorMessage:   "grace period must be a valid duration e.g 24h",
+			successMessage: "",
+		},
+		{
+			name:           "login successful as saul",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--username", "saul", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "saul can't list service accounts",
+			cmd:            ListServiceAccountsCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026"},
+			errorMessage:   "user has no proper permissions",
+			successMessage: "",
+		},
+		{
+			name:           "login successful as admin",
+			cmd:            LoginCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--username", "admin", "--password", "test"},
+			errorMessage:   "",
+			successMessage: "Login succeeded\n",
+		},
+		{
+			name:           "delete service account",
+			cmd:            DeleteServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--id", "2", "--force"},
+			errorMessage:   "",
+			successMessage: "Service account deleted\n",
+		},
+		{
+			name:           "service account not found",
+			cmd:            DeleteServiceAccountCmd(),
+			args:           []string{"--server", "http://127.0.0.1:51026", "--id", "2", "--force"},
+			errorMessage:   "service account not found",
+			successMessage: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ListAPITokensCmd - TODO comment
+func ListAPITokensCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List personal API tokens of a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "api tokens")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/tokens", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]models.APITokenInfo{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]models.APITokenInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-6s %-20s %-12s %-30s %-20s %-20s %-8s\n",
+				"ID",
+				"NAME",
+				"PREFIX",
+				"SCOPES",
+				"EXPIRES",
+				"LAST USED",
+				"REVOKED",
+			)
+
+			for _, result := range *results {
+				expires := "never"
+				if result.ExpiresAt != nil {
+					expires = result.ExpiresAt.Format("2006-01-02 15:04:05")
+				}
+				lastUsed := "never"
+				if result.LastUsedAt != nil {
+					lastUsed = result.LastUsedAt.Format("2006-01-02 15:04:05")
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "%-6d %-20s %-12s %-30s %-20s %-20s %-8v\n",
+					result.ID,
+					truncate(result.Name, 20),
+					result.Prefix,
+					truncate(result.Scopes, 30),
+					expires,
+					lastUsed,
+					result.Revoked,
+				)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	return cmd
+}
+
+// NewAPITokenCmd - TODO comment
+func NewAPITokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a personal API token for automation",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "api tokens")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/tokens", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONAPITokenBody{
+					Name:          viper.GetString("name"),
+					Scopes:        viper.GetString("scopes"),
+					ExpiresInDays: viper.GetUint("expires-in-days"),
+				}).
+				SetResult(models.APITokenInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			result := resp.Result().(*models.APITokenInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(result)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "API token created: %s\n", result.Token)
+			fmt.Fprintf(cmd.OutOrStdout(), "Copy it now, you won't be able to see it again\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().StringP("name", "n", "", "api token name e.g: backup-script")
+	cmd.Flags().StringP("scopes", "s", "", "comma-separated list of scopes: users:read, users:write, groups:read, groups:write")
+	cmd.Flags().Uint("expires-in-days", 0, "number of days until the token expires, 0 means it never expires")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("scopes")
+	return cmd
+}
+
+// RevokeAPITokenCmd - TODO comment
+func RevokeAPITokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke a personal API token",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "api tokens")
+			if err != nil {
+				return err
+			}
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("api token id required")
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/tokens/%d", url, uid, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "API token revoked", jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().Uint("id", 0, "api token id")
+	return cmd
+}
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage personal API tokens for automation",
+}
+
+func init() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	tokenCmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	tokenCmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	tokenCmd.AddCommand(ListAPITokensCmd())
+	tokenCmd.AddCommand(NewAPITokenCmd())
+	tokenCmd.AddCommand(RevokeAPITokenCmd())
+}
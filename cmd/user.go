@@ -53,6 +53,9 @@ func init() {
 	userCmd.AddCommand(UpdateUserCmd())
 	userCmd.AddCommand(DeleteUserCmd())
 	userCmd.AddCommand(UserPasswdCmd())
+	userCmd.AddCommand(UserTOTPCmd())
+	userCmd.AddCommand(UserAppPasswordCmd())
+	userCmd.AddCommand(UserSessionsCmd())
 	userCmd.Flags().UintP("uid", "i", 0, "user account id")
 	userCmd.Flags().StringP("username", "u", "", "username")
 }
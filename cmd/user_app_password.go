@@ -0,0 +1,258 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ListAppPasswordsCmd - TODO comment
+func ListAppPasswordsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List app passwords of a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "app passwords")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/app-passwords", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]models.AppPasswordInfo{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]models.AppPasswordInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-6s %-20s %-15s %-20s %-20s %-8s\n",
+				"ID",
+				"NAME",
+				"APPLICATION",
+				"NETWORKS",
+				"LAST USED",
+				"REVOKED",
+			)
+
+			for _, result := range *results {
+				lastUsed := "never"
+				if result.LastUsedAt != nil {
+					lastUsed = result.LastUsedAt.Format("2006-01-02 15:04:05")
+				}
+				application := "any"
+				if result.Application != "" {
+					application = result.Application
+				}
+				networks := "any"
+				if result.Networks != "" {
+					networks = result.Networks
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "%-6d %-20s %-15s %-20s %-20s %-8v\n",
+					result.ID,
+					truncate(result.Name, 20),
+					truncate(application, 15),
+					truncate(networks, 20),
+					lastUsed,
+					result.Revoked,
+				)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	return cmd
+}
+
+// NewAppPasswordCmd - TODO comment
+func NewAppPasswordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an app password for LDAP clients",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "app passwords")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/app-passwords", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONAppPasswordBody{
+					Name:        viper.GetString("name"),
+					Application: viper.GetString("application"),
+					Networks:    viper.GetString("networks"),
+				}).
+				SetResult(models.AppPasswordInfo{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			result := resp.Result().(*models.AppPasswordInfo)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(result)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "App password created: %s\n", result.Password)
+			fmt.Fprintf(cmd.OutOrStdout(), "Copy it now, you won't be able to see it again\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().StringP("name", "n", "", "app password name e.g: thunderbird")
+	cmd.Flags().StringP("application", "a", "", "only accept this password from this LDAP application")
+	cmd.Flags().String("networks", "", "only accept this password from these networks using a comma-separated list of CIDRs e.g: 10.0.0.0/8,192.168.1.0/24")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+// RevokeAppPasswordCmd - TODO comment
+func RevokeAppPasswordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke an app password",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "app passwords")
+			if err != nil {
+				return err
+			}
+
+			id := viper.GetUint("id")
+			if id == 0 {
+				return fmt.Errorf("app password id required")
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/app-passwords/%d", url, uid, id)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "App password revoked", jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().Uint("id", 0, "app password id")
+	return cmd
+}
+
+// UserAppPasswordCmd - TODO comment
+func UserAppPasswordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "app-password",
+		Short: "Manage application-specific passwords for LDAP clients",
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	cmd.AddCommand(ListAppPasswordsCmd())
+	cmd.AddCommand(NewAppPasswordCmd())
+	cmd.AddCommand(RevokeAppPasswordCmd())
+	return cmd
+}
@@ -71,6 +71,8 @@ func NewUserCmd() *cobra.Command {
 			password := viper.GetString("password")
 			passwordStdin := viper.GetBool("password-stdin")
 			locked := viper.GetBool("lock")
+			ldapRequireOTP := viper.GetBool("ldap-require-otp")
+			proxyAuthz := viper.GetBool("proxy-authz")
 
 			if password == "" && !passwordStdin && !locked {
 				password = prompter.Password("Password")
@@ -142,21 +144,42 @@ func NewUserCmd() *cobra.Command {
 				jpegPhoto = *photo
 			}
 
+			// POSIX attributes, assigned by Glim if not set
+			var uidNumber, gidNumber *uint32
+			if n := viper.GetUint32("uid-number"); n != 0 {
+				uidNumber = &n
+			}
+			if n := viper.GetUint32("gid-number"); n != 0 {
+				gidNumber = &n
+			}
+
+			attributes, err := attributeValues()
+			if err != nil {
+				return err
+			}
+
 			resp, err := client.R().
 				SetHeader("Content-Type", "application/json").
 				SetBody(models.JSONUserBody{
-					Username:     viper.GetString("username"),
-					Password:     password,
-					Name:         strings.Join([]string{viper.GetString("firstname"), viper.GetString("lastname")}, " "),
-					GivenName:    viper.GetString("firstname"),
-					Surname:      viper.GetString("lastname"),
-					Email:        viper.GetString("email"),
-					SSHPublicKey: viper.GetString("ssh-public-key"),
-					MemberOf:     viper.GetString("groups"),
-					JPEGPhoto:    jpegPhoto,
-					Manager:      &manager,
-					Readonly:     &readonly,
-					Locked:       &locked,
+					Username:       viper.GetString("username"),
+					Password:       password,
+					Name:           strings.Join([]string{viper.GetString("firstname"), viper.GetString("lastname")}, " "),
+					GivenName:      viper.GetString("firstname"),
+					Surname:        viper.GetString("lastname"),
+					Email:          viper.GetString("email"),
+					SSHPublicKey:   viper.GetString("ssh-public-key"),
+					MemberOf:       viper.GetString("groups"),
+					JPEGPhoto:      jpegPhoto,
+					Manager:        &manager,
+					Readonly:       &readonly,
+					Locked:         &locked,
+					LDAPRequireOTP: &ldapRequireOTP,
+					ProxyAuthz:     &proxyAuthz,
+					UIDNumber:      uidNumber,
+					GIDNumber:      gidNumber,
+					HomeDirectory:  viper.GetString("home-directory"),
+					LoginShell:     viper.GetString("login-shell"),
+					Attributes:     attributes,
 				}).
 				SetError(&types.APIError{}).
 				Post(endpoint)
@@ -194,6 +217,13 @@ func NewUserCmd() *cobra.Command {
 	cmd.Flags().Bool("plainuser", false, "Glim plain user account. User can read and modify its own user account information but not its group membership.")
 	cmd.Flags().Bool("lock", false, "lock account (no password will be set, user cannot log in)")
 	cmd.Flags().Bool("unlock", false, "unlock account (can log in)")
+	cmd.Flags().Bool("ldap-require-otp", false, "require a TOTP code appended to the password in LDAP binds")
+	cmd.Flags().Bool("proxy-authz", false, "allow the account to use the LDAP proxied authorization control e.g for service accounts")
+	cmd.Flags().Uint32("uid-number", 0, "POSIX uidNumber, the next free number is assigned if not set")
+	cmd.Flags().Uint32("gid-number", 0, "POSIX gidNumber of the primary group, the uidNumber is used if not set")
+	cmd.Flags().String("home-directory", "", "POSIX home directory, Glim's home directory template is used if not set")
+	cmd.Flags().String("login-shell", "", "POSIX login shell, Glim's default login shell is used if not set")
+	cmd.Flags().StringArray("attribute", []string{}, "custom attribute value as name=value, name= removes the attribute (can be repeated)")
 	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
 	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
 	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
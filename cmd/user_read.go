@@ -49,10 +49,42 @@ func getUIDFromUsername(client *resty.Client, username string, url string) (uint
 	return uint(result.ID), nil
 }
 
+// targetUserUID returns the uid of the account selected with the uid or username
+// flags or our own uid. Only managers can manage other users' accounts
+func targetUserUID(client *resty.Client, token *types.TokenAuthentication, url string, what string) (uint, error) {
+	uid := viper.GetUint("uid")
+	username := viper.GetString("username")
+
+	tokenUID, err := WhichIsMyTokenUID(token)
+	if err != nil {
+		return 0, err
+	}
+
+	if uid == 0 {
+		if username != "" {
+			uid, err = getUIDFromUsername(client, username, url)
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			uid = tokenUID
+		}
+	}
+
+	if !AmIManager(token) && tokenUID != uid {
+		return 0, fmt.Errorf("only users with manager role can manage other users %s", what)
+	}
+
+	return uid, nil
+}
+
 func getUser(cmd *cobra.Command, id uint, jsonOutput bool) error {
 	// Glim server URL
 	url := viper.GetString("server")
 	endpoint := fmt.Sprintf("%s/v1/users/%d", url, id)
+	if viper.GetBool("transitive") {
+		endpoint += "?transitive=true"
+	}
 
 	// Get credentials
 	token, err := GetCredentials(url)
@@ -91,6 +123,10 @@ func getUser(cmd *cobra.Command, id uint, jsonOutput bool) error {
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-8v\n", "Manager:", result.Manager)
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-8v\n", "Read-Only:", result.Readonly)
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-8v\n", "Locked:", result.Locked)
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-8v\n", "UID Number:", result.UIDNumber)
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-8v\n", "GID Number:", result.GIDNumber)
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100s\n", "Home:", result.HomeDirectory)
+		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %-100s\n", "Shell:", result.LoginShell)
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %s\n", "SSH Public Key:", result.SSHPublicKey)
 		fmt.Fprintf(cmd.OutOrStdout(), "%-15s %s\n", "JPEG Photo:", truncate(result.JPEGPhoto, 100))
 		fmt.Fprintf(cmd.OutOrStdout(), "----\n")
@@ -100,6 +136,7 @@ func getUser(cmd *cobra.Command, id uint, jsonOutput bool) error {
 				fmt.Fprintf(cmd.OutOrStdout(), " * GID: %-4d Name: %-100s\n", group.ID, group.Name)
 			}
 		}
+		printAttributeValues(cmd, result.Attributes)
 	}
 	return nil
 }
@@ -108,6 +145,9 @@ func getUsers(cmd *cobra.Command, jsonOutput bool) error {
 	// Glim server URL
 	url := viper.GetString("server")
 	endpoint := fmt.Sprintf("%s/v1/users", url)
+	if viper.GetBool("transitive") {
+		endpoint += "?transitive=true"
+	}
 
 	// Get credentials
 	token, err := GetCredentials(url)
@@ -257,6 +297,7 @@ func ListUserCmd() *cobra.Command {
 	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
 	cmd.Flags().UintP("uid", "i", 0, "user account id")
 	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().Bool("transitive", false, "include the groups users are members of through nested groups")
 
 	return cmd
 }
@@ -39,7 +39,7 @@ func TestUserReadCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "--json"},
 			errorMessage:   "",
-			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}]` + "\n",
+			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10000,"gid_number":10000,"home_directory":"/home/admin","login_shell":"/bin/bash"},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false,"uid_number":10001,"gid_number":10001,"home_directory":"/home/search","login_shell":"/bin/bash"},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}]` + "\n",
 		},
 		{
 			name:           "test1 user created",
@@ -53,7 +53,7 @@ func TestUserReadCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "--json"},
 			errorMessage:   "",
-			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":6,"username":"test1","name":" ","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}]` + "\n",
+			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10000,"gid_number":10000,"home_directory":"/home/admin","login_shell":"/bin/bash"},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false,"uid_number":10001,"gid_number":10001,"home_directory":"/home/search","login_shell":"/bin/bash"},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"},{"uid":6,"username":"test1","name":" ","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10005,"gid_number":10005,"home_directory":"/home/test1","login_shell":"/bin/bash"}]` + "\n",
 		},
 		{
 			name:           "test1 user deleted",
@@ -67,7 +67,7 @@ func TestUserReadCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "--json"},
 			errorMessage:   "",
-			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}]` + "\n",
+			successMessage: `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10000,"gid_number":10000,"home_directory":"/home/admin","login_shell":"/bin/bash"},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false,"uid_number":10001,"gid_number":10001,"home_directory":"/home/search","login_shell":"/bin/bash"},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}]` + "\n",
 		},
 		{
 			name:           "user 120 does not exist",
@@ -81,14 +81,14 @@ func TestUserReadCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "-i", "5", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "username mike exists",
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "-u", "mike", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "test1 user created",
@@ -104,12 +104,14 @@ func TestUserReadCmd(t *testing.T) {
 			errorMessage:   "",
 			successMessage: "Login succeeded\n",
 		},
+		// The users id column is AUTOINCREMENT in SQLite so the new test1 doesn't
+		// get the id of the deleted one, and uidNumbers are never reused either
 		{
 			name:           "list users with test1 privileges",
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51010", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":6,"username":"test1","name":" ","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":7,"username":"test1","name":" ","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10006,"gid_number":10006,"home_directory":"/home/test1","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "test1 can't see mikes info",
@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ListSessionsCmd - TODO comment
+func ListSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List login sessions of a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "sessions")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/sessions", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult([]types.Session{}).
+				SetError(&types.APIError{}).
+				Get(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			results := resp.Result().(*[]types.Session)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(results)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%-36s %-20s %-20s %-20s %-30s\n",
+				"ID",
+				"IP",
+				"CREATED",
+				"LAST REFRESH",
+				"USER AGENT",
+			)
+
+			for _, result := range *results {
+				id := result.ID
+				if result.Current {
+					id = id + "*"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%-36s %-20s %-20s %-20s %-30s\n",
+					id,
+					truncate(result.IP, 20),
+					result.CreatedAt.Format("2006-01-02 15:04:05"),
+					result.LastRefreshAt.Format("2006-01-02 15:04:05"),
+					truncate(result.UserAgent, 30),
+				)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	return cmd
+}
+
+// RevokeSessionsCmd - TODO comment
+func RevokeSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke login sessions of a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			id := viper.GetString("id")
+			all := viper.GetBool("all")
+			if id == "" && !all {
+				return fmt.Errorf("session id or all flag required")
+			}
+			if id != "" && all {
+				return fmt.Errorf("id and all flags are mutually exclusive")
+			}
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "sessions")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/sessions", url, uid)
+			if !all {
+				endpoint = fmt.Sprintf("%s/%s", endpoint, id)
+			}
+
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			if all {
+				printCmdMessage(cmd, "Sessions revoked", jsonOutput)
+			} else {
+				printCmdMessage(cmd, "Session revoked", jsonOutput)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().String("id", "", "session id")
+	cmd.Flags().Bool("all", false, "revoke all sessions")
+	return cmd
+}
+
+// UserSessionsCmd - TODO comment
+func UserSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage login sessions",
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	cmd.AddCommand(ListSessionsCmd())
+	cmd.AddCommand(RevokeSessionsCmd())
+	return cmd
+}
@@ -0,0 +1,231 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Songmu/prompter"
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// UserTOTPEnrollCmd - TODO comment
+func UserTOTPEnrollCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "enroll",
+		Short: "Generate a TOTP secret and recovery codes for a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "two-factor authentication")
+			if err != nil {
+				return err
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/totp", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetResult(models.TOTPEnrollment{}).
+				SetError(&types.APIError{}).
+				Post(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			enrollment := resp.Result().(*models.TOTPEnrollment)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.Encode(enrollment)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Secret: %s\n", enrollment.Secret)
+			fmt.Fprintf(cmd.OutOrStdout(), "Provisioning URI: %s\n", enrollment.ProvisioningURI)
+			fmt.Fprintf(cmd.OutOrStdout(), "Recovery codes (store them in a safe place, each code can only be used once):\n")
+			for _, code := range enrollment.RecoveryCodes {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", code)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Add the secret to your authenticator app and run 'glim user totp activate' to finish the enrollment\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	return cmd
+}
+
+// UserTOTPActivateCmd - TODO comment
+func UserTOTPActivateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "activate",
+		Short: "Confirm a TOTP enrollment with a code from your authenticator app",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "two-factor authentication")
+			if err != nil {
+				return err
+			}
+
+			code := viper.GetString("code")
+			if code == "" {
+				code = prompter.Prompt("Two-factor authentication code", "")
+				if code == "" {
+					return fmt.Errorf("two-factor authentication code required")
+				}
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/totp", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONTOTPBody{Code: code}).
+				SetError(&types.APIError{}).
+				Put(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Two-factor authentication enabled", jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().String("code", "", "TOTP code")
+	return cmd
+}
+
+// UserTOTPDisableCmd - TODO comment
+func UserTOTPDisableCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Disable two-factor authentication for a Glim user account",
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			url := viper.GetString("server")
+			jsonOutput := viper.GetBool("json")
+
+			// Get credentials
+			token, err := GetCredentials(url)
+			if err != nil {
+				return err
+			}
+
+			client := RestClient(token.AccessToken)
+			uid, err := targetUserUID(client, token, url, "two-factor authentication")
+			if err != nil {
+				return err
+			}
+
+			// Managers don't need a code to disable two-factor authentication
+			code := viper.GetString("code")
+			if code == "" && !AmIManager(token) {
+				code = prompter.Prompt("Two-factor authentication or recovery code", "")
+				if code == "" {
+					return fmt.Errorf("two-factor authentication code required")
+				}
+			}
+
+			endpoint := fmt.Sprintf("%s/v1/users/%d/totp", url, uid)
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(models.JSONTOTPBody{Code: code}).
+				SetError(&types.APIError{}).
+				Delete(endpoint)
+
+			if err != nil {
+				return fmt.Errorf("can't connect with Glim: %v", err)
+			}
+
+			if resp.IsError() {
+				return fmt.Errorf("%v", resp.Error().(*types.APIError).Message)
+			}
+
+			printCmdMessage(cmd, "Two-factor authentication disabled", jsonOutput)
+			return nil
+		},
+	}
+
+	cmd.Flags().UintP("uid", "i", 0, "User account id")
+	cmd.Flags().StringP("username", "u", "", "username")
+	cmd.Flags().String("code", "", "TOTP or recovery code")
+	return cmd
+}
+
+// UserTOTPCmd - TODO comment
+func UserTOTPCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "totp",
+		Short: "Manage two-factor authentication (TOTP) for Glim user accounts",
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Could not get your home directory: %v\n", err)
+	}
+	defaultRootPEMFilePath := filepath.Join(homeDir, ".glim", "ca.pem")
+
+	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
+	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
+	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
+	cmd.AddCommand(UserTOTPEnrollCmd())
+	cmd.AddCommand(UserTOTPActivateCmd())
+	cmd.AddCommand(UserTOTPDisableCmd())
+	return cmd
+}
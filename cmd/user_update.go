@@ -87,6 +87,10 @@ func UpdateUserCmd() *cobra.Command {
 				return fmt.Errorf("replace and remove flags are mutually exclusive")
 			}
 
+			if viper.GetBool("proxy-authz") && viper.GetBool("no-proxy-authz") {
+				return fmt.Errorf("proxy-authz and no-proxy-authz flags are mutually exclusive")
+			}
+
 			jpegPhoto := ""
 			jpegPhotoPath := viper.GetString("jpeg-photo")
 			if jpegPhotoPath != "" {
@@ -108,6 +112,22 @@ func UpdateUserCmd() *cobra.Command {
 				JPEGPhoto:    jpegPhoto,
 			}
 
+			if n := viper.GetUint32("uid-number"); n != 0 {
+				userBody.UIDNumber = &n
+			}
+
+			if n := viper.GetUint32("gid-number"); n != 0 {
+				userBody.GIDNumber = &n
+			}
+
+			userBody.HomeDirectory = viper.GetString("home-directory")
+			userBody.LoginShell = viper.GetString("login-shell")
+
+			userBody.Attributes, err = attributeValues()
+			if err != nil {
+				return err
+			}
+
 			if viper.GetBool("manager") {
 				userBody.Manager = &trueValue
 				userBody.Readonly = &falseValue
@@ -126,6 +146,22 @@ func UpdateUserCmd() *cobra.Command {
 				userBody.Locked = &falseValue
 			}
 
+			if viper.GetBool("ldap-require-otp") {
+				userBody.LDAPRequireOTP = &trueValue
+			}
+
+			if viper.GetBool("ldap-optional-otp") {
+				userBody.LDAPRequireOTP = &falseValue
+			}
+
+			if viper.GetBool("proxy-authz") {
+				userBody.ProxyAuthz = &trueValue
+			}
+
+			if viper.GetBool("no-proxy-authz") {
+				userBody.ProxyAuthz = &falseValue
+			}
+
 			if viper.GetBool("plainuser") {
 				userBody.Manager = &falseValue
 				userBody.Readonly = &falseValue
@@ -180,7 +216,16 @@ func UpdateUserCmd() *cobra.Command {
 	cmd.Flags().Bool("remove", false, "remove group membership with those specified with -g.")
 	cmd.Flags().Bool("lock", false, "lock account (cannot log in)")
 	cmd.Flags().Bool("unlock", false, "unlock account (can log in)")
+	cmd.Flags().Bool("ldap-require-otp", false, "require a TOTP code appended to the password in LDAP binds")
+	cmd.Flags().Bool("ldap-optional-otp", false, "don't require a TOTP code appended to the password in LDAP binds")
+	cmd.Flags().Bool("proxy-authz", false, "allow the account to use the LDAP proxied authorization control")
+	cmd.Flags().Bool("no-proxy-authz", false, "don't allow the account to use the LDAP proxied authorization control")
 	cmd.Flags().UintP("uid", "i", 0, "user account id")
+	cmd.Flags().Uint32("uid-number", 0, "POSIX uidNumber")
+	cmd.Flags().Uint32("gid-number", 0, "POSIX gidNumber of the primary group")
+	cmd.Flags().String("home-directory", "", "POSIX home directory")
+	cmd.Flags().String("login-shell", "", "POSIX login shell")
+	cmd.Flags().StringArray("attribute", []string{}, "custom attribute value as name=value, name= removes the attribute (can be repeated)")
 	cmd.PersistentFlags().String("tlscacert", defaultRootPEMFilePath, "trust certs signed only by this CA")
 	cmd.PersistentFlags().String("server", "https://127.0.0.1:1323", "glim REST API server address")
 	cmd.PersistentFlags().Bool("json", false, "encodes Glim output as json string")
@@ -45,7 +45,7 @@ func TestUserUpdateCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51011", "-i", "5", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "update mike's firtsname and lastname using uid",
@@ -59,7 +59,7 @@ func TestUserUpdateCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51011", "-i", "5", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":5,"username":"mike","name":"Mike Ehrmantraut","firstname":"Mike","lastname":"Ehrmantraut","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":5,"username":"mike","name":"Mike Ehrmantraut","firstname":"Mike","lastname":"Ehrmantraut","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "update expects uid or username",
@@ -80,7 +80,7 @@ func TestUserUpdateCmd(t *testing.T) {
 			cmd:            ListUserCmd(),
 			args:           []string{"--server", "http://127.0.0.1:51011", "-i", "5", "--json"},
 			errorMessage:   "",
-			successMessage: `{"uid":5,"username":"mike","name":"Mike Ehrmantraut","firstname":"Mike","lastname":"Ehrmantraut","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false}` + "\n",
+			successMessage: `{"uid":5,"username":"mike","name":"Mike Ehrmantraut","firstname":"Mike","lastname":"Ehrmantraut","email":"mike@example.org","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}` + "\n",
 		},
 		{
 			name:           "mike can't be manager and readonly at the same time",
@@ -0,0 +1,129 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix helps to tell personal API tokens from JWT tokens
+const APITokenPrefix = "glim_"
+
+// APITokenScopes are the scopes that can be granted to personal API tokens.
+// A write scope also grants the read scope for the same resource
+var APITokenScopes = []string{"users:read", "users:write", "groups:read", "groups:write"}
+
+// APIToken - long-lived personal token that can be used instead of JWT
+// access tokens with the REST API
+type APIToken struct {
+	ID         uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UUID       *string    `gorm:"size:36;unique" json:"uuid"`
+	UserID     uint32     `gorm:"not null;index" json:"uid"`
+	Name       *string    `gorm:"size:100;not null" json:"name"`
+	Hash       *string    `gorm:"size:64;not null;unique" json:"-"`
+	Prefix     *string    `gorm:"size:16" json:"prefix"`
+	Scopes     *string    `gorm:"size:255" json:"scopes"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// JSONAPITokenBody - TODO comment
+type JSONAPITokenBody struct {
+	Name          string `json:"name"`
+	Scopes        string `json:"scopes"`
+	ExpiresInDays uint   `json:"expires_in_days"`
+}
+
+// APITokenInfo - TODO comment
+type APITokenInfo struct {
+	ID         uint32     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     string     `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// GetAPITokenInfo - TODO comment
+func GetAPITokenInfo(t APIToken) APITokenInfo {
+	var i APITokenInfo
+	i.ID = t.ID
+	if t.Name != nil {
+		i.Name = *t.Name
+	}
+	if t.Prefix != nil {
+		i.Prefix = *t.Prefix
+	}
+	if t.Scopes != nil {
+		i.Scopes = *t.Scopes
+	}
+	i.CreatedAt = t.CreatedAt
+	i.ExpiresAt = t.ExpiresAt
+	i.LastUsedAt = t.LastUsedAt
+	i.Revoked = t.RevokedAt != nil
+	return i
+}
+
+// ValidAPITokenScope checks if we know a scope
+func ValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateAPIToken returns a new random API token
+func GenerateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashAPIToken returns the hash we store for an API token. Tokens are
+// random so we can use a fast hash and look them up by it
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenHasScope tells us if a comma-separated list of scopes grants a scope
+func APITokenHasScope(scopes string, scope string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		s = strings.TrimSpace(s)
+		if s == scope {
+			return true
+		}
+		if strings.HasSuffix(scope, ":read") && s == strings.TrimSuffix(scope, ":read")+":write" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// AppPassword - application-specific password that can be used instead
+// of the user's password in LDAP binds
+type AppPassword struct {
+	ID          uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID      uint32     `gorm:"not null;index" json:"uid"`
+	Name        *string    `gorm:"size:100;not null" json:"name"`
+	Password    *string    `gorm:"size:255;not null" json:"-"`
+	Lookup      *string    `gorm:"size:4;index" json:"-"`
+	Application *string    `gorm:"size:100" json:"application"`
+	Networks    *string    `gorm:"size:1000" json:"networks"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// JSONAppPasswordBody - TODO comment
+type JSONAppPasswordBody struct {
+	Name        string `json:"name"`
+	Application string `json:"application"`
+	Networks    string `json:"networks"`
+}
+
+// AppPasswordInfo - TODO comment
+type AppPasswordInfo struct {
+	ID          uint32     `json:"id"`
+	Name        string     `json:"name"`
+	Application string     `json:"application"`
+	Networks    string     `json:"networks"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Revoked     bool       `json:"revoked"`
+	Password    string     `json:"password,omitempty"`
+}
+
+// GetAppPasswordInfo - TODO comment
+func GetAppPasswordInfo(a AppPassword) AppPasswordInfo {
+	var i AppPasswordInfo
+	i.ID = a.ID
+	if a.Name != nil {
+		i.Name = *a.Name
+	}
+	if a.Application != nil {
+		i.Application = *a.Application
+	}
+	if a.Networks != nil {
+		i.Networks = *a.Networks
+	}
+	i.CreatedAt = a.CreatedAt
+	i.LastUsedAt = a.LastUsedAt
+	i.Revoked = a.RevokedAt != nil
+	return i
+}
+
+const appPasswordAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// GenerateAppPassword returns a random password like abcd-efgh-jkmn-pqrs
+func GenerateAppPassword() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	groups := []string{}
+	for i := 0; i < len(buf); i += 4 {
+		group := make([]byte, 4)
+		for j := range group {
+			group[j] = appPasswordAlphabet[int(buf[i+j])%len(appPasswordAlphabet)]
+		}
+		groups = append(groups, string(group))
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// AppPasswordLookup returns a short identifier so binds only have to check
+// the slow hash of one app password. It's short enough to tell us nothing
+// useful about the password
+func AppPasswordLookup(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:2])
+}
@@ -0,0 +1,559 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Attribute visibility. Public values are shown to everyone that can read
+// the user or group, private values only to managers and readonly accounts
+const (
+	AttributePublic  = "public"
+	AttributePrivate = "private"
+)
+
+// Entries that can have values of an attribute
+const (
+	AttributeForUsers  = "users"
+	AttributeForGroups = "groups"
+	AttributeForAll    = "all"
+)
+
+// ErrInvalidAttribute is returned when custom attribute values don't
+// follow the definition of the attribute
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+// Attribute - custom attribute defined by managers for users and groups
+type Attribute struct {
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Name         *string   `gorm:"size:100;not null;unique" json:"name"`
+	NameFolded   *string   `gorm:"size:100" json:"-"`
+	OID          *string   `gorm:"column:oid;size:255" json:"oid"`
+	Syntax       *string   `gorm:"size:50;not null" json:"syntax"`
+	MultiValued  *bool     `gorm:"default:false" json:"multi_valued"`
+	Pattern      *string   `gorm:"size:500" json:"pattern"`
+	Visibility   *string   `gorm:"size:20;not null" json:"visibility"`
+	AppliesTo    *string   `gorm:"size:20;not null" json:"applies_to"`
+	UserEditable *bool     `gorm:"default:false" json:"user_editable"`
+	Description  *string   `gorm:"size:255" json:"description"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	CreatedBy    *string   `gorm:"size:500" json:"created_by"`
+	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	UpdatedBy    *string   `gorm:"size:500" json:"updated_by"`
+}
+
+// AttributeValue - value of a custom attribute stored for a user or a group
+type AttributeValue struct {
+	ID          uint32     `gorm:"primary_key;auto_increment"`
+	AttributeID uint32     `gorm:"index;not null"`
+	Attribute   *Attribute `gorm:"constraint:OnDelete:CASCADE"`
+	UserID      *uint32    `gorm:"index"`
+	GroupID     *uint32    `gorm:"index"`
+	Value       *string    `gorm:"size:1000;not null"`
+	ValueFolded *string    `gorm:"size:1000"`
+}
+
+// JSONAttributeBody - TODO comment
+type JSONAttributeBody struct {
+	Name         string  `json:"name"`
+	OID          string  `json:"oid"`
+	Syntax       string  `json:"syntax"`
+	MultiValued  *bool   `json:"multi_valued"`
+	Pattern      *string `json:"pattern"`
+	Visibility   string  `json:"visibility"`
+	AppliesTo    string  `json:"applies_to"`
+	UserEditable *bool   `json:"user_editable"`
+	Description  *string `json:"description"`
+}
+
+// AttributeInfo - TODO comment
+type AttributeInfo struct {
+	ID           uint32 `json:"id"`
+	Name         string `json:"name"`
+	OID          string `json:"oid,omitempty"`
+	Syntax       string `json:"syntax"`
+	SyntaxOID    string `json:"syntax_oid"`
+	MultiValued  bool   `json:"multi_valued"`
+	Pattern      string `json:"pattern,omitempty"`
+	Visibility   string `json:"visibility"`
+	AppliesTo    string `json:"applies_to"`
+	UserEditable bool   `json:"user_editable"`
+	Description  string `json:"description,omitempty"`
+}
+
+// GetAttributeInfo - TODO comment
+func GetAttributeInfo(a Attribute) AttributeInfo {
+	var i AttributeInfo
+	i.ID = a.ID
+	if a.Name != nil {
+		i.Name = *a.Name
+	}
+	if a.OID != nil {
+		i.OID = *a.OID
+	}
+	if a.Syntax != nil {
+		i.Syntax = *a.Syntax
+		i.SyntaxOID = attributeSyntaxes[*a.Syntax].oid
+	}
+	if a.MultiValued != nil {
+		i.MultiValued = *a.MultiValued
+	}
+	if a.Pattern != nil {
+		i.Pattern = *a.Pattern
+	}
+	if a.Visibility != nil {
+		i.Visibility = *a.Visibility
+	}
+	if a.AppliesTo != nil {
+		i.AppliesTo = *a.AppliesTo
+	}
+	if a.UserEditable != nil {
+		i.UserEditable = *a.UserEditable
+	}
+	if a.Description != nil {
+		i.Description = *a.Description
+	}
+	return i
+}
+
+// BeforeSave keeps the folded attribute name in sync
+func (a *Attribute) BeforeSave(tx *gorm.DB) error {
+	if v, ok := savedValue(tx, "name", a.Name); ok {
+		tx.Statement.SetColumn("name_folded", foldedValue(v))
+	}
+	return nil
+}
+
+// attributeSyntax - LDAP syntax of custom attribute values (RFC 4517)
+type attributeSyntax struct {
+	oid string
+	// normalize checks a value and returns the form that is stored
+	normalize func(v string) (string, bool)
+	// fold returns the form used to match values in LDAP filters
+	fold func(v string) string
+}
+
+// foldTelephoneNumber ignores case, spaces and hyphens as
+// telephoneNumberMatch does
+func foldTelephoneNumber(v string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(FoldIdentity(v))
+}
+
+// foldNumericString ignores spaces as numericStringMatch does
+func foldNumericString(v string) string {
+	return strings.ReplaceAll(v, " ", "")
+}
+
+// printable checks if a value only has the characters of PrintableString
+func printable(v string) bool {
+	for _, r := range v {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(" '()+,-./:=?", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeSyntaxes - syntaxes that can be chosen for custom attributes
+var attributeSyntaxes = map[string]attributeSyntax{
+	"directoryString": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.15",
+		normalize: func(v string) (string, bool) {
+			return v, utf8.ValidString(v)
+		},
+		fold: FoldIdentity,
+	},
+	"ia5String": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.26",
+		normalize: func(v string) (string, bool) {
+			for i := 0; i < len(v); i++ {
+				if v[i] > 127 {
+					return "", false
+				}
+			}
+			return v, true
+		},
+		fold: FoldIdentity,
+	},
+	"printableString": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.44",
+		normalize: func(v string) (string, bool) {
+			return v, printable(v)
+		},
+		fold: FoldIdentity,
+	},
+	"numericString": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.36",
+		normalize: func(v string) (string, bool) {
+			return v, strings.Trim(v, "0123456789 ") == "" && strings.TrimSpace(v) != ""
+		},
+		fold: foldNumericString,
+	},
+	"telephoneNumber": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.50",
+		normalize: func(v string) (string, bool) {
+			return v, printable(v)
+		},
+		fold: foldTelephoneNumber,
+	},
+	"integer": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.27",
+		normalize: func(v string) (string, bool) {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return "", false
+			}
+			return strconv.FormatInt(n, 10), true
+		},
+		fold: func(v string) string {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return strconv.FormatInt(n, 10)
+			}
+			return v
+		},
+	},
+	"boolean": {
+		oid: "1.3.6.1.4.1.1466.115.121.1.7",
+		normalize: func(v string) (string, bool) {
+			switch strings.ToUpper(v) {
+			case "TRUE":
+				return "TRUE", true
+			case "FALSE":
+				return "FALSE", true
+			}
+			return "", false
+		},
+		fold: strings.ToUpper,
+	},
+}
+
+// AttributeSyntaxes returns the names of the syntaxes that can be chosen
+// for custom attributes
+func AttributeSyntaxes() []string {
+	names := []string{}
+	for name := range attributeSyntaxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reservedAttributeNames - attribute types served by our LDAP server,
+// custom attributes can't use these names
+var reservedAttributeNames = []string{
+	"objectClass", "uid", "userid", "cn", "commonName", "sn", "surname",
+	"givenName", "gn", "mail", "email", "rfc822Mailbox", "sshPublicKey",
+	"uidNumber", "gidNumber", "homeDirectory", "loginShell", "jpegPhoto",
+	"memberOf", "description", "member", "memberUid", "guacConfigProtocol",
+	"guacConfigParameter", "structuralObjectClass", "entryUUID",
+	"creatorsName", "createTimestamp", "modifiersName", "modifyTimestamp",
+	"entryDN", "subschemaSubentry", "hasSubordinates", "userPassword", "ou",
+	"dc",
+}
+
+// ReservedAttributeName checks if a name is used by a built-in attribute
+func ReservedAttributeName(name string) bool {
+	for _, reserved := range reservedAttributeNames {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	attributeNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*$`)
+	oidRegexp           = regexp.MustCompile(`^[0-2](\.(0|[1-9][0-9]*))+$`)
+)
+
+// ValidateAttribute checks the definition of a custom attribute
+func ValidateAttribute(a *Attribute) error {
+	if a.Name == nil || !attributeNameRegexp.MatchString(*a.Name) {
+		return fmt.Errorf("%w: name must start with a letter and only have letters, digits and hyphens", ErrInvalidAttribute)
+	}
+	if ReservedAttributeName(*a.Name) {
+		return fmt.Errorf("%w: %s is a built-in attribute", ErrInvalidAttribute, *a.Name)
+	}
+	if a.OID != nil && *a.OID != "" && !oidRegexp.MatchString(*a.OID) {
+		return fmt.Errorf("%w: oid must be a dotted decimal object identifier", ErrInvalidAttribute)
+	}
+	if a.Syntax == nil {
+		return fmt.Errorf("%w: syntax must be one of %s", ErrInvalidAttribute, strings.Join(AttributeSyntaxes(), ", "))
+	}
+	if _, ok := attributeSyntaxes[*a.Syntax]; !ok {
+		return fmt.Errorf("%w: syntax must be one of %s", ErrInvalidAttribute, strings.Join(AttributeSyntaxes(), ", "))
+	}
+	if a.Pattern != nil && *a.Pattern != "" {
+		if _, err := regexp.Compile(*a.Pattern); err != nil {
+			return fmt.Errorf("%w: wrong pattern, %v", ErrInvalidAttribute, err)
+		}
+	}
+	if a.Visibility == nil || (*a.Visibility != AttributePublic && *a.Visibility != AttributePrivate) {
+		return fmt.Errorf("%w: visibility must be %s or %s", ErrInvalidAttribute, AttributePublic, AttributePrivate)
+	}
+	if a.AppliesTo == nil || (*a.AppliesTo != AttributeForUsers && *a.AppliesTo != AttributeForGroups && *a.AppliesTo != AttributeForAll) {
+		return fmt.Errorf("%w: applies_to must be %s, %s or %s", ErrInvalidAttribute, AttributeForUsers, AttributeForGroups, AttributeForAll)
+	}
+	return nil
+}
+
+// IsPrivate checks if the values of an attribute are private
+func (a *Attribute) IsPrivate() bool {
+	return a.Visibility != nil && *a.Visibility == AttributePrivate
+}
+
+// IsMultiValued checks if an entry can have several values of an attribute
+func (a *Attribute) IsMultiValued() bool {
+	return a.MultiValued != nil && *a.MultiValued
+}
+
+// IsUserEditable checks if users can set their own values of an attribute
+func (a *Attribute) IsUserEditable() bool {
+	return a.UserEditable != nil && *a.UserEditable
+}
+
+// AppliesToEntries checks if users or groups can have values of an attribute
+func (a *Attribute) AppliesToEntries(entries string) bool {
+	return a.AppliesTo != nil && (*a.AppliesTo == AttributeForAll || *a.AppliesTo == entries)
+}
+
+// NormalizeValue checks a value against the syntax and pattern of an
+// attribute and returns the value that is stored
+func (a *Attribute) NormalizeValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%w: %s values can't be empty", ErrInvalidAttribute, *a.Name)
+	}
+	normalized, ok := attributeSyntaxes[*a.Syntax].normalize(value)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not a valid %s value for %s", ErrInvalidAttribute, value, *a.Syntax, *a.Name)
+	}
+	if a.Pattern != nil && *a.Pattern != "" {
+		if re, err := regexp.Compile(*a.Pattern); err != nil || !re.MatchString(normalized) {
+			return "", fmt.Errorf("%w: %s doesn't match the pattern of %s", ErrInvalidAttribute, value, *a.Name)
+		}
+	}
+	return normalized, nil
+}
+
+// FoldValue returns the form of a value used to match it in LDAP filters
+func (a *Attribute) FoldValue(value string) string {
+	if syntax, ok := attributeSyntaxes[*a.Syntax]; ok {
+		return syntax.fold(strings.TrimSpace(value))
+	}
+	return FoldIdentity(value)
+}
+
+// CheckValues checks that the stored values of an attribute follow its
+// definition, used before an attribute definition is changed
+func (a *Attribute) CheckValues(tx *gorm.DB) error {
+	values := []AttributeValue{}
+	if err := tx.Session(&gorm.Session{NewDB: true}).Where("attribute_id = ?", a.ID).Find(&values).Error; err != nil {
+		return err
+	}
+
+	owners := map[string]int{}
+	for _, v := range values {
+		if _, err := a.NormalizeValue(*v.Value); err != nil {
+			return err
+		}
+		owner := ""
+		switch {
+		case v.UserID != nil:
+			if !a.AppliesToEntries(AttributeForUsers) {
+				return fmt.Errorf("%w: users have values of %s", ErrInvalidAttribute, *a.Name)
+			}
+			owner = fmt.Sprintf("u%d", *v.UserID)
+		case v.GroupID != nil:
+			if !a.AppliesToEntries(AttributeForGroups) {
+				return fmt.Errorf("%w: groups have values of %s", ErrInvalidAttribute, *a.Name)
+			}
+			owner = fmt.Sprintf("g%d", *v.GroupID)
+		}
+		owners[owner]++
+		if owners[owner] > 1 && !a.IsMultiValued() {
+			return fmt.Errorf("%w: there are entries with several values of %s", ErrInvalidAttribute, *a.Name)
+		}
+	}
+	return nil
+}
+
+// RefoldValues stores the values of an attribute again in their normalized
+// and folded forms, used after the syntax of an attribute has changed
+func (a *Attribute) RefoldValues(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	values := []AttributeValue{}
+	if err := db.Where("attribute_id = ?", a.ID).Find(&values).Error; err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		normalized, err := a.NormalizeValue(*v.Value)
+		if err != nil {
+			return err
+		}
+		err = db.Model(&AttributeValue{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+			"value":        normalized,
+			"value_folded": a.FoldValue(normalized),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttributeChange - values that replace the values of an attribute, an
+// empty list removes the attribute
+type AttributeChange struct {
+	Attribute Attribute
+	Values    []string
+}
+
+// PrepareAttributeChanges checks the custom attribute values sent for a
+// user or a group, entries is either users or groups
+func PrepareAttributeChanges(tx *gorm.DB, attributes map[string][]string, entries string) ([]AttributeChange, error) {
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := []AttributeChange{}
+	for _, name := range names {
+		var a Attribute
+		err := tx.Session(&gorm.Session{NewDB: true}).Where("name_folded = ?", FoldIdentity(name)).Take(&a).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s is not defined", ErrInvalidAttribute, name)
+			}
+			return nil, err
+		}
+		if !a.AppliesToEntries(entries) {
+			return nil, fmt.Errorf("%w: %s can't be used with %s", ErrInvalidAttribute, name, entries)
+		}
+
+		values := []string{}
+		seen := map[string]bool{}
+		for _, value := range attributes[name] {
+			normalized, err := a.NormalizeValue(value)
+			if err != nil {
+				return nil, err
+			}
+			if folded := a.FoldValue(normalized); !seen[folded] {
+				seen[folded] = true
+				values = append(values, normalized)
+			}
+		}
+		if len(values) > 1 && !a.IsMultiValued() {
+			return nil, fmt.Errorf("%w: %s is single-valued", ErrInvalidAttribute, name)
+		}
+		changes = append(changes, AttributeChange{Attribute: a, Values: values})
+	}
+	return changes, nil
+}
+
+// ApplyAttributeChanges replaces the values of the changed attributes of
+// a user or a group, only one of userID and groupID is set
+func ApplyAttributeChanges(tx *gorm.DB, changes []AttributeChange, userID *uint32, groupID *uint32) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	for _, change := range changes {
+		q := db.Where("attribute_id = ?", change.Attribute.ID)
+		if userID != nil {
+			q = q.Where("user_id = ?", *userID)
+		} else {
+			q = q.Where("group_id = ?", *groupID)
+		}
+		if err := q.Delete(&AttributeValue{}).Error; err != nil {
+			return err
+		}
+
+		for _, value := range change.Values {
+			value := value
+			folded := change.Attribute.FoldValue(value)
+			v := AttributeValue{
+				AttributeID: change.Attribute.ID,
+				UserID:      userID,
+				GroupID:     groupID,
+				Value:       &value,
+				ValueFolded: &folded,
+			}
+			if err := db.Create(&v).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AttributeValuesMap returns the custom attribute values of a user or a
+// group by attribute name. Values must be loaded with their attribute
+func AttributeValuesMap(values []AttributeValue) map[string][]string {
+	m := map[string][]string{}
+	for _, v := range values {
+		if v.Attribute == nil || v.Attribute.Name == nil || v.Value == nil {
+			continue
+		}
+		m[*v.Attribute.Name] = append(m[*v.Attribute.Name], *v.Value)
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// PublicAttributeValues removes the values of private attributes
+func PublicAttributeValues(values []AttributeValue) []AttributeValue {
+	public := []AttributeValue{}
+	for _, v := range values {
+		if v.Attribute != nil && !v.Attribute.IsPrivate() {
+			public = append(public, v)
+		}
+	}
+	return public
+}
+
+// ParseAttributeAssignments parses name=value assignments e.g the values of
+// the attribute flag in our CLI. An assignment with no value, name=, removes
+// the attribute
+func ParseAttributeAssignments(assignments []string) (map[string][]string, error) {
+	attributes := map[string][]string{}
+	for _, assignment := range assignments {
+		name, value, ok := strings.Cut(assignment, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: %s must be name=value", ErrInvalidAttribute, assignment)
+		}
+		if _, found := attributes[name]; !found {
+			attributes[name] = []string{}
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			attributes[name] = append(attributes[name], value)
+		}
+	}
+	return attributes, nil
+}
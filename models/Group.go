@@ -22,28 +22,39 @@ import (
 
 // Group - TODO comment
 type Group struct {
-	ID                        uint32    `gorm:"primary_key;auto_increment" json:"gid" csv:"gid"`
-	Name                      *string   `gorm:"size:100;unique;not null" json:"name" csv:"name"`
-	Description               *string   `gorm:"size:255" json:"description" csv:"description"`
-	CreatedAt                 time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at" csv:"-"`
-	CreatedBy                 *string   `gorm:"size:500" json:"created_by" csv:"-"`
-	UpdatedAt                 time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at" csv:"-"`
-	UpdatedBy                 *string   `gorm:"size:500" json:"updated_by" csv:"-"`
-	UUID                      *string   `gorm:"size:36" json:"uuid" csv:"-"`
-	Members                   []*User   `gorm:"many2many:group_members" csv:"-"`
-	GuacamoleConfigProtocol   *string   `gorm:"size:255" json:"guac_config_protocol" csv:"guac_config_protocol"`
-	GuacamoleConfigParameters *string   `gorm:"size:1000" json:"guac_config_parameters" csv:"guac_config_parameters"`
-	GroupMembers              *string   `csv:"members"`
+	ID                        uint32           `gorm:"primary_key;auto_increment" json:"gid" csv:"gid"`
+	Name                      *string          `gorm:"size:100;unique;not null" json:"name" csv:"name"`
+	Description               *string          `gorm:"size:255" json:"description" csv:"description"`
+	CreatedAt                 time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_at" csv:"-"`
+	CreatedBy                 *string          `gorm:"size:500" json:"created_by" csv:"-"`
+	UpdatedAt                 time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at" csv:"-"`
+	UpdatedBy                 *string          `gorm:"size:500" json:"updated_by" csv:"-"`
+	UUID                      *string          `gorm:"size:36" json:"uuid" csv:"-"`
+	Members                   []*User          `gorm:"many2many:group_members" csv:"-"`
+	MemberGroups              []*Group         `gorm:"many2many:group_member_groups;joinForeignKey:GroupID;joinReferences:MemberGroupID" csv:"-"`
+	GuacamoleConfigProtocol   *string          `gorm:"size:255" json:"guac_config_protocol" csv:"guac_config_protocol"`
+	GuacamoleConfigParameters *string          `gorm:"size:1000" json:"guac_config_parameters" csv:"guac_config_parameters"`
+	GroupMembers              *string          `csv:"members"`
+	GroupMemberGroups         *string          `gorm:"-" json:"-" csv:"member_groups,omitempty"`
+	RequireMFA                *bool            `gorm:"default:false" json:"require_mfa" csv:"-"`
+	NameFolded                *string          `gorm:"size:100" json:"-" csv:"-"`
+	GIDNumber                 *uint32          `gorm:"column:gid_number;uniqueIndex" json:"gid_number" csv:"gid_number,omitempty"`
+	Attributes                []AttributeValue `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"-" csv:"-"`
+	GroupAttributes           *string          `gorm:"-" json:"-" csv:"attributes,omitempty"`
 }
 
 // GroupInfo - TODO comment
 type GroupInfo struct {
-	ID                        uint32     `json:"gid"`
-	Name                      string     `json:"name"`
-	Description               string     `json:"description"`
-	Members                   []UserInfo `json:"members,omitempty"`
-	GuacamoleConfigProtocol   string     `json:"guac_config_protocol"`
-	GuacamoleConfigParameters string     `json:"guac_config_parameters"`
+	ID                        uint32              `json:"gid"`
+	Name                      string              `json:"name"`
+	Description               string              `json:"description"`
+	Members                   []UserInfo          `json:"members,omitempty"`
+	MemberGroups              []GroupInfo         `json:"member_groups,omitempty"`
+	GuacamoleConfigProtocol   string              `json:"guac_config_protocol"`
+	GuacamoleConfigParameters string              `json:"guac_config_parameters"`
+	RequireMFA                bool                `json:"require_mfa,omitempty"`
+	GIDNumber                 uint32              `json:"gid_number,omitempty"`
+	Attributes                map[string][]string `json:"attributes,omitempty"`
 }
 
 type GroupID struct {
@@ -52,17 +63,22 @@ type GroupID struct {
 
 // GroupMembers - TODO comment
 type GroupMembers struct {
-	Members string `json:"members"`
+	Members      string `json:"members"`
+	MemberGroups string `json:"member_groups,omitempty"`
 }
 
 // JSONGroupBody - TODO comment
 type JSONGroupBody struct {
-	Name                      string `json:"name"`
-	Description               string `json:"description"`
-	Members                   string `json:"members,omitempty"`
-	ReplaceMembers            bool   `json:"replace"`
-	GuacamoleConfigProtocol   string `json:"guac_config_protocol"`
-	GuacamoleConfigParameters string `json:"guac_config_parameters"`
+	Name                      string              `json:"name"`
+	Description               string              `json:"description"`
+	Members                   string              `json:"members,omitempty"`
+	MemberGroups              string              `json:"member_groups,omitempty"`
+	ReplaceMembers            bool                `json:"replace"`
+	GuacamoleConfigProtocol   string              `json:"guac_config_protocol"`
+	GuacamoleConfigParameters string              `json:"guac_config_parameters"`
+	RequireMFA                *bool               `json:"require_mfa,omitempty"`
+	GIDNumber                 *uint32             `json:"gid_number,omitempty"`
+	Attributes                map[string][]string `json:"attributes,omitempty"`
 }
 
 // GetGroupInfo - TODO comment
@@ -80,12 +96,30 @@ func GetGroupInfo(g *Group, showMembers bool, guacamole bool) *GroupInfo {
 		i.GuacamoleConfigParameters = *g.GuacamoleConfigParameters
 	}
 
+	if g.RequireMFA != nil {
+		i.RequireMFA = *g.RequireMFA
+	}
+
+	if g.GIDNumber != nil {
+		i.GIDNumber = *g.GIDNumber
+	}
+
+	i.Attributes = AttributeValuesMap(g.Attributes)
+
 	if showMembers {
 		members := []UserInfo{}
 		for _, member := range g.Members {
 			members = append(members, GetUserInfo(*member, !showMembers, guacamole))
 		}
 		i.Members = members
+
+		if len(g.MemberGroups) > 0 {
+			memberGroups := []GroupInfo{}
+			for _, memberGroup := range g.MemberGroups {
+				memberGroups = append(memberGroups, *GetGroupInfo(memberGroup, !showMembers, guacamole))
+			}
+			i.MemberGroups = memberGroups
+		}
 	}
 
 	return &i
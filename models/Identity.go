@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FoldIdentity returns the case-folded form of a username, group name or
+// email. Identities are compared and kept unique using this form so Alice
+// and alice are the same user whatever database we use
+func FoldIdentity(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// foldedValue returns the value stored in a folded column, empty values
+// are stored as NULL so they don't collide
+func foldedValue(value interface{}) interface{} {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		s = *v
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if folded := FoldIdentity(s); folded != "" {
+		return folded
+	}
+	return nil
+}
+
+// savedValue returns the value of a column that is being created or
+// updated, either from a map of updated columns or from the model field
+func savedValue(tx *gorm.DB, column string, field *string) (interface{}, bool) {
+	if values, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		v, ok := values[column]
+		return v, ok
+	}
+	if field == nil {
+		return nil, false
+	}
+	return *field, true
+}
+
+// BeforeSave keeps the folded username and email in sync
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if v, ok := savedValue(tx, "username", u.Username); ok {
+		tx.Statement.SetColumn("username_folded", foldedValue(v))
+	}
+	if v, ok := savedValue(tx, "email", u.Email); ok {
+		tx.Statement.SetColumn("email_folded", foldedValue(v))
+	}
+	return nil
+}
+
+// BeforeSave keeps the folded group name in sync
+func (g *Group) BeforeSave(tx *gorm.DB) error {
+	if v, ok := savedValue(tx, "name", g.Name); ok {
+		tx.Statement.SetColumn("name_folded", foldedValue(v))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrGroupCycle is returned when a group would become a member of itself,
+// directly or through the groups nested in it
+var ErrGroupCycle = errors.New("group membership would create a cycle")
+
+// groupClosure follows the nested groups table from the groups in ids and
+// returns them along with the groups found at any depth. Column from holds
+// the known groups and column to the groups that are followed
+func groupClosure(tx *gorm.DB, ids []uint32, from string, to string) ([]uint32, error) {
+	seen := map[uint32]bool{}
+	closure := []uint32{}
+
+	for len(ids) > 0 {
+		pending := []uint32{}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				closure = append(closure, id)
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		ids = []uint32{}
+		err := tx.Session(&gorm.Session{NewDB: true}).Table("group_member_groups").
+			Where(fmt.Sprintf("%s IN ?", from), pending).
+			Pluck(to, &ids).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return closure, nil
+}
+
+// NestedGroupIDs returns the ids of the groups and of every group nested
+// in them
+func NestedGroupIDs(tx *gorm.DB, ids []uint32) ([]uint32, error) {
+	return groupClosure(tx, ids, "group_id", "member_group_id")
+}
+
+// ParentGroupIDs returns the ids of the groups and of every group they are
+// nested in
+func ParentGroupIDs(tx *gorm.DB, ids []uint32) ([]uint32, error) {
+	return groupClosure(tx, ids, "member_group_id", "group_id")
+}
+
+// CheckMemberGroup returns ErrGroupCycle if member can't be nested in g
+// because g is already member itself or one of the groups nested in it
+func (g *Group) CheckMemberGroup(tx *gorm.DB, member *Group) error {
+	if member.ID == g.ID {
+		return ErrGroupCycle
+	}
+
+	nested, err := NestedGroupIDs(tx, []uint32{member.ID})
+	if err != nil {
+		return err
+	}
+	for _, id := range nested {
+		if id == g.ID {
+			return ErrGroupCycle
+		}
+	}
+	return nil
+}
+
+// RemoveFromNestedGroups removes the group from the groups it is nested in
+// and the groups nested in it
+func (g *Group) RemoveFromNestedGroups(tx *gorm.DB) error {
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Exec("DELETE FROM group_member_groups WHERE group_id = ? OR member_group_id = ?", g.ID, g.ID).Error
+}
+
+// TransitiveMemberOf returns the groups a user is a member of, directly or
+// through the groups nested in them, ordered by id
+func TransitiveMemberOf(tx *gorm.DB, u *User) ([]*Group, error) {
+	groups := []*Group{}
+
+	direct := []uint32{}
+	err := tx.Session(&gorm.Session{NewDB: true}).Table("group_members").
+		Where("user_id = ?", u.ID).
+		Pluck("group_id", &direct).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := ParentGroupIDs(tx, direct)
+	if err != nil || len(ids) == 0 {
+		return groups, err
+	}
+
+	err = tx.Session(&gorm.Session{NewDB: true}).Model(&Group{}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&groups).Error
+	return groups, err
+}
+
+// TransitiveMembers returns the users that are members of a group, directly
+// or through the groups nested in it, ordered by id
+func TransitiveMembers(tx *gorm.DB, g *Group) ([]*User, error) {
+	users := []*User{}
+
+	ids, err := NestedGroupIDs(tx, []uint32{g.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	members := tx.Session(&gorm.Session{NewDB: true}).Table("group_members").
+		Select("user_id").
+		Where("group_id IN ?", ids)
+	err = tx.Session(&gorm.Session{NewDB: true}).Model(&User{}).
+		Where("id IN (?)", members).
+		Order("id").
+		Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDCClient - web application that can log users in using Glim as
+// an OpenID Connect provider
+type OIDCClient struct {
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	ClientID     *string   `gorm:"size:36;not null;unique" json:"client_id"`
+	Name         *string   `gorm:"size:100;not null;unique" json:"name"`
+	SecretHash   *string   `gorm:"size:64" json:"-"`
+	RedirectURIs *string   `gorm:"size:2000;not null" json:"redirect_uris"`
+	Public       *bool     `gorm:"default:false" json:"public"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	CreatedBy    *string   `gorm:"size:500" json:"created_by"`
+	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	UpdatedBy    *string   `gorm:"size:500" json:"updated_by"`
+}
+
+// JSONOIDCClientBody - TODO comment
+type JSONOIDCClientBody struct {
+	Name         string `json:"name"`
+	RedirectURIs string `json:"redirect_uris"`
+	Public       *bool  `json:"public"`
+	ResetSecret  bool   `json:"reset_secret"`
+}
+
+// OIDCClientInfo - TODO comment
+type OIDCClientInfo struct {
+	ID           uint32    `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs string    `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+// GetOIDCClientInfo - TODO comment
+func GetOIDCClientInfo(o OIDCClient) OIDCClientInfo {
+	var i OIDCClientInfo
+	i.ID = o.ID
+	if o.ClientID != nil {
+		i.ClientID = *o.ClientID
+	}
+	if o.Name != nil {
+		i.Name = *o.Name
+	}
+	if o.RedirectURIs != nil {
+		i.RedirectURIs = *o.RedirectURIs
+	}
+	if o.Public != nil {
+		i.Public = *o.Public
+	}
+	i.CreatedAt = o.CreatedAt
+	return i
+}
+
+// ParseRedirectURIs checks a comma-separated list of absolute redirect URIs
+// and returns it without extra spaces
+func ParseRedirectURIs(uris string) (string, bool) {
+	parsed := []string{}
+	for _, uri := range strings.Split(uris, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			continue
+		}
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return "", false
+		}
+		parsed = append(parsed, uri)
+	}
+	return strings.Join(parsed, ","), len(parsed) > 0
+}
+
+// HasRedirectURI checks if a redirect URI has been registered for a client.
+// URIs must match exactly
+func (o *OIDCClient) HasRedirectURI(uri string) bool {
+	if o.RedirectURIs == nil {
+		return false
+	}
+	for _, registered := range strings.Split(*o.RedirectURIs, ",") {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateOIDCClientSecret returns a new random client secret
+func GenerateOIDCClientSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashOIDCClientSecret returns the hash we store for a client secret
+func HashOIDCClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
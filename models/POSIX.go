@@ -0,0 +1,233 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/doncicuto/glim/types"
+	"gorm.io/gorm"
+)
+
+// ErrIDRangeExhausted is returned when every uidNumber or gidNumber of a
+// range has already been allocated
+var ErrIDRangeExhausted = errors.New("no free ids left in range")
+
+// POSIX settings of new users and groups. They can be replaced with
+// ConfigurePOSIX
+var posix = DefaultPOSIXSettings()
+
+// DefaultPOSIXSettings returns the POSIX settings used by default. User
+// and group ranges don't overlap as users get a private group whose
+// gidNumber is their uidNumber
+func DefaultPOSIXSettings() types.POSIXSettings {
+	return types.POSIXSettings{
+		UIDMin:        10000,
+		UIDMax:        29999,
+		GIDMin:        30000,
+		GIDMax:        49999,
+		HomeDirectory: "/home/{username}",
+		LoginShell:    "/bin/bash",
+	}
+}
+
+// ConfigurePOSIX sets the ranges used to allocate ids, the homeDirectory
+// template and the default loginShell
+func ConfigurePOSIX(settings types.POSIXSettings) error {
+	if settings.UIDMin == 0 || settings.UIDMin > settings.UIDMax {
+		return errors.New("uid range must start above 0 and its minimum can't be greater than its maximum")
+	}
+	if settings.GIDMin == 0 || settings.GIDMin > settings.GIDMax {
+		return errors.New("gid range must start above 0 and its minimum can't be greater than its maximum")
+	}
+	if !ValidPOSIXPath(settings.HomeDirectory) {
+		return errors.New("home directory template must be an absolute path")
+	}
+	if !ValidPOSIXPath(settings.LoginShell) {
+		return errors.New("login shell must be an absolute path")
+	}
+	posix = settings
+	return nil
+}
+
+// ValidPOSIXPath checks if a homeDirectory or loginShell can be used in
+// a passwd entry
+func ValidPOSIXPath(p string) bool {
+	return path.IsAbs(p) && !strings.ContainsAny(p, ":\n")
+}
+
+// HomeDirectory returns the home directory of a user following the
+// template, {username} and {uidNumber} are replaced with the user values
+func HomeDirectory(username string, uidNumber uint32) string {
+	return strings.NewReplacer(
+		"{username}", username,
+		"{uidNumber}", strconv.FormatUint(uint64(uidNumber), 10),
+	).Replace(posix.HomeDirectory)
+}
+
+// POSIXIDMark stores the highest id ever allocated for a column so ids
+// freed when users or groups are deleted are not handed out again
+type POSIXIDMark struct {
+	Name string `gorm:"primary_key;size:32"`
+	Last uint32
+}
+
+// lastID returns the high-water mark of a column, 0 if nothing has been
+// allocated yet
+func lastID(tx *gorm.DB, column string) (uint32, error) {
+	var mark POSIXIDMark
+	err := tx.Session(&gorm.Session{NewDB: true}).Where("name = ?", column).Take(&mark).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return mark.Last, nil
+}
+
+// reserveID raises the high-water mark of a column to id if it belongs to
+// the range. Ids outside the range are never allocated so they're ignored
+func reserveID(tx *gorm.DB, column string, id uint32, min uint32, max uint32) error {
+	if id < min || id > max {
+		return nil
+	}
+	last, err := lastID(tx, column)
+	if err != nil {
+		return err
+	}
+	if last >= min && last <= max && last >= id {
+		return nil
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Save(&POSIXIDMark{Name: column, Last: id}).Error
+}
+
+// nextID returns the id following the highest id allocated in a range.
+// Ids of deleted accounts are not reused so their files don't change hands
+func nextID(tx *gorm.DB, model interface{}, column string, min uint32, max uint32) (uint32, error) {
+	var current sql.NullInt64
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(model).
+		Select(fmt.Sprintf("MAX(%s)", column)).
+		Where(fmt.Sprintf("%s BETWEEN ? AND ?", column), min, max).
+		Row().Scan(&current)
+	if err != nil {
+		return 0, err
+	}
+
+	// Rows written before the mark existed may hold higher ids
+	last, err := lastID(tx, column)
+	if err != nil {
+		return 0, err
+	}
+	if last < min || last > max {
+		last = 0
+	}
+	if current.Valid && uint32(current.Int64) > last {
+		last = uint32(current.Int64)
+	}
+
+	id := min
+	if last != 0 {
+		if last >= max {
+			return 0, fmt.Errorf("%w %d-%d", ErrIDRangeExhausted, min, max)
+		}
+		id = last + 1
+	}
+	if err := reserveID(tx, column, id, min, max); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// NextUIDNumber returns the uidNumber for a new user
+func NextUIDNumber(tx *gorm.DB) (uint32, error) {
+	return nextID(tx, &User{}, "uid_number", posix.UIDMin, posix.UIDMax)
+}
+
+// NextGIDNumber returns the gidNumber for a new group
+func NextGIDNumber(tx *gorm.DB) (uint32, error) {
+	return nextID(tx, &Group{}, "gid_number", posix.GIDMin, posix.GIDMax)
+}
+
+// ReserveUIDNumber keeps a uidNumber chosen by a manager from being
+// allocated again once its user is deleted
+func ReserveUIDNumber(tx *gorm.DB, uidNumber uint32) error {
+	return reserveID(tx, "uid_number", uidNumber, posix.UIDMin, posix.UIDMax)
+}
+
+// ReserveGIDNumber keeps a gidNumber chosen by a manager from being
+// allocated again once its group is deleted
+func ReserveGIDNumber(tx *gorm.DB, gidNumber uint32) error {
+	return reserveID(tx, "gid_number", gidNumber, posix.GIDMin, posix.GIDMax)
+}
+
+// AssignPOSIXAttributes allocates the POSIX attributes a user doesn't have
+func (u *User) AssignPOSIXAttributes(tx *gorm.DB) error {
+	if u.UIDNumber == nil {
+		uidNumber, err := NextUIDNumber(tx)
+		if err != nil {
+			return err
+		}
+		u.UIDNumber = &uidNumber
+	} else if err := ReserveUIDNumber(tx, *u.UIDNumber); err != nil {
+		return err
+	}
+
+	if u.GIDNumber == nil {
+		gidNumber := *u.UIDNumber
+		u.GIDNumber = &gidNumber
+	}
+
+	if (u.HomeDirectory == nil || *u.HomeDirectory == "") && u.Username != nil {
+		homeDirectory := HomeDirectory(*u.Username, *u.UIDNumber)
+		u.HomeDirectory = &homeDirectory
+	}
+
+	if u.LoginShell == nil || *u.LoginShell == "" {
+		loginShell := posix.LoginShell
+		u.LoginShell = &loginShell
+	}
+	return nil
+}
+
+// AssignGIDNumber allocates a gidNumber if the group doesn't have one
+func (g *Group) AssignGIDNumber(tx *gorm.DB) error {
+	if g.GIDNumber != nil {
+		return ReserveGIDNumber(tx, *g.GIDNumber)
+	}
+	gidNumber, err := NextGIDNumber(tx)
+	if err != nil {
+		return err
+	}
+	g.GIDNumber = &gidNumber
+	return nil
+}
+
+// BeforeCreate gives new users their POSIX attributes
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	return u.AssignPOSIXAttributes(tx)
+}
+
+// BeforeCreate gives new groups their gidNumber
+func (g *Group) BeforeCreate(tx *gorm.DB) error {
+	return g.AssignGIDNumber(tx)
+}
@@ -0,0 +1,281 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/doncicuto/glim/types"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms. The algorithm used for a stored
+// hash is identified by its prefix ($2a$, $2b$, $2y$ for bcrypt and
+// $argon2id$ for argon2id, using the PHC string format)
+const (
+	BcryptAlgorithm   = "bcrypt"
+	Argon2idAlgorithm = "argon2id"
+)
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// ErrMismatchedHashAndPassword - returned when a password doesn't match a stored hash
+var ErrMismatchedHashAndPassword = errors.New("hashed password is not the hash of the given password")
+
+// ErrUnknownHashAlgorithm - returned when a stored hash has an unknown prefix
+var ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+
+// PasswordHasher - hashes and verifies passwords using an algorithm
+type PasswordHasher interface {
+	// Hash a password
+	Hash(password string) (string, error)
+	// Verify a password against a hash generated by this hasher
+	Verify(hashedPassword, password string) error
+	// Prefix identifies hashes generated with this hasher
+	Prefix(hashedPassword string) bool
+	// NeedsRehash reports if a hash doesn't use this hasher's parameters
+	NeedsRehash(hashedPassword string) bool
+}
+
+// BcryptHasher - bcrypt with a configurable cost
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash a password with bcrypt
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify a password against a bcrypt hash
+func (b BcryptHasher) Verify(hashedPassword, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatchedHashAndPassword
+		}
+		return err
+	}
+	return nil
+}
+
+// Prefix checks if a hash was generated with bcrypt
+func (b BcryptHasher) Prefix(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") ||
+		strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+// NeedsRehash checks if a hash is not bcrypt or uses a different cost
+func (b BcryptHasher) NeedsRehash(hashedPassword string) bool {
+	if !b.Prefix(hashedPassword) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+	return cost != b.Cost
+}
+
+// Argon2idHasher - argon2id with tunable memory (KiB), time and parallelism
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// Hash a password with argon2id using a random salt
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2idKeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.Memory,
+		a.Time,
+		a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify a password against an argon2id hash
+func (a Argon2idHasher) Verify(hashedPassword, password string) error {
+	p, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// Prefix checks if a hash was generated with argon2id
+func (a Argon2idHasher) Prefix(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, argon2idPrefix)
+}
+
+// NeedsRehash checks if a hash is not argon2id or uses different parameters
+func (a Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	p, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return p.memory != a.Memory || p.time != a.Time || p.threads != a.Threads
+}
+
+// decodeArgon2idHash parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2idHash(hashedPassword string) (*argon2idParams, error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != Argon2idAlgorithm {
+		return nil, errors.New("wrong argon2id hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, errors.New("wrong argon2id hash version")
+	}
+	if version != argon2.Version {
+		return nil, errors.New("unsupported argon2id hash version")
+	}
+
+	p := argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, errors.New("wrong argon2id hash parameters")
+	}
+
+	var err error
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, errors.New("wrong argon2id hash salt")
+	}
+
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, errors.New("wrong argon2id hash key")
+	}
+
+	return &p, nil
+}
+
+// Hashers that can verify stored passwords. The first one is used to
+// hash new passwords and can be replaced with ConfigureHasher
+var (
+	hasher        PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+	rehashOnLogin                = false
+)
+
+// NewPasswordHasher returns a hasher for the algorithm in settings
+func NewPasswordHasher(settings types.PasswordHashSettings) (PasswordHasher, error) {
+	switch settings.Algorithm {
+	case "", BcryptAlgorithm:
+		cost := settings.BcryptCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return BcryptHasher{Cost: cost}, nil
+	case Argon2idAlgorithm:
+		if settings.Argon2Memory == 0 || settings.Argon2Time == 0 || settings.Argon2Threads == 0 {
+			return nil, errors.New("argon2id memory, time and parallelism must be greater than 0")
+		}
+		return Argon2idHasher{
+			Memory:  settings.Argon2Memory,
+			Time:    settings.Argon2Time,
+			Threads: settings.Argon2Threads,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", settings.Algorithm)
+	}
+}
+
+// ConfigureHasher sets the algorithm used to hash new passwords and
+// whether old hashes should be upgraded when users log in
+func ConfigureHasher(settings types.PasswordHashSettings) error {
+	h, err := NewPasswordHasher(settings)
+	if err != nil {
+		return err
+	}
+	hasher = h
+	rehashOnLogin = settings.RehashOnLogin
+	return nil
+}
+
+func hasherFor(hashedPassword string) (PasswordHasher, error) {
+	for _, h := range []PasswordHasher{BcryptHasher{}, Argon2idHasher{}} {
+		if h.Prefix(hashedPassword) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashAlgorithm
+}
+
+// Hash - TODO comment
+func Hash(password string) ([]byte, error) {
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hash), nil
+}
+
+// VerifyPassword - TODO comment
+func VerifyPassword(hashedPassword, password string) error {
+	h, err := hasherFor(hashedPassword)
+	if err != nil {
+		return err
+	}
+	return h.Verify(hashedPassword, password)
+}
+
+// NeedsRehash reports if a stored hash should be upgraded, as the
+// rehash-on-login policy is enabled and the hash uses a different
+// algorithm or different parameters than the configured hasher
+func NeedsRehash(hashedPassword string) bool {
+	return rehashOnLogin && hasher.NeedsRehash(hashedPassword)
+}
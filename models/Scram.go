@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ScramSHA256Iterations - PBKDF2 iterations used for new SCRAM-SHA-256
+// credentials, the minimum recommended by RFC 7677
+const ScramSHA256Iterations = 4096
+
+const scramSHA256SaltLen = 16
+
+// ScramCredentials - salted keys needed to verify a SCRAM-SHA-256
+// exchange (RFC 5802). The password can't be recovered from them
+type ScramCredentials struct {
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// ScramSHA256 derives SCRAM-SHA-256 credentials for a password using a
+// random salt. Credentials are encoded like PostgreSQL's verifiers:
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+func ScramSHA256(password string) (string, error) {
+	salt := make([]byte, scramSHA256SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	c := NewScramCredentials(password, salt, ScramSHA256Iterations)
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		c.Iterations,
+		base64.StdEncoding.EncodeToString(c.Salt),
+		base64.StdEncoding.EncodeToString(c.StoredKey),
+		base64.StdEncoding.EncodeToString(c.ServerKey)), nil
+}
+
+// NewScramCredentials derives the SCRAM-SHA-256 keys for a password
+func NewScramCredentials(password string, salt []byte, iterations int) *ScramCredentials {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := ScramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	return &ScramCredentials{
+		Iterations: iterations,
+		Salt:       salt,
+		StoredKey:  storedKey[:],
+		ServerKey:  ScramHMAC(saltedPassword, "Server Key"),
+	}
+}
+
+// ParseScramSHA256 decodes credentials generated with ScramSHA256
+func ParseScramSHA256(encoded string) (*ScramCredentials, error) {
+	var c ScramCredentials
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 3 || parts[0] != "SCRAM-SHA-256" {
+		return nil, errors.New("wrong SCRAM-SHA-256 credentials format")
+	}
+
+	params := strings.SplitN(parts[1], ":", 2)
+	keys := strings.SplitN(parts[2], ":", 2)
+	if len(params) != 2 || len(keys) != 2 {
+		return nil, errors.New("wrong SCRAM-SHA-256 credentials format")
+	}
+
+	if _, err := fmt.Sscanf(params[0], "%d", &c.Iterations); err != nil || c.Iterations < 1 {
+		return nil, errors.New("wrong SCRAM-SHA-256 iterations")
+	}
+
+	var err error
+	if c.Salt, err = base64.StdEncoding.DecodeString(params[1]); err != nil {
+		return nil, errors.New("wrong SCRAM-SHA-256 salt")
+	}
+	if c.StoredKey, err = base64.StdEncoding.DecodeString(keys[0]); err != nil {
+		return nil, errors.New("wrong SCRAM-SHA-256 stored key")
+	}
+	if c.ServerKey, err = base64.StdEncoding.DecodeString(keys[1]); err != nil {
+		return nil, errors.New("wrong SCRAM-SHA-256 server key")
+	}
+
+	return &c, nil
+}
+
+// ScramHMAC - HMAC-SHA-256 as used by SCRAM-SHA-256
+func ScramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var serviceAccountNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// ServiceAccount - account used by applications to bind to our LDAP server.
+// Service accounts live under ou=Services, they can't log in to the REST API
+// and they only read what their search permissions allow
+type ServiceAccount struct {
+	ID                        uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Name                      *string    `gorm:"size:64;not null;unique" json:"name"`
+	NameFolded                *string    `gorm:"size:64" json:"-"`
+	Description               *string    `gorm:"size:255" json:"description"`
+	Password                  *string    `gorm:"size:255;not null" json:"-"`
+	PreviousPassword          *string    `gorm:"size:255" json:"-"`
+	PreviousPasswordExpiresAt *time.Time `json:"-"`
+	PasswordChangedAt         *time.Time `json:"password_changed_at"`
+	SearchUsers               *bool      `gorm:"default:true" json:"search_users"`
+	SearchGroups              *bool      `gorm:"default:true" json:"search_groups"`
+	ReadPrivate               *bool      `gorm:"default:false" json:"read_private"`
+	ProxyAuthz                *bool      `gorm:"default:false" json:"proxy_authz"`
+	GroupsOnly                *bool      `gorm:"default:false" json:"groups_only"`
+	Groups                    []*Group   `gorm:"many2many:service_account_groups" json:"-"`
+	Locked                    *bool      `gorm:"default:false" json:"locked"`
+	LastBindAt                *time.Time `json:"last_bind_at"`
+	CreatedAt                 time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	CreatedBy                 *string    `gorm:"size:500" json:"created_by"`
+	UpdatedAt                 time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	UpdatedBy                 *string    `gorm:"size:500" json:"updated_by"`
+}
+
+// JSONServiceAccountBody - TODO comment
+type JSONServiceAccountBody struct {
+	Name         string  `json:"name"`
+	Description  *string `json:"description"`
+	SearchUsers  *bool   `json:"search_users"`
+	SearchGroups *bool   `json:"search_groups"`
+	ReadPrivate  *bool   `json:"read_private"`
+	ProxyAuthz   *bool   `json:"proxy_authz"`
+	Groups       *string `json:"groups"`
+	Locked       *bool   `json:"locked"`
+}
+
+// JSONServiceAccountRotateBody - TODO comment
+type JSONServiceAccountRotateBody struct {
+	GracePeriod string `json:"grace_period"`
+}
+
+// ServiceAccountInfo - TODO comment
+type ServiceAccountInfo struct {
+	ID                        uint32     `json:"id"`
+	Name                      string     `json:"name"`
+	Description               string     `json:"description"`
+	SearchUsers               bool       `json:"search_users"`
+	SearchGroups              bool       `json:"search_groups"`
+	ReadPrivate               bool       `json:"read_private"`
+	ProxyAuthz                bool       `json:"proxy_authz,omitempty"`
+	GroupsOnly                bool       `json:"groups_only"`
+	Groups                    []string   `json:"groups"`
+	Locked                    bool       `json:"locked"`
+	PasswordChangedAt         *time.Time `json:"password_changed_at"`
+	PreviousPasswordExpiresAt *time.Time `json:"previous_password_expires_at,omitempty"`
+	LastBindAt                *time.Time `json:"last_bind_at"`
+	Password                  string     `json:"password,omitempty"`
+}
+
+// GetServiceAccountInfo - TODO comment
+func GetServiceAccountInfo(s ServiceAccount) ServiceAccountInfo {
+	var i ServiceAccountInfo
+	i.ID = s.ID
+	if s.Name != nil {
+		i.Name = *s.Name
+	}
+	if s.Description != nil {
+		i.Description = *s.Description
+	}
+	i.SearchUsers = s.SearchUsers == nil || *s.SearchUsers
+	i.SearchGroups = s.SearchGroups == nil || *s.SearchGroups
+	i.ReadPrivate = s.ReadPrivate != nil && *s.ReadPrivate
+	i.ProxyAuthz = s.ProxyAuthz != nil && *s.ProxyAuthz
+	i.GroupsOnly = s.GroupsOnly != nil && *s.GroupsOnly
+	i.Groups = []string{}
+	for _, group := range s.Groups {
+		i.Groups = append(i.Groups, *group.Name)
+	}
+	i.Locked = s.Locked != nil && *s.Locked
+	i.PasswordChangedAt = s.PasswordChangedAt
+	if s.PreviousPasswordValid() {
+		i.PreviousPasswordExpiresAt = s.PreviousPasswordExpiresAt
+	}
+	i.LastBindAt = s.LastBindAt
+	return i
+}
+
+// ValidServiceAccountName checks that a service account name can be used
+// in its cn=name,ou=Services DN without escaping
+func ValidServiceAccountName(name string) bool {
+	return serviceAccountNameRegexp.MatchString(name)
+}
+
+// PreviousPasswordValid checks if the password replaced in the last
+// rotation can still be used during its grace period
+func (s *ServiceAccount) PreviousPasswordValid() bool {
+	return s.PreviousPassword != nil && *s.PreviousPassword != "" &&
+		s.PreviousPasswordExpiresAt != nil && time.Now().Before(*s.PreviousPasswordExpiresAt)
+}
+
+// BeforeSave keeps the folded service account name in sync
+func (s *ServiceAccount) BeforeSave(tx *gorm.DB) error {
+	if v, ok := savedValue(tx, "name", s.Name); ok {
+		tx.Statement.SetColumn("name_folded", foldedValue(v))
+	}
+	return nil
+}
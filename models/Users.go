@@ -18,49 +18,69 @@ package models
 
 import (
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User - TODO comment
 type User struct {
-	ID           uint32    `gorm:"primary_key;auto_increment" json:"uid" csv:"uid"`
-	Username     *string   `gorm:"size:64;not null;unique" json:"username" csv:"username"`
-	Name         *string   `gorm:"size:300" json:"name" csv:"-"`
-	GivenName    *string   `gorm:"size:150" json:"firstname" csv:"firstname"`
-	Surname      *string   `gorm:"size:150" json:"lastname" csv:"lastname"`
-	Email        *string   `gorm:"size:322" json:"email" csv:"email"`
-	Password     *string   `gorm:"size:60" json:"password" csv:"password"`
-	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at" csv:"-"`
-	CreatedBy    *string   `gorm:"size:500" json:"created_by" csv:"-"`
-	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at" csv:"-"`
-	UpdatedBy    *string   `gorm:"size:500" json:"updated_by" csv:"-"`
-	Manager      *bool     `gorm:"default:false" json:"manager" csv:"manager"`
-	Readonly     *bool     `gorm:"default:false" json:"readonly" csv:"readonly"`
-	Groups       *string   `csv:"groups"`
-	MemberOf     []*Group  `gorm:"many2many:group_members" csv:"-"`
-	UUID         *string   `gorm:"size:36" json:"uuid" csv:"-"`
-	Locked       *bool     `gorm:"default:false" json:"locked" csv:"locked"`
-	SSHPublicKey *string   `json:"ssh_public_key" csv:"ssh_public_key"`
-	JPEGPhoto    *string   `json:"jpeg_photo" csv:"jpeg_photo"`
+	ID                uint32           `gorm:"primary_key;auto_increment" json:"uid" csv:"uid"`
+	Username          *string          `gorm:"size:64;not null;unique" json:"username" csv:"username"`
+	Name              *string          `gorm:"size:300" json:"name" csv:"-"`
+	GivenName         *string          `gorm:"size:150" json:"firstname" csv:"firstname"`
+	Surname           *string          `gorm:"size:150" json:"lastname" csv:"lastname"`
+	Email             *string          `gorm:"size:322" json:"email" csv:"email"`
+	Password          *string          `gorm:"size:255" json:"password" csv:"password"`
+	CreatedAt         time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_at" csv:"-"`
+	CreatedBy         *string          `gorm:"size:500" json:"created_by" csv:"-"`
+	UpdatedAt         time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at" csv:"-"`
+	UpdatedBy         *string          `gorm:"size:500" json:"updated_by" csv:"-"`
+	Manager           *bool            `gorm:"default:false" json:"manager" csv:"manager"`
+	Readonly          *bool            `gorm:"default:false" json:"readonly" csv:"readonly"`
+	Groups            *string          `csv:"groups"`
+	MemberOf          []*Group         `gorm:"many2many:group_members" csv:"-"`
+	UUID              *string          `gorm:"size:36" json:"uuid" csv:"-"`
+	Locked            *bool            `gorm:"default:false" json:"locked" csv:"locked"`
+	SSHPublicKey      *string          `json:"ssh_public_key" csv:"ssh_public_key"`
+	JPEGPhoto         *string          `json:"jpeg_photo" csv:"jpeg_photo"`
+	TOTPSecret        *string          `gorm:"size:255" json:"-" csv:"-"`
+	TOTPEnabled       *bool            `gorm:"default:false" json:"totp_enabled" csv:"-"`
+	TOTPRecoveryCodes *string          `json:"-" csv:"-"`
+	LDAPRequireOTP    *bool            `gorm:"default:false" json:"ldap_require_otp" csv:"-"`
+	TokenGeneration   uint             `gorm:"default:0" json:"-" csv:"-"`
+	ScramSHA256       *string          `gorm:"size:255" json:"-" csv:"-"`
+	ProxyAuthz        *bool            `gorm:"default:false" json:"proxy_authz" csv:"-"`
+	UsernameFolded    *string          `gorm:"size:64" json:"-" csv:"-"`
+	EmailFolded       *string          `gorm:"size:322" json:"-" csv:"-"`
+	UIDNumber         *uint32          `gorm:"column:uid_number;uniqueIndex" json:"uid_number" csv:"uid_number,omitempty"`
+	GIDNumber         *uint32          `gorm:"column:gid_number" json:"gid_number" csv:"gid_number,omitempty"`
+	HomeDirectory     *string          `gorm:"size:255" json:"home_directory" csv:"home_directory,omitempty"`
+	LoginShell        *string          `gorm:"size:255" json:"login_shell" csv:"login_shell,omitempty"`
+	Attributes        []AttributeValue `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-" csv:"-"`
+	UserAttributes    *string          `gorm:"-" json:"-" csv:"attributes,omitempty"`
 }
 
 // JSONUserBody - TODO comment
 type JSONUserBody struct {
-	Username         string `json:"username"`
-	Name             string `json:"name"`
-	GivenName        string `json:"firstname"`
-	Surname          string `json:"lastname"`
-	Email            string `json:"email"`
-	Password         string `json:"password"`
-	SSHPublicKey     string `json:"ssh_public_key"`
-	JPEGPhoto        string `json:"jpeg_photo"`
-	MemberOf         string `json:"members,omitempty"`
-	Manager          *bool  `json:"manager"`
-	Readonly         *bool  `json:"readonly"`
-	Locked           *bool  `json:"locked"`
-	ReplaceMembersOf bool   `json:"replace"`
-	RemoveMembersOf  bool   `json:"remove"`
+	Username         string              `json:"username"`
+	Name             string              `json:"name"`
+	GivenName        string              `json:"firstname"`
+	Surname          string              `json:"lastname"`
+	Email            string              `json:"email"`
+	Password         string              `json:"password"`
+	SSHPublicKey     string              `json:"ssh_public_key"`
+	JPEGPhoto        string              `json:"jpeg_photo"`
+	MemberOf         string              `json:"members,omitempty"`
+	Manager          *bool               `json:"manager"`
+	Readonly         *bool               `json:"readonly"`
+	Locked           *bool               `json:"locked"`
+	ReplaceMembersOf bool                `json:"replace"`
+	RemoveMembersOf  bool                `json:"remove"`
+	LDAPRequireOTP   *bool               `json:"ldap_require_otp,omitempty"`
+	ProxyAuthz       *bool               `json:"proxy_authz,omitempty"`
+	UIDNumber        *uint32             `json:"uid_number,omitempty"`
+	GIDNumber        *uint32             `json:"gid_number,omitempty"`
+	HomeDirectory    string              `json:"home_directory,omitempty"`
+	LoginShell       string              `json:"login_shell,omitempty"`
+	Attributes       map[string][]string `json:"attributes,omitempty"`
 }
 
 // JSONPasswdBody - TODO comment
@@ -71,32 +91,42 @@ type JSONPasswdBody struct {
 
 // UserInfo - TODO comment
 type UserInfo struct {
-	ID           uint32      `json:"uid"`
-	Username     string      `json:"username"`
-	Name         string      `json:"name"`
-	GivenName    string      `json:"firstname"`
-	Surname      string      `json:"lastname"`
-	Email        string      `json:"email"`
-	SSHPublicKey string      `json:"ssh_public_key"`
-	JPEGPhoto    string      `json:"jpeg_photo"`
-	Manager      bool        `json:"manager"`
-	Readonly     bool        `json:"readonly"`
-	MemberOf     []GroupInfo `json:"memberOf,omitempty"`
-	Locked       bool        `json:"locked"`
+	ID             uint32              `json:"uid"`
+	Username       string              `json:"username"`
+	Name           string              `json:"name"`
+	GivenName      string              `json:"firstname"`
+	Surname        string              `json:"lastname"`
+	Email          string              `json:"email"`
+	SSHPublicKey   string              `json:"ssh_public_key"`
+	JPEGPhoto      string              `json:"jpeg_photo"`
+	Manager        bool                `json:"manager"`
+	Readonly       bool                `json:"readonly"`
+	MemberOf       []GroupInfo         `json:"memberOf,omitempty"`
+	Locked         bool                `json:"locked"`
+	TOTPEnabled    bool                `json:"totp_enabled,omitempty"`
+	LDAPRequireOTP bool                `json:"ldap_require_otp,omitempty"`
+	ProxyAuthz     bool                `json:"proxy_authz,omitempty"`
+	UIDNumber      uint32              `json:"uid_number,omitempty"`
+	GIDNumber      uint32              `json:"gid_number,omitempty"`
+	HomeDirectory  string              `json:"home_directory,omitempty"`
+	LoginShell     string              `json:"login_shell,omitempty"`
+	Attributes     map[string][]string `json:"attributes,omitempty"`
 }
 
-type UserID struct {
-	ID uint32 `json:"uid"`
+// JSONTOTPBody - TODO comment
+type JSONTOTPBody struct {
+	Code string `json:"code"`
 }
 
-// Hash - TODO comment
-func Hash(password string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// TOTPEnrollment - TODO comment
+type TOTPEnrollment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioning_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
 }
 
-// VerifyPassword - TODO comment
-func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+type UserID struct {
+	ID uint32 `json:"uid"`
 }
 
 // GetUserInfo - TODO comment
@@ -133,6 +163,29 @@ func GetUserInfo(u User, showMemberOf bool, guacamole bool) UserInfo {
 	if u.Locked != nil {
 		i.Locked = *u.Locked
 	}
+	if u.TOTPEnabled != nil {
+		i.TOTPEnabled = *u.TOTPEnabled
+	}
+	if u.LDAPRequireOTP != nil {
+		i.LDAPRequireOTP = *u.LDAPRequireOTP
+	}
+	if u.ProxyAuthz != nil {
+		i.ProxyAuthz = *u.ProxyAuthz
+	}
+	if u.UIDNumber != nil {
+		i.UIDNumber = *u.UIDNumber
+	}
+	if u.GIDNumber != nil {
+		i.GIDNumber = *u.GIDNumber
+	}
+	if u.HomeDirectory != nil {
+		i.HomeDirectory = *u.HomeDirectory
+	}
+	if u.LoginShell != nil {
+		i.LoginShell = *u.LoginShell
+	}
+
+	i.Attributes = AttributeValuesMap(u.Attributes)
 
 	if showMemberOf {
 		members := []GroupInfo{}
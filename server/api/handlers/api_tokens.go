@@ -0,0 +1,309 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// authenticateAPIToken looks up a personal API token and returns a token
+// with the same claims that our JWT access tokens have plus its scopes
+func authenticateAPIToken(db *gorm.DB, bearer string) (*jwt.Token, error) {
+	var t models.APIToken
+	var u models.User
+
+	if err := db.Where("hash = ?", models.HashAPIToken(bearer)).Take(&t).Error; err != nil {
+		return nil, err
+	}
+
+	if t.RevokedAt != nil {
+		return nil, errors.New("api token has been revoked")
+	}
+
+	if t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("api token has expired")
+	}
+
+	if err := db.Where("id = ?", t.UserID).Take(&u).Error; err != nil {
+		return nil, err
+	}
+
+	if u.Locked != nil && *u.Locked {
+		return nil, errors.New("account is locked")
+	}
+
+	// Last used tracking
+	db.Model(&models.APIToken{}).Where("id = ?", t.ID).Update("last_used_at", time.Now())
+
+	claims := jwt.MapClaims{}
+	claims["uid"] = float64(u.ID)
+	claims["jti"] = *t.UUID
+	claims["gen"] = float64(u.TokenGeneration)
+	claims["manager"] = u.Manager != nil && *u.Manager
+	claims["readonly"] = u.Readonly != nil && *u.Readonly
+	claims["scopes"] = *t.Scopes
+	if t.ExpiresAt != nil {
+		claims["exp"] = float64(t.ExpiresAt.Unix())
+	}
+
+	return &jwt.Token{Claims: claims, Valid: true}, nil
+}
+
+// isAPIToken tells us if the request was authenticated with a personal API token
+func isAPIToken(c echo.Context) bool {
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	_, ok = claims["scopes"]
+	return ok
+}
+
+// hasScope checks if a personal API token grants a scope
+func hasScope(token *jwt.Token, scope string) bool {
+	claims := token.Claims.(jwt.MapClaims)
+	scopes, ok := claims["scopes"].(string)
+	if !ok {
+		return false
+	}
+	return models.APITokenHasScope(scopes, scope)
+}
+
+// FindAPITokens - TODO comment
+// @Summary      List API tokens
+// @Description  List the personal API tokens of a user account
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Success      200  {array}   models.APITokenInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/tokens [get]
+// @Security 		 Bearer
+func (h *Handler) FindAPITokens(c echo.Context) error {
+	var tokens []models.APIToken
+
+	// API tokens can't be used to manage API tokens
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage api tokens"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	if err := h.DB.Where("user_id = ?", uid).Order("id").Find(&tokens).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	allTokens := []models.APITokenInfo{}
+	for _, token := range tokens {
+		allTokens = append(allTokens, models.GetAPITokenInfo(token))
+	}
+	return c.JSON(http.StatusOK, allTokens)
+}
+
+// SaveAPIToken - TODO comment
+// @Summary      Create API token
+// @Description  Create a personal API token. The token is only returned once
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        token  body models.JSONAPITokenBody  true  "API token body. Name and scopes (a comma-separated list of users:read, users:write, groups:read and groups:write) are required. If expires_in_days is 0 the token doesn't expire"
+// @Success      200  {object}  models.APITokenInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/tokens [post]
+// @Security 		 Bearer
+func (h *Handler) SaveAPIToken(c echo.Context) error {
+	body := models.JSONAPITokenBody{}
+
+	// API tokens can't be used to manage API tokens
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage api tokens"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Validate body
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required api token name"}
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Split(body.Scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !models.ValidAPITokenScope(scope) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "wrong api token scope " + scope}
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required api token scopes"}
+	}
+	allowedScopes := strings.Join(scopes, ",")
+
+	// Check if user exists
+	if err := h.DB.Where("id = ?", uid).First(&models.User{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// Check if an active token with that name already exists
+	err = h.DB.Where("user_id = ? AND name = ? AND revoked_at IS NULL", uid, name).First(&models.APIToken{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "api token already exists"}
+	}
+
+	// Generate token and store its hash
+	token, err := models.GenerateAPIToken()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate api token"}
+	}
+	hash := models.HashAPIToken(token)
+	prefix := token[:len(models.APITokenPrefix)+6]
+	tokenUUID := uuid.New().String()
+
+	t := models.APIToken{
+		UUID:   &tokenUUID,
+		UserID: uint32(uid),
+		Name:   &name,
+		Hash:   &hash,
+		Prefix: &prefix,
+		Scopes: &allowedScopes,
+	}
+
+	if body.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(body.ExpiresInDays) * 24 * time.Hour)
+		t.ExpiresAt = &expiresAt
+	}
+
+	if err := h.DB.Create(&t).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetAPITokenInfo(t)
+	i.Token = token
+	return c.JSON(http.StatusOK, i)
+}
+
+// RevokeAPIToken - TODO comment
+// @Summary      Revoke API token
+// @Description  Revoke a personal API token
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        token_id   path      int  true  "API token ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/tokens/{token_id} [delete]
+// @Security 		 Bearer
+func (h *Handler) RevokeAPIToken(c echo.Context) error {
+	var t models.APIToken
+
+	// API tokens can't be used to manage API tokens
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage api tokens"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "api token id param should be a valid integer"}
+	}
+
+	// Find token
+	if err := h.DB.Where("id = ? AND user_id = ?", id, uid).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "api token not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if t.RevokedAt != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "api token already revoked"}
+	}
+
+	if err := h.DB.Model(&models.APIToken{}).Where("id = ?", id).Update("revoked_at", time.Now()).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/labstack/echo/v4"
+)
+
+func createAPIToken(t *testing.T, e *echo.Echo, secret string, uid int, body string) string {
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/users/%d/tokens", uid), strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", secret))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not create api token - %d %s", res.Code, res.Body.String())
+	}
+	info := models.APITokenInfo{}
+	json.Unmarshal(res.Body.Bytes(), &info)
+	return info.Token
+}
+
+func TestAPITokens(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, _ := getUserTokens("search", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:             "search user can't create api tokens",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/2/tokens",
+			reqBodyJSON:      `{"name": "backup", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "plain user can't create api tokens for other users",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/4/tokens",
+			reqBodyJSON:      `{"name": "backup", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "name is required",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3/tokens",
+			reqBodyJSON:      `{"name": "", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"required api token name"}`,
+		},
+		{
+			name:             "scopes are required",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3/tokens",
+			reqBodyJSON:      `{"name": "backup"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"required api token scopes"}`,
+		},
+		{
+			name:             "scopes must be known",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3/tokens",
+			reqBodyJSON:      `{"name": "backup", "scopes": "users:read,everything"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"wrong api token scope everything"}`,
+		},
+		{
+			name:             "user not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/1000/tokens",
+			reqBodyJSON:      `{"name": "backup", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"user not found"}`,
+		},
+		{
+			name:             "unknown api tokens are rejected",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           "glim_unknown",
+			expectedBodyJSON: `{"message":"invalid or expired api token"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Create some tokens
+	plainReadToken := createAPIToken(t, e, plainUserToken, 3, `{"name": "read", "scopes": "users:read"}`)
+	adminWriteToken := createAPIToken(t, e, adminToken, 1, `{"name": "write", "scopes": "users:write, groups:write", "expires_in_days": 30}`)
+	expiredToken := createAPIToken(t, e, adminToken, 1, `{"name": "expired", "scopes": "users:read"}`)
+	h.DB.Model(&models.APIToken{}).Where("name = ?", "expired").Update("expires_at", time.Now().Add(-time.Hour))
+
+	testCases = []RestTestCase{
+		{
+			name:             "api token names can't be duplicated",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/3/tokens",
+			reqBodyJSON:      `{"name": "read", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"api token already exists"}`,
+		},
+		{
+			name:       "api token with users:read scope can read its user",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3",
+			reqMethod:  http.MethodGet,
+			secret:     plainReadToken,
+		},
+		{
+			name:             "api token keeps user permissions",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/4",
+			reqMethod:        http.MethodGet,
+			secret:           plainReadToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "api token without groups:read scope can't read groups",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodGet,
+			secret:           plainReadToken,
+			expectedBodyJSON: `{"message":"api token has no groups:read scope"}`,
+		},
+		{
+			name:             "api token without users:write scope can't update users",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3",
+			reqBodyJSON:      `{"name": "Saul"}`,
+			reqMethod:        http.MethodPut,
+			secret:           plainReadToken,
+			expectedBodyJSON: `{"message":"api token has no users:write scope"}`,
+		},
+		{
+			name:       "write scope grants read scope",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/groups",
+			reqMethod:  http.MethodGet,
+			secret:     adminWriteToken,
+		},
+		{
+			name:        "api token with users:write scope can create users",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users",
+			reqBodyJSON: `{"username": "howard", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminWriteToken,
+		},
+		{
+			name:             "api tokens can't create api tokens",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/1/tokens",
+			reqBodyJSON:      `{"name": "other", "scopes": "users:read"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminWriteToken,
+			expectedBodyJSON: `{"message":"api tokens can't be used to manage api tokens"}`,
+		},
+		{
+			name:             "api tokens can't create app passwords",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/1/app-passwords",
+			reqBodyJSON:      `{"name": "mail"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminWriteToken,
+			expectedBodyJSON: `{"message":"api tokens can't be used to manage app passwords"}`,
+		},
+		{
+			name:             "api tokens can't disable two-factor authentication",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/totp",
+			reqMethod:        http.MethodDelete,
+			secret:           adminWriteToken,
+			expectedBodyJSON: `{"message":"api tokens can't be used to manage two-factor authentication"}`,
+		},
+		{
+			name:             "api tokens can't revoke sessions",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/sessions",
+			reqMethod:        http.MethodDelete,
+			secret:           adminWriteToken,
+			expectedBodyJSON: `{"message":"api tokens can't be used to manage sessions"}`,
+		},
+		{
+			name:             "api tokens can't change passwords",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/passwd",
+			reqBodyJSON:      `{"password": "new"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminWriteToken,
+			expectedBodyJSON: `{"message":"api tokens can't be used to change passwords"}`,
+		},
+		{
+			name:             "expired api tokens are rejected",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/1",
+			reqMethod:        http.MethodGet,
+			secret:           expiredToken,
+			expectedBodyJSON: `{"message":"invalid or expired api token"}`,
+		},
+		{
+			name:       "list api tokens",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3/tokens",
+			reqMethod:  http.MethodGet,
+			secret:     plainUserToken,
+		},
+		{
+			name:             "api token belongs to other user",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/4/tokens/1",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"api token not found"}`,
+		},
+		{
+			name:       "revoke api token",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/users/3/tokens/1",
+			reqMethod:  http.MethodDelete,
+			secret:     plainUserToken,
+		},
+		{
+			name:             "api token already revoked",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/3/tokens/1",
+			reqMethod:        http.MethodDelete,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"api token already revoked"}`,
+		},
+		{
+			name:             "revoked api tokens are rejected",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           plainReadToken,
+			expectedBodyJSON: `{"message":"invalid or expired api token"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Tokens are hashed and last used is tracked
+	var tokens []models.APIToken
+	h.DB.Order("id").Find(&tokens)
+	if len(tokens) != 3 {
+		t.Fatalf("expected 3 api tokens, got %d", len(tokens))
+	}
+	if *tokens[0].Hash == plainReadToken || *tokens[0].Hash != models.HashAPIToken(plainReadToken) {
+		t.Fatalf("api tokens should be stored hashed")
+	}
+	if tokens[1].LastUsedAt == nil || tokens[1].ExpiresAt == nil {
+		t.Fatalf("wrong api token last used or expiry")
+	}
+}
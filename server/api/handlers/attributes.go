@@ -0,0 +1,340 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// privileged checks if the token belongs to a manager or a readonly
+// account, they can read private attributes
+func privileged(c echo.Context) bool {
+	if c.Get("user") == nil {
+		return false
+	}
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	manager, _ := claims["manager"].(bool)
+	readonly, _ := claims["readonly"].(bool)
+	return manager || readonly
+}
+
+// visibleAttributes returns the custom attribute values the token can read
+func visibleAttributes(c echo.Context, values []models.AttributeValue) []models.AttributeValue {
+	if privileged(c) {
+		return values
+	}
+	return models.PublicAttributeValues(values)
+}
+
+// preloadAttributes loads custom attribute values with their definitions
+func preloadAttributes(db *gorm.DB) *gorm.DB {
+	return db.Preload("Attributes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Attributes.Attribute")
+}
+
+// attributeValues returns the custom attribute values of a user or a
+// group, column is either user_id or group_id
+func (h *Handler) attributeValues(column string, id uint32) ([]models.AttributeValue, error) {
+	values := []models.AttributeValue{}
+	err := h.DB.Preload("Attribute").Where(column+" = ?", id).Order("id").Find(&values).Error
+	return values, err
+}
+
+// attributesError returns the HTTP error for custom attribute errors
+func attributesError(err error) error {
+	if errors.Is(err, models.ErrInvalidAttribute) {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: err.Error()}
+	}
+	return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+}
+
+// FindAttributes - TODO comment
+// @Summary      List custom attributes
+// @Description  List the custom attributes that users and groups can have
+// @Tags         attributes
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   models.AttributeInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /attributes [get]
+// @Security 		 Bearer
+func (h *Handler) FindAttributes(c echo.Context) error {
+	var attributes []models.Attribute
+
+	if err := h.DB.Order("id").Find(&attributes).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	allAttributes := []models.AttributeInfo{}
+	for _, a := range attributes {
+		allAttributes = append(allAttributes, models.GetAttributeInfo(a))
+	}
+	return c.JSON(http.StatusOK, allAttributes)
+}
+
+// SaveAttribute - TODO comment
+// @Summary      Define custom attribute
+// @Description  Define a custom attribute that users and groups can have. Its values are stored per user and group and served over LDAP
+// @Tags         attributes
+// @Accept       json
+// @Produce      json
+// @Param        attribute  body models.JSONAttributeBody  true  "Attribute body. Name is required and must be a valid LDAP attribute name that is not used by a built-in attribute. Syntax is one of boolean, directoryString (default), ia5String, integer, numericString, printableString or telephoneNumber. Visibility is public (default) or private, private values are only shown to managers and readonly accounts. Applies to is users (default), groups or all. If user_editable is true users can set their own values. Pattern is an optional regular expression values must match"
+// @Success      200  {object}  models.AttributeInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /attributes [post]
+// @Security 		 Bearer
+func (h *Handler) SaveAttribute(c echo.Context) error {
+	body := models.JSONAttributeBody{}
+
+	createdBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to define attribute"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required attribute name"}
+	}
+
+	a := models.Attribute{
+		Name:         &name,
+		MultiValued:  body.MultiValued,
+		Pattern:      body.Pattern,
+		UserEditable: body.UserEditable,
+		Description:  body.Description,
+		CreatedBy:    createdBy.Username,
+		UpdatedBy:    createdBy.Username,
+	}
+
+	oid := strings.TrimSpace(body.OID)
+	a.OID = &oid
+
+	syntax := "directoryString"
+	if body.Syntax != "" {
+		syntax = body.Syntax
+	}
+	a.Syntax = &syntax
+
+	visibility := models.AttributePublic
+	if body.Visibility != "" {
+		visibility = body.Visibility
+	}
+	a.Visibility = &visibility
+
+	appliesTo := models.AttributeForUsers
+	if body.AppliesTo != "" {
+		appliesTo = body.AppliesTo
+	}
+	a.AppliesTo = &appliesTo
+
+	if err := models.ValidateAttribute(&a); err != nil {
+		return attributesError(err)
+	}
+
+	// Check if attribute already exists
+	err = h.DB.Where("name_folded = ?", models.FoldIdentity(name)).First(&models.Attribute{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "attribute already exists"}
+	}
+
+	if err := h.DB.Create(&a).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.JSON(http.StatusOK, models.GetAttributeInfo(a))
+}
+
+// UpdateAttribute - TODO comment
+// @Summary      Update custom attribute
+// @Description  Update the definition of a custom attribute. Stored values must follow the new definition
+// @Tags         attributes
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Attribute ID"
+// @Param        attribute  body models.JSONAttributeBody  true  "Attribute body. Empty properties are not changed, an empty pattern removes the pattern"
+// @Success      200  {object}  models.AttributeInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /attributes/{id} [put]
+// @Security 		 Bearer
+func (h *Handler) UpdateAttribute(c echo.Context) error {
+	var a models.Attribute
+	body := models.JSONAttributeBody{}
+
+	updatedBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to update attribute"}
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "attribute id param should be a valid integer"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Find attribute
+	if err := h.DB.Where("id = ?", id).First(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "attribute not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	updates := map[string]interface{}{"updated_by": *updatedBy.Username}
+
+	name := strings.TrimSpace(body.Name)
+	if name != "" && name != *a.Name {
+		err = h.DB.Where("name_folded = ? AND id <> ?", models.FoldIdentity(name), id).First(&models.Attribute{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "attribute already exists"}
+		}
+		a.Name = &name
+		updates["name"] = name
+	}
+
+	if oid := strings.TrimSpace(body.OID); oid != "" {
+		a.OID = &oid
+		updates["oid"] = oid
+	}
+
+	if body.Syntax != "" {
+		a.Syntax = &body.Syntax
+		updates["syntax"] = body.Syntax
+	}
+
+	if body.MultiValued != nil {
+		a.MultiValued = body.MultiValued
+		updates["multi_valued"] = *body.MultiValued
+	}
+
+	if body.Pattern != nil {
+		a.Pattern = body.Pattern
+		updates["pattern"] = *body.Pattern
+	}
+
+	if body.Visibility != "" {
+		a.Visibility = &body.Visibility
+		updates["visibility"] = body.Visibility
+	}
+
+	if body.AppliesTo != "" {
+		a.AppliesTo = &body.AppliesTo
+		updates["applies_to"] = body.AppliesTo
+	}
+
+	if body.UserEditable != nil {
+		a.UserEditable = body.UserEditable
+		updates["user_editable"] = *body.UserEditable
+	}
+
+	if body.Description != nil {
+		a.Description = body.Description
+		updates["description"] = *body.Description
+	}
+
+	if err := models.ValidateAttribute(&a); err != nil {
+		return attributesError(err)
+	}
+
+	// Values already stored must follow the new definition
+	if err := a.CheckValues(h.DB); err != nil {
+		return attributesError(err)
+	}
+
+	if err := h.DB.Model(&models.Attribute{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// Syntax changes may change how values are matched
+	if err := a.RefoldValues(h.DB); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Where("id = ?", id).First(&a).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.JSON(http.StatusOK, models.GetAttributeInfo(a))
+}
+
+// DeleteAttribute - TODO comment
+// @Summary      Delete custom attribute
+// @Description  Delete a custom attribute and the values users and groups have
+// @Tags         attributes
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Attribute ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /attributes/{id} [delete]
+// @Security 		 Bearer
+func (h *Handler) DeleteAttribute(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "attribute id param should be a valid integer"}
+	}
+
+	if err := h.DB.Where("id = ?", id).First(&models.Attribute{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "attribute not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Where("attribute_id = ?", id).Delete(&models.AttributeValue{}).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Where("id = ?", id).Delete(&models.Attribute{}).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
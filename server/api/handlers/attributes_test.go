@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCustomAttributes(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, _ := getUserTokens("search", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:             "telephoneNumber is defined",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "telephoneNumber", "oid": "2.5.4.20", "syntax": "telephoneNumber", "multi_valued": true, "user_editable": true}`,
+			expectedBodyJSON: `{"id":1,"name":"telephoneNumber","oid":"2.5.4.20","syntax":"telephoneNumber","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.50","multi_valued":true,"visibility":"public","applies_to":"users","user_editable":true}`,
+		},
+		{
+			name:             "employeeNumber is defined as a private attribute",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "employeeNumber", "syntax": "integer", "visibility": "private"}`,
+			expectedBodyJSON: `{"id":2,"name":"employeeNumber","syntax":"integer","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.27","multi_valued":false,"visibility":"private","applies_to":"users","user_editable":false}`,
+		},
+		{
+			name:             "title is defined",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "title", "description": "Job title"}`,
+			expectedBodyJSON: `{"id":3,"name":"title","syntax":"directoryString","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.15","multi_valued":false,"visibility":"public","applies_to":"users","user_editable":false,"description":"Job title"}`,
+		},
+		{
+			name:             "departmentNumber is defined for users and groups",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "departmentNumber", "pattern": "^D[0-9]+$", "applies_to": "all"}`,
+			expectedBodyJSON: `{"id":4,"name":"departmentNumber","syntax":"directoryString","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.15","multi_valued":false,"pattern":"^D[0-9]+$","visibility":"public","applies_to":"all","user_editable":false}`,
+		},
+		{
+			name:             "built-in attributes can't be defined",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "Mail"}`,
+			expectedBodyJSON: `{"message":"invalid attribute: Mail is a built-in attribute"}`,
+		},
+		{
+			name:             "attribute names are unique ignoring case",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "TITLE"}`,
+			expectedBodyJSON: `{"message":"attribute already exists"}`,
+		},
+		{
+			name:             "attribute syntax must be known",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "preferredLanguage", "syntax": "language"}`,
+			expectedBodyJSON: `{"message":"invalid attribute: syntax must be one of boolean, directoryString, ia5String, integer, numericString, printableString, telephoneNumber"}`,
+		},
+		{
+			name:             "plain users can't define attributes",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			reqBodyJSON:      `{"name": "preferredLanguage"}`,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "saul gets custom attributes",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"telephoneNumber": ["+34 600 000 000", "+34 611 111 111"], "employeeNumber": ["0042"], "title": ["Lawyer"]}}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash","attributes":{"employeeNumber":["42"],"telephoneNumber":["+34 600 000 000","+34 611 111 111"],"title":["Lawyer"]}}`,
+		},
+		{
+			name:             "single-valued attributes only have one value",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"title": ["Lawyer", "Partner"]}}`,
+			expectedBodyJSON: `{"message":"invalid attribute: title is single-valued"}`,
+		},
+		{
+			name:             "values must follow the attribute syntax",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"employeeNumber": ["forty-two"]}}`,
+			expectedBodyJSON: `{"message":"invalid attribute: forty-two is not a valid integer value for employeeNumber"}`,
+		},
+		{
+			name:             "values must match the attribute pattern",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"departmentNumber": ["Legal"]}}`,
+			expectedBodyJSON: `{"message":"invalid attribute: Legal doesn't match the pattern of departmentNumber"}`,
+		},
+		{
+			name:             "attributes must be defined",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"preferredLanguage": ["es"]}}`,
+			expectedBodyJSON: `{"message":"invalid attribute: preferredLanguage is not defined"}`,
+		},
+		{
+			name:             "attribute with values can't become single-valued",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/attributes/1",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"multi_valued": false}`,
+			expectedBodyJSON: `{"message":"invalid attribute: there are entries with several values of telephoneNumber"}`,
+		},
+		{
+			name:             "saul can't read his private attributes",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash","attributes":{"telephoneNumber":["+34 600 000 000","+34 611 111 111"],"title":["Lawyer"]}}`,
+		},
+		{
+			name:             "search can read private attributes",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           searchToken,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash","attributes":{"employeeNumber":["42"],"telephoneNumber":["+34 600 000 000","+34 611 111 111"],"title":["Lawyer"]}}`,
+		},
+		{
+			name:             "saul can't update attributes that are not user editable",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           plainUserToken,
+			reqBodyJSON:      `{"attributes": {"title": ["Partner"]}}`,
+			expectedBodyJSON: `{"message":"only managers can update the title attribute"}`,
+		},
+		{
+			name:             "saul updates his telephone numbers",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           plainUserToken,
+			reqBodyJSON:      `{"attributes": {"telephoneNumber": ["+34 622 222 222"]}}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash","attributes":{"telephoneNumber":["+34 622 222 222"],"title":["Lawyer"]}}`,
+		},
+		{
+			name:             "group devel is created with a department",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "devel", "description": "Developers", "attributes": {"departmentNumber": ["D10"]}}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000,"attributes":{"departmentNumber":["D10"]}}`,
+		},
+		{
+			name:             "groups can't have user attributes",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/groups/1",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"title": ["Developers"]}}`,
+			expectedBodyJSON: `{"message":"invalid attribute: title can't be used with groups"}`,
+		},
+		{
+			name:       "title is deleted",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/attributes/3",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "employeeNumber is removed from saul",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"attributes": {"employeeNumber": []}}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash","attributes":{"telephoneNumber":["+34 622 222 222"]}}`,
+		},
+		{
+			name:             "search lists the attributes",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodGet,
+			secret:           searchToken,
+			expectedBodyJSON: `[{"id":1,"name":"telephoneNumber","oid":"2.5.4.20","syntax":"telephoneNumber","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.50","multi_valued":true,"visibility":"public","applies_to":"users","user_editable":true},{"id":2,"name":"employeeNumber","syntax":"integer","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.27","multi_valued":false,"visibility":"private","applies_to":"users","user_editable":false},{"id":4,"name":"departmentNumber","syntax":"directoryString","syntax_oid":"1.3.6.1.4.1.1466.115.121.1.15","multi_valued":false,"pattern":"^D[0-9]+$","visibility":"public","applies_to":"all","user_editable":false}]`,
+		},
+		{
+			name:             "plain users can't list the attributes",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/attributes",
+			reqMethod:        http.MethodGet,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+}
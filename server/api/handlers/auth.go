@@ -0,0 +1,103 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/jwks"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// Authenticate validates the bearer token sent in the Authorization header.
+// JWT access tokens and personal API tokens are accepted, in both cases the
+// token is stored in the context as "user" so the IsBlacklisted, IsReader,
+// IsManager and IsUpdater middleware can inspect its claims. API tokens are
+// also checked against the scope required for the resource. Requests with no
+// Authorization header can use a client certificate mapped to a user
+func Authenticate(settings types.APISettings, resource string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+
+			// Requests without a bearer token may be authenticated with a
+			// verified client certificate
+			if auth == "" && settings.ClientCertMapping != nil {
+				if cert := clientCertificate(c); cert != nil {
+					token, err := authenticateClientCert(settings.DB, settings.ClientCertMapping, cert)
+					if err != nil {
+						return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "client certificate does not map to a valid user", Internal: err}
+					}
+					c.Set("user", token)
+					return next(c)
+				}
+			}
+
+			if !strings.HasPrefix(auth, "Bearer ") || len(auth) <= len("Bearer ") {
+				return &echo.HTTPError{Code: http.StatusBadRequest, Message: "missing or malformed jwt"}
+			}
+			bearer := strings.TrimPrefix(auth, "Bearer ")
+
+			// Personal API tokens
+			if strings.HasPrefix(bearer, models.APITokenPrefix) {
+				token, err := authenticateAPIToken(settings.DB, bearer)
+				if err != nil {
+					return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "invalid or expired api token"}
+				}
+
+				scope := fmt.Sprintf("%s:write", resource)
+				if c.Request().Method == http.MethodGet || c.Request().Method == http.MethodHead {
+					scope = fmt.Sprintf("%s:read", resource)
+				}
+				if !hasScope(token, scope) {
+					return &echo.HTTPError{Code: http.StatusForbidden, Message: fmt.Sprintf("api token has no %s scope", scope)}
+				}
+
+				c.Set("user", token)
+				return next(c)
+			}
+
+			// JWT access tokens
+			token, err := jwt.Parse(bearer, signingKeys(settings).Keyfunc)
+			if err != nil || !token.Valid {
+				return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "invalid or expired jwt", Internal: err}
+			}
+
+			// Tokens issued to OIDC clients can't be used with the REST API
+			if !token.Claims.(jwt.MapClaims).VerifyAudience("api.glim.server", true) {
+				return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "invalid or expired jwt"}
+			}
+
+			c.Set("user", token)
+			return next(c)
+		}
+	}
+}
+
+// signingKeys returns the keys used to sign and verify JWT tokens. If no
+// key set has been configured tokens are signed with HS256 and the API secret
+func signingKeys(settings types.APISettings) *jwks.KeySet {
+	if settings.Keys != nil {
+		return settings.Keys
+	}
+	return jwks.NewHMACKeySet(settings.APISecret)
+}
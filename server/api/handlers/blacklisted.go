@@ -17,15 +17,29 @@ limitations under the License.
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/doncicuto/glim/models"
 	"github.com/doncicuto/glim/types"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
+// isCurrentGeneration checks that the token generation claim matches the user's
+// current generation. Tokens issued before generations existed have no claim
+// and are considered as generation 0
+func isCurrentGeneration(claims jwt.MapClaims, generation uint) bool {
+	gen, ok := claims["gen"].(float64)
+	if !ok {
+		return generation == 0
+	}
+	return uint(gen) == generation
+}
+
 // IsBlacklisted - TODO comment
-func IsBlacklisted(kv types.Store) echo.MiddlewareFunc {
+func IsBlacklisted(kv types.Store, db *gorm.DB) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if c.Get("user") == nil {
@@ -53,6 +67,32 @@ func IsBlacklisted(kv types.Store) echo.MiddlewareFunc {
 				}
 			}
 
+			// Tokens are no longer valid if the user has been deleted, locked
+			// or its tokens have been invalidated
+			uid, ok := claims["uid"].(float64)
+			if !ok {
+				return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "wrong token or missing info in token claims"}
+			}
+			var u models.User
+			if err := db.Where("id = ?", uint(uid)).Take(&u).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "token no longer valid"}
+				}
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+			}
+			if (u.Locked != nil && *u.Locked) || !isCurrentGeneration(claims, u.TokenGeneration) {
+				return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "token no longer valid"}
+			}
+
+			// Role middlewares must use the current roles, not the ones
+			// the user had when the token was issued
+			if _, ok := claims["manager"].(bool); ok {
+				claims["manager"] = u.Manager != nil && *u.Manager
+			}
+			if _, ok := claims["readonly"].(bool); ok {
+				claims["readonly"] = u.Readonly != nil && *u.Readonly
+			}
+
 			return next(c)
 		}
 	}
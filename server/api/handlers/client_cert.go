@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// clientCertificate returns the client certificate verified during the TLS
+// handshake or nil if the client didn't send one
+func clientCertificate(c echo.Context) *x509.Certificate {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// authenticateClientCert maps a verified client certificate to a Glim user
+// and returns a token with the same claims used by access tokens so role
+// middleware can be applied
+func authenticateClientCert(db *gorm.DB, mapping *clientcert.Mapping, cert *x509.Certificate) (*jwt.Token, error) {
+	var u models.User
+
+	identity, ok := mapping.Identity(cert)
+	if !ok {
+		return nil, errors.New("client certificate has no value for the mapping rule")
+	}
+
+	query := db.Where("username_folded = ?", models.FoldIdentity(identity))
+	if mapping.ByEmail() {
+		query = db.Where("email_folded = ?", models.FoldIdentity(identity))
+	}
+	if err := query.Take(&u).Error; err != nil {
+		return nil, err
+	}
+
+	if u.Locked != nil && *u.Locked {
+		return nil, errors.New("account is locked")
+	}
+
+	claims := jwt.MapClaims{}
+	claims["uid"] = float64(u.ID)
+	claims["jti"] = fmt.Sprintf("cert-%s", cert.SerialNumber.Text(16))
+	claims["gen"] = float64(u.TokenGeneration)
+	claims["manager"] = u.Manager != nil && *u.Manager
+	claims["readonly"] = u.Readonly != nil && *u.Readonly
+
+	return &jwt.Token{Claims: claims, Valid: true}, nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientCert(t *testing.T, cn string, emails []string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key - %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: cn},
+		EmailAddresses: emails,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate - %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate - %v", err)
+	}
+	return cert
+}
+
+func runClientCertTest(t *testing.T, e *echo.Echo, name string, method string, target string, body string, cert *x509.Certificate, expResCode int, expectedBodyJSON string) {
+	t.Run(name, func(t *testing.T) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Equal(t, expResCode, res.Code)
+		if expectedBodyJSON != "" {
+			assert.Equal(t, expectedBodyJSON, strings.TrimSuffix(res.Body.String(), "\n"))
+		}
+	})
+}
+
+func TestClientCert(t *testing.T) {
+	// Setup
+	h, _, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Client certificates common names are usernames
+	mapping, err := clientcert.ParseMapping("cn")
+	if err != nil {
+		t.Fatalf("could not parse mapping - %v", err)
+	}
+	settings.ClientCertMode = clientcert.ModeRequest
+	settings.ClientCertMapping = mapping
+	e := EchoServer(settings)
+
+	adminCert := newClientCert(t, "admin", nil)
+	saulCert := newClientCert(t, "saul", nil)
+	unknownCert := newClientCert(t, "walter", nil)
+
+	runClientCertTest(t, e, "request without certificate or token", http.MethodGet, "/v1/users/3", "", nil, http.StatusBadRequest, `{"message":"missing or malformed jwt"}`)
+	runClientCertTest(t, e, "certificate not mapped to a user", http.MethodGet, "/v1/users/3", "", unknownCert, http.StatusUnauthorized, `{"message":"client certificate does not map to a valid user"}`)
+	runClientCertTest(t, e, "plain user can read its account", http.MethodGet, "/v1/users/3", "", saulCert, http.StatusOK, "")
+	runClientCertTest(t, e, "plain user can't list users", http.MethodGet, "/v1/users", "", saulCert, http.StatusUnauthorized, `{"message":"user has no proper permissions"}`)
+	runClientCertTest(t, e, "plain user can't create groups", http.MethodPost, "/v1/groups", `{"name": "devel"}`, saulCert, http.StatusForbidden, `{"message":"user has no proper permissions"}`)
+	runClientCertTest(t, e, "manager can create groups", http.MethodPost, "/v1/groups", `{"name": "devel"}`, adminCert, http.StatusOK, "")
+
+	// Locked users can't use their certificates
+	h.DB.Exec("UPDATE users SET locked = ? WHERE username = ?", true, "saul")
+	runClientCertTest(t, e, "locked user", http.MethodGet, "/v1/users/3", "", saulCert, http.StatusUnauthorized, `{"message":"client certificate does not map to a valid user"}`)
+
+	// Email SANs matched with a regular expression
+	mapping, err = clientcert.ParseMapping(`email:^(.+)@services\.example\.org$`)
+	if err != nil {
+		t.Fatalf("could not parse mapping - %v", err)
+	}
+	settings.ClientCertMapping = mapping
+	e = EchoServer(settings)
+
+	kimCert := newClientCert(t, "Kim Wexler", []string{"kim@services.example.org"})
+	otherDomainCert := newClientCert(t, "kim", []string{"kim@example.com"})
+	runClientCertTest(t, e, "email mapped to username", http.MethodGet, "/v1/users/4", "", kimCert, http.StatusOK, "")
+	runClientCertTest(t, e, "email not matching the mapping", http.MethodGet, "/v1/users/4", "", otherDomainCert, http.StatusUnauthorized, `{"message":"client certificate does not map to a valid user"}`)
+}
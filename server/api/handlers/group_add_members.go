@@ -33,11 +33,12 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "Group ID"
-// @Param        members body models.GroupMembers  true  "Group members body. The members property expect a comma-separated list of usernames e.g 'bob,sally' to be added to the group"
+// @Param        members body models.GroupMembers  true  "Group members body. The members property expect a comma-separated list of usernames e.g 'bob,sally' and the member groups property a comma-separated list of group names to be added to the group"
 // @Success      200  {object}  models.GroupInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
 // @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
 // @Failure 	   500  {object} types.ErrorResponse
 // @Router       /groups/{id}/members [post]
 // @Security 		 Bearer
@@ -67,6 +68,15 @@ func (h *Handler) AddGroupMembers(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	// Nested groups can't create cycles
+	memberGroups := []*models.Group{}
+	if m.MemberGroups != "" {
+		memberGroups, err = h.FindMemberGroups(g, strings.Split(m.MemberGroups, ","))
+		if err != nil {
+			return memberGroupsError(err)
+		}
+	}
+
 	// Update group members
 	if m.Members != "" {
 		members := strings.Split(m.Members, ",")
@@ -76,9 +86,15 @@ func (h *Handler) AddGroupMembers(c echo.Context) error {
 		}
 	}
 
+	// Update nested groups
+	err = h.AddMemberGroups(g, memberGroups)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
 	// Get updated group
 	g = new(models.Group)
-	err = h.DB.Preload("Members").Model(&models.Group{}).Where("id = ?", gid).First(&g).Error
+	err = h.DB.Preload("Members").Preload("MemberGroups").Model(&models.Group{}).Where("id = ?", gid).First(&g).Error
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
@@ -36,7 +36,7 @@ func (h *Handler) AddMembers(g *models.Group, members []string) error {
 		member = strings.TrimSpace(member)
 		// Find user
 		user := new(models.User)
-		err = h.DB.Model(&models.User{}).Where("username = ?", member).Take(&user).Error
+		err = h.DB.Model(&models.User{}).Where("username_folded = ?", models.FoldIdentity(member)).Take(&user).Error
 		if err == nil {
 			// Append association
 			err = h.DB.Model(&g).Association("Members").Append(user)
@@ -48,13 +48,58 @@ func (h *Handler) AddMembers(g *models.Group, members []string) error {
 	return nil
 }
 
+// FindMemberGroups - finds the groups that will be nested in a group.
+// Unknown groups are skipped like unknown usernames and models.ErrGroupCycle
+// is returned if a group would become a member of itself
+func (h *Handler) FindMemberGroups(g *models.Group, memberGroups []string) ([]*models.Group, error) {
+	groups := []*models.Group{}
+	for _, name := range memberGroups {
+		name = strings.TrimSpace(name)
+		if g.Name != nil && models.FoldIdentity(name) == models.FoldIdentity(*g.Name) {
+			return nil, models.ErrGroupCycle
+		}
+
+		// Find group
+		group := new(models.Group)
+		err := h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(name)).Take(&group).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		if err := g.CheckMemberGroup(h.DB, group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// AddMemberGroups - TODO comment
+func (h *Handler) AddMemberGroups(g *models.Group, memberGroups []*models.Group) error {
+	if len(memberGroups) == 0 {
+		return nil
+	}
+	return h.DB.Model(&g).Association("MemberGroups").Append(memberGroups)
+}
+
+// memberGroupsError - returns the HTTP error for a nested groups error
+func memberGroupsError(err error) *echo.HTTPError {
+	if errors.Is(err, models.ErrGroupCycle) {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: err.Error()}
+	}
+	return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+}
+
 // SaveGroup - TODO comment
 // @Summary      Create a new group
 // @Description  Create a new group
 // @Tags         groups
 // @Accept       json
 // @Produce      json
-// @Param        group body models.JSONGroupBody  true  "Group body. Name is required. The members property expect a comma-separated list of usernames e.g 'bob,sally'. The replace property is not used in this command."
+// @Param        group body models.JSONGroupBody  true  "Group body. Name is required. The members property expect a comma-separated list of usernames e.g 'bob,sally'. The member groups property expect a comma-separated list of group names to be nested in the group. The gid number property is optional, if not set it is allocated from the configured range. The attributes property sets the values of custom attributes by attribute name. The replace property is not used in this command."
 // @Success      200  {object}  models.GroupInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -102,12 +147,24 @@ func (h *Handler) SaveGroup(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "Apache Guacamole config protocol is required"}
 	}
 
+	if body.GIDNumber != nil && *body.GIDNumber == 0 {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "gid number must be greater than 0"}
+	}
+
 	// Check if group already exists
-	err := h.DB.Where("name = ?", body.Name).First(&g).Error
+	err := h.DB.Where("name_folded = ?", models.FoldIdentity(body.Name)).First(&g).Error
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "group already exists"}
 	}
 
+	// Check if gid number is already in use
+	if body.GIDNumber != nil {
+		err = h.DB.Model(&models.Group{}).Where("gid_number = ?", *body.GIDNumber).First(&models.Group{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "gid number already exists"}
+		}
+	}
+
 	// Prepare new UUID
 	groupUUID := uuid.New().String()
 	g.UUID = &groupUUID
@@ -120,6 +177,27 @@ func (h *Handler) SaveGroup(c echo.Context) error {
 	g.GuacamoleConfigProtocol = &body.GuacamoleConfigProtocol
 	g.GuacamoleConfigParameters = &body.GuacamoleConfigParameters
 
+	// Two-factor authentication required for members
+	g.RequireMFA = body.RequireMFA
+
+	// POSIX gid number, allocated when the group is created if not set
+	g.GIDNumber = body.GIDNumber
+
+	// Nested groups
+	memberGroups := []*models.Group{}
+	if body.MemberGroups != "" {
+		memberGroups, err = h.FindMemberGroups(g, strings.Split(body.MemberGroups, ","))
+		if err != nil {
+			return memberGroupsError(err)
+		}
+	}
+
+	// Custom attributes
+	changes, err := models.PrepareAttributeChanges(h.DB, body.Attributes, models.AttributeForGroups)
+	if err != nil {
+		return attributesError(err)
+	}
+
 	// Created by
 	g.CreatedBy = createdBy.Username
 	g.UpdatedBy = createdBy.Username
@@ -139,6 +217,21 @@ func (h *Handler) SaveGroup(c echo.Context) error {
 		}
 	}
 
+	// Add nested groups to group
+	err = h.AddMemberGroups(g, memberGroups)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// Add custom attributes
+	if err := models.ApplyAttributeChanges(h.DB, changes, nil, &g.ID); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	g.Attributes, err = h.attributeValues("group_id", g.ID)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
 	// Send group information
 	showMembers := true
 	i := models.GetGroupInfo(g, showMembers, h.Guacamole)
@@ -22,7 +22,7 @@ func TestGroupGuacamoleCreate(t *testing.T) {
 			reqMethod:        http.MethodPost,
 			secret:           adminToken,
 			reqBodyJSON:      `{"name": "devel", "description": "Developers", "guac_config_protocol": "vnc", "guac_config_parameters": "host=192.168.1.131"}`,
-			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"vnc","guac_config_parameters":"host=192.168.1.131"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"vnc","guac_config_parameters":"host=192.168.1.131","gid_number":30000}`,
 		},
 		{
 			name:             "group can't be created with missing Guacamole settings",
@@ -55,6 +55,18 @@ func (h *Handler) DeleteGroup(c echo.Context) error {
 	}
 
 	err = h.DB.Model(&g).Where("id = ?", gid).Take(&g).Delete(&g).Error
+	if err == nil {
+		// Remove the group from the group hierarchy
+		err = g.RemoveFromNestedGroups(h.DB)
+	}
+	if err == nil {
+		// Remove group custom attributes
+		err = h.DB.Where("group_id = ?", g.ID).Delete(&models.AttributeValue{}).Error
+	}
+	if err == nil {
+		// Service accounts restricted to this group can't search it anymore
+		err = h.DB.Exec("DELETE FROM service_account_groups WHERE group_id = ?", g.ID).Error
+	}
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNestedGroups(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:             "group devel is created",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "devel", "description": "Developers", "members": "saul"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}`,
+		},
+		{
+			name:             "group staff is created with devel nested",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "staff", "description": "Staff", "members": "kim", "member_groups": "devel"}`,
+			expectedBodyJSON: `{"gid":2,"name":"staff","description":"Staff","members":[{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"}],"member_groups":[{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30001}`,
+		},
+		{
+			name:             "group can't be nested in itself",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "all", "description": "Everyone", "member_groups": "staff,all"}`,
+			expectedBodyJSON: `{"message":"group membership would create a cycle"}`,
+		},
+		{
+			name:             "group all is created with staff nested",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"name": "all", "description": "Everyone", "member_groups": "staff"}`,
+			expectedBodyJSON: `{"gid":3,"name":"all","description":"Everyone","member_groups":[{"gid":2,"name":"staff","description":"Staff","guac_config_protocol":"","guac_config_parameters":"","gid_number":30001}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30002}`,
+		},
+		{
+			name:             "nesting all in devel creates a cycle",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/groups/1",
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			reqBodyJSON:      `{"member_groups": "all"}`,
+			expectedBodyJSON: `{"message":"group membership would create a cycle"}`,
+		},
+		{
+			name:             "adding devel to itself creates a cycle",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/groups/1/members",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			reqBodyJSON:      `{"members": "", "member_groups": "devel"}`,
+			expectedBodyJSON: `{"message":"group membership would create a cycle"}`,
+		},
+		{
+			name:             "saul is only a direct member of devel",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"memberOf":[{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}],"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
+		},
+		{
+			name:             "saul is a transitive member of devel, staff and all",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3?transitive=true",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"memberOf":[{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000},{"gid":2,"name":"staff","description":"Staff","guac_config_protocol":"","guac_config_parameters":"","gid_number":30001},{"gid":3,"name":"all","description":"Everyone","guac_config_protocol":"","guac_config_parameters":"","gid_number":30002}],"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
+		},
+		{
+			name:             "all has saul and kim as transitive members",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups/3?transitive=true",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"gid":3,"name":"all","description":"Everyone","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"}],"member_groups":[{"gid":2,"name":"staff","description":"Staff","guac_config_protocol":"","guac_config_parameters":"","gid_number":30001}],"guac_config_protocol":"","guac_config_parameters":"","gid_number":30002}`,
+		},
+		{
+			name:        "devel is removed from staff",
+			expResCode:  http.StatusNoContent,
+			reqURL:      "/v1/groups/2/members",
+			reqMethod:   http.MethodDelete,
+			secret:      adminToken,
+			reqBodyJSON: `{"members": "", "member_groups": "devel"}`,
+		},
+		{
+			name:             "saul is no longer a transitive member of staff and all",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/3?transitive=true",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"memberOf":[{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"","guac_config_parameters":"","gid_number":30000}],"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
+		},
+		{
+			name:       "group staff is deleted",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/groups/2",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "all has no nested groups left",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups/3",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"gid":3,"name":"all","description":"Everyone","guac_config_protocol":"","guac_config_parameters":"","gid_number":30002}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+}
@@ -26,13 +26,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// transitive - checks if the transitive query param asks for the members
+// or memberships obtained through nested groups
+func transitive(c echo.Context) bool {
+	t, _ := strconv.ParseBool(c.QueryParam("transitive"))
+	return t
+}
+
 // FindGroupByID - TODO comment
 // @Summary      Find group by id
-// @Description  Find group by id
+// @Description  Find group by id. If transitive is true, members include the members of the nested groups
 // @Tags         groups
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "Group ID"
+// @Param        transitive   query      bool  false  "Include members of nested groups"
 // @Success      200  {object}  models.GroupInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -45,7 +53,7 @@ func (h *Handler) FindGroupByID(c echo.Context) error {
 	var err error
 	gid := c.Param("gid")
 
-	err = h.DB.Preload("Members").Model(&models.Group{}).Where("id = ?", gid).Take(&g).Error
+	err = preloadAttributes(h.DB).Preload("Members").Preload("MemberGroups").Model(&models.Group{}).Where("id = ?", gid).Take(&g).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &echo.HTTPError{Code: http.StatusNotFound, Message: "group not found"}
@@ -53,6 +61,15 @@ func (h *Handler) FindGroupByID(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	if transitive(c) {
+		g.Members, err = models.TransitiveMembers(h.DB, &g)
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+	}
+
+	g.Attributes = visibleAttributes(c, g.Attributes)
+
 	showMembers := true
 	i := models.GetGroupInfo(&g, showMembers, h.Guacamole)
 	return c.JSON(http.StatusOK, i)
@@ -78,7 +95,7 @@ func (h *Handler) FindGIDFromGroupName(c echo.Context) error {
 	var err error
 	group := c.Param("group")
 
-	err = h.DB.Model(&models.Group{}).Where("name = ?", group).Take(&g).Error
+	err = h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(group)).Take(&g).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &echo.HTTPError{Code: http.StatusNotFound, Message: "group not found"}
@@ -92,10 +109,11 @@ func (h *Handler) FindGIDFromGroupName(c echo.Context) error {
 
 // FindAllGroups - TODO comment
 // @Summary      Find all groups
-// @Description  Find all groups
+// @Description  Find all groups. If transitive is true, members include the members of the nested groups
 // @Tags         groups
 // @Accept       json
 // @Produce      json
+// @Param        transitive   query      bool  false  "Include members of nested groups"
 // @Success      200  {object}  models.GroupInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -116,8 +134,9 @@ func (h *Handler) FindAllGroups(c echo.Context) error {
 
 	// Retrieve groups from database
 	groups := []models.Group{}
-	if err := h.DB.
+	if err := preloadAttributes(h.DB).
 		Preload("Members").
+		Preload("MemberGroups").
 		Model(&models.Group{}).
 		Offset((page - 1) * limit).
 		Limit(limit).
@@ -132,6 +151,14 @@ func (h *Handler) FindAllGroups(c echo.Context) error {
 	var allGroups []models.GroupInfo
 	showMembers := true
 	for _, group := range groups {
+		if transitive(c) {
+			members, err := models.TransitiveMembers(h.DB, &group)
+			if err != nil {
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+			}
+			group.Members = members
+		}
+		group.Attributes = visibleAttributes(c, group.Attributes)
 		allGroups = append(allGroups, *models.GetGroupInfo(&group, showMembers, h.Guacamole))
 	}
 
@@ -23,7 +23,7 @@ func TestGroupGuacamoleRead(t *testing.T) {
 			reqMethod:        http.MethodPost,
 			secret:           adminToken,
 			reqBodyJSON:      `{"name": "devel", "description": "Developers", "members":"saul", "guac_config_protocol":"vnc", "guac_config_parameters":"host=localhost"}`,
-			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost","gid_number":30000}`,
 		},
 		{
 			name:             "readonly user can see a Guacamole group detail by its gid",
@@ -31,7 +31,7 @@ func TestGroupGuacamoleRead(t *testing.T) {
 			reqURL:           "/v1/groups/1",
 			reqMethod:        http.MethodGet,
 			secret:           searchToken,
-			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}],"guac_config_protocol":"vnc","guac_config_parameters":"host=localhost","gid_number":30000}`,
 		},
 	}
 
@@ -34,7 +34,7 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "Group ID"
-// @Param        members body models.GroupMembers  true  "Group members body. The members property expect a comma-separated list of usernames e.g 'bob,sally' to be removed from the group"
+// @Param        members body models.GroupMembers  true  "Group members body. The members property expect a comma-separated list of usernames e.g 'bob,sally' and the member groups property a comma-separated list of group names to be removed from the group"
 // @Success      204
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -75,7 +75,7 @@ func (h *Handler) RemoveGroupMembers(c echo.Context) error {
 
 		// Find user
 		u := new(models.User)
-		err = h.DB.Model(&models.User{}).Where("username = ?", member).Take(&u).Error
+		err = h.DB.Model(&models.User{}).Where("username_folded = ?", models.FoldIdentity(member)).Take(&u).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				continue
@@ -90,6 +90,28 @@ func (h *Handler) RemoveGroupMembers(c echo.Context) error {
 		}
 	}
 
+	// Remove nested groups
+	if m.MemberGroups != "" {
+		for _, name := range strings.Split(m.MemberGroups, ",") {
+
+			// Find group
+			memberGroup := new(models.Group)
+			err = h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(strings.TrimSpace(name))).Take(&memberGroup).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+			}
+
+			// Delete association
+			err = h.DB.Model(&g).Association("MemberGroups").Delete(memberGroup)
+			if err != nil {
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: fmt.Sprintf("could not remove member group from group. Error: %v", err)}
+			}
+		}
+	}
+
 	// Return 204
 	return c.NoContent(http.StatusNoContent)
 }
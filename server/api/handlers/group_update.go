@@ -37,7 +37,7 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "Group ID"
-// @Param        group body models.JSONGroupBody  true  "Group body. All properties are optional. The members property expect a comma-separated list of usernames e.g 'bob,sally'. The replace property if true will replace all members by those selected by the members property, if replace is false the member will be added to current members."
+// @Param        group body models.JSONGroupBody  true  "Group body. All properties are optional. The members property expect a comma-separated list of usernames e.g 'bob,sally'. The member groups property expect a comma-separated list of group names to be nested in the group. The replace property if true will replace all members by those selected by the members and member groups properties, if replace is false the members will be added to current members. The attributes property replaces the values of the custom attributes it has, an empty list removes an attribute."
 // @Success      200  {object}  models.UserInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -94,7 +94,7 @@ func (h *Handler) UpdateGroup(c echo.Context) error {
 
 	// Validate other fields
 	if body.Name != "" {
-		err := h.DB.Model(&models.Group{}).Where("name = ? AND id <> ?", body.Name, gid).First(&models.Group{}).Error
+		err := h.DB.Model(&models.Group{}).Where("name_folded = ? AND id <> ?", models.FoldIdentity(body.Name), gid).First(&models.Group{}).Error
 		if err != nil {
 			// Does group name exist?
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -126,12 +126,56 @@ func (h *Handler) UpdateGroup(c echo.Context) error {
 		modifiedBy["guacamole_config_parameters"] = html.EscapeString(strings.TrimSpace(body.GuacamoleConfigParameters))
 	}
 
+	if body.RequireMFA != nil {
+		modifiedBy["require_mfa"] = *body.RequireMFA
+	}
+
+	if body.GIDNumber != nil {
+		if *body.GIDNumber == 0 {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "gid number must be greater than 0"}
+		}
+		err := h.DB.Model(&models.Group{}).Where("gid_number = ? AND id <> ?", *body.GIDNumber, gid).First(&models.Group{}).Error
+		if err == nil {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "gid number cannot be duplicated"}
+		}
+		modifiedBy["gid_number"] = *body.GIDNumber
+	}
+
+	// Nested groups can't create cycles
+	memberGroups := []*models.Group{}
+	if body.MemberGroups != "" {
+		memberGroups, err = h.FindMemberGroups(g, strings.Split(body.MemberGroups, ","))
+		if err != nil {
+			return memberGroupsError(err)
+		}
+	}
+
+	// Custom attributes
+	changes, err := models.PrepareAttributeChanges(h.DB, body.Attributes, models.AttributeForGroups)
+	if err != nil {
+		return attributesError(err)
+	}
+
 	// New update date
 	modifiedBy["updated_at"] = time.Now()
 	modifiedBy["updated_by"] = *u.Username
 
-	// Update group
-	if err := h.DB.Model(&models.Group{}).Where("id = ?", gid).Updates(modifiedBy).Error; err != nil {
+	// Update group, a gidNumber chosen by a manager is reserved along with it
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Group{}).Where("id = ?", gid).Updates(modifiedBy).Error; err != nil {
+			return err
+		}
+		if body.GIDNumber != nil {
+			return models.ReserveGIDNumber(tx, *body.GIDNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	groupID := uint32(gid)
+	if err := models.ApplyAttributeChanges(h.DB, changes, nil, &groupID); err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
@@ -162,9 +206,25 @@ func (h *Handler) UpdateGroup(c echo.Context) error {
 		}
 	}
 
+	// Update nested groups
+	if body.MemberGroups != "" {
+		if body.ReplaceMembers {
+			// We are going to replace all nested groups, so let's clear the associations first
+			err := h.DB.Model(&g).Association("MemberGroups").Clear()
+			if err != nil {
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+			}
+		}
+
+		err := h.AddMemberGroups(g, memberGroups)
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+	}
+
 	// Get updated group
 	g = new(models.Group)
-	if err := h.DB.Preload("Members").Model(&models.Group{}).Where("id = ?", gid).First(&g).Error; err != nil {
+	if err := preloadAttributes(h.DB).Preload("Members").Preload("MemberGroups").Model(&models.Group{}).Where("id = ?", gid).First(&g).Error; err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
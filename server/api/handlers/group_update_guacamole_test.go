@@ -22,7 +22,7 @@ func TestGroupGuacamoleUpdate(t *testing.T) {
 			reqMethod:        http.MethodPost,
 			secret:           adminToken,
 			reqBodyJSON:      `{"name": "devel", "description": "Developers", "guac_config_protocol": "vnc", "guac_config_parameters": "host=192.168.1.131"}`,
-			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"vnc","guac_config_parameters":"host=192.168.1.131"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"vnc","guac_config_parameters":"host=192.168.1.131","gid_number":30000}`,
 		},
 		{
 			name:             "group devel Guacamole settings can be updated",
@@ -31,7 +31,7 @@ func TestGroupGuacamoleUpdate(t *testing.T) {
 			reqMethod:        http.MethodPut,
 			secret:           adminToken,
 			reqBodyJSON:      `{"name": "devel", "description": "Developers", "guac_config_protocol": "ssh", "guac_config_parameters": "host=localhost"}`,
-			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"ssh","guac_config_parameters":"host=localhost"}`,
+			expectedBodyJSON: `{"gid":1,"name":"devel","description":"Developers","guac_config_protocol":"ssh","guac_config_parameters":"host=localhost","gid_number":30000}`,
 		},
 		{
 			name:             "group can be created without Guacamole settings",
@@ -40,7 +40,7 @@ func TestGroupGuacamoleUpdate(t *testing.T) {
 			reqMethod:        http.MethodPost,
 			secret:           adminToken,
 			reqBodyJSON:      `{"name": "admin", "description": "Admins"}`,
-			expectedBodyJSON: `{"gid":2,"name":"admin","description":"Admins","guac_config_protocol":"","guac_config_parameters":""}`,
+			expectedBodyJSON: `{"gid":2,"name":"admin","description":"Admins","guac_config_protocol":"","guac_config_parameters":"","gid_number":30001}`,
 		},
 		{
 			name:             "group devel Guacamole settings can't be updated without protocol",
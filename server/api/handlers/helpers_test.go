@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/doncicuto/glim/models"
 	"github.com/doncicuto/glim/server/db"
 	"github.com/doncicuto/glim/server/kv/badgerdb"
 	"github.com/doncicuto/glim/types"
@@ -31,12 +32,27 @@ func newTestDatabase() (*gorm.DB, error) {
 	var dbInit = types.DBInit{
 		AdminPasswd:   "test",
 		SearchPasswd:  "test",
-		Users:         "saul,kim,mike",
+		Users:         "search,saul,kim,mike",
 		DefaultPasswd: "test",
 		UseSqlite:     true,
 	}
 	sqlLog := false
-	return db.Initialize("/tmp/test.db", sqlLog, dbInit)
+	newDb, err := db.Initialize("/tmp/test.db", sqlLog, dbInit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The search bind account is a service account, tests use a readonly
+	// user with the same name to cover the read-only role
+	err = newDb.Model(&models.User{}).Where("username = ?", "search").Updates(map[string]interface{}{
+		"given_name": "Read-Only",
+		"surname":    "Account",
+		"readonly":   true,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return newDb, nil
 }
 
 func newTestKV() (badgerdb.Store, error) {
@@ -100,7 +116,11 @@ func runTests(t *testing.T, tc RestTestCase, e *echo.Echo) {
 }
 
 func getUserTokens(username string, h *Handler, e *echo.Echo, settings types.APISettings) (string, string) {
-	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"username": "%s", "password": "test"}`, username)))
+	return getUserTokensWithPassword(username, "test", h, e, settings)
+}
+
+func getUserTokensWithPassword(username string, password string, h *Handler, e *echo.Echo, settings types.APISettings) (string, string) {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"username": "%s", "password": "%s"}`, username, password)))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	res := httptest.NewRecorder()
 	c := e.NewContext(req, res)
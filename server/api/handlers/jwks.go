@@ -0,0 +1,36 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/doncicuto/glim/types"
+	"github.com/labstack/echo/v4"
+)
+
+// JWKS - TODO comment
+// @Summary      Get JSON Web Key Set
+// @Description  Get the public keys that can be used to verify the tokens signed by Glim. The set is empty when tokens are signed with HS256
+// @Tags         authentication
+// @Produce      json
+// @Success      200  {object}  jwks.JSONWebKeySet
+// @Router       /.well-known/jwks.json [get]
+func (h *Handler) JWKS(c echo.Context, settings types.APISettings) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, signingKeys(settings).JWKS())
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/server/jwks"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKS(t *testing.T) {
+	for _, algorithm := range []string{jwks.RS256, jwks.ES256, jwks.EdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			// Setup
+			h, _, settings := testSetup(t, false)
+			defer testCleanUp()
+
+			dir := "/tmp/" + uuid.New().String() + "-jwt-keys"
+			defer os.RemoveAll(dir)
+
+			keys, err := jwks.NewKeySet(algorithm, dir, settings.APISecret, time.Hour)
+			if err != nil {
+				t.Fatalf("could not create key set - %v", err)
+			}
+			settings.Keys = keys
+			e := EchoServer(settings)
+
+			// Tokens are signed with the current key
+			adminToken, _ := getUserTokens("admin", h, e, settings)
+			token, _ := jwt.Parse(adminToken, nil)
+			assert.Equal(t, algorithm, token.Header["alg"])
+			assert.Equal(t, keys.Current().ID, token.Header["kid"])
+
+			// and accepted by the REST API
+			runTests(t, RestTestCase{
+				name:       "token signed with current key is accepted",
+				expResCode: http.StatusOK,
+				reqURL:     "/v1/users/1",
+				reqMethod:  http.MethodGet,
+				secret:     adminToken,
+			}, e)
+
+			// HS256 tokens signed with the API secret are no longer accepted
+			hmacSettings := settings
+			hmacSettings.Keys = nil
+			hmacToken, _ := getUserTokens("admin", h, e, hmacSettings)
+			runTests(t, RestTestCase{
+				name:             "token signed with api secret is rejected",
+				expResCode:       http.StatusUnauthorized,
+				reqURL:           "/v1/users/1",
+				reqMethod:        http.MethodGet,
+				secret:           hmacToken,
+				expectedBodyJSON: `{"message":"invalid or expired jwt"}`,
+			}, e)
+
+			// Rotation keeps the previous key for verification
+			previous := keys.Current().ID
+			time.Sleep(time.Second)
+			if _, err := keys.Rotate(); err != nil {
+				t.Fatalf("could not rotate key - %v", err)
+			}
+			assert.NotEqual(t, previous, keys.Current().ID)
+
+			runTests(t, RestTestCase{
+				name:       "token signed with retired key is accepted",
+				expResCode: http.StatusOK,
+				reqURL:     "/v1/users/1",
+				reqMethod:  http.MethodGet,
+				secret:     adminToken,
+			}, e)
+
+			// Both keys are published
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusOK, res.Code)
+
+			set := jwks.JSONWebKeySet{}
+			json.Unmarshal(res.Body.Bytes(), &set)
+			assert.Equal(t, 2, len(set.Keys))
+			assert.Equal(t, previous, set.Keys[0].Kid)
+			assert.Equal(t, keys.Current().ID, set.Keys[1].Kid)
+			assert.Equal(t, algorithm, set.Keys[1].Alg)
+
+			// Keys are read from the keys directory
+			reloaded, err := jwks.NewKeySet(algorithm, dir, settings.APISecret, time.Hour)
+			if err != nil {
+				t.Fatalf("could not reload key set - %v", err)
+			}
+			assert.Equal(t, keys.Current().ID, reloaded.Current().ID)
+			assert.Equal(t, 2, len(reloaded.Keys()))
+
+			// Retired keys are removed once their tokens have expired
+			expired, err := jwks.NewKeySet(algorithm, dir, settings.APISecret, 0)
+			if err != nil {
+				t.Fatalf("could not reload key set - %v", err)
+			}
+			assert.Equal(t, 1, len(expired.Keys()))
+			assert.Equal(t, keys.Current().ID, expired.Current().ID)
+		})
+	}
+}
+
+func TestJWKSWithHS256(t *testing.T) {
+	// Setup
+	_, e, _ := testSetup(t, false)
+	defer testCleanUp()
+
+	runTests(t, RestTestCase{
+		name:             "no keys are published with HS256",
+		expResCode:       http.StatusOK,
+		reqURL:           "/.well-known/jwks.json",
+		reqMethod:        http.MethodGet,
+		expectedBodyJSON: `{"keys":[]}`,
+	}, e)
+}
@@ -21,6 +21,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/doncicuto/glim/server/ratelimit"
+	"github.com/doncicuto/glim/server/totp"
 	"github.com/doncicuto/glim/types"
 	"gorm.io/gorm"
 
@@ -36,37 +38,23 @@ import (
 // @Tags         authentication
 // @Accept       json
 // @Produce      json
-// @Param        authentication  body types.LoginBody  true  "Username and password"
+// @Param        authentication  body types.LoginBody  true  "Username, password and TOTP code if two-factor authentication is enabled"
 // @Success      200  {object}  types.TokenAuthentication
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
+// @Failure			 429  {object} types.ErrorResponse
 // @Failure 	   500  {object} types.ErrorResponse
 // @Router       /login [post]
 func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
-	var dbUser models.User
-
-	// Parse username and password from body
-	u := new(models.User)
-	if err := c.Bind(u); err != nil {
+	// Parse username, password and optional TOTP code from body
+	body := new(types.LoginBody)
+	if err := c.Bind(body); err != nil {
 		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "could not bind json body to user model"}
 	}
-	username := *u.Username
-	password := *u.Password
-
-	// Check if user exists
-	err := h.DB.Where("username = ?", username).First(&dbUser).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
-	}
 
-	// Check if account is locked
-	if *dbUser.Locked {
-		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
-	}
-
-	// Check if passwords match
-	if err := models.VerifyPassword(*dbUser.Password, password); err != nil {
-		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
+	dbUser, httpErr := h.authenticateUser(c, settings, body.Username, body.Password, body.TOTPCode)
+	if httpErr != nil {
+		return httpErr
 	}
 
 	// Access token expiry times
@@ -82,6 +70,8 @@ func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
 	cc["uid"] = dbUser.ID
 	cc["iat"] = time.Now().Unix()
 	cc["exp"] = atExpiresOn
+	cc["sid"] = uuid.New().String()
+	cc["gen"] = dbUser.TokenGeneration
 
 	// Create access claims and token
 	ajti := uuid.New() // token id
@@ -89,9 +79,7 @@ func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
 	ac["jti"] = ajti
 	ac["manager"] = dbUser.Manager
 	ac["readonly"] = dbUser.Readonly
-	t := jwt.New(jwt.SigningMethodHS256)
-	t.Claims = ac
-	at, err := t.SignedString([]byte(settings.APISecret))
+	at, err := signingKeys(settings).Sign(ac)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not create access token"}
 	}
@@ -113,9 +101,7 @@ func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
 	rc["ajti"] = ajti
 	rc["exp"] = time.Now().Add(rtExpiresIn).Unix()
 
-	t = jwt.New(jwt.SigningMethodHS256)
-	t.Claims = rc
-	rt, err := t.SignedString([]byte(settings.APISecret))
+	rt, err := signingKeys(settings).Sign(rc)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not create access token"}
 	}
@@ -126,6 +112,23 @@ func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add refresh token to key-value store"}
 	}
 
+	// Track session, the client address is taken from trusted sources
+	// only (see ipExtractor) so clients can't forge it
+	now := time.Now()
+	err = h.saveSession(types.Session{
+		ID:            cc["sid"].(string),
+		UID:           dbUser.ID,
+		IP:            c.RealIP(),
+		UserAgent:     c.Request().UserAgent(),
+		CreatedAt:     now,
+		LastRefreshAt: now,
+		JTI:           rjti.String(),
+		AJTI:          ajti.String(),
+	}, rtExpiresIn)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add session to key-value store"}
+	}
+
 	// Create response with access and refresh tokens
 	tokenAuth := types.TokenAuthentication{}
 	tokenAuth.AccessToken = at
@@ -136,3 +139,75 @@ func (h *Handler) Login(c echo.Context, settings types.APISettings) error {
 
 	return c.JSON(http.StatusOK, tokenAuth)
 }
+
+// authenticateUser checks a user's password and, if two-factor authentication
+// is enabled, its TOTP code. It's shared by the REST API and OIDC logins.
+// Failed attempts are throttled by source IP and username
+func (h *Handler) authenticateUser(c echo.Context, settings types.APISettings, username string, password string, totpCode string) (*models.User, *echo.HTTPError) {
+	keys := []string{ratelimit.IPKey(c.RealIP()), ratelimit.UserKey(username)}
+	if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+		return nil, tooManyAttempts(c, wait)
+	}
+
+	dbUser, httpErr := h.checkCredentials(c, settings, username, password, totpCode)
+
+	// Asking for the TOTP code is not a failed attempt
+	if httpErr != nil && httpErr.Message != types.TOTPCodeRequired {
+		settings.RateLimiter.Fail(keys...)
+	}
+	return dbUser, httpErr
+}
+
+// checkCredentials checks the password and TOTP code of a user
+func (h *Handler) checkCredentials(c echo.Context, settings types.APISettings, username string, password string, totpCode string) (*models.User, *echo.HTTPError) {
+	var dbUser models.User
+
+	// Check if user exists
+	err := h.DB.Preload("MemberOf").Where("username_folded = ?", models.FoldIdentity(username)).First(&dbUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
+	}
+
+	// Check if account is locked
+	if *dbUser.Locked {
+		return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
+	}
+
+	// Check if passwords match
+	if err := models.VerifyPassword(*dbUser.Password, password); err != nil {
+		return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong username or password"}
+	}
+
+	// Upgrade stored password hash if our hashing policy has changed
+	if models.NeedsRehash(*dbUser.Password) {
+		if hash, err := models.Hash(password); err == nil {
+			if err := h.DB.Model(&models.User{}).Where("id = ?", dbUser.ID).Update("password", string(hash)).Error; err != nil {
+				c.Logger().Printf("could not upgrade password hash of user %d: %v", dbUser.ID, err)
+			}
+		}
+	}
+
+	// Users created before SASL SCRAM-SHA-256 was available get their
+	// credentials the first time they log in with their password
+	if dbUser.ScramSHA256 == nil || *dbUser.ScramSHA256 == "" {
+		if scram, err := models.ScramSHA256(password); err == nil {
+			if err := h.DB.Model(&models.User{}).Where("id = ?", dbUser.ID).Update("scram_sha256", scram).Error; err != nil {
+				c.Logger().Printf("could not store SCRAM credentials of user %d: %v", dbUser.ID, err)
+			}
+		}
+	}
+
+	// Check two-factor authentication
+	if totp.Enabled(&dbUser) {
+		if totpCode == "" {
+			return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: types.TOTPCodeRequired}
+		}
+		if err := totp.Verify(h.DB, h.KV, settings.TOTPSecretKey, &dbUser, totpCode); err != nil {
+			return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: "wrong two-factor authentication code"}
+		}
+	} else if totp.Required(&dbUser) {
+		return nil, &echo.HTTPError{Code: http.StatusUnauthorized, Message: "two-factor authentication is required for this account, please contact a manager to enroll"}
+	}
+
+	return &dbUser, nil
+}
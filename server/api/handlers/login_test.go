@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
 )
 
 func TestLogin(t *testing.T) {
@@ -66,3 +70,63 @@ func TestLogin(t *testing.T) {
 		runTests(t, tc, e)
 	}
 }
+
+func TestLoginRehash(t *testing.T) {
+	// Setup
+	h, e, _ := testSetup(t, false)
+	defer testCleanUp()
+
+	// Switch to argon2id and upgrade hashes on login
+	err := models.ConfigureHasher(types.PasswordHashSettings{
+		Algorithm:     models.Argon2idAlgorithm,
+		Argon2Memory:  1024,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+		RehashOnLogin: true,
+	})
+	if err != nil {
+		t.Fatalf("could not configure hasher - %v", err)
+	}
+	defer models.ConfigureHasher(types.PasswordHashSettings{})
+
+	testCases := []RestTestCase{
+		{
+			name:        "Login with bcrypt hash kim",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "kim", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:        "Login with upgraded argon2id hash kim",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "kim", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:        "Wrong password with argon2id hash kim",
+			expResCode:  http.StatusUnauthorized,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "kim", "password": "boooo"}`,
+			reqMethod:   http.MethodPost,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	var kim models.User
+	if err := h.DB.Where("username = ?", "kim").Take(&kim).Error; err != nil {
+		t.Fatalf("could not find user - %v", err)
+	}
+	if !strings.HasPrefix(*kim.Password, "$argon2id$") {
+		t.Fatalf("password hash was not upgraded to argon2id")
+	}
+
+	// Upgraded hash already uses the configured parameters
+	if models.NeedsRehash(*kim.Password) {
+		t.Fatalf("upgraded hash should not need a rehash")
+	}
+}
@@ -47,9 +47,7 @@ func (h *Handler) Logout(c echo.Context, settings types.APISettings) error {
 
 	// Get refresh token claims
 	claims := make(jwt.MapClaims)
-	token, err := jwt.ParseWithClaims(tokens.RefreshToken, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(settings.APISecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokens.RefreshToken, claims, signingKeys(settings).Keyfunc)
 
 	// Extract access token jti
 	ajti, ok := claims["ajti"].(string)
@@ -88,6 +86,13 @@ func (h *Handler) Logout(c echo.Context, settings types.APISettings) error {
 		if err != nil {
 			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not store access token info"}
 		}
+
+		// Remove session
+		if sid, ok := claims["sid"].(string); ok {
+			if uid, ok := claims["uid"].(float64); ok {
+				h.KV.Delete(sessionKey(uint32(uid), sid))
+			}
+		}
 	}
 
 	return c.NoContent(http.StatusNoContent)
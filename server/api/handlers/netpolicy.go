@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// ipExtractor returns how we get the address of a client. We use the peer
+// connected to us unless it's a trusted proxy, then the X-Forwarded-For
+// header it adds is used. Headers sent by other clients are ignored as they
+// could forge them
+func ipExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, network := range trustedProxies {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// NetworkPolicy rejects requests from networks not allowed to perform an
+// operation. The client address is taken from trusted sources only, see
+// ipExtractor
+func NetworkPolicy(policies netpolicy.Policies, operation string) echo.MiddlewareFunc {
+	policy := policies.Operation(operation)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			addr := c.RealIP()
+			if !policy.Allows(addr) {
+				c.Logger().Printf("%s request %s %s rejected by network policy client %s", operation, c.Request().Method, c.Request().URL.Path, netpolicy.Host(addr))
+				return &echo.HTTPError{Code: http.StatusForbidden, Message: "access from your network is not allowed"}
+			}
+			return next(c)
+		}
+	}
+}
+
+// isOwnAccount tells us if the uid param of a request is the uid of the
+// authenticated user
+func isOwnAccount(c echo.Context) bool {
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	uid, ok := claims["uid"].(float64)
+	return ok && c.Param("uid") == fmt.Sprintf("%d", uint(uid))
+}
+
+// ManagerNetworkForOthers applies the manager network policy to requests
+// acting on other user accounts, only managers can perform them
+func ManagerNetworkForOthers(policies netpolicy.Policies) echo.MiddlewareFunc {
+	managerNetwork := NetworkPolicy(policies, netpolicy.Manager)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		restricted := managerNetwork(next)
+		return func(c echo.Context) error {
+			if isOwnAccount(c) {
+				return next(c)
+			}
+			return restricted(c)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/doncicuto/glim/server/netpolicy"
+)
+
+func newNetworkPolicies(t *testing.T, rules ...string) netpolicy.Policies {
+	policies := netpolicy.Policies{}
+	for _, rule := range rules {
+		if err := policies.Add(rule); err != nil {
+			t.Fatalf("could not parse network rule - %v", err)
+		}
+	}
+	return policies
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	// Setup, test requests come from 192.0.2.1
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	// Manager operations are only allowed from admin networks
+	managerSettings := settings
+	managerSettings.NetworkPolicies = newNetworkPolicies(t, "manager:allow:10.0.0.0/24")
+	testCases := []RestTestCase{
+		{
+			name:             "manager operation from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/groups",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"name": "devel"}`,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:       "user operation by a manager is allowed",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users",
+			reqMethod:  http.MethodGet,
+			secret:     adminToken,
+		},
+		{
+			name:       "user operation by a plain user is allowed",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3",
+			reqMethod:  http.MethodGet,
+			secret:     plainUserToken,
+		},
+		{
+			name:             "manager can't update other accounts from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodPut,
+			reqBodyJSON:      `{"manager": true}`,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:             "manager can't change other users passwords from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/passwd",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"password": "other"}`,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:             "manager can't disable other users TOTP from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/totp",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:             "manager can't list other users sessions from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/sessions",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:        "manager can update its own account",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/1",
+			reqMethod:   http.MethodPut,
+			reqBodyJSON: `{"email": "admin@example.org"}`,
+			secret:      adminToken,
+		},
+		{
+			name:        "plain user can update its own account",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3",
+			reqMethod:   http.MethodPut,
+			reqBodyJSON: `{"email": "saul@example.org"}`,
+			secret:      plainUserToken,
+		},
+		{
+			name:       "plain user can list its own sessions",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3/sessions",
+			reqMethod:  http.MethodGet,
+			secret:     plainUserToken,
+		},
+	}
+	server := EchoServer(managerSettings)
+	for _, tc := range testCases {
+		runTests(t, tc, server)
+	}
+
+	// User operations are denied for the test network
+	userSettings := settings
+	userSettings.NetworkPolicies = newNetworkPolicies(t, "user:allow:192.0.2.0/24", "user:deny:192.0.2.1")
+	testCases = []RestTestCase{
+		{
+			name:             "user operation from a denied address",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:        "anonymous operation is allowed",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqMethod:   http.MethodPost,
+			reqBodyJSON: `{"username": "saul", "password": "test"}`,
+		},
+	}
+	server = EchoServer(userSettings)
+	for _, tc := range testCases {
+		runTests(t, tc, server)
+	}
+
+	// Only other networks can reach the server
+	anonymousSettings := settings
+	anonymousSettings.NetworkPolicies = newNetworkPolicies(t, "anonymous:allow:198.51.100.0/24")
+	testCases = []RestTestCase{
+		{
+			name:             "login from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/login",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"username": "saul", "password": "test"}`,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+		{
+			name:             "authenticated request from a network not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"access from your network is not allowed"}`,
+		},
+	}
+	server = EchoServer(anonymousSettings)
+	for _, tc := range testCases {
+		runTests(t, tc, server)
+	}
+}
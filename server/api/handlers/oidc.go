@@ -0,0 +1,485 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/jwks"
+	"github.com/doncicuto/glim/server/oidc"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// oidcEnabled tells us if the OIDC provider endpoints are served. An issuer
+// must have been configured and tokens must be signed with an asymmetric
+// algorithm so clients can verify ID tokens with our public keys
+func oidcEnabled(settings types.APISettings) bool {
+	return settings.OIDCIssuer != "" && signingKeys(settings).Algorithm() != jwks.HS256
+}
+
+// oidcIssuer returns the configured issuer identifier, it's never taken
+// from the request
+func oidcIssuer(settings types.APISettings) string {
+	return strings.TrimSuffix(settings.OIDCIssuer, "/")
+}
+
+// oidcError returns an OAuth 2.0 error response
+func oidcError(c echo.Context, code int, err string, description string) error {
+	return c.JSON(code, oidc.Error{Error: err, ErrorDescription: description})
+}
+
+// oidcRedirect sends the browser back to the client's redirect URI
+func oidcRedirect(c echo.Context, redirectURI string, params url.Values) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "wrong redirect_uri"}
+	}
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return c.Redirect(http.StatusFound, u.String())
+}
+
+// authenticateOIDCClient checks the credentials sent by a client using
+// client_secret_basic or client_secret_post. Public clients only send their
+// client_id unless confidentialOnly is set
+func (h *Handler) authenticateOIDCClient(c echo.Context, confidentialOnly bool) (*models.OIDCClient, error) {
+	var client models.OIDCClient
+
+	clientID, clientSecret, basicAuth := c.Request().BasicAuth()
+	if basicAuth {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = c.FormValue("client_id")
+		clientSecret = c.FormValue("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, errors.New("required client_id")
+	}
+
+	if err := h.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+
+	public := client.Public != nil && *client.Public
+	if public && confidentialOnly {
+		return nil, errors.New("public clients can't use this endpoint")
+	}
+
+	if !public {
+		hash := models.HashOIDCClientSecret(clientSecret)
+		if client.SecretHash == nil || subtle.ConstantTimeCompare([]byte(hash), []byte(*client.SecretHash)) != 1 {
+			return nil, errors.New("wrong client secret")
+		}
+	}
+
+	return &client, nil
+}
+
+// validateAuthorizationRequest checks the client and its redirect URI. If
+// both are fine other errors are sent back to the client's redirect URI
+func (h *Handler) validateAuthorizationRequest(c echo.Context, req *oidc.AuthorizationRequest) (*models.OIDCClient, error) {
+	var client models.OIDCClient
+
+	if req.ClientID == "" {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "required client_id"}
+	}
+
+	if err := h.DB.Where("client_id = ?", req.ClientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "unknown oidc client"}
+		}
+		return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "redirect_uri has not been registered for this client"}
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if req.ResponseType != "code" {
+		params.Set("error", "unsupported_response_type")
+		params.Set("error_description", "only the authorization code flow is supported")
+		return nil, oidcRedirect(c, req.RedirectURI, params)
+	}
+
+	if !oidc.HasScope(req.Scope, "openid") {
+		params.Set("error", "invalid_scope")
+		params.Set("error_description", "openid scope is required")
+		return nil, oidcRedirect(c, req.RedirectURI, params)
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != oidc.CodeChallengeMethod {
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "PKCE with the S256 code challenge method is required")
+		return nil, oidcRedirect(c, req.RedirectURI, params)
+	}
+
+	return &client, nil
+}
+
+// newLoginToken issues the token that must be sent back with the login
+// form. It's stored with the authorization request fingerprint and set as a
+// same-site cookie so other sites can't submit the form for the user
+func (h *Handler) newLoginToken(c echo.Context, settings types.APISettings, req oidc.AuthorizationRequest) (string, error) {
+	token, err := oidc.GenerateCode()
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.KV.Set(oidc.LoginTokenKey(token), req.Fingerprint(), oidc.LoginTokenExpiry*time.Second); err != nil {
+		return "", err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidc.LoginTokenCookie,
+		Value:    token,
+		Path:     oidc.AuthorizationPath,
+		MaxAge:   oidc.LoginTokenExpiry,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oidcIssuer(settings), "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// validLoginToken checks the token sent with the login form against the
+// cookie and the authorization request it was issued for
+func (h *Handler) validLoginToken(c echo.Context, token string, req oidc.AuthorizationRequest) bool {
+	cookie, err := c.Cookie(oidc.LoginTokenCookie)
+	if token == "" || err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		return false
+	}
+
+	fingerprint, found, err := h.KV.Get(oidc.LoginTokenKey(token))
+	if err != nil || !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(fingerprint), []byte(req.Fingerprint())) == 1
+}
+
+// renderLoginPage shows the OIDC login page
+func renderLoginPage(c echo.Context, code int, client *models.OIDCClient, req oidc.AuthorizationRequest, loginToken string, username string, message string) error {
+	var page bytes.Buffer
+	err := oidc.RenderLoginPage(&page, oidc.LoginPage{
+		ClientName: *client.Name,
+		Username:   username,
+		Error:      message,
+		LoginToken: loginToken,
+		Request:    req,
+	})
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not render login page"}
+	}
+
+	c.Response().Header().Set("X-Frame-Options", "DENY")
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTMLBlob(code, page.Bytes())
+}
+
+// OIDCDiscovery - TODO comment
+// @Summary      OpenID Connect discovery
+// @Description  Get the OpenID Provider metadata
+// @Tags         oidc
+// @Produce      json
+// @Success      200  {object}  oidc.Discovery
+// @Router       /.well-known/openid-configuration [get]
+func (h *Handler) OIDCDiscovery(c echo.Context, settings types.APISettings) error {
+	return c.JSON(http.StatusOK, oidc.NewDiscovery(oidcIssuer(settings), signingKeys(settings).Algorithm()))
+}
+
+// OIDCAuthorize - TODO comment
+// @Summary      OpenID Connect authorization endpoint
+// @Description  Show the login page for an authorization code flow request. PKCE with S256 is required
+// @Tags         oidc
+// @Produce      html
+// @Param        client_id              query  string  true  "Client ID"
+// @Param        redirect_uri           query  string  true  "Registered redirect URI"
+// @Param        response_type          query  string  true  "Must be code"
+// @Param        scope                  query  string  true  "Space-separated scopes, openid is required"
+// @Param        code_challenge         query  string  true  "PKCE code challenge"
+// @Param        code_challenge_method  query  string  true  "Must be S256"
+// @Param        state                  query  string  false  "Opaque value sent back to the client"
+// @Param        nonce                  query  string  false  "Value added to the ID token"
+// @Success      200
+// @Success      302
+// @Failure			 400  {object} types.ErrorResponse
+// @Router       /oidc/authorize [get]
+func (h *Handler) OIDCAuthorize(c echo.Context, settings types.APISettings) error {
+	req := oidc.AuthorizationRequest{}
+	if err := c.Bind(&req); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "could not parse authorization request"}
+	}
+
+	client, err := h.validateAuthorizationRequest(c, &req)
+	if client == nil {
+		return err
+	}
+
+	loginToken, err := h.newLoginToken(c, settings, req)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add login token to key-value store"}
+	}
+
+	return renderLoginPage(c, http.StatusOK, client, req, loginToken, "", "")
+}
+
+// OIDCLogin - TODO comment
+// @Summary      OpenID Connect login
+// @Description  Log in from the login page. On success the browser is sent to the client's redirect URI with an authorization code
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Success      302
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401
+// @Failure			 403  {object} types.ErrorResponse
+// @Router       /oidc/authorize [post]
+func (h *Handler) OIDCLogin(c echo.Context, settings types.APISettings) error {
+	req := oidc.AuthorizationRequest{}
+	if err := c.Bind(&req); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "could not parse authorization request"}
+	}
+
+	client, err := h.validateAuthorizationRequest(c, &req)
+	if client == nil {
+		return err
+	}
+
+	// The login form must have been rendered for this browser and request
+	loginToken := c.FormValue("login_token")
+	if !h.validLoginToken(c, loginToken, req) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "login form is not valid or has expired"}
+	}
+
+	// Check credentials
+	username := c.FormValue("username")
+	user, httpErr := h.authenticateUser(c, settings, username, c.FormValue("password"), c.FormValue("totp_code"))
+	if httpErr != nil {
+		return renderLoginPage(c, httpErr.Code, client, req, loginToken, username, fmt.Sprintf("%v", httpErr.Message))
+	}
+
+	// Login form tokens can only be used once
+	h.KV.Delete(oidc.LoginTokenKey(loginToken))
+
+	// Store authorization request with the code
+	code, err := oidc.GenerateCode()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate authorization code"}
+	}
+
+	req.Scope = oidc.FilterScopes(req.Scope)
+	req.UID = user.ID
+	req.AuthTime = time.Now().Unix()
+	data, err := json.Marshal(req)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not store authorization code"}
+	}
+
+	if err := h.KV.Set(oidc.CodeKey(code), string(data), oidc.CodeExpiry*time.Second); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add authorization code to key-value store"}
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return oidcRedirect(c, req.RedirectURI, params)
+}
+
+// OIDCToken - TODO comment
+// @Summary      OpenID Connect token endpoint
+// @Description  Exchange an authorization code for an access token and an ID token. Confidential clients authenticate with client_secret_basic or client_secret_post
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Success      200  {object}  oidc.TokenResponse
+// @Failure			 400  {object} oidc.Error
+// @Failure			 401  {object} oidc.Error
+// @Failure 	   500  {object} oidc.Error
+// @Router       /oidc/token [post]
+func (h *Handler) OIDCToken(c echo.Context, settings types.APISettings) error {
+	var user models.User
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	if c.FormValue("grant_type") != "authorization_code" {
+		return oidcError(c, http.StatusBadRequest, "unsupported_grant_type", "only the authorization_code grant type is supported")
+	}
+
+	// Authenticate client
+	client, err := h.authenticateOIDCClient(c, false)
+	if err != nil {
+		return oidcError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	clientID := *client.ClientID
+
+	// Authorization codes can only be used once
+	code := c.FormValue("code")
+	data, found, err := h.KV.Take(oidc.CodeKey(code))
+	if err != nil {
+		return oidcError(c, http.StatusInternalServerError, "server_error", "could not query the key-value store")
+	}
+	if code == "" || !found {
+		return oidcError(c, http.StatusBadRequest, "invalid_grant", "authorization code is not valid")
+	}
+
+	req := oidc.AuthorizationRequest{}
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return oidcError(c, http.StatusBadRequest, "invalid_grant", "authorization code is not valid")
+	}
+
+	if req.ClientID != clientID || req.RedirectURI != c.FormValue("redirect_uri") {
+		return oidcError(c, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+
+	if !oidc.VerifyCodeChallenge(req.CodeChallenge, c.FormValue("code_verifier")) {
+		return oidcError(c, http.StatusBadRequest, "invalid_grant", "wrong code_verifier")
+	}
+
+	// Get user and its groups
+	if err := h.DB.Preload("MemberOf").Where("id = ?", req.UID).First(&user).Error; err != nil || (user.Locked != nil && *user.Locked) {
+		return oidcError(c, http.StatusBadRequest, "invalid_grant", "user account is not available")
+	}
+
+	issuer := oidcIssuer(settings)
+	now := time.Now()
+	expiresIn := settings.AccessTokenExpiry
+
+	// Access tokens can only be used with the userinfo endpoint
+	ac := jwt.MapClaims{}
+	ac["iss"] = issuer
+	ac["aud"] = issuer + oidc.UserInfoPath
+	ac["sub"] = fmt.Sprintf("%d", user.ID)
+	ac["uid"] = user.ID
+	ac["gen"] = user.TokenGeneration
+	ac["azp"] = clientID
+	ac["scope"] = req.Scope
+	ac["jti"] = uuid.New().String()
+	ac["iat"] = now.Unix()
+	ac["exp"] = now.Add(time.Duration(expiresIn) * time.Second).Unix()
+	at, err := signingKeys(settings).Sign(ac)
+	if err != nil {
+		return oidcError(c, http.StatusInternalServerError, "server_error", "could not create access token")
+	}
+
+	// Add access token to Key-Value store
+	if err := h.KV.Set(ac["jti"].(string), "false", time.Duration(expiresIn)*time.Second); err != nil {
+		return oidcError(c, http.StatusInternalServerError, "server_error", "could not add access token to key-value store")
+	}
+
+	// ID token with the claims granted by the scopes
+	ic := jwt.MapClaims{}
+	for k, v := range oidc.UserClaims(&user, req.Scope) {
+		ic[k] = v
+	}
+	ic["iss"] = issuer
+	ic["aud"] = clientID
+	ic["iat"] = now.Unix()
+	ic["exp"] = now.Add(time.Duration(expiresIn) * time.Second).Unix()
+	ic["auth_time"] = req.AuthTime
+	if req.Nonce != "" {
+		ic["nonce"] = req.Nonce
+	}
+	idToken, err := signingKeys(settings).Sign(ic)
+	if err != nil {
+		return oidcError(c, http.StatusInternalServerError, "server_error", "could not create id token")
+	}
+
+	return c.JSON(http.StatusOK, oidc.TokenResponse{
+		AccessToken: at,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		IDToken:     idToken,
+		Scope:       req.Scope,
+	})
+}
+
+// OIDCUserInfo - TODO comment
+// @Summary      OpenID Connect userinfo endpoint
+// @Description  Get the claims about the user that has authorized a client. The claims depend on the scopes granted
+// @Tags         oidc
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure			 401  {object} oidc.Error
+// @Router       /oidc/userinfo [get]
+// @Security 		 Bearer
+func (h *Handler) OIDCUserInfo(c echo.Context, settings types.APISettings) error {
+	var user models.User
+
+	invalidToken := func() error {
+		c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return oidcError(c, http.StatusUnauthorized, "invalid_token", "access token is not valid")
+	}
+
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return invalidToken()
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimPrefix(auth, "Bearer "), claims, signingKeys(settings).Keyfunc)
+	if err != nil || !token.Valid {
+		return invalidToken()
+	}
+
+	issuer := oidcIssuer(settings)
+	scope, _ := claims["scope"].(string)
+	if !claims.VerifyAudience(issuer+oidc.UserInfoPath, true) || !oidc.HasScope(scope, "openid") {
+		return invalidToken()
+	}
+
+	// Check if token has been revoked
+	jti, _ := claims["jti"].(string)
+	if revoked, err := h.isRevoked(jti); err != nil || revoked {
+		return invalidToken()
+	}
+
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return invalidToken()
+	}
+
+	if err := h.DB.Preload("MemberOf").Where("id = ?", uint32(uid)).First(&user).Error; err != nil || (user.Locked != nil && *user.Locked) || !isCurrentGeneration(claims, user.TokenGeneration) {
+		return invalidToken()
+	}
+
+	return c.JSON(http.StatusOK, oidc.UserClaims(&user, scope))
+}
@@ -0,0 +1,279 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// tokenUser returns the user that has sent the request
+func (h *Handler) tokenUser(c echo.Context) (*models.User, error) {
+	u := new(models.User)
+	if c.Get("user") == nil {
+		return nil, errors.New("wrong token or missing info in token claims")
+	}
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return nil, errors.New("wrong token or missing info in token claims")
+	}
+	if err := h.DB.Model(&models.User{}).Where("id = ?", uint(uid)).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// FindOIDCClients - TODO comment
+// @Summary      List OIDC clients
+// @Description  List the web applications that can log users in using Glim as an OpenID Connect provider
+// @Tags         oidc
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   models.OIDCClientInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /oidc/clients [get]
+// @Security 		 Bearer
+func (h *Handler) FindOIDCClients(c echo.Context) error {
+	var clients []models.OIDCClient
+
+	if err := h.DB.Order("id").Find(&clients).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	allClients := []models.OIDCClientInfo{}
+	for _, client := range clients {
+		allClients = append(allClients, models.GetOIDCClientInfo(client))
+	}
+	return c.JSON(http.StatusOK, allClients)
+}
+
+// SaveOIDCClient - TODO comment
+// @Summary      Register OIDC client
+// @Description  Register a web application that can log users in using Glim as an OpenID Connect provider. The client secret is only returned once
+// @Tags         oidc
+// @Accept       json
+// @Produce      json
+// @Param        client  body models.JSONOIDCClientBody  true  "OIDC client body. Name and redirect_uris (a comma-separated list of absolute URIs) are required. Public clients, such as single-page apps, get no client secret and must use PKCE. The reset_secret property is not used in this command"
+// @Success      200  {object}  models.OIDCClientInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /oidc/clients [post]
+// @Security 		 Bearer
+func (h *Handler) SaveOIDCClient(c echo.Context) error {
+	body := models.JSONOIDCClientBody{}
+
+	createdBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to register oidc client"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Validate body
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required oidc client name"}
+	}
+
+	redirectURIs, ok := models.ParseRedirectURIs(body.RedirectURIs)
+	if !ok {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "redirect_uris must be a comma-separated list of absolute URIs"}
+	}
+
+	// Check if client already exists
+	err = h.DB.Where("name = ?", name).First(&models.OIDCClient{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "oidc client already exists"}
+	}
+
+	public := body.Public != nil && *body.Public
+	clientID := uuid.New().String()
+	client := models.OIDCClient{
+		ClientID:     &clientID,
+		Name:         &name,
+		RedirectURIs: &redirectURIs,
+		Public:       &public,
+		CreatedBy:    createdBy.Username,
+		UpdatedBy:    createdBy.Username,
+	}
+
+	// Confidential clients authenticate with a secret
+	secret := ""
+	if !public {
+		secret, err = models.GenerateOIDCClientSecret()
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate client secret"}
+		}
+		hash := models.HashOIDCClientSecret(secret)
+		client.SecretHash = &hash
+	}
+
+	if err := h.DB.Create(&client).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetOIDCClientInfo(client)
+	i.ClientSecret = secret
+	return c.JSON(http.StatusOK, i)
+}
+
+// UpdateOIDCClient - TODO comment
+// @Summary      Update OIDC client
+// @Description  Update an OIDC client's name, redirect URIs or type, or reset its client secret
+// @Tags         oidc
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "OIDC client ID"
+// @Param        client  body models.JSONOIDCClientBody  true  "OIDC client body. Empty properties are not changed. If reset_secret is true a new client secret is returned"
+// @Success      200  {object}  models.OIDCClientInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /oidc/clients/{id} [put]
+// @Security 		 Bearer
+func (h *Handler) UpdateOIDCClient(c echo.Context) error {
+	var client models.OIDCClient
+	body := models.JSONOIDCClientBody{}
+
+	updatedBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to update oidc client"}
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "oidc client id param should be a valid integer"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Find client
+	if err := h.DB.Where("id = ?", id).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "oidc client not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	updates := map[string]interface{}{"updated_by": *updatedBy.Username}
+
+	name := strings.TrimSpace(body.Name)
+	if name != "" && name != *client.Name {
+		err = h.DB.Where("name = ?", name).First(&models.OIDCClient{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "oidc client already exists"}
+		}
+		updates["name"] = name
+	}
+
+	if strings.TrimSpace(body.RedirectURIs) != "" {
+		redirectURIs, ok := models.ParseRedirectURIs(body.RedirectURIs)
+		if !ok {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "redirect_uris must be a comma-separated list of absolute URIs"}
+		}
+		updates["redirect_uris"] = redirectURIs
+	}
+
+	public := client.Public != nil && *client.Public
+	if body.Public != nil {
+		public = *body.Public
+		updates["public"] = public
+	}
+
+	secret := ""
+	if public {
+		updates["secret_hash"] = ""
+	} else if body.ResetSecret || client.SecretHash == nil || *client.SecretHash == "" {
+		secret, err = models.GenerateOIDCClientSecret()
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate client secret"}
+		}
+		updates["secret_hash"] = models.HashOIDCClientSecret(secret)
+	}
+
+	if err := h.DB.Model(&models.OIDCClient{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Where("id = ?", id).First(&client).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetOIDCClientInfo(client)
+	i.ClientSecret = secret
+	return c.JSON(http.StatusOK, i)
+}
+
+// DeleteOIDCClient - TODO comment
+// @Summary      Delete OIDC client
+// @Description  Delete an OIDC client. Its authorization codes can no longer be exchanged for tokens
+// @Tags         oidc
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "OIDC client ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /oidc/clients/{id} [delete]
+// @Security 		 Bearer
+func (h *Handler) DeleteOIDCClient(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "oidc client id param should be a valid integer"}
+	}
+
+	if err := h.DB.Where("id = ?", id).First(&models.OIDCClient{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "oidc client not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Where("id = ?", id).Delete(&models.OIDCClient{}).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
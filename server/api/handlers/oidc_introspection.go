@@ -0,0 +1,194 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/oidc"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// isRevoked checks if a token id has been blacklisted in the key-value store
+func (h *Handler) isRevoked(jti string) (bool, error) {
+	if jti == "" {
+		return true, nil
+	}
+	val, found, err := h.KV.Get(jti)
+	if err != nil {
+		return false, err
+	}
+	return found && val == "true", nil
+}
+
+// parseSignedToken parses a JWT token signed by Glim. Expired tokens and
+// tokens signed with unknown keys are not valid
+func parseSignedToken(settings types.APISettings, token string) (jwt.MapClaims, bool) {
+	claims := jwt.MapClaims{}
+	t, err := jwt.ParseWithClaims(token, claims, signingKeys(settings).Keyfunc)
+	if err != nil || !t.Valid {
+		return nil, false
+	}
+	return claims, true
+}
+
+// tokenTypeHint tells us if a JWT token is an access or a refresh token.
+// Refresh tokens keep the id of their access token in the ajti claim
+func tokenTypeHint(claims jwt.MapClaims) string {
+	if _, ok := claims["ajti"]; ok {
+		return "refresh_token"
+	}
+	return "access_token"
+}
+
+// OIDCIntrospect - TODO comment
+// @Summary      OAuth 2.0 token introspection
+// @Description  Check if a token issued by Glim is active as described in RFC 7662. Callers authenticate as confidential OIDC clients using client_secret_basic or client_secret_post. Access, refresh and personal API tokens can be introspected
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "Token to introspect"
+// @Param        token_type_hint  formData  string  false  "access_token or refresh_token"
+// @Success      200  {object}  oidc.IntrospectionResponse
+// @Failure			 401  {object} oidc.Error
+// @Router       /oidc/introspect [post]
+func (h *Handler) OIDCIntrospect(c echo.Context, settings types.APISettings) error {
+	var user models.User
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	if _, err := h.authenticateOIDCClient(c, true); err != nil {
+		return oidcError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	inactive := oidc.IntrospectionResponse{Active: false}
+	token := c.FormValue("token")
+
+	// Personal API tokens
+	if strings.HasPrefix(token, models.APITokenPrefix) {
+		t, err := authenticateAPIToken(settings.DB, token)
+		if err != nil {
+			return c.JSON(http.StatusOK, inactive)
+		}
+		claims := t.Claims.(jwt.MapClaims)
+		if err := h.DB.Where("id = ?", uint32(claims["uid"].(float64))).First(&user).Error; err != nil {
+			return c.JSON(http.StatusOK, inactive)
+		}
+
+		response := oidc.IntrospectionResponse{
+			Active:    true,
+			Scope:     strings.ReplaceAll(claims["scopes"].(string), ",", " "),
+			Username:  *user.Username,
+			TokenType: "api_token",
+			Sub:       fmt.Sprintf("%d", user.ID),
+			Jti:       claims["jti"].(string),
+		}
+		if exp, ok := claims["exp"].(float64); ok {
+			response.Exp = int64(exp)
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+
+	// JWT tokens
+	claims, valid := parseSignedToken(settings, token)
+	if !valid {
+		return c.JSON(http.StatusOK, inactive)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if revoked, err := h.isRevoked(jti); err != nil || revoked {
+		return c.JSON(http.StatusOK, inactive)
+	}
+
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return c.JSON(http.StatusOK, inactive)
+	}
+	if err := h.DB.Where("id = ?", uint32(uid)).First(&user).Error; err != nil || (user.Locked != nil && *user.Locked) || !isCurrentGeneration(claims, user.TokenGeneration) {
+		return c.JSON(http.StatusOK, inactive)
+	}
+
+	response := oidc.IntrospectionResponse{
+		Active:    true,
+		Username:  *user.Username,
+		TokenType: tokenTypeHint(claims),
+		Sub:       fmt.Sprintf("%d", user.ID),
+		Jti:       jti,
+	}
+	response.Scope, _ = claims["scope"].(string)
+	response.ClientID, _ = claims["azp"].(string)
+	response.Aud, _ = claims["aud"].(string)
+	response.Iss, _ = claims["iss"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		response.Exp = int64(exp)
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		response.Iat = int64(iat)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// OIDCRevoke - TODO comment
+// @Summary      OAuth 2.0 token revocation
+// @Description  Revoke a token issued to the calling OIDC client as described in RFC 7009. Tokens issued to other clients or to the REST API are ignored. The response is the same for unknown or invalid tokens
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "Token to revoke"
+// @Param        token_type_hint  formData  string  false  "access_token or refresh_token"
+// @Success      200
+// @Failure			 401  {object} oidc.Error
+// @Failure 	   503  {object} oidc.Error
+// @Router       /oidc/revoke [post]
+func (h *Handler) OIDCRevoke(c echo.Context, settings types.APISettings) error {
+	client, err := h.authenticateOIDCClient(c, false)
+	if err != nil {
+		return oidcError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	claims, valid := parseSignedToken(settings, c.FormValue("token"))
+	if !valid {
+		return c.NoContent(http.StatusOK)
+	}
+
+	// Clients can only revoke the tokens issued to them, REST API tokens
+	// have no authorized party and are ignored
+	if azp, _ := claims["azp"].(string); azp == "" || azp != *client.ClientID {
+		return c.NoContent(http.StatusOK)
+	}
+
+	// Keep the token blacklisted until it expires
+	expiration := time.Second * time.Duration(settings.RefreshTokenExpiry)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiration = time.Until(time.Unix(int64(exp), 0)) + time.Second
+	}
+
+	if jti, ok := claims["jti"].(string); ok {
+		if err := h.KV.Set(jti, "true", expiration); err != nil {
+			return oidcError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "could not store revoked token info")
+		}
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/oidc"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func introspect(t *testing.T, e *echo.Echo, clientID string, clientSecret string, token string) oidc.IntrospectionResponse {
+	form := url.Values{}
+	form.Set("token", token)
+	req := httptest.NewRequest(http.MethodPost, "/oidc/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.SetBasicAuth(clientID, clientSecret)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not introspect token - %d %s", res.Code, res.Body.String())
+	}
+	response := oidc.IntrospectionResponse{}
+	json.Unmarshal(res.Body.Bytes(), &response)
+	return response
+}
+
+func TestOIDCIntrospectionAndRevocation(t *testing.T) {
+	// Setup
+	h, e, settings := oidcTestSetup(t)
+	defer testCleanUp()
+
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	client := registerOIDCClient(t, e, adminToken, `{"name": "proxy", "redirect_uris": "https://app.example.org/callback"}`)
+	publicClient := registerOIDCClient(t, e, adminToken, `{"name": "spa", "redirect_uris": "https://spa.example.org/callback", "public": true}`)
+
+	// Callers must authenticate as confidential clients
+	accessToken, refreshToken := getUserTokens("saul", h, e, settings)
+	form := url.Values{}
+	form.Set("token", accessToken)
+	res := oidcRequest(e, http.MethodPost, "/oidc/introspect", form, "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, `{"error":"invalid_client","error_description":"client authentication failed"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+
+	form.Set("client_id", publicClient.ClientID)
+	res = oidcRequest(e, http.MethodPost, "/oidc/introspect", form, "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	form.Set("client_id", client.ClientID)
+	form.Set("client_secret", "wrong")
+	res = oidcRequest(e, http.MethodPost, "/oidc/introspect", form, "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// Active tokens
+	response := introspect(t, e, client.ClientID, client.ClientSecret, accessToken)
+	assert.True(t, response.Active)
+	assert.Equal(t, "saul", response.Username)
+	assert.Equal(t, "3", response.Sub)
+	assert.Equal(t, "access_token", response.TokenType)
+	assert.NotEmpty(t, response.Jti)
+	assert.NotZero(t, response.Exp)
+
+	response = introspect(t, e, client.ClientID, client.ClientSecret, refreshToken)
+	assert.True(t, response.Active)
+	assert.Equal(t, "refresh_token", response.TokenType)
+
+	// Unknown tokens
+	response = introspect(t, e, client.ClientID, client.ClientSecret, "not-a-token")
+	assert.Equal(t, oidc.IntrospectionResponse{Active: false}, response)
+
+	// Personal API tokens
+	apiToken := createAPIToken(t, e, adminToken, 1, `{"name": "ci", "scopes": "users:read,groups:read"}`)
+	response = introspect(t, e, client.ClientID, client.ClientSecret, apiToken)
+	assert.True(t, response.Active)
+	assert.Equal(t, "admin", response.Username)
+	assert.Equal(t, "api_token", response.TokenType)
+	assert.Equal(t, "users:read groups:read", response.Scope)
+
+	// Tokens revoked with a logout are no longer active
+	req := httptest.NewRequest(http.MethodDelete, "/v1/login/refresh_token", strings.NewReader(fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, accessToken).Active)
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, refreshToken).Active)
+
+	// REST API tokens have no authorized party so clients can't revoke them
+	accessToken, refreshToken = getUserTokens("kim", h, e, settings)
+	form = url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+	form.Set("client_id", client.ClientID)
+	form.Set("client_secret", client.ClientSecret)
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	form.Set("token", accessToken)
+	form.Del("token_type_hint")
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	assert.True(t, introspect(t, e, client.ClientID, client.ClientSecret, accessToken).Active)
+	assert.True(t, introspect(t, e, client.ClientID, client.ClientSecret, refreshToken).Active)
+
+	// Clients can only revoke the tokens issued to them
+	tokens := oidcTokens(t, e, client.ClientID, client.ClientSecret)
+	other := registerOIDCClient(t, e, adminToken, `{"name": "other", "redirect_uris": "https://app.example.org/callback"}`)
+	form = url.Values{}
+	form.Set("token", tokens.AccessToken)
+	form.Set("client_id", other.ClientID)
+	form.Set("client_secret", other.ClientSecret)
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, introspect(t, e, client.ClientID, client.ClientSecret, tokens.AccessToken).Active)
+
+	form = url.Values{}
+	form.Set("token", tokens.AccessToken)
+	form.Set("client_id", publicClient.ClientID)
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, introspect(t, e, client.ClientID, client.ClientSecret, tokens.AccessToken).Active)
+
+	// Revoking an access token
+	form.Set("client_id", client.ClientID)
+	form.Set("client_secret", client.ClientSecret)
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, tokens.AccessToken).Active)
+	res = oidcRequest(e, http.MethodGet, "/oidc/userinfo", nil, tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// Tokens issued before a password change, demotion or lock are no longer active
+	accessToken, refreshToken = getUserTokens("saul", h, e, settings)
+	tokens = oidcTokens(t, e, client.ClientID, client.ClientSecret)
+	h.DB.Model(&models.User{}).Where("id = ?", 3).Update("token_generation", gorm.Expr("token_generation + 1"))
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, accessToken).Active)
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, refreshToken).Active)
+	assert.False(t, introspect(t, e, client.ClientID, client.ClientSecret, tokens.AccessToken).Active)
+	res = oidcRequest(e, http.MethodGet, "/oidc/userinfo", nil, tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	tokens = oidcTokens(t, e, client.ClientID, client.ClientSecret)
+	assert.True(t, introspect(t, e, client.ClientID, client.ClientSecret, tokens.AccessToken).Active)
+
+	// Invalid tokens don't produce errors
+	form.Set("token", "not-a-token")
+	res = oidcRequest(e, http.MethodPost, "/oidc/revoke", form, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/jwks"
+	"github.com/doncicuto/glim/server/oidc"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func testCodeChallenge() string {
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func oidcRequest(e *echo.Echo, method string, target string, form url.Values, bearer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	if bearer != "" {
+		req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", bearer))
+	}
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	return res
+}
+
+func registerOIDCClient(t *testing.T, e *echo.Echo, secret string, body string) models.OIDCClientInfo {
+	req := httptest.NewRequest(http.MethodPost, "/v1/oidc/clients", strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", secret))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	client := models.OIDCClientInfo{}
+	json.Unmarshal(res.Body.Bytes(), &client)
+	if client.ClientID == "" {
+		t.Fatalf("could not register oidc client - %s", res.Body.String())
+	}
+	return client
+}
+
+func oidcAuthorizeParams(clientID string) url.Values {
+	params := url.Values{}
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", "https://app.example.org/callback")
+	params.Set("response_type", "code")
+	params.Set("scope", "openid profile email groups")
+	params.Set("state", "xyz")
+	params.Set("nonce", "n-0S6_WzA2Mj")
+	params.Set("code_challenge", testCodeChallenge())
+	params.Set("code_challenge_method", "S256")
+	return params
+}
+
+// oidcTestSetup prepares a test server with the OIDC provider enabled, ID
+// tokens are signed with RS256 keys
+func oidcTestSetup(t *testing.T) (*Handler, *echo.Echo, types.APISettings) {
+	h, _, settings := testSetup(t, false)
+
+	keys, err := jwks.NewKeySet(jwks.RS256, t.TempDir(), settings.APISecret, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create key set - %v", err)
+	}
+	settings.Keys = keys
+	settings.OIDCIssuer = "https://glim.example.org/"
+
+	return h, EchoServer(settings), settings
+}
+
+// oidcLoginForm shows the login page for an authorization request and
+// returns the form with its login token and the cookie set in the browser
+func oidcLoginForm(t *testing.T, e *echo.Echo, params url.Values) (url.Values, *http.Cookie) {
+	res := oidcRequest(e, http.MethodGet, "/oidc/authorize?"+params.Encode(), nil, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not show login page - %d %s", res.Code, res.Body.String())
+	}
+
+	cookies := res.Result().Cookies()
+	match := regexp.MustCompile(`name="login_token" value="([^"]+)"`).FindStringSubmatch(res.Body.String())
+	if len(cookies) != 1 || match == nil {
+		t.Fatalf("login page has no login token - %s", res.Body.String())
+	}
+
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("login_token", match[1])
+	return form, cookies[0]
+}
+
+// oidcLoginRequest submits the login form
+func oidcLoginRequest(e *echo.Echo, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/oidc/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	return res
+}
+
+func oidcLogin(t *testing.T, e *echo.Echo, clientID string) string {
+	form, cookie := oidcLoginForm(t, e, oidcAuthorizeParams(clientID))
+	form.Set("username", "saul")
+	form.Set("password", "test")
+	res := oidcLoginRequest(e, form, cookie)
+	if res.Code != http.StatusFound {
+		t.Fatalf("could not log in - %d %s", res.Code, res.Body.String())
+	}
+	location, _ := url.Parse(res.Header().Get("Location"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+// oidcTokens goes through the authorization code flow as saul and returns
+// the tokens issued to a client
+func oidcTokens(t *testing.T, e *echo.Echo, clientID string, clientSecret string) oidc.TokenResponse {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", oidcLogin(t, e, clientID))
+	form.Set("redirect_uri", "https://app.example.org/callback")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("code_verifier", testCodeVerifier)
+	res := oidcRequest(e, http.MethodPost, "/oidc/token", form, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not exchange authorization code - %d %s", res.Code, res.Body.String())
+	}
+	tokens := oidc.TokenResponse{}
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+	return tokens
+}
+
+func TestOIDCClients(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	testCases := []RestTestCase{
+		{
+			name:             "plain user can't register oidc clients",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/oidc/clients",
+			reqBodyJSON:      `{"name": "app", "redirect_uris": "https://app.example.org/callback"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "name is required",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/oidc/clients",
+			reqBodyJSON:      `{"redirect_uris": "https://app.example.org/callback"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"required oidc client name"}`,
+		},
+		{
+			name:             "redirect uris must be absolute",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/oidc/clients",
+			reqBodyJSON:      `{"name": "app", "redirect_uris": "/callback"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"redirect_uris must be a comma-separated list of absolute URIs"}`,
+		},
+		{
+			name:        "manager registers oidc client",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/oidc/clients",
+			reqBodyJSON: `{"name": "app", "redirect_uris": "https://app.example.org/callback"}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:             "oidc client names can't be duplicated",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/oidc/clients",
+			reqBodyJSON:      `{"name": "app", "redirect_uris": "https://app.example.org/callback"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"oidc client already exists"}`,
+		},
+		{
+			name:       "list oidc clients",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/oidc/clients",
+			reqMethod:  http.MethodGet,
+			secret:     adminToken,
+		},
+		{
+			name:        "update oidc client",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/oidc/clients/1",
+			reqBodyJSON: `{"redirect_uris": "https://app.example.org/callback, https://app.example.org/other"}`,
+			reqMethod:   http.MethodPut,
+			secret:      adminToken,
+		},
+		{
+			name:             "oidc client not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/oidc/clients/1000",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"oidc client not found"}`,
+		},
+		{
+			name:       "delete oidc client",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/oidc/clients/1",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "list oidc clients after delete",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/oidc/clients",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `[]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	// Setup
+	_, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// No issuer has been configured
+	res := oidcRequest(e, http.MethodGet, "/.well-known/openid-configuration", nil, "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	// ID tokens would be signed with the API secret
+	settings.OIDCIssuer = "https://glim.example.org"
+	e = EchoServer(settings)
+	res = oidcRequest(e, http.MethodGet, "/.well-known/openid-configuration", nil, "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	res = oidcRequest(e, http.MethodPost, "/oidc/token", url.Values{}, "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	// Setup
+	h, e, settings := oidcTestSetup(t)
+	defer testCleanUp()
+
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+
+	// Group for groups claim
+	runTests(t, RestTestCase{
+		name:        "create group",
+		expResCode:  http.StatusOK,
+		reqURL:      "/v1/groups",
+		reqBodyJSON: `{"name": "devel", "members": "saul"}`,
+		reqMethod:   http.MethodPost,
+		secret:      adminToken,
+	}, e)
+
+	// Register a confidential client
+	client := registerOIDCClient(t, e, adminToken, `{"name": "app", "redirect_uris": "https://app.example.org/callback"}`)
+
+	// Discovery
+	res := oidcRequest(e, http.MethodGet, "/.well-known/openid-configuration", nil, "")
+	discovery := oidc.Discovery{}
+	json.Unmarshal(res.Body.Bytes(), &discovery)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "https://glim.example.org", discovery.Issuer)
+	assert.Equal(t, "https://glim.example.org/oidc/token", discovery.TokenEndpoint)
+	assert.Equal(t, "https://glim.example.org/.well-known/jwks.json", discovery.JWKSURI)
+	assert.Equal(t, []string{jwks.RS256}, discovery.IDTokenSigningAlgValuesSupported)
+
+	// The issuer is never taken from the request
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	req.Host = "evil.example.org"
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	json.Unmarshal(res.Body.Bytes(), &discovery)
+	assert.Equal(t, "https://glim.example.org", discovery.Issuer)
+	assert.Equal(t, []string{"S256"}, discovery.CodeChallengeMethodsSupported)
+
+	// Authorization endpoint shows the login page
+	params := oidcAuthorizeParams(client.ClientID)
+	res = oidcRequest(e, http.MethodGet, "/oidc/authorize?"+params.Encode(), nil, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), "Sign in to app")
+
+	// Unknown redirect URIs are not used
+	params.Set("redirect_uri", "https://evil.example.org/callback")
+	res = oidcRequest(e, http.MethodGet, "/oidc/authorize?"+params.Encode(), nil, "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"message":"redirect_uri has not been registered for this client"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+
+	// PKCE is required
+	params = oidcAuthorizeParams(client.ClientID)
+	params.Del("code_challenge")
+	res = oidcRequest(e, http.MethodGet, "/oidc/authorize?"+params.Encode(), nil, "")
+	assert.Equal(t, http.StatusFound, res.Code)
+	location, _ := url.Parse(res.Header().Get("Location"))
+	assert.Equal(t, "invalid_request", location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	// Login forms can't be submitted without the token and cookie of the
+	// login page shown for the same authorization request
+	form, cookie := oidcLoginForm(t, e, oidcAuthorizeParams(client.ClientID))
+	form.Set("username", "saul")
+	form.Set("password", "test")
+	for name, tc := range map[string]struct {
+		form   url.Values
+		cookie *http.Cookie
+	}{
+		"no login token": {form: oidcAuthorizeParams(client.ClientID), cookie: cookie},
+		"no cookie":      {form: form, cookie: nil},
+		"other cookie":   {form: form, cookie: &http.Cookie{Name: oidc.LoginTokenCookie, Value: "other"}},
+	} {
+		res = oidcLoginRequest(e, tc.form, tc.cookie)
+		assert.Equal(t, http.StatusForbidden, res.Code, name)
+	}
+
+	otherRequest := url.Values{}
+	for k, v := range form {
+		otherRequest[k] = v
+	}
+	otherRequest.Set("state", "other")
+	res = oidcLoginRequest(e, otherRequest, cookie)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Equal(t, `{"message":"login form is not valid or has expired"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+
+	// Wrong password shows the login page again
+	form.Set("password", "wrong")
+	res = oidcLoginRequest(e, form, cookie)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Contains(t, res.Body.String(), "wrong username or password")
+
+	// The login form can be sent again and its token is only used once
+	form.Set("password", "test")
+	res = oidcLoginRequest(e, form, cookie)
+	assert.Equal(t, http.StatusFound, res.Code)
+	res = oidcLoginRequest(e, form, cookie)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	// Wrong code verifier
+	code := oidcLogin(t, e, client.ClientID)
+	form = url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", "https://app.example.org/callback")
+	form.Set("client_id", client.ClientID)
+	form.Set("client_secret", client.ClientSecret)
+	form.Set("code_verifier", strings.Repeat("a", 43))
+	res = oidcRequest(e, http.MethodPost, "/oidc/token", form, "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"error":"invalid_grant","error_description":"wrong code_verifier"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+
+	// Wrong client secret
+	code = oidcLogin(t, e, client.ClientID)
+	form.Set("code", code)
+	form.Set("code_verifier", testCodeVerifier)
+	form.Set("client_secret", "wrong")
+	res = oidcRequest(e, http.MethodPost, "/oidc/token", form, "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// Code exchange
+	form.Del("client_secret")
+	req = httptest.NewRequest(http.MethodPost, "/oidc/token", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	tokens := oidc.TokenResponse{}
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "openid profile email groups", tokens.Scope)
+
+	claims := jwt.MapClaims{}
+	idToken, err := jwt.ParseWithClaims(tokens.IDToken, claims, signingKeys(settings).Keyfunc)
+	if err != nil || !idToken.Valid {
+		t.Fatalf("id token is not valid - %v", err)
+	}
+	assert.Equal(t, "3", claims["sub"])
+	assert.Equal(t, client.ClientID, claims["aud"])
+	assert.Equal(t, "https://glim.example.org", claims["iss"])
+	assert.Equal(t, jwks.RS256, idToken.Header["alg"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, "saul", claims["preferred_username"])
+	assert.Equal(t, []interface{}{"devel"}, claims["groups"])
+
+	// Codes can't be reused
+	res = oidcRequest(e, http.MethodPost, "/oidc/token", form, "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	req = httptest.NewRequest(http.MethodPost, "/oidc/token", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"error":"invalid_grant","error_description":"authorization code is not valid"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+
+	// Only one of several concurrent exchanges of a code succeeds
+	form.Set("code", oidcLogin(t, e, client.ClientID))
+	exchanged := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/oidc/token", strings.NewReader(form.Encode()))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			req.SetBasicAuth(client.ClientID, client.ClientSecret)
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+			exchanged <- res.Code
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		if <-exchanged == http.StatusOK {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	// Userinfo
+	res = oidcRequest(e, http.MethodGet, "/oidc/userinfo", nil, tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, res.Code)
+	userinfo := map[string]interface{}{}
+	json.Unmarshal(res.Body.Bytes(), &userinfo)
+	assert.Equal(t, "3", userinfo["sub"])
+	assert.Equal(t, []interface{}{"devel"}, userinfo["groups"])
+
+	// Users without a locked status are not locked
+	h.DB.Model(&models.User{}).Where("id = ?", 3).Update("locked", nil)
+	res = oidcRequest(e, http.MethodGet, "/oidc/userinfo", nil, tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = oidcRequest(e, http.MethodGet, "/oidc/userinfo", nil, adminToken)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// OIDC access tokens can't be used with the REST API
+	runTests(t, RestTestCase{
+		name:             "oidc access token is rejected by the REST API",
+		expResCode:       http.StatusUnauthorized,
+		reqURL:           "/v1/users/3",
+		reqMethod:        http.MethodGet,
+		secret:           tokens.AccessToken,
+		expectedBodyJSON: `{"message":"invalid or expired jwt"}`,
+	}, e)
+}
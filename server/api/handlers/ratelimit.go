@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/doncicuto/glim/server/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// tooManyAttempts tells the client how long it has to wait before trying again
+func tooManyAttempts(c echo.Context, wait time.Duration) *echo.HTTPError {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return &echo.HTTPError{Code: http.StatusTooManyRequests, Message: "too many failed attempts, please try again later"}
+}
+
+// RateLimit throttles clients by source IP when their requests keep failing
+// with 400 or 401 responses, e.g when guessing refresh tokens or client secrets
+func RateLimit(limiter *ratelimit.Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := ratelimit.IPKey(c.RealIP())
+			if wait, err := limiter.Blocked(key); err == nil && wait > 0 {
+				return tooManyAttempts(c, wait)
+			}
+
+			err := next(c)
+
+			// Handlers may return an error or write the error response themselves
+			status := c.Response().Status
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+			if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+				limiter.Fail(key)
+			}
+			return err
+		}
+	}
+}
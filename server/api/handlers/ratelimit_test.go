@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/doncicuto/glim/server/ratelimit"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	// Setup, two failed attempts are allowed
+	_, _, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	settings.RateLimiter = ratelimit.New(settings.KV, 2, time.Minute)
+	e := EchoServer(settings)
+
+	postWithHeader := func(target string, body string, ip string, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = ip + ":34567"
+		if forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	post := func(target string, body string, ip string) *httptest.ResponseRecorder {
+		return postWithHeader(target, body, ip, "")
+	}
+
+	// Failed logins are throttled by username
+	res := post("/v1/login", `{"username": "saul", "password": "wrong"}`, "192.0.2.10")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = post("/v1/login", `{"username": "saul", "password": "wrong"}`, "192.0.2.11")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	res = post("/v1/login", `{"username": "saul", "password": "test"}`, "192.0.2.12")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, `{"message":"too many failed attempts, please try again later"}`, strings.TrimSuffix(res.Body.String(), "\n"))
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	// and by source IP
+	res = post("/v1/login", `{"username": "mike", "password": "wrong"}`, "192.0.2.13")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = post("/v1/login", `{"username": "search", "password": "wrong"}`, "192.0.2.13")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = post("/v1/login", `{"username": "admin", "password": "test"}`, "192.0.2.13")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+
+	// Other users and IPs are not affected
+	res = post("/v1/login", `{"username": "kim", "password": "test"}`, "192.0.2.20")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	// Failed refresh token requests are throttled by source IP
+	res = post("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.30")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = post("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.30")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = post("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.30")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	// Forged X-Forwarded-For headers don't change the source IP
+	for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		res = postWithHeader("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.40", forwardedFor)
+		assert.Equal(t, http.StatusBadRequest, res.Code, i)
+	}
+	res = postWithHeader("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.40", "203.0.113.3")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+
+	// unless they're set by a trusted proxy
+	settings.TrustedProxies, _ = netpolicy.ParseNetworks([]string{"192.0.2.50"})
+	e = EchoServer(settings)
+	for i := 0; i < 2; i++ {
+		res = postWithHeader("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.50", "203.0.113.10")
+		assert.Equal(t, http.StatusBadRequest, res.Code, i)
+	}
+	res = postWithHeader("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.50", "203.0.113.10")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	res = postWithHeader("/v1/login/refresh_token", `{"refresh_token": "wrong"}`, "192.0.2.50", "203.0.113.11")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
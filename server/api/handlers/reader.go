@@ -58,7 +58,7 @@ func IsReader(db *gorm.DB) echo.MiddlewareFunc {
 			username := c.Param("username")
 			var u models.User
 			if username != "" {
-				err := db.Where("username = ?", username).Take(&u).Error
+				err := db.Where("username_folded = ?", models.FoldIdentity(username)).Take(&u).Error
 				if err != nil {
 					if errors.Is(err, gorm.ErrRecordNotFound) {
 						return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "user has no proper permissions"}
@@ -38,6 +38,7 @@ import (
 // @Success      200  {object}  types.TokenAuthentication
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
+// @Failure			 429  {object} types.ErrorResponse
 // @Failure 	   500  {object} types.ErrorResponse
 // @Router       /login/refresh_token [post]
 func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
@@ -50,9 +51,7 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 
 	// Get refresh token claims
 	claims := make(jwt.MapClaims)
-	token, err := jwt.ParseWithClaims(tokens.RefreshToken, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(settings.APISecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokens.RefreshToken, claims, signingKeys(settings).Keyfunc)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "could not parse token, you may have to log in again"}
 	}
@@ -100,6 +99,11 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "invalid uid found in token"}
 	}
 
+	// Check if user has been locked or its tokens have been invalidated
+	if (dbUser.Locked != nil && *dbUser.Locked) || !isCurrentGeneration(claims, dbUser.TokenGeneration) {
+		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "token no longer valid"}
+	}
+
 	// Check if refresh token ID (jti) has been blacklisted
 	val, found, err := h.KV.Get(jti)
 	if err != nil {
@@ -112,6 +116,20 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 		}
 	}
 
+	// Check if session has been revoked. Tokens issued before sessions
+	// were tracked have no session id
+	sid, hasSession := claims["sid"].(string)
+	var session *types.Session
+	if hasSession {
+		session, found, err = h.getSession(dbUser.ID, sid)
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "could not get stored session info"}
+		}
+		if !found {
+			return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "session has been revoked"}
+		}
+	}
+
 	// Blacklist old refresh token
 	err = h.KV.Set(jti, "true", time.Second*3600)
 	if err != nil {
@@ -142,23 +160,25 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 	// it will be useful to check if we have to login again
 	// as the MAX_DAYS_WITHOUT_RELOGIN has been reached
 	cc["iat"] = iat
+	cc["gen"] = dbUser.TokenGeneration
+	if hasSession {
+		cc["sid"] = sid
+	}
 
 	// Create access claims and token
-	tokenID := uuid.New() // token id
-	ac := cc              // add common claims to access token claims
-	ac["jti"] = tokenID
+	accessTokenID := uuid.New() // token id
+	ac := cc                    // add common claims to access token claims
+	ac["jti"] = accessTokenID
 	ac["exp"] = atExpiresOn
 	ac["manager"] = dbUser.Manager
 	ac["readonly"] = dbUser.Readonly
-	t := jwt.New(jwt.SigningMethodHS256)
-	t.Claims = ac
-	at, err := t.SignedString([]byte(settings.APISecret))
+	at, err := signingKeys(settings).Sign(ac)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not create access token"}
 	}
 
 	// Add access token to Key-Value store
-	err = h.KV.Set(tokenID.String(), "false", atExpiresIn)
+	err = h.KV.Set(accessTokenID.String(), "false", atExpiresIn)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add access token to key-value store"}
 	}
@@ -168,14 +188,12 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 	rtExpiresIn := time.Second * time.Duration(expiry)
 
 	// Create response token
-	tokenID = uuid.New() // token id
-	rc := cc             // add common claims to refresh token claims
+	tokenID := uuid.New() // token id
+	rc := cc              // add common claims to refresh token claims
 	rc["jti"] = tokenID
 	rc["exp"] = time.Now().Add(rtExpiresIn).Unix()
-	rc["ajti"] = ajti
-	t = jwt.New(jwt.SigningMethodHS256)
-	t.Claims = rc
-	rt, err := t.SignedString([]byte(settings.APISecret))
+	rc["ajti"] = accessTokenID
+	rt, err := signingKeys(settings).Sign(rc)
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not create access token"}
 	}
@@ -186,6 +204,18 @@ func (h *Handler) Refresh(c echo.Context, settings types.APISettings) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not add refresh token to key-value store"}
 	}
 
+	// Update session
+	if hasSession {
+		session.IP = c.RealIP()
+		session.UserAgent = c.Request().UserAgent()
+		session.LastRefreshAt = time.Now()
+		session.JTI = tokenID.String()
+		session.AJTI = accessTokenID.String()
+		if err := h.saveSession(*session, rtExpiresIn); err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not update session in key-value store"}
+		}
+	}
+
 	// Create response with access and refresh tokens
 	tokenAuth := types.TokenAuthentication{}
 	tokenAuth.AccessToken = at
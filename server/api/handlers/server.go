@@ -1,9 +1,9 @@
 package handlers
 
 import (
+	"github.com/doncicuto/glim/server/netpolicy"
 	"github.com/doncicuto/glim/types"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"gorm.io/gorm"
 )
@@ -32,19 +32,58 @@ func EchoServer(settings types.APISettings) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.IPExtractor = ipExtractor(settings.TrustedProxies)
 
 	// Initialize handler
 	blacklist := settings.KV
 	h := &Handler{DB: settings.DB, KV: blacklist, Guacamole: settings.Guacamole}
 
+	// Network policies for anonymous, user and manager operations
+	e.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.Anonymous))
+	managerNetwork := NetworkPolicy(settings.NetworkPolicies, netpolicy.Manager)
+	othersNetwork := ManagerNetworkForOthers(settings.NetworkPolicies)
+
 	// Routes
+	e.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		return h.JWKS(c, settings)
+	})
+
+	// OpenID Connect provider, it's only served if an issuer has been set
+	// and ID tokens can be verified with our public keys
+	if oidcEnabled(settings) {
+		e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+			return h.OIDCDiscovery(c, settings)
+		})
+		e.GET("/oidc/authorize", func(c echo.Context) error {
+			return h.OIDCAuthorize(c, settings)
+		})
+		e.POST("/oidc/authorize", func(c echo.Context) error {
+			return h.OIDCLogin(c, settings)
+		})
+		e.POST("/oidc/token", func(c echo.Context) error {
+			return h.OIDCToken(c, settings)
+		}, RateLimit(settings.RateLimiter))
+		e.GET("/oidc/userinfo", func(c echo.Context) error {
+			return h.OIDCUserInfo(c, settings)
+		})
+		e.POST("/oidc/userinfo", func(c echo.Context) error {
+			return h.OIDCUserInfo(c, settings)
+		})
+		e.POST("/oidc/introspect", func(c echo.Context) error {
+			return h.OIDCIntrospect(c, settings)
+		})
+		e.POST("/oidc/revoke", func(c echo.Context) error {
+			return h.OIDCRevoke(c, settings)
+		})
+	}
+
 	v1 := e.Group("v1")
 	v1.POST("/login", func(c echo.Context) error {
 		return h.Login(c, settings)
 	})
 	v1.POST("/login/refresh_token", func(c echo.Context) error {
 		return h.Refresh(c, settings)
-	})
+	}, RateLimit(settings.RateLimiter))
 	v1.DELETE("/login/refresh_token", func(c echo.Context) error {
 		return h.Logout(c, settings)
 	})
@@ -59,25 +98,69 @@ func EchoServer(settings types.APISettings) *echo.Echo {
 	})
 
 	u := v1.Group("/users")
-	u.Use(middleware.JWT([]byte(settings.APISecret)))
-	u.GET("", h.FindAllUsers, IsBlacklisted(blacklist), IsReader(settings.DB))
-	u.POST("", h.SaveUser, IsBlacklisted(blacklist), IsManager)
-	u.GET("/:uid", h.FindUserByID, IsBlacklisted(blacklist), IsReader(settings.DB))
-	u.GET("/:username/uid", h.FindUIDFromUsername, IsBlacklisted(blacklist), IsReader(settings.DB))
-	u.PUT("/:uid", h.UpdateUser, IsBlacklisted(blacklist), IsUpdater)
-	u.DELETE("/:uid", h.DeleteUser, IsBlacklisted(blacklist), IsManager)
-	u.POST("/:uid/passwd", h.Passwd, IsBlacklisted(blacklist))
+	u.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.User), Authenticate(settings, "users"))
+	u.GET("", h.FindAllUsers, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	u.POST("", h.SaveUser, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	u.GET("/:uid", h.FindUserByID, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	u.GET("/:username/uid", h.FindUIDFromUsername, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	u.PUT("/:uid", h.UpdateUser, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid", h.DeleteUser, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	u.POST("/:uid/passwd", h.Passwd, IsBlacklisted(blacklist, settings.DB), othersNetwork)
+	u.POST("/:uid/totp", func(c echo.Context) error {
+		return h.EnrollTOTP(c, settings)
+	}, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.PUT("/:uid/totp", func(c echo.Context) error {
+		return h.ActivateTOTP(c, settings)
+	}, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid/totp", func(c echo.Context) error {
+		return h.DisableTOTP(c, settings)
+	}, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.GET("/:uid/app-passwords", h.FindAppPasswords, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.POST("/:uid/app-passwords", h.SaveAppPassword, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid/app-passwords/:id", h.RevokeAppPassword, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.GET("/:uid/sessions", h.FindSessions, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid/sessions", func(c echo.Context) error {
+		return h.RevokeSessions(c, settings)
+	}, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid/sessions/:sid", func(c echo.Context) error {
+		return h.RevokeSession(c, settings)
+	}, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.GET("/:uid/tokens", h.FindAPITokens, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.POST("/:uid/tokens", h.SaveAPIToken, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
+	u.DELETE("/:uid/tokens/:id", h.RevokeAPIToken, IsBlacklisted(blacklist, settings.DB), othersNetwork, IsUpdater)
 
 	g := v1.Group("/groups")
-	g.Use(middleware.JWT([]byte(settings.APISecret)))
-	g.GET("", h.FindAllGroups, IsBlacklisted(blacklist), IsReader(settings.DB))
-	g.POST("", h.SaveGroup, IsBlacklisted(blacklist), IsManager)
-	g.GET("/:gid", h.FindGroupByID, IsBlacklisted(blacklist), IsReader(settings.DB))
-	g.GET("/:group/gid", h.FindGIDFromGroupName, IsBlacklisted(blacklist), IsReader(settings.DB))
-	g.PUT("/:gid", h.UpdateGroup, IsBlacklisted(blacklist), IsManager)
-	g.DELETE("/:gid", h.DeleteGroup, IsBlacklisted(blacklist), IsManager)
-	g.POST("/:gid/members", h.AddGroupMembers, IsBlacklisted(blacklist), IsManager)
-	g.DELETE("/:gid/members", h.RemoveGroupMembers, IsBlacklisted(blacklist), IsManager)
+	g.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.User), Authenticate(settings, "groups"))
+	g.GET("", h.FindAllGroups, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	g.POST("", h.SaveGroup, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	g.GET("/:gid", h.FindGroupByID, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	g.GET("/:group/gid", h.FindGIDFromGroupName, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	g.PUT("/:gid", h.UpdateGroup, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	g.DELETE("/:gid", h.DeleteGroup, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	g.POST("/:gid/members", h.AddGroupMembers, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	g.DELETE("/:gid/members", h.RemoveGroupMembers, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+
+	o := v1.Group("/oidc/clients")
+	o.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.User), Authenticate(settings, "oidc"))
+	o.GET("", h.FindOIDCClients, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	o.POST("", h.SaveOIDCClient, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	o.PUT("/:id", h.UpdateOIDCClient, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	o.DELETE("/:id", h.DeleteOIDCClient, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+
+	a := v1.Group("/attributes")
+	a.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.User), Authenticate(settings, "attributes"))
+	a.GET("", h.FindAttributes, IsBlacklisted(blacklist, settings.DB), IsReader(settings.DB))
+	a.POST("", h.SaveAttribute, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	a.PUT("/:id", h.UpdateAttribute, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	a.DELETE("/:id", h.DeleteAttribute, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+
+	sa := v1.Group("/service-accounts")
+	sa.Use(NetworkPolicy(settings.NetworkPolicies, netpolicy.User), Authenticate(settings, "service-accounts"))
+	sa.GET("", h.FindServiceAccounts, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	sa.POST("", h.SaveServiceAccount, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	sa.PUT("/:id", h.UpdateServiceAccount, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	sa.POST("/:id/rotate", h.RotateServiceAccountPassword, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
+	sa.DELETE("/:id", h.DeleteServiceAccount, IsBlacklisted(blacklist, settings.DB), managerNetwork, IsManager)
 
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
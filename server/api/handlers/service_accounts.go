@@ -0,0 +1,402 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// serviceAccountGroups returns the groups of a comma-separated list of
+// group names, they restrict what a service account can search
+func (h *Handler) serviceAccountGroups(names string) ([]*models.Group, error) {
+	groups := []*models.Group{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		g := new(models.Group)
+		err := h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(name)).Take(&g).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, &echo.HTTPError{Code: http.StatusNotFound, Message: fmt.Sprintf("group %s not found", name)}
+			}
+			return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// newServiceAccountPassword generates a password and returns it along
+// with the hash we store
+func newServiceAccountPassword() (string, string, error) {
+	password, err := models.GenerateAppPassword()
+	if err != nil {
+		return "", "", &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate service account password"}
+	}
+
+	hash, err := models.Hash(password)
+	if err != nil {
+		return "", "", &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	return password, string(hash), nil
+}
+
+// findServiceAccount returns the service account for the id param
+func (h *Handler) findServiceAccount(c echo.Context) (*models.ServiceAccount, error) {
+	s := new(models.ServiceAccount)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "service account id param should be a valid integer"}
+	}
+
+	if err := h.DB.Preload("Groups").Where("id = ?", id).First(s).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &echo.HTTPError{Code: http.StatusNotFound, Message: "service account not found"}
+		}
+		return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	return s, nil
+}
+
+// FindServiceAccounts - TODO comment
+// @Summary      List service accounts
+// @Description  List the accounts applications use to bind to our LDAP server
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   models.ServiceAccountInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /service-accounts [get]
+// @Security 		 Bearer
+func (h *Handler) FindServiceAccounts(c echo.Context) error {
+	var serviceAccounts []models.ServiceAccount
+
+	if err := h.DB.Preload("Groups").Order("id").Find(&serviceAccounts).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	allServiceAccounts := []models.ServiceAccountInfo{}
+	for _, s := range serviceAccounts {
+		allServiceAccounts = append(allServiceAccounts, models.GetServiceAccountInfo(s))
+	}
+	return c.JSON(http.StatusOK, allServiceAccounts)
+}
+
+// SaveServiceAccount - TODO comment
+// @Summary      Create service account
+// @Description  Create an account that applications use to bind to our LDAP server as cn=name,ou=Services. Service accounts can't log in to the REST API. The generated password is only returned once
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        service_account  body models.JSONServiceAccountBody  true  "Service account body. Name is required, it may have letters, digits, dots, hyphens and underscores. Search users and search groups properties (true by default) allow searching users and groups. Read private property allows reading private custom attributes. Groups is an optional comma-separated list of group names, if set only members of those groups and those groups are returned in searches, even if the groups are deleted later. Locked property if true will disable binds"
+// @Success      200  {object}  models.ServiceAccountInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /service-accounts [post]
+// @Security 		 Bearer
+func (h *Handler) SaveServiceAccount(c echo.Context) error {
+	body := models.JSONServiceAccountBody{}
+
+	createdBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to create service account"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required service account name"}
+	}
+
+	if !models.ValidServiceAccountName(name) {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "service account name may only have letters, digits, dots, hyphens and underscores"}
+	}
+
+	// Check if service account already exists
+	err = h.DB.Where("name_folded = ?", models.FoldIdentity(name)).First(&models.ServiceAccount{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "service account already exists"}
+	}
+
+	groups := []*models.Group{}
+	if body.Groups != nil {
+		groups, err = h.serviceAccountGroups(*body.Groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	password, hash, err := newServiceAccountPassword()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	groupsOnly := len(groups) > 0
+	s := models.ServiceAccount{
+		Name:              &name,
+		Description:       body.Description,
+		Password:          &hash,
+		PasswordChangedAt: &now,
+		SearchUsers:       body.SearchUsers,
+		SearchGroups:      body.SearchGroups,
+		ReadPrivate:       body.ReadPrivate,
+		ProxyAuthz:        body.ProxyAuthz,
+		GroupsOnly:        &groupsOnly,
+		Groups:            groups,
+		Locked:            body.Locked,
+		CreatedBy:         createdBy.Username,
+		UpdatedBy:         createdBy.Username,
+	}
+
+	if err := h.DB.Create(&s).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Preload("Groups").Where("id = ?", s.ID).First(&s).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetServiceAccountInfo(s)
+	i.Password = password
+	return c.JSON(http.StatusOK, i)
+}
+
+// UpdateServiceAccount - TODO comment
+// @Summary      Update service account
+// @Description  Update the name, description, search permissions or lock status of a service account
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Service account ID"
+// @Param        service_account  body models.JSONServiceAccountBody  true  "Service account body. Properties that are not set are not changed. Groups replaces the groups that restrict searches, an empty list removes the restriction"
+// @Success      200  {object}  models.ServiceAccountInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /service-accounts/{id} [put]
+// @Security 		 Bearer
+func (h *Handler) UpdateServiceAccount(c echo.Context) error {
+	body := models.JSONServiceAccountBody{}
+
+	updatedBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to update service account"}
+	}
+
+	s, err := h.findServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	updates := map[string]interface{}{"updated_by": *updatedBy.Username}
+
+	name := strings.TrimSpace(body.Name)
+	if name != "" && name != *s.Name {
+		if !models.ValidServiceAccountName(name) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "service account name may only have letters, digits, dots, hyphens and underscores"}
+		}
+		err = h.DB.Where("name_folded = ? AND id <> ?", models.FoldIdentity(name), s.ID).First(&models.ServiceAccount{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "service account already exists"}
+		}
+		updates["name"] = name
+	}
+
+	if body.Description != nil {
+		updates["description"] = *body.Description
+	}
+
+	if body.SearchUsers != nil {
+		updates["search_users"] = *body.SearchUsers
+	}
+
+	if body.SearchGroups != nil {
+		updates["search_groups"] = *body.SearchGroups
+	}
+
+	if body.ReadPrivate != nil {
+		updates["read_private"] = *body.ReadPrivate
+	}
+
+	if body.ProxyAuthz != nil {
+		updates["proxy_authz"] = *body.ProxyAuthz
+	}
+
+	if body.Locked != nil {
+		updates["locked"] = *body.Locked
+	}
+
+	if body.Groups != nil {
+		groups, err := h.serviceAccountGroups(*body.Groups)
+		if err != nil {
+			return err
+		}
+		if err := h.DB.Model(s).Association("Groups").Replace(groups); err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+		updates["groups_only"] = len(groups) > 0
+	}
+
+	if err := h.DB.Model(&models.ServiceAccount{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Preload("Groups").Where("id = ?", s.ID).First(s).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.JSON(http.StatusOK, models.GetServiceAccountInfo(*s))
+}
+
+// RotateServiceAccountPassword - TODO comment
+// @Summary      Rotate service account password
+// @Description  Generate a new password for a service account. The new password is only returned once. The previous password can still be used during the grace period so applications can be updated without downtime
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Service account ID"
+// @Param        rotation  body models.JSONServiceAccountRotateBody  false  "Rotation body. Grace period is an optional duration e.g 24h, the previous password stops working immediately if not set"
+// @Success      200  {object}  models.ServiceAccountInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /service-accounts/{id}/rotate [post]
+// @Security 		 Bearer
+func (h *Handler) RotateServiceAccountPassword(c echo.Context) error {
+	body := models.JSONServiceAccountRotateBody{}
+
+	updatedBy, err := h.tokenUser(c)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong user attempting to rotate service account password"}
+	}
+
+	s, err := h.findServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	var gracePeriod time.Duration
+	if body.GracePeriod != "" {
+		gracePeriod, err = time.ParseDuration(body.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "grace period must be a valid duration e.g 24h"}
+		}
+	}
+
+	password, hash, err := newServiceAccountPassword()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"password":                     hash,
+		"password_changed_at":          now,
+		"previous_password":            nil,
+		"previous_password_expires_at": nil,
+		"updated_by":                   *updatedBy.Username,
+	}
+	if gracePeriod > 0 {
+		updates["previous_password"] = *s.Password
+		updates["previous_password_expires_at"] = now.Add(gracePeriod)
+	}
+
+	if err := h.DB.Model(&models.ServiceAccount{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Preload("Groups").Where("id = ?", s.ID).First(s).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetServiceAccountInfo(*s)
+	i.Password = password
+	return c.JSON(http.StatusOK, i)
+}
+
+// DeleteServiceAccount - TODO comment
+// @Summary      Delete service account
+// @Description  Delete a service account, applications can't bind with it anymore
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Service account ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /service-accounts/{id} [delete]
+// @Security 		 Bearer
+func (h *Handler) DeleteServiceAccount(c echo.Context) error {
+	s, err := h.findServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.Model(s).Association("Groups").Clear(); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if err := h.DB.Delete(&models.ServiceAccount{}, s.ID).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/labstack/echo/v4"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, _ := getUserTokens("search", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:        "devel group is created",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/groups",
+			reqBodyJSON: `{"name": "devel", "members": "saul"}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:             "search user can't create service accounts",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/service-accounts",
+			reqBodyJSON:      `{"name": "nextcloud"}`,
+			reqMethod:        http.MethodPost,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "plain user can't list service accounts",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/service-accounts",
+			reqMethod:        http.MethodGet,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "name is required",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/service-accounts",
+			reqBodyJSON:      `{"name": ""}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"required service account name"}`,
+		},
+		{
+			name:             "name must be valid in a DN",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/service-accounts",
+			reqBodyJSON:      `{"name": "next,cloud"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account name may only have letters, digits, dots, hyphens and underscores"}`,
+		},
+		{
+			name:             "groups must exist",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/service-accounts",
+			reqBodyJSON:      `{"name": "nextcloud", "groups": "ops"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"group ops not found"}`,
+		},
+		{
+			name:        "manager creates service account",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/service-accounts",
+			reqBodyJSON: `{"name": "nextcloud", "description": "Nextcloud LDAP backend", "groups": "devel", "proxy_authz": true}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:             "service account names are unique ignoring case",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/service-accounts",
+			reqBodyJSON:      `{"name": "NextCloud"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account already exists"}`,
+		},
+		{
+			name:        "manager creates service account without group search",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/service-accounts",
+			reqBodyJSON: `{"name": "mail", "search_groups": false, "read_private": true}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:       "list service accounts",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/service-accounts",
+			reqMethod:  http.MethodGet,
+			secret:     adminToken,
+		},
+		{
+			name:             "service account id must be an integer",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/service-accounts/none",
+			reqBodyJSON:      `{"locked": true}`,
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account id param should be a valid integer"}`,
+		},
+		{
+			name:             "service account not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/service-accounts/1000",
+			reqBodyJSON:      `{"locked": true}`,
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account not found"}`,
+		},
+		{
+			name:             "service account names can't be taken twice",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/service-accounts/3",
+			reqBodyJSON:      `{"name": "NEXTCLOUD"}`,
+			reqMethod:        http.MethodPut,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account already exists"}`,
+		},
+		{
+			name:        "manager locks service account",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/service-accounts/3",
+			reqBodyJSON: `{"name": "postfix", "locked": true}`,
+			reqMethod:   http.MethodPut,
+			secret:      adminToken,
+		},
+		{
+			name:             "grace period must be a duration",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/service-accounts/2/rotate",
+			reqBodyJSON:      `{"grace_period": "tomorrow"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"grace period must be a valid duration e.g 24h"}`,
+		},
+		{
+			name:             "plain user can't rotate service account passwords",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/service-accounts/2/rotate",
+			reqBodyJSON:      `{}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:        "manager rotates service account password",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/service-accounts/2/rotate",
+			reqBodyJSON: `{"grace_period": "24h"}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:       "devel group is deleted",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/groups/1",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:       "manager deletes service account",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/service-accounts/3",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "service account already deleted",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/service-accounts/3",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"service account not found"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Passwords are hashed, rotation keeps the previous password for the
+	// grace period and deleted groups keep restricting searches. The search
+	// service account is created with the database
+	var serviceAccounts []models.ServiceAccount
+	h.DB.Preload("Groups").Order("id").Find(&serviceAccounts)
+	if len(serviceAccounts) != 2 || *serviceAccounts[0].Name != "search" {
+		t.Fatalf("expected search and nextcloud service accounts, got %d", len(serviceAccounts))
+	}
+	s := serviceAccounts[1]
+	if !s.PreviousPasswordValid() || *s.PreviousPassword == *s.Password {
+		t.Fatalf("previous password should be valid during the grace period")
+	}
+	if s.GroupsOnly == nil || !*s.GroupsOnly || len(s.Groups) != 0 {
+		t.Fatalf("service account should still be restricted to deleted groups")
+	}
+	if s.ProxyAuthz == nil || !*s.ProxyAuthz {
+		t.Fatalf("service account should have the proxy authorization right")
+	}
+
+	// Service accounts can't log in to the REST API
+	req := httptest.NewRequest(http.MethodPost, "/v1/service-accounts/2/rotate", strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", adminToken))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	info := models.ServiceAccountInfo{}
+	if err := json.Unmarshal(res.Body.Bytes(), &info); err != nil || info.Password == "" {
+		t.Fatalf("rotation should return the new password")
+	}
+	if info.PreviousPasswordExpiresAt != nil {
+		t.Fatalf("previous password should stop working without grace period")
+	}
+
+	runTests(t, RestTestCase{
+		name:        "service accounts can't log in",
+		expResCode:  http.StatusUnauthorized,
+		reqURL:      "/v1/login",
+		reqBodyJSON: fmt.Sprintf(`{"username": "nextcloud", "password": "%s"}`, info.Password),
+		reqMethod:   http.MethodPost,
+	}, e)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTokenInvalidation(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and plain users
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, searchRefreshToken := getUserTokens("search", h, e, settings)
+	saulToken, saulRefreshToken := getUserTokens("saul", h, e, settings)
+	kimToken, kimRefreshToken := getUserTokens("kim", h, e, settings)
+	mikeToken, _ := getUserTokens("mike", h, e, settings)
+	kimAPIToken := createAPIToken(t, e, kimToken, 4, `{"name": "ci", "scopes": "users:read"}`)
+
+	testCases := []RestTestCase{
+		{
+			name:       "readonly user can list users before demotion",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users",
+			reqMethod:  http.MethodGet,
+			secret:     searchToken,
+		},
+		{
+			name:        "admin removes readonly status",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/2",
+			reqMethod:   http.MethodPut,
+			reqBodyJSON: `{"readonly": false}`,
+			secret:      adminToken,
+		},
+		{
+			name:             "demoted user access token is no longer valid",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users",
+			reqMethod:        http.MethodGet,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:             "demoted user refresh token is no longer valid",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login/refresh_token",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"refresh_token": "` + searchRefreshToken + `"}`,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:        "updating other fields keeps tokens valid",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3",
+			reqMethod:   http.MethodPut,
+			reqBodyJSON: `{"email": "saul@example.org"}`,
+			secret:      adminToken,
+		},
+		{
+			name:       "user access token still valid",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3",
+			reqMethod:  http.MethodGet,
+			secret:     saulToken,
+		},
+		{
+			name:        "admin locks user",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3",
+			reqMethod:   http.MethodPut,
+			reqBodyJSON: `{"locked": true}`,
+			secret:      adminToken,
+		},
+		{
+			name:             "locked user access token is no longer valid",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           saulToken,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:             "locked user refresh token is no longer valid",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login/refresh_token",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"refresh_token": "` + saulRefreshToken + `"}`,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:        "user changes password",
+			expResCode:  http.StatusNoContent,
+			reqURL:      "/v1/users/4/passwd",
+			reqMethod:   http.MethodPost,
+			reqBodyJSON: `{"old_password": "test", "password": "newtest"}`,
+			secret:      kimToken,
+		},
+		{
+			name:             "access token is no longer valid after password change",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/4",
+			reqMethod:        http.MethodGet,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:             "refresh token is no longer valid after password change",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login/refresh_token",
+			reqMethod:        http.MethodPost,
+			reqBodyJSON:      `{"refresh_token": "` + kimRefreshToken + `"}`,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:             "api token is revoked after password change",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/4",
+			reqMethod:        http.MethodGet,
+			secret:           kimAPIToken,
+			expectedBodyJSON: `{"message":"invalid or expired api token"}`,
+		},
+		{
+			name:       "admin deletes user",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/users/5",
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "deleted user access token is no longer valid",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/5",
+			reqMethod:        http.MethodGet,
+			secret:           mikeToken,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// A new login gets valid tokens with the current roles
+	searchToken, _ = getUserTokens("search", h, e, settings)
+	testCases = []RestTestCase{
+		{
+			name:       "new token is valid after demotion",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/2",
+			reqMethod:  http.MethodGet,
+			secret:     searchToken,
+		},
+		{
+			name:             "new token has no readonly permissions",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users",
+			reqMethod:        http.MethodGet,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+}
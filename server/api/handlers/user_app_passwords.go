@@ -0,0 +1,241 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// FindAppPasswords - TODO comment
+// @Summary      List app passwords
+// @Description  List the application-specific passwords of a user account
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Success      200  {array}   models.AppPasswordInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/app-passwords [get]
+// @Security 		 Bearer
+func (h *Handler) FindAppPasswords(c echo.Context) error {
+	var appPasswords []models.AppPassword
+
+	// API tokens can't be used to manage app passwords
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage app passwords"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	if err := h.DB.Where("user_id = ?", uid).Order("id").Find(&appPasswords).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	var allAppPasswords []models.AppPasswordInfo
+	for _, appPassword := range appPasswords {
+		allAppPasswords = append(allAppPasswords, models.GetAppPasswordInfo(appPassword))
+	}
+
+	if len(allAppPasswords) == 0 {
+		return c.JSON(http.StatusOK, []models.AppPasswordInfo{})
+	}
+	return c.JSON(http.StatusOK, allAppPasswords)
+}
+
+// SaveAppPassword - TODO comment
+// @Summary      Create app password
+// @Description  Create an application-specific password that can be used in LDAP binds. The generated password is only returned once
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        app_password  body models.JSONAppPasswordBody  true  "App password body. Name is required. Application and networks (a comma-separated list of CIDRs) optionally restrict where the password can be used"
+// @Success      200  {object}  models.AppPasswordInfo
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/app-passwords [post]
+// @Security 		 Bearer
+func (h *Handler) SaveAppPassword(c echo.Context) error {
+	body := models.JSONAppPasswordBody{}
+
+	// API tokens can't be used to manage app passwords
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage app passwords"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	// Get request body
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Validate body
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required app password name"}
+	}
+
+	networks := []string{}
+	if body.Networks != "" {
+		for _, cidr := range strings.Split(body.Networks, ",") {
+			_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "networks must be a comma-separated list of CIDRs"}
+			}
+			networks = append(networks, network.String())
+		}
+	}
+	allowedNetworks := strings.Join(networks, ",")
+	application := strings.TrimSpace(body.Application)
+
+	// Check if user exists
+	if err := h.DB.Where("id = ?", uid).First(&models.User{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// Check if an active app password with that name already exists
+	err = h.DB.Where("user_id = ? AND name = ? AND revoked_at IS NULL", uid, name).First(&models.AppPassword{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "app password already exists"}
+	}
+
+	// Generate password and store its hash
+	password, err := models.GenerateAppPassword()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate app password"}
+	}
+
+	hashedPassword, err := models.Hash(password)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	hash := string(hashedPassword)
+	lookup := models.AppPasswordLookup(password)
+
+	a := models.AppPassword{
+		UserID:      uint32(uid),
+		Name:        &name,
+		Password:    &hash,
+		Lookup:      &lookup,
+		Application: &application,
+		Networks:    &allowedNetworks,
+	}
+
+	if err := h.DB.Create(&a).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	i := models.GetAppPasswordInfo(a)
+	i.Password = password
+	return c.JSON(http.StatusOK, i)
+}
+
+// RevokeAppPassword - TODO comment
+// @Summary      Revoke app password
+// @Description  Revoke an application-specific password so it can't be used in LDAP binds anymore
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        app_password_id   path      int  true  "App password ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/app-passwords/{app_password_id} [delete]
+// @Security 		 Bearer
+func (h *Handler) RevokeAppPassword(c echo.Context) error {
+	var a models.AppPassword
+
+	// API tokens can't be used to manage app passwords
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage app passwords"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "app password id param should be a valid integer"}
+	}
+
+	// Find app password
+	if err := h.DB.Where("id = ? AND user_id = ?", id, uid).First(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "app password not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if a.RevokedAt != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "app password already revoked"}
+	}
+
+	if err := h.DB.Model(&models.AppPassword{}).Where("id = ?", id).Update("revoked_at", time.Now()).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
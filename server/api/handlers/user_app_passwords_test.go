@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+)
+
+func TestUserAppPasswords(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, _ := getUserTokens("search", h, e, settings)
+	plainUserToken, _ := getUserTokens("saul", h, e, settings)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:             "search user can't create app passwords",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/2/app-passwords",
+			reqBodyJSON:      `{"name": "mail"}`,
+			reqMethod:        http.MethodPost,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "plain user can't create app passwords for other users",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/4/app-passwords",
+			reqBodyJSON:      `{"name": "mail"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "name is required",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3/app-passwords",
+			reqBodyJSON:      `{"name": ""}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"required app password name"}`,
+		},
+		{
+			name:             "networks must be CIDRs",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/3/app-passwords",
+			reqBodyJSON:      `{"name": "mail", "networks": "10.0.0.1"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"networks must be a comma-separated list of CIDRs"}`,
+		},
+		{
+			name:             "user not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/1000/app-passwords",
+			reqBodyJSON:      `{"name": "mail"}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"user not found"}`,
+		},
+		{
+			name:        "plain user creates app password",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3/app-passwords",
+			reqBodyJSON: `{"name": "mail", "networks": "10.0.0.0/8"}`,
+			reqMethod:   http.MethodPost,
+			secret:      plainUserToken,
+		},
+		{
+			name:             "app password names can't be duplicated",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/3/app-passwords",
+			reqBodyJSON:      `{"name": "mail"}`,
+			reqMethod:        http.MethodPost,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"app password already exists"}`,
+		},
+		{
+			name:        "manager creates app password for other user",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3/app-passwords",
+			reqBodyJSON: `{"name": "vpn", "application": "vpn"}`,
+			reqMethod:   http.MethodPost,
+			secret:      adminToken,
+		},
+		{
+			name:       "list app passwords",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3/app-passwords",
+			reqMethod:  http.MethodGet,
+			secret:     plainUserToken,
+		},
+		{
+			name:             "list app passwords for user without app passwords",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/4/app-passwords",
+			reqMethod:        http.MethodGet,
+			secret:           adminToken,
+			expectedBodyJSON: `[]`,
+		},
+		{
+			name:             "app password id must be an integer",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/3/app-passwords/none",
+			reqMethod:        http.MethodDelete,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"app password id param should be a valid integer"}`,
+		},
+		{
+			name:             "app password belongs to other user",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/4/app-passwords/1",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"app password not found"}`,
+		},
+		{
+			name:       "revoke app password",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/users/3/app-passwords/1",
+			reqMethod:  http.MethodDelete,
+			secret:     plainUserToken,
+		},
+		{
+			name:             "app password already revoked",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/3/app-passwords/1",
+			reqMethod:        http.MethodDelete,
+			secret:           plainUserToken,
+			expectedBodyJSON: `{"message":"app password already revoked"}`,
+		},
+		{
+			name:        "revoked app password names can be reused",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/users/3/app-passwords",
+			reqBodyJSON: `{"name": "mail"}`,
+			reqMethod:   http.MethodPost,
+			secret:      plainUserToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Passwords are hashed and revocation is recorded
+	var appPasswords []models.AppPassword
+	h.DB.Where("user_id = ?", 3).Order("id").Find(&appPasswords)
+	if len(appPasswords) != 3 {
+		t.Fatalf("expected 3 app passwords, got %d", len(appPasswords))
+	}
+	if appPasswords[0].RevokedAt == nil || appPasswords[1].RevokedAt != nil {
+		t.Fatalf("wrong app password revocation status")
+	}
+	if *appPasswords[1].Networks != "" || *appPasswords[0].Networks != "10.0.0.0/8" {
+		t.Fatalf("wrong app password networks")
+	}
+	if appPasswords[1].Lookup == nil || len(*appPasswords[1].Lookup) != 4 {
+		t.Fatalf("app password lookup identifier not stored")
+	}
+}
@@ -38,7 +38,7 @@ func (h *Handler) AddMembersOf(u *models.User, memberOf []string) error {
 		member = strings.TrimSpace(member)
 		// Find group
 		g := new(models.Group)
-		err = h.DB.Model(&models.Group{}).Where("name = ?", member).Take(&g).Error
+		err = h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(member)).Take(&g).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return &echo.HTTPError{Code: http.StatusNotFound, Message: fmt.Sprintf("group %s not found", member)}
@@ -61,7 +61,7 @@ func (h *Handler) AddMembersOf(u *models.User, memberOf []string) error {
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        user  body models.JSONUserBody  true  "User account body. Username is required. The members property expect a comma-separated list of group names e.g 'admin,devel' that you want the user be member of. Password property is optional, if set it will be the password for that user, if no password is sent the user account will be locked (user can not log in). Manager property if true will assign the Manager role. Readonly property if true will set this user for read-only usage (queries). Locked property if true will disable log in for that user. Remove and replace properties are not currently used."
+// @Param        user  body models.JSONUserBody  true  "User account body. Username is required. Usernames and emails are unique ignoring case. The members property expect a comma-separated list of group names e.g 'admin,devel' that you want the user be member of. Password property is optional, if set it will be the password for that user, if no password is sent the user account will be locked (user can not log in). Manager property if true will assign the Manager role. Readonly property if true will set this user for read-only usage (queries). Locked property if true will disable log in for that user. LDAP require OTP property if true will require a TOTP code appended to the password in LDAP binds. Proxy authz property if true will allow the account to use the LDAP proxied authorization control. Attributes property sets the values of custom attributes by attribute name. UID number, GID number, home directory and login shell properties are optional POSIX attributes, if not set the uid number is allocated from the configured range, the gid number is the uid number, the home directory follows the configured template and the login shell is the default shell. Remove and replace properties are not currently used."
 // @Success      200  {object}  models.UserInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -130,6 +130,45 @@ func (h *Handler) SaveUser(c echo.Context) error {
 		u.Locked = body.Locked
 	}
 
+	if body.LDAPRequireOTP != nil {
+		u.LDAPRequireOTP = body.LDAPRequireOTP
+	}
+
+	if body.ProxyAuthz != nil {
+		u.ProxyAuthz = body.ProxyAuthz
+	}
+
+	// POSIX attributes, those not set are allocated when the user is created
+	if body.UIDNumber != nil && *body.UIDNumber == 0 {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "uid number must be greater than 0"}
+	}
+	u.UIDNumber = body.UIDNumber
+
+	if body.GIDNumber != nil && *body.GIDNumber == 0 {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "gid number must be greater than 0"}
+	}
+	u.GIDNumber = body.GIDNumber
+
+	if body.HomeDirectory != "" {
+		if !models.ValidPOSIXPath(body.HomeDirectory) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "home directory must be an absolute path"}
+		}
+		u.HomeDirectory = &body.HomeDirectory
+	}
+
+	if body.LoginShell != "" {
+		if !models.ValidPOSIXPath(body.LoginShell) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "login shell must be an absolute path"}
+		}
+		u.LoginShell = &body.LoginShell
+	}
+
+	// Custom attributes
+	changes, err := models.PrepareAttributeChanges(h.DB, body.Attributes, models.AttributeForUsers)
+	if err != nil {
+		return attributesError(err)
+	}
+
 	userUUID := uuid.New().String()
 	u.UUID = &userUUID
 
@@ -137,11 +176,27 @@ func (h *Handler) SaveUser(c echo.Context) error {
 	u.UpdatedBy = createdBy.Username
 
 	// Check if user already exists
-	err := h.DB.Model(&models.User{}).Where("username = ?", body.Username).First(&u).Error
+	err = h.DB.Model(&models.User{}).Where("username_folded = ?", models.FoldIdentity(body.Username)).First(&u).Error
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "user already exists"}
 	}
 
+	// Check if email is already in use
+	if body.Email != "" {
+		err = h.DB.Model(&models.User{}).Where("email_folded = ?", models.FoldIdentity(body.Email)).First(&models.User{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "email already exists"}
+		}
+	}
+
+	// Check if uid number is already in use
+	if body.UIDNumber != nil {
+		err = h.DB.Model(&models.User{}).Where("uid_number = ?", *body.UIDNumber).First(&models.User{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid number already exists"}
+		}
+	}
+
 	// Hash password
 	hashedPassword, err := models.Hash(body.Password)
 	if err != nil {
@@ -150,6 +205,13 @@ func (h *Handler) SaveUser(c echo.Context) error {
 	password := string(hashedPassword)
 	u.Password = &password
 
+	// SASL SCRAM-SHA-256 credentials
+	scram, err := models.ScramSHA256(body.Password)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	u.ScramSHA256 = &scram
+
 	// Add new user
 	err = h.DB.Model(models.User{}).Create(&u).Error
 	if err != nil {
@@ -157,7 +219,7 @@ func (h *Handler) SaveUser(c echo.Context) error {
 	}
 
 	// Get new user
-	err = h.DB.Where("username = ?", body.Username).First(&u).Error
+	err = h.DB.Where("username_folded = ?", models.FoldIdentity(body.Username)).First(&u).Error
 	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
@@ -171,6 +233,15 @@ func (h *Handler) SaveUser(c echo.Context) error {
 		}
 	}
 
+	// Add custom attributes
+	if err := models.ApplyAttributeChanges(h.DB, changes, &u.ID, nil); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	u.Attributes, err = h.attributeValues("user_id", u.ID)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
 	showMemberOf := true
 	i := models.GetUserInfo(*u, showMemberOf, h.Guacamole)
 	return c.JSON(http.StatusOK, i)
@@ -71,5 +71,28 @@ func (h *Handler) DeleteUser(c echo.Context) error {
 		return err
 	}
 
+	// Remove user app passwords
+	err = h.DB.Where("user_id = ?", u.ID).Delete(&models.AppPassword{}).Error
+	if err != nil {
+		return err
+	}
+
+	// Remove user API tokens
+	err = h.DB.Where("user_id = ?", u.ID).Delete(&models.APIToken{}).Error
+	if err != nil {
+		return err
+	}
+
+	// Remove user custom attributes
+	err = h.DB.Where("user_id = ?", u.ID).Delete(&models.AttributeValue{}).Error
+	if err != nil {
+		return err
+	}
+
+	// Remove user sessions
+	if err := h.invalidateUserTokens(u.ID); err != nil {
+		return err
+	}
+
 	return c.NoContent(http.StatusNoContent)
 }
@@ -55,6 +55,11 @@ func (h *Handler) Passwd(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
 	}
 
+	// API tokens can't be used to change passwords
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to change passwords"}
+	}
+
 	// Bind body
 	body := new(models.JSONPasswdBody)
 	if err := c.Bind(body); err != nil {
@@ -120,6 +125,13 @@ func (h *Handler) Passwd(c echo.Context) error {
 	}
 	newUser["password"] = string(hashedPassword)
 
+	// SASL SCRAM-SHA-256 credentials
+	scram, err := models.ScramSHA256(body.Password)
+	if err != nil {
+		return err
+	}
+	newUser["scram_sha256"] = scram
+
 	// Update date
 	newUser["updated_at"] = time.Now()
 
@@ -129,6 +141,11 @@ func (h *Handler) Passwd(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	// Password change invalidates all user tokens
+	if err := h.invalidateUserTokens(dbUser.ID); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not invalidate user tokens"}
+	}
+
 	// Return OK
 	return c.NoContent(http.StatusNoContent)
 }
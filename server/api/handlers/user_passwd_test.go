@@ -106,6 +106,15 @@ func TestUserPasswd(t *testing.T) {
 			secret:      searchToken,
 			reqBodyJSON: `{"old_password": "test", "password": "new"}`,
 		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Password changes invalidate tokens so we have to log in again
+	searchToken, _ = getUserTokensWithPassword("search", "new", h, e, settings)
+	testCases = []RestTestCase{
 		{
 			name:        "check new password is valid",
 			expResCode:  http.StatusNoContent,
@@ -130,6 +139,14 @@ func TestUserPasswd(t *testing.T) {
 			secret:      adminToken,
 			reqBodyJSON: `{"password": "new"}`,
 		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	searchToken, _ = getUserTokensWithPassword("search", "new", h, e, settings)
+	testCases = []RestTestCase{
 		{
 			name:        "check new password is valid",
 			expResCode:  http.StatusNoContent,
@@ -28,10 +28,11 @@ import (
 
 // FindAllUsers - TODO comment
 // @Summary      Find all users
-// @Description  Find all users
+// @Description  Find all users. If transitive is true, memberOf includes the groups users are members of through nested groups
 // @Tags         users
 // @Accept       json
 // @Produce      json
+// @Param        transitive   query      bool  false  "Include memberships through nested groups"
 // @Success      200  {object}  models.UserInfo
 // @Failure 	   500  {object} types.ErrorResponse
 // @Router       /users [get]
@@ -50,7 +51,7 @@ func (h *Handler) FindAllUsers(c echo.Context) error {
 
 	// Retrieve users from database
 	users := []models.User{}
-	if err := h.DB.
+	if err := preloadAttributes(h.DB).
 		Preload("MemberOf").
 		Model(&models.User{}).
 		Offset((page - 1) * limit).
@@ -66,6 +67,14 @@ func (h *Handler) FindAllUsers(c echo.Context) error {
 	var allUsers []models.UserInfo
 	showMemberOf := true
 	for _, user := range users {
+		if transitive(c) {
+			memberOf, err := models.TransitiveMemberOf(h.DB, &user)
+			if err != nil {
+				return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+			}
+			user.MemberOf = memberOf
+		}
+		user.Attributes = visibleAttributes(c, user.Attributes)
 		allUsers = append(allUsers, models.GetUserInfo(user, showMemberOf, h.Guacamole))
 	}
 
@@ -74,11 +83,12 @@ func (h *Handler) FindAllUsers(c echo.Context) error {
 
 // FindUserByID - TODO comment
 // @Summary      Find user by id
-// @Description  Find user by id
+// @Description  Find user by id. If transitive is true, memberOf includes the groups the user is a member of through nested groups
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "User Account ID"
+// @Param        transitive   query      bool  false  "Include memberships through nested groups"
 // @Success      200  {object}  models.UserInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -96,7 +106,7 @@ func (h *Handler) FindUserByID(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
 	}
 
-	err = h.DB.Preload("MemberOf").Model(&models.User{}).Where("id = ?", id).Take(&u).Error
+	err = preloadAttributes(h.DB).Preload("MemberOf").Model(&models.User{}).Where("id = ?", id).Take(&u).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
@@ -104,6 +114,15 @@ func (h *Handler) FindUserByID(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	if transitive(c) {
+		u.MemberOf, err = models.TransitiveMemberOf(h.DB, &u)
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+	}
+
+	u.Attributes = visibleAttributes(c, u.Attributes)
+
 	showMemberOf := true
 	i := models.GetUserInfo(u, showMemberOf, h.Guacamole)
 	return c.JSON(http.StatusOK, i)
@@ -129,7 +148,7 @@ func (h *Handler) FindUIDFromUsername(c echo.Context) error {
 	var err error
 	username := c.Param("username")
 
-	err = h.DB.Model(&models.User{}).Where("username = ?", username).Take(&u).Error
+	err = h.DB.Model(&models.User{}).Where("username_folded = ?", models.FoldIdentity(username)).Take(&u).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
@@ -15,7 +15,7 @@ func TestUserRead(t *testing.T) {
 	searchToken, _ := getUserTokens("search", h, e, settings)
 	plainUserToken, _ := getUserTokens("saul", h, e, settings)
 
-	everybodyInfo := `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}]`
+	everybodyInfo := `[{"uid":1,"username":"admin","name":"","firstname":"LDAP","lastname":"administrator","email":"","ssh_public_key":"","jpeg_photo":"","manager":true,"readonly":false,"locked":false,"uid_number":10000,"gid_number":10000,"home_directory":"/home/admin","login_shell":"/bin/bash"},{"uid":2,"username":"search","name":"","firstname":"Read-Only","lastname":"Account","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":true,"locked":false,"uid_number":10001,"gid_number":10001,"home_directory":"/home/search","login_shell":"/bin/bash"},{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"},{"uid":4,"username":"kim","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10003,"gid_number":10003,"home_directory":"/home/kim","login_shell":"/bin/bash"},{"uid":5,"username":"mike","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10004,"gid_number":10004,"home_directory":"/home/mike","login_shell":"/bin/bash"}]`
 
 	// Test cases
 	testCases := []RestTestCase{
@@ -41,7 +41,7 @@ func TestUserRead(t *testing.T) {
 			reqURL:           "/v1/users/3",
 			reqMethod:        http.MethodGet,
 			secret:           plainUserToken,
-			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
 		},
 		{
 			name:             "manager user can see a plainuser account info",
@@ -49,7 +49,7 @@ func TestUserRead(t *testing.T) {
 			reqURL:           "/v1/users/3",
 			reqMethod:        http.MethodGet,
 			secret:           searchToken,
-			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
 		},
 		{
 			name:             "search user can see a plainuser account info",
@@ -57,7 +57,7 @@ func TestUserRead(t *testing.T) {
 			reqURL:           "/v1/users/3",
 			reqMethod:        http.MethodGet,
 			secret:           searchToken,
-			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false}`,
+			expectedBodyJSON: `{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}`,
 		},
 		{
 			name:             "uid must be an integer",
@@ -131,6 +131,14 @@ func TestUserRead(t *testing.T) {
 			secret:           plainUserToken,
 			expectedBodyJSON: `{"uid":3}`,
 		},
+		{
+			name:             "usernames are case-insensitive",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/users/Saul/uid",
+			reqMethod:        http.MethodGet,
+			secret:           searchToken,
+			expectedBodyJSON: `{"uid":3}`,
+		},
 	}
 
 	for _, tc := range testCases {
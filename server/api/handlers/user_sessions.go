@@ -0,0 +1,276 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// storedSession keeps the token ids of a session, they're not shown in
+// session listings
+type storedSession struct {
+	types.Session
+	JTI  string `json:"jti"`
+	AJTI string `json:"ajti"`
+}
+
+// sessionKey returns the key-value store key for a session
+func sessionKey(uid uint32, sid string) string {
+	return fmt.Sprintf("session-%d-%s", uid, sid)
+}
+
+// saveSession stores a session until its refresh token expires
+func (h *Handler) saveSession(s types.Session, expiration time.Duration) error {
+	data, err := json.Marshal(storedSession{Session: s, JTI: s.JTI, AJTI: s.AJTI})
+	if err != nil {
+		return err
+	}
+	return h.KV.Set(sessionKey(s.UID, s.ID), string(data), expiration)
+}
+
+// getSession reads a session from the key-value store
+func (h *Handler) getSession(uid uint32, sid string) (*types.Session, bool, error) {
+	val, found, err := h.KV.Get(sessionKey(uid, sid))
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	stored := storedSession{}
+	if err := json.Unmarshal([]byte(val), &stored); err != nil {
+		return nil, false, err
+	}
+	s := stored.Session
+	s.JTI = stored.JTI
+	s.AJTI = stored.AJTI
+	return &s, true, nil
+}
+
+// findSessions returns the sessions of a user, oldest first
+func (h *Handler) findSessions(uid uint32) ([]types.Session, error) {
+	prefix := sessionKey(uid, "")
+	keys, err := h.KV.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []types.Session{}
+	for _, key := range keys {
+		sid := strings.TrimPrefix(key, prefix)
+		s, found, err := h.getSession(uid, sid)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			sessions = append(sessions, *s)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// revokeSession blacklists the tokens of a session and removes it
+func (h *Handler) revokeSession(s types.Session, settings types.APISettings) error {
+	expiration := time.Second * time.Duration(settings.RefreshTokenExpiry)
+	for _, jti := range []string{s.JTI, s.AJTI} {
+		if jti == "" {
+			continue
+		}
+		if err := h.KV.Set(jti, "true", expiration); err != nil {
+			return err
+		}
+	}
+	return h.KV.Delete(sessionKey(s.UID, s.ID))
+}
+
+// invalidateUserTokens bumps the user's token generation so all its outstanding
+// access and refresh tokens are rejected, revokes its personal API tokens and
+// removes its session records
+func (h *Handler) invalidateUserTokens(uid uint32) error {
+	err := h.DB.Model(&models.User{}).Where("id = ?", uid).Update("token_generation", gorm.Expr("token_generation + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", uid).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.findSessions(uid)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err := h.KV.Delete(sessionKey(s.UID, s.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionUID gets the uid param for session requests
+func sessionUID(c echo.Context) (uint32, error) {
+	if c.Param("uid") == "" {
+		return 0, &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return 0, &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+	return uint32(uid), nil
+}
+
+// FindSessions - TODO comment
+// @Summary      List sessions
+// @Description  List the login sessions of a user account with the client IP address and user agent
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Success      200  {array}   types.Session
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/sessions [get]
+// @Security 		 Bearer
+func (h *Handler) FindSessions(c echo.Context) error {
+	// API tokens can't be used to manage sessions
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage sessions"}
+	}
+
+	uid, err := sessionUID(c)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.findSessions(uid)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not query the key-value store"}
+	}
+
+	// Mark the session used by this request
+	claims := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	if sid, ok := claims["sid"].(string); ok {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == sid
+		}
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSessions - TODO comment
+// @Summary      Revoke sessions
+// @Description  Revoke all the login sessions of a user account. Their access and refresh tokens can no longer be used
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/sessions [delete]
+// @Security 		 Bearer
+func (h *Handler) RevokeSessions(c echo.Context, settings types.APISettings) error {
+	// API tokens can't be used to manage sessions
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage sessions"}
+	}
+
+	uid, err := sessionUID(c)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.findSessions(uid)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not query the key-value store"}
+	}
+
+	for _, s := range sessions {
+		if err := h.revokeSession(s, settings); err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not revoke session"}
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeSession - TODO comment
+// @Summary      Revoke session
+// @Description  Revoke a login session. Its access and refresh tokens can no longer be used
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        sid   path      string  true  "Session ID"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/sessions/{sid} [delete]
+// @Security 		 Bearer
+func (h *Handler) RevokeSession(c echo.Context, settings types.APISettings) error {
+	// API tokens can't be used to manage sessions
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage sessions"}
+	}
+
+	uid, err := sessionUID(c)
+	if err != nil {
+		return err
+	}
+
+	s, found, err := h.getSession(uid, c.Param("sid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not query the key-value store"}
+	}
+	if !found {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "session not found"}
+	}
+
+	if err := h.revokeSession(*s, settings); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not revoke session"}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
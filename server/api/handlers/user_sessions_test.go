@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doncicuto/glim/types"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func getSessions(t *testing.T, e *echo.Echo, secret string, uid int) []types.Session {
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/users/%d/sessions", uid), nil)
+	req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", secret))
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not list sessions - %d %s", res.Code, res.Body.String())
+	}
+	sessions := []types.Session{}
+	json.Unmarshal(res.Body.Bytes(), &sessions)
+	return sessions
+}
+
+func refreshTokens(e *echo.Echo, refreshToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/login/refresh_token", strings.NewReader(fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "glim-test")
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	return res
+}
+
+func TestUserSessions(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+
+	// Log in with admin and twice with a plain user
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	firstToken, firstRefreshToken := getUserTokens("saul", h, e, settings)
+	secondToken, secondRefreshToken := getUserTokens("saul", h, e, settings)
+	kimToken, _ := getUserTokens("kim", h, e, settings)
+
+	// Sessions are listed with the one used by the request marked
+	sessions := getSessions(t, e, secondToken, 3)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+	assert.Equal(t, uint32(3), sessions[0].UID)
+	assert.Equal(t, "192.0.2.1", sessions[0].IP)
+	assert.NotEqual(t, sessions[0].ID, sessions[1].ID)
+
+	testCases := []RestTestCase{
+		{
+			name:             "plain user can't list other users sessions",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/sessions",
+			reqMethod:        http.MethodGet,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "plain user can't revoke other users sessions",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/sessions",
+			reqMethod:        http.MethodDelete,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "session not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/3/sessions/unknown",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"session not found"}`,
+		},
+		{
+			name:       "manager revokes a session",
+			expResCode: http.StatusNoContent,
+			reqURL:     "/v1/users/3/sessions/" + sessions[0].ID,
+			reqMethod:  http.MethodDelete,
+			secret:     adminToken,
+		},
+		{
+			name:             "access token of revoked session is rejected",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/users/3",
+			reqMethod:        http.MethodGet,
+			secret:           firstToken,
+			expectedBodyJSON: `{"message":"token no longer valid"}`,
+		},
+		{
+			name:       "access token of other sessions is accepted",
+			expResCode: http.StatusOK,
+			reqURL:     "/v1/users/3",
+			reqMethod:  http.MethodGet,
+			secret:     secondToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+
+	// Refresh token of revoked session is rejected
+	res := refreshTokens(e, firstRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	// Refreshing updates the session
+	res = refreshTokens(e, secondRefreshToken)
+	assert.Equal(t, http.StatusOK, res.Code)
+	tokens := types.TokenAuthentication{}
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+
+	sessions = getSessions(t, e, tokens.AccessToken, 3)
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	assert.True(t, sessions[0].Current)
+	assert.Equal(t, "glim-test", sessions[0].UserAgent)
+	assert.True(t, sessions[0].LastRefreshAt.After(sessions[0].CreatedAt))
+
+	// User revokes all its sessions
+	runTests(t, RestTestCase{
+		name:       "revoke all sessions",
+		expResCode: http.StatusNoContent,
+		reqURL:     "/v1/users/3/sessions",
+		reqMethod:  http.MethodDelete,
+		secret:     tokens.AccessToken,
+	}, e)
+
+	runTests(t, RestTestCase{
+		name:             "access token of refreshed session is rejected",
+		expResCode:       http.StatusUnauthorized,
+		reqURL:           "/v1/users/3",
+		reqMethod:        http.MethodGet,
+		secret:           tokens.AccessToken,
+		expectedBodyJSON: `{"message":"token no longer valid"}`,
+	}, e)
+
+	res = refreshTokens(e, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	assert.Equal(t, 0, len(getSessions(t, e, adminToken, 3)))
+
+	// Logout removes the session
+	_, refreshToken := getUserTokens("mike", h, e, settings)
+	assert.Equal(t, 1, len(getSessions(t, e, adminToken, 5)))
+	req := httptest.NewRequest(http.MethodDelete, "/v1/login/refresh_token", strings.NewReader(fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, 0, len(getSessions(t, e, adminToken, 5)))
+}
+
+func TestUserSessionsClientAddress(t *testing.T) {
+	// Setup
+	_, e, _ := testSetup(t, false)
+	defer testCleanUp()
+
+	request := func(target string, body string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.1")
+		req.Header.Set(echo.HeaderXRealIP, "203.0.113.2")
+		req.RemoteAddr = ip + ":34567"
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+
+	// Forged headers are not recorded as the session address
+	res := request("/v1/login", `{"username": "saul", "password": "test"}`, "192.0.2.60")
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not log in - %d %s", res.Code, res.Body.String())
+	}
+	tokens := types.TokenAuthentication{}
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+	sessions := getSessions(t, e, tokens.AccessToken, 3)
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	assert.Equal(t, "192.0.2.60", sessions[0].IP)
+
+	// neither when tokens are refreshed
+	res = request("/v1/login/refresh_token", fmt.Sprintf(`{"refresh_token": "%s"}`, tokens.RefreshToken), "192.0.2.61")
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not refresh tokens - %d %s", res.Code, res.Body.String())
+	}
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+	sessions = getSessions(t, e, tokens.AccessToken, 3)
+	assert.Equal(t, "192.0.2.61", sessions[0].IP)
+}
@@ -0,0 +1,280 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/totp"
+	"github.com/doncicuto/glim/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// EnrollTOTP - TODO comment
+// @Summary      Start two-factor authentication enrollment
+// @Description  Generate a new TOTP secret and recovery codes for a user account. The secret must be confirmed with a valid code before it's enforced at login
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Success      200  {object}  models.TOTPEnrollment
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/totp [post]
+// @Security 		 Bearer
+func (h *Handler) EnrollTOTP(c echo.Context, settings types.APISettings) error {
+	var dbUser models.User
+
+	// API tokens can't be used to manage two-factor authentication
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage two-factor authentication"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	id, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	// Check if user exists
+	err = h.DB.Where("id = ?", id).First(&dbUser).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// Users must disable two-factor authentication before enrolling again
+	if totp.Enabled(&dbUser) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "two-factor authentication is already enabled"}
+	}
+
+	// Generate secret and recovery codes
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate TOTP secret"}
+	}
+
+	encryptedSecret, err := totp.Encrypt(settings.TOTPSecretKey, secret)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not encrypt TOTP secret"}
+	}
+
+	codes, hashedCodes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not generate recovery codes"}
+	}
+
+	// Store pending enrollment
+	err = h.DB.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":         encryptedSecret,
+		"totp_recovery_codes": hashedCodes,
+		"totp_enabled":        false,
+		"updated_at":          time.Now(),
+	}).Error
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.JSON(http.StatusOK, models.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, *dbUser.Username),
+		RecoveryCodes:   codes,
+	})
+}
+
+// ActivateTOTP - TODO comment
+// @Summary      Confirm two-factor authentication enrollment
+// @Description  Confirm a pending TOTP enrollment with a code from the authenticator app
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        code body models.JSONTOTPBody  true  "TOTP code"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/totp [put]
+// @Security 		 Bearer
+func (h *Handler) ActivateTOTP(c echo.Context, settings types.APISettings) error {
+	var dbUser models.User
+
+	// API tokens can't be used to manage two-factor authentication
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage two-factor authentication"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	id, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	// Bind body
+	body := new(models.JSONTOTPBody)
+	if err := c.Bind(body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	if body.Code == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required TOTP code"}
+	}
+
+	// Check if user exists
+	err = h.DB.Where("id = ?", id).First(&dbUser).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if totp.Enabled(&dbUser) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "two-factor authentication is already enabled"}
+	}
+
+	if dbUser.TOTPSecret == nil || *dbUser.TOTPSecret == "" {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "two-factor authentication enrollment has not been started"}
+	}
+
+	// Only TOTP codes are valid here, recovery codes can't confirm an enrollment
+	if err := totp.VerifyCode(h.KV, settings.TOTPSecretKey, &dbUser, body.Code); err != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong two-factor authentication code"}
+	}
+
+	err = h.DB.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_enabled": true,
+		"updated_at":   time.Now(),
+	}).Error
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DisableTOTP - TODO comment
+// @Summary      Disable two-factor authentication
+// @Description  Remove the TOTP secret and recovery codes of a user account. Users disabling their own two-factor authentication must provide a valid code
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User Account ID"
+// @Param        code body models.JSONTOTPBody  false  "TOTP or recovery code"
+// @Success      204
+// @Failure			 400  {object} types.ErrorResponse
+// @Failure			 401  {object} types.ErrorResponse
+// @Failure 	   403  {object} types.ErrorResponse
+// @Failure 	   404  {object} types.ErrorResponse
+// @Failure 	   406  {object} types.ErrorResponse
+// @Failure 	   500  {object} types.ErrorResponse
+// @Router       /users/{id}/totp [delete]
+// @Security 		 Bearer
+func (h *Handler) DisableTOTP(c echo.Context, settings types.APISettings) error {
+	var dbUser models.User
+
+	// API tokens can't be used to manage two-factor authentication
+	if isAPIToken(c) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "api tokens can't be used to manage two-factor authentication"}
+	}
+
+	// User id cannot be empty
+	if c.Param("uid") == "" {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "required user uid"}
+	}
+
+	id, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "uid param should be a valid integer"}
+	}
+
+	// Bind body
+	body := new(models.JSONTOTPBody)
+	if err := c.Bind(body); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Get manager status from JWT token
+	if c.Get("user") == nil {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "wrong token or missing info in token claims"}
+	}
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	manager, ok := claims["manager"].(bool)
+	if !ok {
+		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "wrong token or missing info in token claims"}
+	}
+
+	// Check if user exists
+	err = h.DB.Where("id = ?", id).First(&dbUser).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "user not found"}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if dbUser.TOTPSecret == nil || *dbUser.TOTPSecret == "" {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "two-factor authentication is not enabled"}
+	}
+
+	// A stolen access token shouldn't be enough to remove the second factor,
+	// so only managers can disable it without a valid code
+	if !manager && totp.Enabled(&dbUser) {
+		if body.Code == "" {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: types.TOTPCodeRequired}
+		}
+		if err := totp.Verify(h.DB, h.KV, settings.TOTPSecretKey, &dbUser, body.Code); err != nil {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "wrong two-factor authentication code"}
+		}
+	}
+
+	err = h.DB.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":         "",
+		"totp_recovery_codes": "",
+		"totp_enabled":        false,
+		"updated_at":          time.Now(),
+	}).Error
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/totp"
+	"github.com/labstack/echo/v4"
+)
+
+func TestUserTOTP(t *testing.T) {
+	// Setup
+	h, e, settings := testSetup(t, false)
+	defer testCleanUp()
+	settings.TOTPSecretKey = "totpsecret"
+	e = EchoServer(settings)
+
+	// Log in with admin, search and/or plain user and get tokens
+	adminToken, _ := getUserTokens("admin", h, e, settings)
+	searchToken, _ := getUserTokens("search", h, e, settings)
+	kimToken, _ := getUserTokens("kim", h, e, settings)
+
+	// Enroll kim
+	req := httptest.NewRequest(http.MethodPost, "/v1/users/4/totp", nil)
+	req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("Bearer %v", kimToken))
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("could not enroll kim - %d %s", res.Code, res.Body.String())
+	}
+	enrollment := models.TOTPEnrollment{}
+	if err := json.Unmarshal(res.Body.Bytes(), &enrollment); err != nil {
+		t.Fatalf("could not decode enrollment - %v", err)
+	}
+	if len(enrollment.RecoveryCodes) != totp.RecoveryCodes || !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/Glim:kim?") {
+		t.Fatalf("wrong enrollment response - %s", res.Body.String())
+	}
+
+	// Secret must be encrypted at rest
+	var kim models.User
+	h.DB.Where("username = ?", "kim").Take(&kim)
+	if *kim.TOTPSecret == enrollment.Secret {
+		t.Fatalf("TOTP secret stored in plain text")
+	}
+
+	// Recovery codes are long random values stored as SHA-256 hashes
+	hashes := strings.Split(*kim.TOTPRecoveryCodes, ",")
+	if len(enrollment.RecoveryCodes[0]) != 19 || len(hashes) != totp.RecoveryCodes || len(hashes[0]) != 64 {
+		t.Fatalf("wrong recovery codes - %v %v", enrollment.RecoveryCodes, hashes)
+	}
+
+	// Concurrent logins can't redeem the same recovery code twice
+	staleKim := kim
+	if err := totp.Verify(h.DB, h.KV, settings.TOTPSecretKey, &kim, enrollment.RecoveryCodes[2]); err != nil {
+		t.Fatalf("could not use recovery code - %v", err)
+	}
+	if err := totp.Verify(h.DB, h.KV, settings.TOTPSecretKey, &staleKim, enrollment.RecoveryCodes[2]); err != totp.ErrInvalidCode {
+		t.Fatalf("recovery code used twice - %v", err)
+	}
+
+	counter := totp.Counter(time.Now())
+	code, _ := totp.Code(enrollment.Secret, counter)
+	nextCode, _ := totp.Code(enrollment.Secret, counter+1)
+
+	// Test cases
+	testCases := []RestTestCase{
+		{
+			name:             "user has no proper permissions to enroll other user",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/3/totp",
+			reqMethod:        http.MethodPost,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "readonly user can't enroll",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/2/totp",
+			reqMethod:        http.MethodPost,
+			secret:           searchToken,
+			expectedBodyJSON: `{"message":"user has no proper permissions"}`,
+		},
+		{
+			name:             "user not found",
+			expResCode:       http.StatusNotFound,
+			reqURL:           "/v1/users/1000/totp",
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"user not found"}`,
+		},
+		{
+			name:        "login not enforced until enrollment is confirmed",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "kim", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:             "activation requires code",
+			expResCode:       http.StatusNotAcceptable,
+			reqURL:           "/v1/users/4/totp",
+			reqBodyJSON:      `{"code": ""}`,
+			reqMethod:        http.MethodPut,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"required TOTP code"}`,
+		},
+		{
+			name:             "activation with wrong code",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/4/totp",
+			reqBodyJSON:      `{"code": "abcdef"}`,
+			reqMethod:        http.MethodPut,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"wrong two-factor authentication code"}`,
+		},
+		{
+			name:             "activation with recovery code is not allowed",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/4/totp",
+			reqBodyJSON:      fmt.Sprintf(`{"code": "%s"}`, enrollment.RecoveryCodes[0]),
+			reqMethod:        http.MethodPut,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"wrong two-factor authentication code"}`,
+		},
+		{
+			name:        "activation succesful",
+			expResCode:  http.StatusNoContent,
+			reqURL:      "/v1/users/4/totp",
+			reqBodyJSON: fmt.Sprintf(`{"code": "%s"}`, code),
+			reqMethod:   http.MethodPut,
+			secret:      kimToken,
+		},
+		{
+			name:             "enrollment not allowed while enabled",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/4/totp",
+			reqMethod:        http.MethodPost,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"two-factor authentication is already enabled"}`,
+		},
+		{
+			name:             "login without code",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      `{"username": "kim", "password": "test"}`,
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"two-factor authentication code required"}`,
+		},
+		{
+			name:             "login with wrong password and code",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      fmt.Sprintf(`{"username": "kim", "password": "boooo", "totp_code": "%s"}`, nextCode),
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"wrong username or password"}`,
+		},
+		{
+			name:             "login replaying activation code",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      fmt.Sprintf(`{"username": "kim", "password": "test", "totp_code": "%s"}`, code),
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"wrong two-factor authentication code"}`,
+		},
+		{
+			name:        "login with code",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: fmt.Sprintf(`{"username": "kim", "password": "test", "totp_code": "%s"}`, nextCode),
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:             "login replaying code",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      fmt.Sprintf(`{"username": "kim", "password": "test", "totp_code": "%s"}`, nextCode),
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"wrong two-factor authentication code"}`,
+		},
+		{
+			name:        "login with recovery code",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: fmt.Sprintf(`{"username": "kim", "password": "test", "totp_code": "%s"}`, enrollment.RecoveryCodes[0]),
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:             "recovery codes can only be used once",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      fmt.Sprintf(`{"username": "kim", "password": "test", "totp_code": "%s"}`, enrollment.RecoveryCodes[0]),
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"wrong two-factor authentication code"}`,
+		},
+		{
+			name:             "user needs a code to disable two-factor authentication",
+			expResCode:       http.StatusForbidden,
+			reqURL:           "/v1/users/4/totp",
+			reqMethod:        http.MethodDelete,
+			secret:           kimToken,
+			expectedBodyJSON: `{"message":"two-factor authentication code required"}`,
+		},
+		{
+			name:        "user disables two-factor authentication with recovery code",
+			expResCode:  http.StatusNoContent,
+			reqURL:      "/v1/users/4/totp",
+			reqBodyJSON: fmt.Sprintf(`{"code": "%s"}`, enrollment.RecoveryCodes[1]),
+			reqMethod:   http.MethodDelete,
+			secret:      kimToken,
+		},
+		{
+			name:             "two-factor authentication not enabled",
+			expResCode:       http.StatusBadRequest,
+			reqURL:           "/v1/users/4/totp",
+			reqMethod:        http.MethodDelete,
+			secret:           adminToken,
+			expectedBodyJSON: `{"message":"two-factor authentication is not enabled"}`,
+		},
+		{
+			name:        "login after disabling two-factor authentication",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "kim", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+		},
+		{
+			name:             "group requiring two-factor authentication",
+			expResCode:       http.StatusOK,
+			reqURL:           "/v1/groups",
+			reqBodyJSON:      `{"name": "mfa", "description": "MFA required", "members": "saul", "require_mfa": true}`,
+			reqMethod:        http.MethodPost,
+			secret:           adminToken,
+			expectedBodyJSON: `{"gid":1,"name":"mfa","description":"MFA required","members":[{"uid":3,"username":"saul","name":"","firstname":"","lastname":"","email":"","ssh_public_key":"","jpeg_photo":"","manager":false,"readonly":false,"locked":false,"uid_number":10002,"gid_number":10002,"home_directory":"/home/saul","login_shell":"/bin/bash"}],"guac_config_protocol":"","guac_config_parameters":"","require_mfa":true,"gid_number":30000}`,
+		},
+		{
+			name:             "login not enrolled member of group requiring two-factor authentication",
+			expResCode:       http.StatusUnauthorized,
+			reqURL:           "/v1/login",
+			reqBodyJSON:      `{"username": "saul", "password": "test"}`,
+			reqMethod:        http.MethodPost,
+			expectedBodyJSON: `{"message":"two-factor authentication is required for this account, please contact a manager to enroll"}`,
+		},
+		{
+			name:        "group no longer requires two-factor authentication",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/groups/1",
+			reqBodyJSON: `{"require_mfa": false}`,
+			reqMethod:   http.MethodPut,
+			secret:      adminToken,
+		},
+		{
+			name:        "login member of group not requiring two-factor authentication",
+			expResCode:  http.StatusOK,
+			reqURL:      "/v1/login",
+			reqBodyJSON: `{"username": "saul", "password": "test"}`,
+			reqMethod:   http.MethodPost,
+		},
+	}
+
+	for _, tc := range testCases {
+		runTests(t, tc, e)
+	}
+}
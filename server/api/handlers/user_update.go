@@ -40,7 +40,7 @@ func (h *Handler) RemoveMembersOf(u *models.User, memberOf []string) error {
 		member = strings.TrimSpace(member)
 		// Find group
 		g := new(models.Group)
-		err = h.DB.Model(&models.Group{}).Where("name = ?", member).Take(&g).Error
+		err = h.DB.Model(&models.Group{}).Where("name_folded = ?", models.FoldIdentity(member)).Take(&g).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return &echo.HTTPError{Code: http.StatusNotFound, Message: fmt.Sprintf("group %s not found", member)}
@@ -64,7 +64,7 @@ func (h *Handler) RemoveMembersOf(u *models.User, memberOf []string) error {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "User Account ID"
-// @Param        user  body models.JSONUserBody  true  "User account body. Username is required. The members property expect a comma-separated list of group names e.g 'admin,devel'. Password property is optional, if set it will be the password for that user, if no password is sent the user account will be locked (user can not log in). Manager property if true will assign the Manager role. Readonly property if true will set this user for read-only usage (queries). Locked property if true will disable log in for that user. Remove property if true will remove group membership from those specified in the members property. Remove property if true will replace group membership from those specified in the members property. Name property is not used"
+// @Param        user  body models.JSONUserBody  true  "User account body. Username is required. The members property expect a comma-separated list of group names e.g 'admin,devel'. Password property is optional, if set it will be the password for that user, if no password is sent the user account will be locked (user can not log in). Manager property if true will assign the Manager role. Readonly property if true will set this user for read-only usage (queries). Locked property if true will disable log in for that user. Remove property if true will remove group membership from those specified in the members property. Remove property if true will replace group membership from those specified in the members property. LDAP require OTP property if true will require a TOTP code appended to the password in LDAP binds. Proxy authz property if true will allow the account to use the LDAP proxied authorization control. Attributes property replaces the values of the custom attributes it has, an empty list removes an attribute, users can only update the public attributes defined as user editable. UID number, GID number and home directory properties can only be updated by managers, a home directory that follows the configured template is renamed with the user. Name property is not used"
 // @Success      200  {object}  models.UserInfo
 // @Failure			 400  {object} types.ErrorResponse
 // @Failure			 401  {object} types.ErrorResponse
@@ -127,7 +127,7 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 
 	// Validate other fields
 	if body.Username != "" {
-		err := h.DB.Model(&models.User{}).Where("username = ? AND id <> ?", body.Username, uid).First(&models.User{}).Error
+		err := h.DB.Model(&models.User{}).Where("username_folded = ? AND id <> ?", models.FoldIdentity(body.Username), uid).First(&models.User{}).Error
 		if err != nil {
 			// Does username exist?
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -163,6 +163,10 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 		if _, err := mail.ParseAddress(body.Email); err != nil {
 			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "invalid email"}
 		}
+		err := h.DB.Model(&models.User{}).Where("email_folded = ? AND id <> ?", models.FoldIdentity(body.Email), uid).First(&models.User{}).Error
+		if err == nil {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "email cannot be duplicated"}
+		}
 		updatedUser["email"] = body.Email
 	}
 
@@ -195,16 +199,112 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 		updatedUser["locked"] = *body.Locked
 	}
 
+	// Users can require OTP codes for their LDAP binds but only managers can remove that requirement
+	if body.LDAPRequireOTP != nil {
+		if !manager && !*body.LDAPRequireOTP {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "only managers can remove the LDAP OTP requirement"}
+		}
+		updatedUser["ldap_require_otp"] = *body.LDAPRequireOTP
+	}
+
+	if body.ProxyAuthz != nil {
+		if !manager {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "only managers can update the proxy authorization right"}
+		}
+		updatedUser["proxy_authz"] = *body.ProxyAuthz
+	}
+
+	// POSIX attributes, users can only choose their login shell
+	if body.UIDNumber != nil {
+		if !manager {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "only managers can update the uid number"}
+		}
+		if *body.UIDNumber == 0 {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "uid number must be greater than 0"}
+		}
+		err := h.DB.Model(&models.User{}).Where("uid_number = ? AND id <> ?", *body.UIDNumber, uid).First(&models.User{}).Error
+		if err == nil {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "uid number cannot be duplicated"}
+		}
+		updatedUser["uid_number"] = *body.UIDNumber
+	}
+
+	if body.GIDNumber != nil {
+		if !manager {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "only managers can update the gid number"}
+		}
+		if *body.GIDNumber == 0 {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "gid number must be greater than 0"}
+		}
+		updatedUser["gid_number"] = *body.GIDNumber
+	}
+
+	if body.HomeDirectory != "" {
+		if !manager {
+			return &echo.HTTPError{Code: http.StatusForbidden, Message: "only managers can update the home directory"}
+		}
+		if !models.ValidPOSIXPath(body.HomeDirectory) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "home directory must be an absolute path"}
+		}
+		updatedUser["home_directory"] = body.HomeDirectory
+	} else if u.HomeDirectory != nil && u.UIDNumber != nil && *u.HomeDirectory == models.HomeDirectory(*u.Username, *u.UIDNumber) {
+		// Home directories that follow the template keep following it
+		username := *u.Username
+		if v, ok := updatedUser["username"]; ok {
+			username = v.(string)
+		}
+		uidNumber := *u.UIDNumber
+		if body.UIDNumber != nil {
+			uidNumber = *body.UIDNumber
+		}
+		if home := models.HomeDirectory(username, uidNumber); home != *u.HomeDirectory {
+			updatedUser["home_directory"] = home
+		}
+	}
+
+	if body.LoginShell != "" {
+		if !models.ValidPOSIXPath(body.LoginShell) {
+			return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "login shell must be an absolute path"}
+		}
+		updatedUser["login_shell"] = body.LoginShell
+	}
+
+	// Custom attributes, users can only set the public attributes they can edit
+	changes, err := models.PrepareAttributeChanges(h.DB, body.Attributes, models.AttributeForUsers)
+	if err != nil {
+		return attributesError(err)
+	}
+	if !manager {
+		for _, change := range changes {
+			if !change.Attribute.IsUserEditable() || change.Attribute.IsPrivate() {
+				return &echo.HTTPError{Code: http.StatusForbidden, Message: fmt.Sprintf("only managers can update the %s attribute", *change.Attribute.Name)}
+			}
+		}
+	}
+
 	if body.ReplaceMembersOf && body.RemoveMembersOf {
 		return &echo.HTTPError{Code: http.StatusNotAcceptable, Message: "replace and replace are mutually exclusive"}
 	}
 
+	// Demoted or locked users must log in again
+	invalidateTokens := (body.Manager != nil && *body.Manager != (u.Manager != nil && *u.Manager)) ||
+		(body.Readonly != nil && *body.Readonly != (u.Readonly != nil && *u.Readonly)) ||
+		(body.Locked != nil && *body.Locked && !(u.Locked != nil && *u.Locked))
+
 	// Update date
 	updatedUser["updated_at"] = time.Now()
 	updatedUser["updated_by"] = *modifiedBy.Username
 
-	// Update user
-	err = h.DB.Model(&models.User{}).Where("id = ?", uid).Updates(updatedUser).Error
+	// Update user, a uidNumber chosen by a manager is reserved along with it
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", uid).Updates(updatedUser).Error; err != nil {
+			return err
+		}
+		if body.UIDNumber != nil {
+			return models.ReserveUIDNumber(tx, *body.UIDNumber)
+		}
+		return nil
+	})
 	if err != nil {
 		// Does user exist?
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -213,6 +313,16 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	if err := models.ApplyAttributeChanges(h.DB, changes, &u.ID, nil); err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	if invalidateTokens {
+		if err := h.invalidateUserTokens(uint32(uid)); err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "could not invalidate user tokens"}
+		}
+	}
+
 	// Get updated user
 	err = h.DB.Where("id = ?", uid).First(&u).Error
 	if err != nil {
@@ -253,6 +363,12 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
 
+	u.Attributes, err = h.attributeValues("user_id", u.ID)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	u.Attributes = visibleAttributes(c, u.Attributes)
+
 	// Return user
 	showMemberOf := true
 	return c.JSON(http.StatusOK, models.GetUserInfo(*u, showMemberOf, h.Guacamole))
@@ -18,6 +18,7 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"sync"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/labstack/gommon/log"
 
 	"github.com/doncicuto/glim/server/api/handlers"
+	"github.com/doncicuto/glim/server/clientcert"
 	"github.com/doncicuto/glim/types"
 )
 
@@ -43,8 +45,22 @@ func Server(wg *sync.WaitGroup, shutdownChannel chan bool, settings types.APISet
 	}))
 	e.Logger.Printf("starting REST API in address %s...", settings.Address)
 
+	// TLS server, client certificates are requested if enabled
+	cert, err := tls.LoadX509KeyPair(settings.TLSCert, settings.TLSKey)
+	if err != nil {
+		e.Logger.Fatal("could not load server certificate and private key pair")
+	}
+	e.TLSServer.Addr = settings.Address
+	e.TLSServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if err := clientcert.ConfigureTLS(e.TLSServer.TLSConfig, settings.ClientCertMode, settings.ClientCA); err != nil {
+		e.Logger.Fatal(err)
+	}
+	if settings.ClientCertMode == clientcert.ModeRequest || settings.ClientCertMode == clientcert.ModeRequire {
+		e.Logger.Printf("REST API client certificates mode: %s...", settings.ClientCertMode)
+	}
+
 	go func() {
-		if err := e.StartTLS(settings.Address, settings.TLSCert, settings.TLSKey); err != nil {
+		if err := e.StartServer(e.TLSServer); err != nil {
 			e.Logger.Printf("shutting down REST API server...")
 		}
 	}()
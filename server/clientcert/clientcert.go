@@ -0,0 +1,154 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Client certificate modes for the REST API
+const (
+	// ModeNone - client certificates are not requested
+	ModeNone = "none"
+	// ModeRequest - client certificates are requested and verified if sent
+	ModeRequest = "request"
+	// ModeRequire - requests without a valid client certificate are rejected
+	ModeRequire = "require"
+)
+
+// Certificate fields that can be mapped to a Glim user
+const (
+	FieldCN    = "cn"
+	FieldEmail = "email"
+	FieldDNS   = "dns"
+	FieldURI   = "uri"
+)
+
+// ValidMode checks if we know the client certificate mode
+func ValidMode(mode string) bool {
+	return mode == ModeNone || mode == ModeRequest || mode == ModeRequire
+}
+
+// ConfigureTLS asks for client certificates signed by the CA stored in the
+// caFile PEM file, according to the mode
+func ConfigureTLS(config *tls.Config, mode string, caFile string) error {
+	switch mode {
+	case ModeNone, "":
+		return nil
+	case ModeRequest:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ModeRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("wrong client certificate mode %s, expected none, request or require", mode)
+	}
+
+	if caFile == "" {
+		return fmt.Errorf("a client CA file is required to verify client certificates")
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("could not read client CA file %s", caFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+	config.ClientCAs = pool
+	return nil
+}
+
+// Mapping tells us which Glim user a client certificate belongs to. The
+// value of a certificate field is used as the username unless a regular
+// expression is set, then its first capture group is used. Email SANs are
+// compared with the users' email when no regular expression is set
+type Mapping struct {
+	Field   string
+	Pattern *regexp.Regexp
+}
+
+// ParseMapping parses a mapping rule using the field[:regexp] format e.g
+// cn or email:^(.+)@example\.org$
+func ParseMapping(rule string) (*Mapping, error) {
+	parts := strings.SplitN(rule, ":", 2)
+
+	m := Mapping{Field: strings.ToLower(strings.TrimSpace(parts[0]))}
+	switch m.Field {
+	case FieldCN, FieldEmail, FieldDNS, FieldURI:
+	default:
+		return nil, fmt.Errorf("wrong client certificate field %s, expected cn, email, dns or uri", parts[0])
+	}
+
+	if len(parts) == 2 {
+		pattern, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("wrong client certificate mapping expression %s: %v", parts[1], err)
+		}
+		if pattern.NumSubexp() < 1 {
+			return nil, fmt.Errorf("client certificate mapping expression %s must have a capture group", parts[1])
+		}
+		m.Pattern = pattern
+	}
+
+	return &m, nil
+}
+
+// ByEmail tells us if the identity must be compared with users' email
+func (m *Mapping) ByEmail() bool {
+	return m.Field == FieldEmail && m.Pattern == nil
+}
+
+// values returns the certificate values for the mapping field
+func (m *Mapping) values(cert *x509.Certificate) []string {
+	switch m.Field {
+	case FieldCN:
+		return []string{cert.Subject.CommonName}
+	case FieldEmail:
+		return cert.EmailAddresses
+	case FieldDNS:
+		return cert.DNSNames
+	case FieldURI:
+		uris := []string{}
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		return uris
+	}
+	return nil
+}
+
+// Identity returns the username, or email, a certificate maps to using the
+// first certificate value matching the rule
+func (m *Mapping) Identity(cert *x509.Certificate) (string, bool) {
+	for _, value := range m.values(cert) {
+		if value == "" {
+			continue
+		}
+		if m.Pattern == nil {
+			return value, true
+		}
+		if matches := m.Pattern.FindStringSubmatch(value); len(matches) > 1 && matches[1] != "" {
+			return matches[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Collision - identities that are the same once case-folded e.g Alice and
+// alice. They must be renamed before their unique index can be created
+type Collision struct {
+	Table  string
+	Column string
+	Folded string
+	Values []string
+}
+
+// foldedColumn - a column whose case-folded copy must be unique
+type foldedColumn struct {
+	table  string
+	column string
+	folded string
+}
+
+var foldedColumns = []foldedColumn{
+	{table: "users", column: "username", folded: "username_folded"},
+	{table: "users", column: "email", folded: "email_folded"},
+	{table: "groups", column: "name", folded: "name_folded"},
+}
+
+// foldedIdentity returns the case-folded value stored for an identity
+func foldedIdentity(s *string) interface{} {
+	if s == nil || models.FoldIdentity(*s) == "" {
+		return nil
+	}
+	return models.FoldIdentity(*s)
+}
+
+// backfillFoldedIdentities stores the case-folded identities of rows
+// created before folded columns existed
+func backfillFoldedIdentities(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Where("username_folded IS NULL OR (email_folded IS NULL AND email <> '')").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := db.Model(&models.User{}).Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+			"username_folded": foldedIdentity(u.Username),
+			"email_folded":    foldedIdentity(u.Email),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	var groups []models.Group
+	if err := db.Where("name_folded IS NULL").Find(&groups).Error; err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := db.Model(&models.Group{}).Where("id = ?", g.ID).UpdateColumn("name_folded", foldedIdentity(g.Name)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindCollisions returns the usernames, emails and group names that are
+// duplicated once case-folded
+func FindCollisions(db *gorm.DB) ([]Collision, error) {
+	collisions := []Collision{}
+	for _, c := range foldedColumns {
+		var duplicated []string
+		if err := db.Table(c.table).
+			Where(c.folded+" IS NOT NULL").
+			Group(c.folded).
+			Having("COUNT(*) > 1").
+			Pluck(c.folded, &duplicated).Error; err != nil {
+			return nil, err
+		}
+
+		for _, folded := range duplicated {
+			var values []string
+			if err := db.Table(c.table).Where(c.folded+" = ?", folded).Order(c.column).Pluck(c.column, &values).Error; err != nil {
+				return nil, err
+			}
+			collisions = append(collisions, Collision{Table: c.table, Column: c.column, Folded: folded, Values: values})
+		}
+	}
+	return collisions, nil
+}
+
+// migrateFoldedIdentities fills the case-folded identity columns and adds
+// their unique indexes. Existing collisions are reported and the index of
+// that column is not created until they're fixed
+func migrateFoldedIdentities(db *gorm.DB) ([]Collision, error) {
+	if err := backfillFoldedIdentities(db); err != nil {
+		return nil, err
+	}
+
+	collisions, err := FindCollisions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range foldedColumns {
+		collides := false
+		for _, collision := range collisions {
+			if collision.Table == c.table && collision.Column == c.column {
+				collides = true
+			}
+		}
+		if collides {
+			continue
+		}
+		index := fmt.Sprintf("idx_%s_%s", c.table, c.folded)
+		if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS ? ON ? (?)", clause.Column{Name: index}, clause.Table{Name: c.table}, clause.Column{Name: c.folded}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range collisions {
+		fmt.Printf("%s [Glim] ⇨ %s %s %s collide once case is ignored (%s), please rename them\n", time.Now().Format(time.RFC3339), c.Table, c.Column, strings.Join(c.Values, ", "), c.Folded)
+	}
+	return collisions, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldedIdentitiesMigration(t *testing.T) {
+	dbPath := fmt.Sprintf("/tmp/%s.db", uuid.New().String())
+	defer os.Remove(dbPath)
+
+	db, err := Initialize(dbPath, false, types.DBInit{
+		AdminPasswd:   "test",
+		SearchPasswd:  "test",
+		Users:         "saul,kim",
+		DefaultPasswd: "test",
+		UseSqlite:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+
+	// Identities are folded when they are saved
+	var saul models.User
+	assert.NoError(t, db.Where("username_folded = ?", "saul").Take(&saul).Error)
+	assert.NoError(t, db.Model(&models.User{}).Where("id = ?", saul.ID).Update("email", "Saul@Example.org").Error)
+	assert.NoError(t, db.Where("email_folded = ?", "saul@example.org").Take(&saul).Error)
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "idx_users_username_folded"))
+
+	// Rows written before the migration have no folded identities
+	assert.NoError(t, db.Migrator().DropIndex(&models.User{}, "idx_users_username_folded"))
+	assert.NoError(t, db.Model(&models.User{}).Where("username = ?", "kim").UpdateColumns(map[string]interface{}{
+		"username":        "SAUL",
+		"username_folded": nil,
+	}).Error)
+
+	collisions, err := migrateFoldedIdentities(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []Collision{{Table: "users", Column: "username", Folded: "saul", Values: []string{"SAUL", "saul"}}}, collisions)
+	assert.False(t, db.Migrator().HasIndex(&models.User{}, "idx_users_username_folded"))
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "idx_users_email_folded"))
+	assert.True(t, db.Migrator().HasIndex(&models.Group{}, "idx_groups_name_folded"))
+
+	// Once renamed the unique index is created
+	assert.NoError(t, db.Model(&models.User{}).Where("username = ?", "SAUL").Update("username", "kim").Error)
+	collisions, err = migrateFoldedIdentities(db)
+	assert.NoError(t, err)
+	assert.Empty(t, collisions)
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "idx_users_username_folded"))
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/doncicuto/glim/models"
 	"github.com/doncicuto/glim/types"
@@ -38,7 +39,7 @@ func createUsers(db *gorm.DB, dbInit types.DBInit) {
 
 	for _, username := range strings.Split(users, ",") {
 		var u models.User
-		err := db.Where("username = ?", username).Take(&u).Error
+		err := db.Where("username_folded = ?", models.FoldIdentity(username)).Take(&u).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) && username != "" {
 			createUser(db, username, password)
 		}
@@ -51,6 +52,11 @@ func createUser(db *gorm.DB, username string, password string) {
 		fmt.Printf("Username: %s", "could not be created")
 		return
 	}
+	scram, err := models.ScramSHA256(password)
+	if err != nil {
+		fmt.Printf("Username: %s", "could not be created")
+		return
+	}
 
 	userUUID := uuid.New().String()
 	hashed := string(hash)
@@ -58,11 +64,12 @@ func createUser(db *gorm.DB, username string, password string) {
 	readonly := false
 
 	if err := db.Create(&models.User{
-		Username: &username,
-		Password: &hashed,
-		Manager:  &manager,
-		Readonly: &readonly,
-		UUID:     &userUUID,
+		Username:    &username,
+		Password:    &hashed,
+		ScramSHA256: &scram,
+		Manager:     &manager,
+		Readonly:    &readonly,
+		UUID:        &userUUID,
 	}).Error; err != nil {
 		fmt.Printf("Username: %s", "could not be created")
 	}
@@ -85,6 +92,10 @@ func createManager(db *gorm.DB, initialPassword string) error {
 	if err != nil {
 		return err
 	}
+	scram, err := models.ScramSHA256(chosenPassword)
+	if err != nil {
+		return err
+	}
 	userUUID := uuid.New().String()
 	username := "admin"
 	firstname := "LDAP"
@@ -94,13 +105,14 @@ func createManager(db *gorm.DB, initialPassword string) error {
 	readonly := false
 
 	if err := db.Create(&models.User{
-		Username:  &username,
-		GivenName: &firstname,
-		Surname:   &lastname,
-		Password:  &hashed,
-		Manager:   &manager,
-		Readonly:  &readonly,
-		UUID:      &userUUID,
+		Username:    &username,
+		GivenName:   &firstname,
+		Surname:     &lastname,
+		Password:    &hashed,
+		ScramSHA256: &scram,
+		Manager:     &manager,
+		Readonly:    &readonly,
+		UUID:        &userUUID,
 	}).Error; err != nil {
 		return err
 	}
@@ -119,56 +131,6 @@ func createManager(db *gorm.DB, initialPassword string) error {
 	return nil
 }
 
-func createReadonly(db *gorm.DB, initialPassword string) error {
-	var chosenPassword string
-	var err error
-
-	if initialPassword == "" {
-		chosenPassword, err = password.Generate(64, 10, 0, false, true)
-		if err != nil {
-			return err
-		}
-	} else {
-		chosenPassword = initialPassword
-	}
-
-	hash, err := models.Hash(chosenPassword)
-	if err != nil {
-		return err
-	}
-	userUUID := uuid.New().String()
-	username := "search"
-	firstname := "Read-Only"
-	lastname := "Account"
-	hashed := string(hash)
-	manager := false
-	readonly := true
-
-	if err := db.Create(&models.User{
-		Username:  &username,
-		GivenName: &firstname,
-		Surname:   &lastname,
-		Password:  &hashed,
-		Manager:   &manager,
-		Readonly:  &readonly,
-		UUID:      &userUUID,
-	}).Error; err != nil {
-		return err
-	}
-
-	if os.Getenv("ENV") != "test" {
-		fmt.Println("")
-		fmt.Println("------------------------------------- WARNING -------------------------------------")
-		fmt.Println("A new user with read-only permissions has been created:")
-		fmt.Println("- Username: search") // TODO - Allow username with env
-		fmt.Printf("- Password %s\n", chosenPassword)
-		fmt.Println("Please store or write down this password to perform search queries in Glim.")
-		fmt.Println("-----------------------------------------------------------------------------------")
-	}
-
-	return nil
-}
-
 // Initialize - TODO common
 func Initialize(dbName string, sqlLog bool, dbInit types.DBInit) (*gorm.DB, error) {
 	var db *gorm.DB
@@ -207,6 +169,22 @@ func Initialize(dbName string, sqlLog bool, dbInit types.DBInit) (*gorm.DB, erro
 	// Migrate the schema
 	db.AutoMigrate(&models.User{})
 	db.AutoMigrate(&models.Group{})
+	db.AutoMigrate(&models.AppPassword{})
+	db.AutoMigrate(&models.APIToken{})
+	db.AutoMigrate(&models.OIDCClient{})
+	db.AutoMigrate(&models.Attribute{})
+	db.AutoMigrate(&models.AttributeValue{})
+	db.AutoMigrate(&models.POSIXIDMark{})
+
+	// Readonly users become service accounts under ou=Services
+	if err := migrateServiceAccounts(db); err != nil {
+		return nil, err
+	}
+
+	// Usernames, emails and group names are unique once case-folded
+	if _, err := migrateFoldedIdentities(db); err != nil {
+		return nil, err
+	}
 
 	// Do we have a manager? if not create one
 	var manager models.User
@@ -217,15 +195,23 @@ func Initialize(dbName string, sqlLog bool, dbInit types.DBInit) (*gorm.DB, erro
 		}
 	}
 
-	var search models.User
-	err = db.Where("readonly = ?", true).Take(&search).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		if err := createReadonly(db, dbInit.SearchPasswd); err != nil {
+	// Do we have a service account? if not create the search one
+	var serviceAccounts int64
+	if err := db.Model(&models.ServiceAccount{}).Count(&serviceAccounts).Error; err != nil {
+		return nil, err
+	}
+	if serviceAccounts == 0 {
+		if err := createSearchAccount(db, dbInit.SearchPasswd); err != nil {
 			return nil, err
 		}
 	}
 
 	createUsers(db, dbInit)
 
+	// Users and groups created before POSIX attributes were added
+	if err := assignPOSIXAttributes(db); err != nil {
+		fmt.Printf("%s [Glim] ⇨ could not assign POSIX attributes to existing users and groups. %v\n", time.Now().Format(time.RFC3339), err)
+	}
+
 	return db, nil
 }
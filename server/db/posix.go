@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/doncicuto/glim/models"
+	"gorm.io/gorm"
+)
+
+// assignPOSIXAttributes allocates the POSIX attributes of the users and
+// groups created before Glim had them. Rows are processed in creation order
+// so older accounts get lower ids
+func assignPOSIXAttributes(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Where("uid_number IS NULL OR gid_number IS NULL OR home_directory IS NULL OR login_shell IS NULL").Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := u.AssignPOSIXAttributes(db); err != nil {
+			return err
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+			"uid_number":     *u.UIDNumber,
+			"gid_number":     *u.GIDNumber,
+			"home_directory": *u.HomeDirectory,
+			"login_shell":    *u.LoginShell,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	var groups []models.Group
+	if err := db.Where("gid_number IS NULL").Order("id").Find(&groups).Error; err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := g.AssignGIDNumber(db); err != nil {
+			return err
+		}
+		if err := db.Model(&models.Group{}).Where("id = ?", g.ID).UpdateColumn("gid_number", *g.GIDNumber).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
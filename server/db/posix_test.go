@@ -0,0 +1,111 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPOSIXAttributesMigration(t *testing.T) {
+	dbPath := fmt.Sprintf("/tmp/%s.db", uuid.New().String())
+	defer os.Remove(dbPath)
+
+	db, err := Initialize(dbPath, false, types.DBInit{
+		AdminPasswd:   "test",
+		SearchPasswd:  "test",
+		Users:         "saul,kim",
+		DefaultPasswd: "test",
+		UseSqlite:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+
+	// New users get POSIX attributes
+	var saul models.User
+	assert.NoError(t, db.Where("username = ?", "saul").Take(&saul).Error)
+	assert.Equal(t, uint32(10001), *saul.UIDNumber)
+	assert.Equal(t, uint32(10001), *saul.GIDNumber)
+	assert.Equal(t, "/home/saul", *saul.HomeDirectory)
+	assert.Equal(t, "/bin/bash", *saul.LoginShell)
+
+	// Rows written before POSIX attributes existed get them allocated
+	name := "lawyers"
+	assert.NoError(t, db.Create(&models.Group{Name: &name}).Error)
+	assert.NoError(t, db.Model(&models.Group{}).Where("name = ?", name).UpdateColumn("gid_number", nil).Error)
+	assert.NoError(t, db.Model(&models.User{}).Where("username = ?", "kim").UpdateColumns(map[string]interface{}{
+		"uid_number":     nil,
+		"gid_number":     nil,
+		"home_directory": nil,
+		"login_shell":    nil,
+	}).Error)
+
+	assert.NoError(t, db.Where("1 = 1").Delete(&models.POSIXIDMark{}).Error)
+
+	assert.NoError(t, assignPOSIXAttributes(db))
+
+	var kim models.User
+	assert.NoError(t, db.Where("username = ?", "kim").Take(&kim).Error)
+	assert.Equal(t, uint32(10002), *kim.UIDNumber)
+	assert.Equal(t, uint32(10002), *kim.GIDNumber)
+	assert.Equal(t, "/home/kim", *kim.HomeDirectory)
+
+	var lawyers models.Group
+	assert.NoError(t, db.Where("name = ?", name).Take(&lawyers).Error)
+	assert.Equal(t, uint32(30000), *lawyers.GIDNumber)
+}
+
+func TestPOSIXIDsNotReused(t *testing.T) {
+	dbPath := fmt.Sprintf("/tmp/%s.db", uuid.New().String())
+	defer os.Remove(dbPath)
+
+	db, err := Initialize(dbPath, false, types.DBInit{
+		AdminPasswd:   "test",
+		SearchPasswd:  "test",
+		Users:         "saul",
+		DefaultPasswd: "test",
+		UseSqlite:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+
+	// Deleting the newest user doesn't free its uidNumber
+	kim := "kim"
+	u := models.User{Username: &kim}
+	assert.NoError(t, db.Create(&u).Error)
+	assert.Equal(t, uint32(10002), *u.UIDNumber)
+	assert.NoError(t, db.Where("username = ?", kim).Delete(&models.User{}).Error)
+
+	mike := "mike"
+	u = models.User{Username: &mike}
+	assert.NoError(t, db.Create(&u).Error)
+	assert.Equal(t, uint32(10003), *u.UIDNumber)
+	assert.Equal(t, uint32(10003), *u.GIDNumber)
+
+	// uidNumbers chosen by a manager are not reused either
+	uidNumber := uint32(20000)
+	walter := "walter"
+	assert.NoError(t, db.Create(&models.User{Username: &walter, UIDNumber: &uidNumber}).Error)
+	assert.NoError(t, db.Where("username = ?", walter).Delete(&models.User{}).Error)
+
+	jesse := "jesse"
+	u = models.User{Username: &jesse}
+	assert.NoError(t, db.Create(&u).Error)
+	assert.Equal(t, uint32(20001), *u.UIDNumber)
+
+	// The same goes for groups
+	lawyers := "lawyers"
+	assert.NoError(t, db.Create(&models.Group{Name: &lawyers}).Error)
+	assert.NoError(t, db.Where("name = ?", lawyers).Delete(&models.Group{}).Error)
+
+	fixers := "fixers"
+	g := models.Group{Name: &fixers}
+	assert.NoError(t, db.Create(&g).Error)
+	assert.Equal(t, uint32(30001), *g.GIDNumber)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/sethvargo/go-password/password"
+	"gorm.io/gorm"
+)
+
+// migrateServiceAccounts creates the service accounts table. The first time
+// it's created, readonly users become service accounts as they were the
+// accounts applications used to bind before service accounts existed. Both
+// steps share a transaction so a failed migration is tried again
+func migrateServiceAccounts(db *gorm.DB) error {
+	firstRun := !db.Migrator().HasTable(&models.ServiceAccount{})
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.ServiceAccount{}); err != nil {
+			return err
+		}
+		if !firstRun {
+			return nil
+		}
+		return migrateReadonlyUsers(tx)
+	})
+}
+
+// migrateReadonlyUsers turns readonly users into service accounts with the
+// same name, password and lock status. They keep reading every entry
+func migrateReadonlyUsers(tx *gorm.DB) error {
+	var users []models.User
+	if err := tx.Where("readonly = ? AND (manager IS NULL OR manager = ?)", true, false).Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.Username == nil || u.Password == nil || !models.ValidServiceAccountName(*u.Username) {
+			fmt.Printf("%s [Glim] ⇨ readonly user %d can't be a service account, it's kept as a user\n", time.Now().Format(time.RFC3339), u.ID)
+			continue
+		}
+
+		names := []string{}
+		for _, name := range []*string{u.GivenName, u.Surname} {
+			if name != nil && *name != "" {
+				names = append(names, *name)
+			}
+		}
+		description := strings.Join(names, " ")
+		now := time.Now()
+		allowed, groupsOnly := true, false
+
+		if err := tx.Create(&models.ServiceAccount{
+			Name:              u.Username,
+			Description:       &description,
+			Password:          u.Password,
+			PasswordChangedAt: &now,
+			SearchUsers:       &allowed,
+			SearchGroups:      &allowed,
+			ReadPrivate:       &allowed,
+			ProxyAuthz:        u.ProxyAuthz,
+			GroupsOnly:        &groupsOnly,
+			Locked:            u.Locked,
+			CreatedBy:         u.CreatedBy,
+			UpdatedBy:         u.UpdatedBy,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Remove the user as the REST API does
+		if err := tx.Model(&u).Association("MemberOf").Clear(); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.AppPassword{}, &models.APIToken{}, &models.AttributeValue{}} {
+			if err := tx.Where("user_id = ?", u.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&u).Error; err != nil {
+			return err
+		}
+
+		fmt.Printf("%s [Glim] ⇨ readonly user %s is now the service account cn=%s,ou=Services\n", time.Now().Format(time.RFC3339), *u.Username, *u.Username)
+	}
+	return nil
+}
+
+// createSearchAccount creates the service account that applications use to
+// search our directory
+func createSearchAccount(db *gorm.DB, initialPassword string) error {
+	var chosenPassword string
+	var err error
+
+	if initialPassword == "" {
+		chosenPassword, err = password.Generate(64, 10, 0, false, true)
+		if err != nil {
+			return err
+		}
+	} else {
+		chosenPassword = initialPassword
+	}
+
+	hash, err := models.Hash(chosenPassword)
+	if err != nil {
+		return err
+	}
+
+	name := "search"
+	description := "Read-Only Account"
+	hashed := string(hash)
+	now := time.Now()
+	allowed, groupsOnly := true, false
+
+	if err := db.Create(&models.ServiceAccount{
+		Name:              &name,
+		Description:       &description,
+		Password:          &hashed,
+		PasswordChangedAt: &now,
+		SearchUsers:       &allowed,
+		SearchGroups:      &allowed,
+		ReadPrivate:       &allowed,
+		GroupsOnly:        &groupsOnly,
+	}).Error; err != nil {
+		return err
+	}
+
+	if os.Getenv("ENV") != "test" {
+		fmt.Println("")
+		fmt.Println("------------------------------------- WARNING -------------------------------------")
+		fmt.Println("A new service account with read-only permissions has been created:")
+		fmt.Println("- Bind DN: cn=search,ou=Services followed by Glim's domain")
+		fmt.Printf("- Password %s\n", chosenPassword)
+		fmt.Println("Please store or write down this password to perform search queries in Glim.")
+		fmt.Println("-----------------------------------------------------------------------------------")
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadonlyUsersMigration(t *testing.T) {
+	dbPath := fmt.Sprintf("/tmp/%s.db", uuid.New().String())
+	defer os.Remove(dbPath)
+
+	db, err := Initialize(dbPath, false, types.DBInit{
+		AdminPasswd:   "test",
+		SearchPasswd:  "test",
+		Users:         "saul",
+		DefaultPasswd: "test",
+		UseSqlite:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+
+	// New databases get a search service account
+	var search models.ServiceAccount
+	assert.NoError(t, db.Where("name = ?", "search").Take(&search).Error)
+	assert.NoError(t, models.VerifyPassword(*search.Password, "test"))
+	assert.Error(t, db.Where("username = ?", "search").Take(&models.User{}).Error)
+
+	// Databases created before service accounts existed have readonly users
+	assert.NoError(t, db.Migrator().DropTable("service_account_groups", &models.ServiceAccount{}))
+	indexer, readonly, locked := "indexer", true, true
+	assert.NoError(t, db.Create(&models.User{Username: &indexer, Password: search.Password, Readonly: &readonly, Locked: &locked}).Error)
+	var u models.User
+	assert.NoError(t, db.Where("username = ?", indexer).Take(&u).Error)
+	lawyers := "lawyers"
+	assert.NoError(t, db.Create(&models.Group{Name: &lawyers, Members: []*models.User{&u}}).Error)
+
+	assert.NoError(t, migrateServiceAccounts(db))
+
+	var s models.ServiceAccount
+	assert.NoError(t, db.Where("name = ?", indexer).Take(&s).Error)
+	assert.Equal(t, *search.Password, *s.Password)
+	assert.True(t, *s.Locked)
+	assert.True(t, *s.SearchUsers && *s.SearchGroups && *s.ReadPrivate)
+	assert.Error(t, db.Where("username = ?", indexer).Take(&models.User{}).Error)
+
+	var g models.Group
+	assert.NoError(t, db.Preload("Members").Where("name = ?", lawyers).Take(&g).Error)
+	assert.Empty(t, g.Members)
+
+	// Readonly users created once service accounts exist are kept
+	auditor := "auditor"
+	assert.NoError(t, db.Create(&models.User{Username: &auditor, Password: search.Password, Readonly: &readonly}).Error)
+	assert.NoError(t, migrateServiceAccounts(db))
+	assert.NoError(t, db.Where("username = ?", auditor).Take(&models.User{}).Error)
+	assert.Error(t, db.Where("name = ?", auditor).Take(&models.ServiceAccount{}).Error)
+}
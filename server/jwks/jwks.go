@@ -0,0 +1,406 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms. HS256 uses the shared API secret and
+// publishes no keys, the rest use private keys stored in a directory
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// kidTimeFormat is the layout of the timestamp that prefixes key ids, it
+// tells us when a key was created so keys can be sorted and retired
+const kidTimeFormat = "20060102T150405Z"
+
+// ValidAlgorithm checks if we know a signing algorithm
+func ValidAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case HS256, RS256, ES256, EdDSA:
+		return true
+	}
+	return false
+}
+
+// Key - private key used to sign tokens identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	// RetiredAt is set when a newer key replaces this key. Retired keys
+	// are only used to verify tokens until they have expired
+	RetiredAt *time.Time
+	signer    crypto.Signer
+}
+
+// JSONWebKey - public key as described in RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet - set of public keys as described in RFC 7517
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySet - keys used to sign and verify JWT tokens
+type KeySet struct {
+	mu        sync.RWMutex
+	algorithm string
+	secret    []byte
+	dir       string
+	lifetime  time.Duration
+	keys      []*Key
+}
+
+// NewHMACKeySet returns a key set that signs tokens with HS256 and a shared secret
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{algorithm: HS256, secret: []byte(secret)}
+}
+
+// NewKeySet returns a key set for the algorithm. Asymmetric keys are read
+// from dir and a new key is generated if there's no current key for the
+// algorithm. Retired keys are kept for verification during lifetime, which
+// should be the lifetime of the longest-lived token we sign
+func NewKeySet(algorithm string, dir string, secret string, lifetime time.Duration) (*KeySet, error) {
+	if !ValidAlgorithm(algorithm) {
+		return nil, fmt.Errorf("unsupported jwt signing algorithm %s", algorithm)
+	}
+
+	if algorithm == HS256 {
+		return NewHMACKeySet(secret), nil
+	}
+
+	ks := &KeySet{algorithm: algorithm, dir: dir, lifetime: lifetime}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create jwt keys directory: %v", err)
+	}
+
+	if err := ks.Load(); err != nil {
+		return nil, err
+	}
+
+	if current := ks.Current(); current == nil || current.Algorithm != algorithm {
+		if _, err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// Algorithm returns the algorithm used to sign new tokens
+func (ks *KeySet) Algorithm() string {
+	return ks.algorithm
+}
+
+// Current returns the key used to sign new tokens
+func (ks *KeySet) Current() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return nil
+	}
+	return ks.keys[len(ks.keys)-1]
+}
+
+// Keys returns the keys that can be used to verify tokens, oldest first
+func (ks *KeySet) Keys() []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return append([]*Key{}, ks.keys...)
+}
+
+// Load reads the keys stored in the key set directory. Keys whose
+// retirement is older than the key set lifetime are removed
+func (ks *KeySet) Load() error {
+	if ks.algorithm == HS256 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := []*Key{}
+	for _, file := range files {
+		key, err := readKey(file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.prune()
+	return nil
+}
+
+// Rotate generates a new key for the key set algorithm and retires the
+// current key
+func (ks *KeySet) Rotate() (*Key, error) {
+	if ks.algorithm == HS256 {
+		return nil, fmt.Errorf("keys can't be rotated when using %s", HS256)
+	}
+
+	key, pemBytes, err := generateKey(ks.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(ks.dir, key.ID+".pem")
+	if err := os.WriteFile(file, pemBytes, 0600); err != nil {
+		return nil, fmt.Errorf("could not store jwt key: %v", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = append(ks.keys, key)
+	ks.prune()
+	return key, nil
+}
+
+// RotateIfOlderThan rotates the current key if it was created more than
+// maxAge ago. It tells us if a rotation happened
+func (ks *KeySet) RotateIfOlderThan(maxAge time.Duration) (bool, error) {
+	if ks.algorithm == HS256 || maxAge <= 0 {
+		return false, nil
+	}
+
+	current := ks.Current()
+	if current != nil && time.Since(current.CreatedAt) < maxAge {
+		return false, nil
+	}
+
+	if _, err := ks.Rotate(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// prune sorts keys by creation time, sets retirement times and removes
+// keys that can't have signed tokens that are still valid
+func (ks *KeySet) prune() {
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].CreatedAt.Before(ks.keys[j].CreatedAt)
+	})
+
+	keys := []*Key{}
+	for i, key := range ks.keys {
+		if i < len(ks.keys)-1 {
+			retiredAt := ks.keys[i+1].CreatedAt
+			key.RetiredAt = &retiredAt
+			if time.Since(retiredAt) > ks.lifetime {
+				os.Remove(filepath.Join(ks.dir, key.ID+".pem"))
+				continue
+			}
+		} else {
+			key.RetiredAt = nil
+		}
+		keys = append(keys, key)
+	}
+	ks.keys = keys
+}
+
+// Sign returns a signed token for the claims using the current key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.algorithm == HS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+
+	key := ks.Current()
+	if key == nil {
+		return "", fmt.Errorf("no jwt signing key available")
+	}
+
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	t.Header["kid"] = key.ID
+	return t.SignedString(key.signer)
+}
+
+// Keyfunc returns the key needed to verify a token. It can be used with
+// jwt.Parse and jwt.ParseWithClaims
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	alg, _ := t.Header["alg"].(string)
+
+	if ks.algorithm == HS256 {
+		if alg != HS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", alg)
+		}
+		return ks.secret, nil
+	}
+
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("token has no key id")
+	}
+
+	for _, key := range ks.Keys() {
+		if key.ID == kid {
+			if key.Algorithm != alg {
+				return nil, fmt.Errorf("unexpected signing method %v", alg)
+			}
+			return key.signer.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %s", kid)
+}
+
+// JWKS returns the public keys that can be used to verify our tokens
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ks.Keys() {
+		jwk := JSONWebKey{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+		switch pub := key.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// generateKey creates a new private key for the algorithm and returns it
+// along with its PKCS #8 PEM encoding
+func generateKey(algorithm string) (*Key, []byte, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case RS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported jwt signing algorithm %s", algorithm)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate jwt key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not encode jwt key: %v", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	key := &Key{
+		ID:        fmt.Sprintf("%s-%s", now.Format(kidTimeFormat), hex.EncodeToString(suffix)),
+		Algorithm: algorithm,
+		CreatedAt: now,
+		signer:    signer,
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// readKey reads a PKCS #8 PEM private key. The file name is the key id
+func readKey(file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read jwt key %s: %v", file, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("could not decode jwt key %s", file)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse jwt key %s: %v", file, err)
+	}
+
+	key := &Key{ID: strings.TrimSuffix(filepath.Base(file), ".pem")}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = RS256
+		key.signer = k
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("jwt key %s should use the P-256 curve", file)
+		}
+		key.Algorithm = ES256
+		key.signer = k
+	case ed25519.PrivateKey:
+		key.Algorithm = EdDSA
+		key.signer = k
+	default:
+		return nil, fmt.Errorf("unsupported jwt key type in %s", file)
+	}
+
+	createdAt, err := time.Parse(kidTimeFormat, strings.SplitN(key.ID, "-", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("jwt key file name %s should start with its creation time", file)
+	}
+	key.CreatedAt = createdAt
+	return key, nil
+}
@@ -20,6 +20,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/dgraph-io/badger"
@@ -104,6 +105,99 @@ func (s Store) Delete(k string) error {
 	return err
 }
 
+// Take gets a value and deletes its key in one atomic step
+func (s Store) Take(k string) (v string, found bool, err error) {
+	for {
+		var valCopy []byte
+		err = s.DB.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get([]byte(k))
+			if err != nil {
+				return err
+			}
+
+			valCopy, err = item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			return txn.Delete([]byte(k))
+		})
+
+		// Concurrent takes conflict, so we try again and only one finds the key
+		if err == badger.ErrConflict {
+			continue
+		}
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		return string(valCopy), true, nil
+	}
+}
+
+// Keys returns the keys starting with a prefix
+func (s Store) Keys(prefix string) ([]string, error) {
+	keys := []string{}
+	err := s.DB.View(func(txn *badger.Txn) error {
+		options := badger.DefaultIteratorOptions
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		p := []byte(prefix)
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			keys = append(keys, string(it.Item().KeyCopy(nil)))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Increment atomically increments a counter, the expiration is only set
+// when the counter is created so it keeps its original expiry time
+func (s Store) Increment(k string, expiration time.Duration) (int64, error) {
+	var count int64
+	for {
+		err := s.DB.Update(func(txn *badger.Txn) error {
+			count = 1
+			ttl := expiration
+
+			item, err := txn.Get([]byte(k))
+			switch {
+			case err == nil:
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				previous, err := strconv.ParseInt(string(val), 10, 64)
+				if err != nil {
+					return err
+				}
+				remaining := time.Until(time.Unix(int64(item.ExpiresAt()), 0))
+				if item.ExpiresAt() == 0 || remaining > 0 {
+					count = previous + 1
+					ttl = remaining
+				}
+			case err != badger.ErrKeyNotFound:
+				return err
+			}
+
+			e := badger.NewEntry([]byte(k), []byte(strconv.FormatInt(count, 10)))
+			if ttl > 0 {
+				e = e.WithTTL(ttl)
+			}
+			return txn.SetEntry(e)
+		})
+
+		// Concurrent increments conflict, so we try again
+		if err == badger.ErrConflict {
+			continue
+		}
+		return count, err
+	}
+}
+
 // Close will terminate a connection with BadgerDB
 func (s Store) Close() error {
 	return s.DB.Close()
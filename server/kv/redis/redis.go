@@ -68,14 +68,65 @@ func (s Store) Get(k string) (v string, found bool, err error) {
 
 // Set a value for a given key
 func (s Store) Set(k string, v string, expiration time.Duration) error {
-	_, err := s.DB.SetNX(ctx, k, v, expiration).Result()
-	return err
+	return s.DB.Set(ctx, k, v, expiration).Err()
 }
 
 // Delete given key
 func (s Store) Delete(k string) error {
-	_, err := s.DB.SetNX(ctx, k, "", 1).Result()
-	return err
+	return s.DB.Del(ctx, k).Err()
+}
+
+// Take gets a value and deletes its key in one atomic step
+func (s Store) Take(k string) (v string, found bool, err error) {
+	var get *redis.StringCmd
+	_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, k)
+		pipe.Del(ctx, k)
+		return nil
+	})
+
+	if err != nil {
+		if err == redis.Nil {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return get.Val(), true, nil
+}
+
+// Keys returns the keys starting with a prefix
+func (s Store) Keys(prefix string) ([]string, error) {
+	keys := []string{}
+	var cursor uint64
+	for {
+		page, next, err := s.DB.Scan(ctx, cursor, prefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return keys, nil
+}
+
+// incrementScript increments a counter and sets its expiration when it has
+// none, so a counter never outlives its window even if a previous call
+// failed between both steps
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// Increment atomically increments a counter, the expiration is only set
+// when the counter has none so it keeps its original expiry time
+func (s Store) Increment(k string, expiration time.Duration) (int64, error) {
+	return incrementScript.Run(ctx, s.DB, []string{k}, expiration.Milliseconds()).Int64()
 }
 
 // Close will terminate a connection with Redis
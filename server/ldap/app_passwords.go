@@ -0,0 +1,86 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+)
+
+// appPasswordAllowed checks if an app password can be used by a client
+// connecting from remoteAddr
+func appPasswordAllowed(settings types.LDAPSettings, a models.AppPassword, remoteAddr string) bool {
+	if a.Application != nil && *a.Application != "" {
+		app := clientApplication(settings, remoteAddr)
+		if app == nil || app.Name != *a.Application {
+			return false
+		}
+	}
+
+	if a.Networks != nil && *a.Networks != "" {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			host = remoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+
+		for _, cidr := range strings.Split(*a.Networks, ",") {
+			_, network, err := net.ParseCIDR(cidr)
+			if err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// verifyAppPassword checks a bind password against the active app
+// passwords of a user, recording when the matching one was last used.
+// Only app passwords whose lookup identifier matches are checked, as well
+// as those created before we stored one
+func verifyAppPassword(settings types.LDAPSettings, u *models.User, pass string, remoteAddr string) (*models.AppPassword, error) {
+	var appPasswords []models.AppPassword
+
+	lookup := models.AppPasswordLookup(pass)
+	if err := settings.DB.Where("user_id = ? AND revoked_at IS NULL AND (lookup = ? OR lookup IS NULL)", u.ID, lookup).Find(&appPasswords).Error; err != nil {
+		return nil, err
+	}
+
+	for i, a := range appPasswords {
+		if !appPasswordAllowed(settings, a, remoteAddr) {
+			continue
+		}
+		if models.VerifyPassword(*a.Password, pass) == nil {
+			if err := settings.DB.Model(&models.AppPassword{}).Where("id = ?", a.ID).Updates(map[string]interface{}{"last_used_at": time.Now(), "lookup": lookup}).Error; err != nil {
+				printLog(fmt.Sprintf("could not record use of app password %d: %v", a.ID, err))
+			}
+			return &appPasswords[i], nil
+		}
+	}
+
+	return nil, errWrongCredentials
+}
@@ -0,0 +1,276 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+)
+
+// entrySource - the database record an entry is built from
+type entrySource struct {
+	dn         string
+	structural string
+	uuid       *string
+	createdBy  *string
+	createdAt  time.Time
+	updatedBy  *string
+	updatedAt  time.Time
+	domain     string
+	guacamole  bool
+	user       *models.User
+	group      *models.Group
+}
+
+// attributeMapping - maps an LDAP attribute type to the values we get from
+// our models
+type attributeMapping struct {
+	// name is the attribute type sent to clients
+	name string
+	// aliases are other names for this attribute type e.g commonName for cn
+	aliases []string
+	// operational attributes are only returned if they're requested by name or with +
+	operational bool
+	// binary attributes accept the ;binary option
+	binary bool
+	// objectClasses whose attributes include this one
+	objectClasses []string
+	values        func(e *entrySource) []string
+}
+
+// objectClassSuperiors - superior classes of the object classes we use,
+// requesting a class also requests the attributes of its superiors
+var objectClassSuperiors = map[string][]string{
+	"inetorgperson":        {"organizationalperson"},
+	"organizationalperson": {"person"},
+	"person":               {"top"},
+	"ldappublickey":        {"top"},
+	"posixaccount":         {"top"},
+	"posixgroup":           {"top"},
+	"groupofnames":         {"top"},
+	"guacconfiggroup":      {"top"},
+	"organizationalunit":   {"top"},
+}
+
+// generalizedTime formats a timestamp as GeneralizedTime
+func generalizedTime(t time.Time) []string {
+	return []string{t.UTC().Format("20060102150405Z")}
+}
+
+// stringValue returns the value of a model field, empty values are not
+// returned as LDAP values can't be empty
+func stringValue(s *string) []string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return []string{*s}
+}
+
+// numberValue returns the value of a numeric model field
+func numberValue(n *uint32) []string {
+	if n == nil {
+		return nil
+	}
+	return []string{strconv.FormatUint(uint64(*n), 10)}
+}
+
+// operationalAttributes - operational attributes shared by users and groups
+var operationalAttributes = []attributeMapping{
+	{
+		name:        "structuralObjectClass",
+		operational: true,
+		values:      func(e *entrySource) []string { return []string{e.structural} },
+	},
+	{
+		name:        "entryUUID",
+		operational: true,
+		values:      func(e *entrySource) []string { return stringValue(e.uuid) },
+	},
+	{
+		name:        "creatorsName",
+		operational: true,
+		values: func(e *entrySource) []string {
+			if e.createdBy == nil {
+				return nil
+			}
+			return []string{accountDN(e.domain, *e.createdBy)}
+		},
+	},
+	{
+		name:        "createTimestamp",
+		operational: true,
+		values:      func(e *entrySource) []string { return generalizedTime(e.createdAt) },
+	},
+	{
+		name:        "modifiersName",
+		operational: true,
+		values: func(e *entrySource) []string {
+			if e.updatedBy == nil {
+				return nil
+			}
+			return []string{accountDN(e.domain, *e.updatedBy)}
+		},
+	},
+	{
+		name:        "modifyTimestamp",
+		operational: true,
+		values:      func(e *entrySource) []string { return generalizedTime(e.updatedAt) },
+	},
+	{
+		name:        "entryDN",
+		operational: true,
+		values:      func(e *entrySource) []string { return []string{e.dn} },
+	},
+	{
+		name:        "subschemaSubentry",
+		operational: true,
+		values:      func(e *entrySource) []string { return []string{"cn=Subschema"} },
+	},
+	{
+		name:        "hasSubordinates",
+		operational: true,
+		values:      func(e *entrySource) []string { return []string{"FALSE"} },
+	},
+}
+
+// attributeSelection - the attributes requested in a search as defined in
+// RFC 4511 section 4.5.1.8
+type attributeSelection struct {
+	// all user attributes, requested with * or an empty list
+	all bool
+	// all operational attributes, requested with +
+	operational bool
+	// requested attribute types and object classes, lowercased and
+	// without options, and the options that were requested with them
+	names map[string]string
+	// only attribute types are returned, without values
+	typesOnly bool
+}
+
+// newAttributeSelection parses the attribute list of a search request
+func newAttributeSelection(requested []string, typesOnly bool) attributeSelection {
+	s := attributeSelection{
+		all:       len(requested) == 0,
+		names:     map[string]string{},
+		typesOnly: typesOnly,
+	}
+
+	for _, r := range requested {
+		switch r {
+		case "*":
+			s.all = true
+		case "+":
+			s.operational = true
+		case "1.1":
+			// No attributes, ignored if other attributes are requested
+		default:
+			name, options, _ := strings.Cut(r, ";")
+			name = strings.ToLower(strings.TrimPrefix(name, "@"))
+			if options != "" {
+				options = ";" + options
+			}
+			s.names[name] = options
+
+			// A requested object class includes the attributes of its superiors
+			superiors := append([]string{}, objectClassSuperiors[name]...)
+			for len(superiors) > 0 {
+				superior := superiors[0]
+				superiors = append(superiors[1:], objectClassSuperiors[superior]...)
+				if _, ok := s.names[superior]; !ok {
+					s.names[superior] = ""
+				}
+			}
+		}
+	}
+	return s
+}
+
+// validOptions checks the attribute options requested for an attribute,
+// we only know ;binary
+func validOptions(a *attributeMapping, options string) bool {
+	for _, option := range strings.Split(strings.TrimPrefix(options, ";"), ";") {
+		if option != "" && !(strings.EqualFold(option, "binary") && a.binary) {
+			return false
+		}
+	}
+	return true
+}
+
+// selects returns the attribute description used in an entry when an
+// attribute has been requested
+func (s attributeSelection) selects(a *attributeMapping) (string, bool) {
+	for _, name := range append([]string{a.name}, a.aliases...) {
+		if options, ok := s.names[strings.ToLower(name)]; ok {
+			if !validOptions(a, options) {
+				return "", false
+			}
+			return a.name + options, true
+		}
+	}
+
+	if (a.operational && s.operational) || (!a.operational && s.all) {
+		return a.name, true
+	}
+
+	if !a.operational {
+		for _, class := range a.objectClasses {
+			if _, ok := s.names[strings.ToLower(class)]; ok {
+				return a.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// entryValues returns the requested attributes of an entry
+func (s attributeSelection) entryValues(registry []attributeMapping, e *entrySource) map[string][]string {
+	values := map[string][]string{}
+	for i := range registry {
+		description, ok := s.selects(&registry[i])
+		if !ok {
+			continue
+		}
+		v := registry[i].values(e)
+		if len(v) == 0 {
+			continue
+		}
+		if s.typesOnly {
+			v = []string{}
+		}
+		values[description] = v
+	}
+	return values
+}
+
+// staticValues returns the requested attributes of entries that are not
+// stored in our database e.g ou=Users
+func (s attributeSelection) staticValues(entry map[string][]string) map[string][]string {
+	values := map[string][]string{}
+	for name, v := range entry {
+		if _, ok := s.names[strings.ToLower(name)]; !ok && !s.all {
+			continue
+		}
+		if s.typesOnly {
+			v = []string{}
+		}
+		values[name] = v
+	}
+	return values
+}
@@ -0,0 +1,296 @@
+package ldap
+
+import (
+	"encoding/base64"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUser() models.User {
+	username := "saul"
+	givenName := "Saul"
+	surname := "Goodman"
+	name := "Saul Goodman"
+	email := "saul@example.org"
+	photo := base64.StdEncoding.EncodeToString([]byte{0xff, 0xd8, 0xff})
+	id := "b6b6c1a0-6d0e-4b52-8d3e-2f1d1a8b2a11"
+	admin := "admin"
+	group := "lawyers"
+	return models.User{
+		Username:  &username,
+		GivenName: &givenName,
+		Surname:   &surname,
+		Name:      &name,
+		Email:     &email,
+		JPEGPhoto: &photo,
+		UUID:      &id,
+		CreatedBy: &admin,
+		UpdatedBy: &username,
+		CreatedAt: time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2022, 8, 2, 10, 0, 0, 0, time.UTC),
+		MemberOf:  []*models.Group{{Name: &group}},
+	}
+}
+
+func attributeNames(values map[string][]string) []string {
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAttributeSelection(t *testing.T) {
+	domain := "dc=example,dc=org"
+	testCases := []struct {
+		name      string
+		requested []string
+		expected  []string
+	}{
+		{
+			name:      "Empty list returns user attributes",
+			requested: []string{},
+			expected:  []string{"cn", "givenName", "jpegPhoto", "mail", "memberOf", "objectClass", "sn", "uid"},
+		},
+		{
+			name:      "Asterisk returns user attributes",
+			requested: []string{"*"},
+			expected:  []string{"cn", "givenName", "jpegPhoto", "mail", "memberOf", "objectClass", "sn", "uid"},
+		},
+		{
+			name:      "Plus returns operational attributes",
+			requested: []string{"+"},
+			expected:  []string{"createTimestamp", "creatorsName", "entryDN", "entryUUID", "hasSubordinates", "modifiersName", "modifyTimestamp", "structuralObjectClass", "subschemaSubentry"},
+		},
+		{
+			name:      "No attributes",
+			requested: []string{"1.1"},
+			expected:  []string{},
+		},
+		{
+			name:      "No attributes is ignored with other attributes",
+			requested: []string{"1.1", "uid"},
+			expected:  []string{"uid"},
+		},
+		{
+			name:      "Names are case-insensitive",
+			requested: []string{"UID", "Mail", "memberof", "MODIFIERSNAME"},
+			expected:  []string{"mail", "memberOf", "modifiersName", "uid"},
+		},
+		{
+			name:      "Aliases",
+			requested: []string{"commonName", "surname"},
+			expected:  []string{"cn", "sn"},
+		},
+		{
+			name:      "Object class expansion",
+			requested: []string{"@person"},
+			expected:  []string{"cn", "objectClass", "sn"},
+		},
+		{
+			name:      "Object class expansion includes superior classes",
+			requested: []string{"inetOrgPerson"},
+			expected:  []string{"cn", "givenName", "jpegPhoto", "mail", "objectClass", "sn", "uid"},
+		},
+		{
+			name:      "Binary option",
+			requested: []string{"jpegPhoto;binary"},
+			expected:  []string{"jpegPhoto;binary"},
+		},
+		{
+			name:      "Binary option for a string attribute",
+			requested: []string{"uid;binary"},
+			expected:  []string{},
+		},
+		{
+			name:      "Unknown attributes",
+			requested: []string{"userPassword", "unknown"},
+			expected:  []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values := userEntry(testUser(), newAttributeSelection(tc.requested, false), domain)
+			assert.Equal(t, tc.expected, attributeNames(values))
+		})
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		values := userEntry(testUser(), newAttributeSelection([]string{"*", "+"}, false), domain)
+		assert.Equal(t, []string{string([]byte{0xff, 0xd8, 0xff})}, values["jpegPhoto"])
+		assert.Equal(t, []string{"cn=lawyers,ou=Groups,dc=example,dc=org"}, values["memberOf"])
+		assert.Equal(t, []string{"cn=admin,dc=example,dc=org"}, values["creatorsName"])
+		assert.Equal(t, []string{"uid=saul,ou=Users,dc=example,dc=org"}, values["modifiersName"])
+		assert.Equal(t, []string{"20220801100000Z"}, values["createTimestamp"])
+		assert.Equal(t, []string{"inetOrgPerson"}, values["structuralObjectClass"])
+	})
+
+	t.Run("Types only", func(t *testing.T) {
+		values := userEntry(testUser(), newAttributeSelection([]string{"uid", "mail"}, true), domain)
+		assert.Equal(t, map[string][]string{"uid": {}, "mail": {}}, values)
+	})
+}
+
+func TestSearchAttributes(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60014")
+	defer testCleanUp(dbPath.String())
+
+	photo := base64.StdEncoding.EncodeToString([]byte{0xff, 0xd8, 0xff, 0xe0})
+	if err := settings.DB.Model(&models.User{}).Where("username = ?", "saul").Update("jpeg_photo", photo).Error; err != nil {
+		t.Fatalf("could not set photo - %v", err)
+	}
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60014")
+
+	c, err := net.Dial("tcp", "127.0.0.1:60014")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+	if err := conn.Bind("cn=search,dc=example,dc=org", "test"); err != nil {
+		t.Fatalf("could not bind - %v", err)
+	}
+
+	search := func(t *testing.T, typesOnly bool, attributes []string) *ldapClient.Entry {
+		searchRequest := ldapClient.NewSearchRequest("uid=saul,ou=Users,dc=example,dc=org", ldapClient.ScopeBaseObject, ldapClient.DerefAlways, 0, 0, typesOnly, "(objectClass=*)", attributes, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) || !assert.Len(t, sr.Entries, 1) {
+			t.FailNow()
+		}
+		return sr.Entries[0]
+	}
+
+	t.Run("binary values", func(t *testing.T) {
+		entry := search(t, false, []string{"jpegPhoto;binary"})
+		assert.Equal(t, []byte{0xff, 0xd8, 0xff, 0xe0}, entry.GetRawAttributeValue("jpegPhoto;binary"))
+	})
+
+	t.Run("types only", func(t *testing.T) {
+		entry := search(t, true, []string{"uid", "MAIL", "entryDN"})
+		names := []string{}
+		for _, a := range entry.Attributes {
+			names = append(names, a.Name)
+			assert.Empty(t, a.Values)
+		}
+		sort.Strings(names)
+		assert.Equal(t, []string{"entryDN", "uid"}, names)
+	})
+}
+
+func TestPOSIXAttributes(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60015")
+	defer testCleanUp(dbPath.String())
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60015")
+
+	c, err := net.Dial("tcp", "127.0.0.1:60015")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+	if err := conn.Bind("cn=search,dc=example,dc=org", "test"); err != nil {
+		t.Fatalf("could not bind - %v", err)
+	}
+
+	search := func(t *testing.T, baseDN string, filter string, attributes []string) []*ldapClient.Entry {
+		searchRequest := ldapClient.NewSearchRequest(baseDN, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, attributes, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return sr.Entries
+	}
+
+	t.Run("posixAccount by uidNumber", func(t *testing.T) {
+		entries := search(t, "ou=Users,dc=example,dc=org", "(&(objectClass=posixAccount)(uidNumber=10002))", []string{"uid", "uidNumber", "gidNumber", "homeDirectory", "loginShell"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, "saul", entries[0].GetAttributeValue("uid"))
+		assert.Equal(t, "10002", entries[0].GetAttributeValue("uidNumber"))
+		assert.Equal(t, "10002", entries[0].GetAttributeValue("gidNumber"))
+		assert.Equal(t, "/home/saul", entries[0].GetAttributeValue("homeDirectory"))
+		assert.Equal(t, "/bin/bash", entries[0].GetAttributeValue("loginShell"))
+	})
+
+	t.Run("posixGroup by gidNumber", func(t *testing.T) {
+		entries := search(t, "ou=Groups,dc=example,dc=org", "(&(objectClass=posixGroup)(gidNumber=30001))", []string{"objectClass", "cn", "gidNumber", "memberUid"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, "test2", entries[0].GetAttributeValue("cn"))
+		assert.Equal(t, []string{"groupOfNames", "posixGroup"}, entries[0].GetAttributeValues("objectClass"))
+		assert.Equal(t, []string{"kim"}, entries[0].GetAttributeValues("memberUid"))
+	})
+
+	t.Run("posixGroup by memberUid", func(t *testing.T) {
+		entries := search(t, "ou=Groups,dc=example,dc=org", "(&(objectClass=posixGroup)(memberUid=saul))", []string{"cn", "gidNumber", "memberUid"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, "test", entries[0].GetAttributeValue("cn"))
+		assert.Equal(t, "30000", entries[0].GetAttributeValue("gidNumber"))
+		assert.Equal(t, []string{"saul", "kim"}, entries[0].GetAttributeValues("memberUid"))
+	})
+
+	t.Run("wrong numbers match nothing", func(t *testing.T) {
+		entries := search(t, "ou=Users,dc=example,dc=org", "(uidNumber=abc)", []string{"uid"})
+		assert.Empty(t, entries)
+	})
+}
+
+func TestReservedAttributeNames(t *testing.T) {
+	// Custom attributes can't use the names of the attributes we serve
+	for _, registry := range [][]attributeMapping{userAttributes, groupAttributes} {
+		for _, a := range registry {
+			for _, name := range append([]string{a.name}, a.aliases...) {
+				assert.True(t, models.ReservedAttributeName(name), name)
+			}
+		}
+	}
+}
@@ -3,9 +3,12 @@ package ldap
 import (
 	"errors"
 	"fmt"
-	"strings"
+	"net"
+	"time"
 
 	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/doncicuto/glim/server/ratelimit"
 	"github.com/doncicuto/glim/types"
 	ber "github.com/go-asn1-ber/asn1-ber"
 	"gorm.io/gorm"
@@ -47,8 +50,7 @@ func bindPassword(p *ber.Packet) (string, *ServerError) {
 }
 
 // HandleBind - TODO comment
-func HandleBind(message *Message, settings types.LDAPSettings, remoteAddr string) (*ber.Packet, string, error) {
-	username := ""
+func HandleBind(message *Message, settings types.LDAPSettings, remoteAddr string, external *externalIdentity, state *saslBindState) (*ber.Packet, string, error) {
 	id := message.ID
 	p := message.Request
 
@@ -57,11 +59,28 @@ func HandleBind(message *Message, settings types.LDAPSettings, remoteAddr string
 		return encodeBindResponse(id, err.Code, err.Msg), "", errors.New(err.Msg)
 	}
 
+	if err := proxiedAuthorizationNotSupported(message); err != nil {
+		return encodeBindResponse(id, err.Code, err.Msg), "", errors.New(err.Msg)
+	}
+
 	n, err := bindName(p[1])
 	if err != nil {
 		return encodeBindResponse(id, err.Code, err.Msg), n, errors.New(err.Msg)
 	}
 
+	// SASL binds
+	if isSASLBind(p[2]) {
+		creds, err := bindSASLCredentials(p[2])
+		if err != nil {
+			state.reset()
+			return encodeBindResponse(id, err.Code, err.Msg), "", errors.New(err.Msg)
+		}
+		return handleSASLBind(id, settings, remoteAddr, external, state, creds)
+	}
+
+	// A simple bind aborts any SASL bind in progress
+	state.reset()
+
 	pass, err := bindPassword(p[2])
 	if err != nil {
 		return encodeBindResponse(id, err.Code, err.Msg), n, errors.New(err.Msg)
@@ -71,29 +90,27 @@ func HandleBind(message *Message, settings types.LDAPSettings, remoteAddr string
 		return encodeBindResponse(id, InappropriateAuthentication, ""), n, fmt.Errorf("anonymous ldap bind is not available")
 	}
 
-	dn := strings.Split(n, ",")
-	if strings.HasPrefix(dn[0], "cn=") {
-		username = strings.TrimPrefix(dn[0], "cn=")
-		domain := strings.TrimPrefix(n, dn[0])
-		domain = strings.TrimPrefix(domain, ",")
-		if domain != settings.Domain {
-			return encodeBindResponse(id, InvalidCredentials, ""), n, fmt.Errorf("wrong domain: %s", domain)
-		}
+	// Service accounts bind with their DN below ou=Services
+	if name, ok := childValue(n, servicesDN(settings.Domain), "cn"); ok {
+		r, err := serviceAccountBind(id, settings, remoteAddr, name, pass)
+		return r, n, err
 	}
 
-	if strings.HasPrefix(dn[0], "uid=") {
-		username = strings.TrimPrefix(dn[0], "uid=")
-		if dn[1] != "ou=Users" {
-			return encodeBindResponse(id, InvalidCredentials, ""), n, fmt.Errorf("wrong ou: %s", dn[1])
-		}
-		domain := strings.TrimPrefix(n, dn[0])
-		domain = strings.TrimPrefix(domain, ",")
-		domain = strings.TrimPrefix(domain, dn[1])
-		domain = strings.TrimPrefix(domain, ",")
+	// Readonly users moved to ou=Services keep binding with their cn=name DN
+	if name, ok := childValue(n, settings.Domain, "cn"); ok && movedToServices(settings, name) {
+		r, err := serviceAccountBind(id, settings, remoteAddr, name, pass)
+		return r, serviceAccountDN(settings.Domain, name), err
+	}
 
-		if domain != settings.Domain {
-			return encodeBindResponse(id, InvalidCredentials, ""), n, fmt.Errorf("wrong domain: %s", domain)
+	// Map the bind name to a user
+	username, nameErr := resolveBindName(settings, n)
+	if nameErr != nil {
+		keys := bindRateLimitKeys(remoteAddr, n)
+		if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+			return encodeBindResponse(id, Busy, "too many failed attempts, please try again later"), n, fmt.Errorf("too many failed attempts, bind throttled for %v client %s", wait.Round(time.Second), remoteAddr)
 		}
+		settings.RateLimiter.Fail(keys...)
+		return encodeBindResponse(id, InvalidCredentials, ""), n, fmt.Errorf("%v client %s", nameErr, remoteAddr)
 	}
 
 	// DEBUG - TODO
@@ -101,21 +118,105 @@ func HandleBind(message *Message, settings types.LDAPSettings, remoteAddr string
 	printLog(fmt.Sprintf("bind name: %s client %s", n, remoteAddr))
 	printLog(fmt.Sprintf("bind password: %s client %s", "**********", remoteAddr))
 
+	// Names that are not DNs identify the user's entry once bound
+	if !isBindDN(n) {
+		n = userDN(settings.Domain, username)
+	}
+
+	r, err2 := passwordBind(id, settings, remoteAddr, username, pass)
+	return r, n, err2
+}
+
+// bindRateLimitKeys returns the keys used to throttle failed binds by
+// source IP and username
+func bindRateLimitKeys(remoteAddr string, username string) []string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return []string{ratelimit.IPKey(host), ratelimit.UserKey(username)}
+}
+
+// bindAllowed checks if the client network is allowed to bind with an
+// account. Network policies don't apply to local ldapi clients
+func bindAllowed(settings types.LDAPSettings, u *models.User, remoteAddr string) (string, bool) {
+	operation := netpolicy.User
+	if u.Manager != nil && *u.Manager {
+		operation = netpolicy.Manager
+	}
+	if isLDAPI(remoteAddr) {
+		return operation, true
+	}
+	return operation, settings.NetworkPolicies.Operation(operation).Allows(remoteAddr)
+}
+
+// passwordBind authenticates a username and password sent with a simple
+// bind or a SASL PLAIN bind
+func passwordBind(id int64, settings types.LDAPSettings, remoteAddr string, username string, pass string) (*ber.Packet, error) {
+	// Failed binds are throttled by source IP and username
+	keys := bindRateLimitKeys(remoteAddr, username)
+	if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+		return encodeBindResponse(id, Busy, "too many failed attempts, please try again later"), fmt.Errorf("too many failed attempts, bind throttled for %v client %s", wait.Round(time.Second), remoteAddr)
+	}
+
 	// Check credentials in database
 	var dbUser models.User
 
 	// Check if user exists
-	if errors.Is(settings.DB.Where("username = ?", username).First(&dbUser).Error, gorm.ErrRecordNotFound) {
-		return encodeBindResponse(id, InsufficientAccessRights, ""), n, fmt.Errorf("wrong username or password client %s", remoteAddr)
+	if errors.Is(settings.DB.Where("username_folded = ?", models.FoldIdentity(username)).First(&dbUser).Error, gorm.ErrRecordNotFound) {
+		settings.RateLimiter.Fail(keys...)
+		return encodeBindResponse(id, InsufficientAccessRights, ""), fmt.Errorf("wrong username or password client %s", remoteAddr)
+	}
+
+	// Check if the client network is allowed to bind with this account
+	if operation, ok := bindAllowed(settings, &dbUser, remoteAddr); !ok {
+		return encodeBindResponse(id, InsufficientAccessRights, "access from your network is not allowed"), fmt.Errorf("%s bind rejected by network policy client %s", operation, remoteAddr)
+	}
+
+	// Locked accounts can't bind, neither with their password nor an app password
+	if dbUser.Locked != nil && *dbUser.Locked {
+		return encodeBindResponse(id, InvalidCredentials, ""), fmt.Errorf("account %s is locked client %s", *dbUser.Username, remoteAddr)
 	}
 
-	// Check if passwords match
-	if err := models.VerifyPassword(*dbUser.Password, pass); err != nil {
-		return encodeBindResponse(id, InvalidCredentials, ""), n, fmt.Errorf("wrong username or password client %s", remoteAddr)
+	// Check if passwords (and OTP code if appended) match
+	password, passErr := verifyBindPassword(settings, &dbUser, pass, remoteAddr)
+	if passErr != nil {
+		// Checking app passwords is slow, so throttled clients are rejected
+		// first even if they were allowed when the bind started
+		if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+			return encodeBindResponse(id, Busy, "too many failed attempts, please try again later"), fmt.Errorf("too many failed attempts, bind throttled for %v client %s", wait.Round(time.Second), remoteAddr)
+		}
+
+		// Maybe the client is using an app password
+		appPassword, err := verifyAppPassword(settings, &dbUser, pass, remoteAddr)
+		if err != nil {
+			settings.RateLimiter.Fail(keys...)
+			return encodeBindResponse(id, InvalidCredentials, ""), fmt.Errorf("%v client %s", passErr, remoteAddr)
+		}
+		printLog(fmt.Sprintf("success: valid app password %s provided client %s", *appPassword.Name, remoteAddr))
+		return encodeBindResponse(id, Success, ""), nil
+	}
+
+	// Upgrade stored password hash if our hashing policy has changed
+	if models.NeedsRehash(*dbUser.Password) {
+		if hash, err := models.Hash(password); err == nil {
+			if err := settings.DB.Model(&models.User{}).Where("id = ?", dbUser.ID).Update("password", string(hash)).Error; err != nil {
+				printLog(fmt.Sprintf("could not upgrade password hash of user %d: %v", dbUser.ID, err))
+			}
+		}
+	}
+
+	// Users created before SASL SCRAM-SHA-256 was available get their
+	// credentials the first time they bind with their password
+	if dbUser.ScramSHA256 == nil || *dbUser.ScramSHA256 == "" {
+		if scram, err := models.ScramSHA256(password); err == nil {
+			if err := settings.DB.Model(&models.User{}).Where("id = ?", dbUser.ID).Update("scram_sha256", scram).Error; err != nil {
+				printLog(fmt.Sprintf("could not store SCRAM credentials of user %d: %v", dbUser.ID, err))
+			}
+		}
 	}
 
 	// Successful bind
 	printLog("success: valid credentials provided")
-	r := encodeBindResponse(id, Success, "")
-	return r, n, nil
+	return encodeBindResponse(id, Success, ""), nil
 }
@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+)
+
+// Bind name rules mapping what users type in their appliances to a Glim
+// user. DNs (uid=alice,ou=Users,... or cn=alice,...) are always accepted
+const (
+	// BindNameUID - bare username e.g alice
+	BindNameUID = "uid"
+	// BindNameMail - email address e.g alice@example.com
+	BindNameMail = "mail"
+	// BindNameUPN - username followed by our domain e.g alice@example.org
+	BindNameUPN = "upn"
+	// BindNameNetBIOS - NetBIOS style domain and username e.g EXAMPLE\alice
+	BindNameNetBIOS = "netbios"
+)
+
+// ValidBindNameRule checks if we know a bind name rule
+func ValidBindNameRule(rule string) bool {
+	return rule == BindNameUID || rule == BindNameMail || rule == BindNameUPN || rule == BindNameNetBIOS
+}
+
+// dnsDomain returns the DNS domain of our LDAP domain e.g example.org
+func dnsDomain(domain string) string {
+	dn, err := ParseDN(domain)
+	if err != nil {
+		return ""
+	}
+
+	labels := []string{}
+	for _, rdn := range dn {
+		for _, a := range rdn {
+			if strings.EqualFold(a.Type, "dc") {
+				labels = append(labels, a.Value)
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// netBIOSDomain returns the NetBIOS domain name used in DOMAIN\username
+// bind names, by default the first label of our domain e.g EXAMPLE
+func netBIOSDomain(settings types.LDAPSettings) string {
+	if settings.NetBIOSDomain != "" {
+		return settings.NetBIOSDomain
+	}
+	label, _, _ := strings.Cut(dnsDomain(settings.Domain), ".")
+	return strings.ToUpper(label)
+}
+
+// isBindDN checks if a bind name is a DN instead of a name for our rules
+func isBindDN(name string) bool {
+	return strings.Contains(name, "=")
+}
+
+// resolveBindName returns the username for a bind name. DNs are checked
+// against our tree, other names are matched with the enabled rules and
+// they must resolve to a single user
+func resolveBindName(settings types.LDAPSettings, name string) (string, error) {
+	if isBindDN(name) {
+		username, ok := dnUsername(settings, name)
+		if !ok {
+			return "", fmt.Errorf("wrong bind DN %s", name)
+		}
+		return username, nil
+	}
+
+	usernames := map[string]bool{}
+	addUser := func(query string, args ...interface{}) {
+		var users []models.User
+		settings.DB.Where(query, args...).Find(&users)
+		for _, u := range users {
+			usernames[*u.Username] = true
+		}
+	}
+
+	for _, rule := range settings.BindNameRules {
+		switch rule {
+		case BindNameUID:
+			if name != "" && !strings.ContainsAny(name, "@\\") {
+				addUser("username_folded = ?", models.FoldIdentity(name))
+			}
+		case BindNameMail:
+			if strings.Contains(name, "@") {
+				addUser("email_folded = ?", models.FoldIdentity(name))
+			}
+		case BindNameUPN:
+			i := strings.LastIndex(name, "@")
+			if i > 0 && strings.EqualFold(name[i+1:], dnsDomain(settings.Domain)) {
+				addUser("username_folded = ?", models.FoldIdentity(name[:i]))
+			}
+		case BindNameNetBIOS:
+			domain, username, found := strings.Cut(name, "\\")
+			if found && username != "" && strings.EqualFold(domain, netBIOSDomain(settings)) {
+				addUser("username_folded = ?", models.FoldIdentity(username))
+			}
+		}
+	}
+
+	switch len(usernames) {
+	case 0:
+		return "", fmt.Errorf("bind name %s doesn't match any user", name)
+	case 1:
+		for username := range usernames {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("bind name %s matches %d users", name, len(usernames))
+}
@@ -1,10 +1,18 @@
 package ldap
 
 import (
+	"fmt"
 	"net"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/kv/badgerdb"
+	"github.com/doncicuto/glim/server/ratelimit"
+	"github.com/doncicuto/glim/server/totp"
+	"github.com/doncicuto/glim/types"
 	ldapClient "github.com/go-ldap/ldap"
 	"github.com/google/uuid"
 )
@@ -54,6 +62,12 @@ func TestBindOperation(t *testing.T) {
 			conn:         conn,
 			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
 		},
+		{
+			name:     "Usernames are case-insensitive",
+			username: "uid=SAUL,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
 		{
 			name:         "Wrong user",
 			username:     "uid=test,ou=Users,dc=example,dc=org",
@@ -82,6 +96,598 @@ func TestBindOperation(t *testing.T) {
 			conn:         conn,
 			errorMessage: `LDAP Result Code 206 "Empty password not allowed by the client": ldap: empty password not allowed by the client`,
 		},
+		{
+			name:         "Bind DN without parent entries",
+			username:     "uid=saul",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Bare username without bind name rules",
+			username:     "saul",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+	}
+
+	for _, tc := range testCases {
+		runBindTests(t, tc)
+	}
+}
+
+func TestBindOTP(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60002")
+	defer testCleanUp(dbPath.String())
+
+	kv, err := badgerdb.NewBadgerStore(fmt.Sprintf("/tmp/%s-kv", dbPath.String()))
+	if err != nil {
+		t.Fatalf("could not initialize kv - %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf("/tmp/%s-kv", dbPath.String()))
+
+	settings.KV = kv
+	settings.TOTPSecretKey = "secret"
+	settings.OTPPolicy = OTPPolicyOptional
+
+	// Enroll saul and require OTP codes for kim
+	secret, _ := totp.GenerateSecret()
+	encryptedSecret, _ := totp.Encrypt(settings.TOTPSecretKey, secret)
+	settings.DB.Model(&models.User{}).Where("username = ?", "saul").Updates(map[string]interface{}{"totp_secret": encryptedSecret, "totp_enabled": true})
+	settings.DB.Model(&models.User{}).Where("username = ?", "kim").Update("ldap_require_otp", true)
+
+	counter := totp.Counter(time.Now())
+	code, _ := totp.Code(secret, counter)
+	nextCode, _ := totp.Code(secret, counter+1)
+	wrongCode, _ := totp.Code(secret, counter+5)
+
+	// Local clients belong to an application requiring OTP codes
+	vpn, err := ParseApplication("vpn:required:127.0.0.0/8")
+	if err != nil {
+		t.Fatalf("could not parse application - %v", err)
+	}
+	vpnSettings := settings
+	vpnSettings.Applications = []types.LDAPApplication{vpn}
+
+	vpnListener, err := net.Listen("tcp", "127.0.0.1:60003")
+	if err != nil {
+		t.Fatalf("could not initialize socket - %v", err)
+	}
+
+	// Launch testing servers
+	serve := func(l net.Listener, settings types.LDAPSettings) {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}
+	go serve(l, settings)
+	go serve(vpnListener, vpnSettings)
+	defer l.Close()
+	defer vpnListener.Close()
+
+	waitForTestServer(t, "127.0.0.1:60002")
+	waitForTestServer(t, "127.0.0.1:60003")
+
+	// Create Ldap connections
+	dial := func(addr string) *ldapClient.Conn {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		conn := ldapClient.NewConn(c, false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		return conn
+	}
+	conn := dial("127.0.0.1:60002")
+	defer conn.Close()
+	vpnConn := dial("127.0.0.1:60003")
+	defer vpnConn.Close()
+
+	// Test cases
+	testCases := []BindTestCase{
+		{
+			name:     "OTP code is optional",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:     "Password with OTP code",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test+" + code,
+			conn:     conn,
+		},
+		{
+			name:         "OTP code can't be replayed",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test+" + code,
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Wrong OTP code",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test+" + wrongCode,
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "User requires OTP code but has not enrolled",
+			username:     "uid=kim,ou=Users,dc=example,dc=org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Application requires OTP code",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test",
+			conn:         vpnConn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:     "Application requires OTP code and it's provided",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test+" + nextCode,
+			conn:     vpnConn,
+		},
+	}
+
+	for _, tc := range testCases {
+		runBindTests(t, tc)
+	}
+}
+
+func TestBindAppPassword(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60004")
+	defer testCleanUp(dbPath.String())
+
+	vpn, err := ParseApplication("vpn:optional:127.0.0.0/8")
+	if err != nil {
+		t.Fatalf("could not parse application - %v", err)
+	}
+	settings.Applications = []types.LDAPApplication{vpn}
+
+	// App passwords for saul
+	addAppPassword := func(name string, password string, application string, networks string, revoked bool) {
+		hash, _ := models.Hash(password)
+		hashedPassword := string(hash)
+		a := models.AppPassword{UserID: 3, Name: &name, Password: &hashedPassword, Application: &application, Networks: &networks}
+		// The mail app password was created before lookup identifiers existed
+		if name != "mail" {
+			lookup := models.AppPasswordLookup(password)
+			a.Lookup = &lookup
+		}
+		if revoked {
+			now := time.Now()
+			a.RevokedAt = &now
+		}
+		if err := settings.DB.Create(&a).Error; err != nil {
+			t.Fatalf("could not create app password - %v", err)
+		}
+	}
+	addAppPassword("mail", "mail-password", "", "", false)
+	addAppPassword("vpn", "vpn-password", "vpn", "", false)
+	addAppPassword("wifi", "wifi-password", "wifi", "", false)
+	addAppPassword("office", "office-password", "", "192.168.1.0/24", false)
+	addAppPassword("local", "local-password", "", "127.0.0.1/32", false)
+	addAppPassword("old", "old-password", "", "", true)
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60004")
+
+	// Create an Ldap connection
+	c, err := net.Dial("tcp", "127.0.0.1:60004")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+
+	// Test cases
+	testCases := []BindTestCase{
+		{
+			name:     "Unrestricted app password",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "mail-password",
+			conn:     conn,
+		},
+		{
+			name:     "App password restricted to client application",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "vpn-password",
+			conn:     conn,
+		},
+		{
+			name:         "App password restricted to other application",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "wifi-password",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "App password restricted to other network",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "office-password",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:     "App password restricted to client network",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "local-password",
+			conn:     conn,
+		},
+		{
+			name:         "Revoked app password",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "old-password",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "App password of other user",
+			username:     "uid=kim,ou=Users,dc=example,dc=org",
+			password:     "mail-password",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:     "User password still works",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
+	}
+
+	for _, tc := range testCases {
+		runBindTests(t, tc)
+	}
+
+	// Last used timestamp is recorded
+	var mail models.AppPassword
+	settings.DB.Where("name = ?", "mail").Take(&mail)
+	if mail.LastUsedAt == nil {
+		t.Fatalf("app password last used timestamp not recorded")
+	}
+
+	// App passwords without a lookup identifier get one once used
+	if mail.Lookup == nil || *mail.Lookup != models.AppPasswordLookup("mail-password") {
+		t.Fatalf("app password lookup identifier not recorded")
+	}
+
+	// Locked users can't bind with their app passwords
+	settings.DB.Model(&models.User{}).Where("id = ?", 3).Update("locked", true)
+	lockedTestCases := []BindTestCase{
+		{
+			name:         "App password of locked user",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "mail-password",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Password of locked user",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+	}
+
+	for _, tc := range lockedTestCases {
+		runBindTests(t, tc)
+	}
+}
+
+func TestBindRateLimit(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60005")
+	defer testCleanUp(dbPath.String())
+
+	kv, err := badgerdb.NewBadgerStore(fmt.Sprintf("/tmp/%s-kv", dbPath.String()))
+	if err != nil {
+		t.Fatalf("could not initialize kv - %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf("/tmp/%s-kv", dbPath.String()))
+
+	// Two failed binds are allowed
+	settings.KV = kv
+	settings.RateLimiter = ratelimit.New(kv, 2, time.Minute)
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60005")
+
+	// Create an Ldap connection
+	c, err := net.Dial("tcp", "127.0.0.1:60005")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+
+	// Test cases
+	testCases := []BindTestCase{
+		{
+			name:     "Bind successful",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:         "First wrong password",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test1",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Second wrong password",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test1",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Right password is throttled",
+			username:     "uid=saul,ou=Users,dc=example,dc=org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 51 "Busy": too many failed attempts, please try again later`,
+		},
+		{
+			name:         "Other users from the same client are throttled",
+			username:     "uid=kim,ou=Users,dc=example,dc=org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 51 "Busy": too many failed attempts, please try again later`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runBindTests(t, tc)
+	}
+}
+
+func TestBindNetworkPolicy(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60006")
+	defer testCleanUp(dbPath.String())
+
+	// Manager accounts can only bind from admin networks
+	if err := settings.NetworkPolicies.Add("manager:allow:10.0.0.0/24"); err != nil {
+		t.Fatalf("could not parse network rule - %v", err)
+	}
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60006")
+
+	// Create an Ldap connection
+	c, err := net.Dial("tcp", "127.0.0.1:60006")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+
+	// Test cases
+	testCases := []BindTestCase{
+		{
+			name:     "User bind allowed",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:         "Manager bind from a network not allowed",
+			username:     "cn=admin,dc=example,dc=org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 50 "Insufficient Access Rights": access from your network is not allowed`,
+		},
+	}
+
+	for _, tc := range testCases {
+		runBindTests(t, tc)
+	}
+}
+
+func TestConnectionNetworkPolicy(t *testing.T) {
+	dbPath := uuid.New()
+	db, err := newTestDatabase(dbPath.String())
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+	defer testCleanUp(dbPath.String())
+
+	// Local clients can't reach our server
+	settings := testSettings(db, "127.0.0.1:60007")
+	if err := settings.NetworkPolicies.Add("anonymous:deny:127.0.0.0/8"); err != nil {
+		t.Fatalf("could not parse network rule - %v", err)
+	}
+
+	var wg sync.WaitGroup
+	shutdownChannel := make(chan bool)
+	wg.Add(1)
+	go Server(&wg, shutdownChannel, settings)
+	defer func() {
+		shutdownChannel <- true
+		wg.Wait()
+	}()
+
+	waitForTestServer(t, "127.0.0.1:60007")
+
+	// Connections are closed as soon as they're accepted
+	c, err := net.Dial("tcp", "127.0.0.1:60007")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+
+	if err := conn.Bind("uid=saul,ou=Users,dc=example,dc=org", "test"); err == nil {
+		t.Fatal(fmt.Errorf("error was expected"))
+	}
+}
+
+func TestBindNames(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60012")
+	defer testCleanUp(dbPath.String())
+
+	settings.BindNameRules = []string{BindNameUID, BindNameMail, BindNameUPN, BindNameNetBIOS}
+
+	// kim's email looks like saul's user principal name
+	emails := map[string]string{"saul": "saul@example.com", "kim": "saul@example.org", "mike": "mike@example.com"}
+	for username, email := range emails {
+		if err := settings.DB.Model(&models.User{}).Where("username = ?", username).Update("email", email).Error; err != nil {
+			t.Fatalf("could not update email - %v", err)
+		}
+	}
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60012")
+
+	// Create an Ldap connection
+	c, err := net.Dial("tcp", "127.0.0.1:60012")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+
+	// Test cases
+	testCases := []BindTestCase{
+		{
+			name:     "Bind with DN",
+			username: "uid=saul,ou=Users,dc=example,dc=org",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:     "Bind with bare username",
+			username: "saul",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:     "Bind with email",
+			username: "Saul@example.com",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:     "Bind with user principal name",
+			username: "mike@example.org",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:     "Bind with NetBIOS domain",
+			username: "EXAMPLE\\kim",
+			password: "test",
+			conn:     conn,
+		},
+		{
+			name:         "Bind with another NetBIOS domain",
+			username:     "OTHER\\kim",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Bind name matching several users",
+			username:     "saul@example.org",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Bind name not matching any user",
+			username:     "walter",
+			password:     "test",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
+		{
+			name:         "Bind with email and wrong password",
+			username:     "saul@example.com",
+			password:     "wrong",
+			conn:         conn,
+			errorMessage: `LDAP Result Code 49 "Invalid Credentials": `,
+		},
 	}
 
 	for _, tc := range testCases {
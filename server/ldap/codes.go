@@ -108,6 +108,7 @@ const (
 	ObjectClassModsProhibited    = 69
 	AffectsMultipleDSAs          = 71
 	Other                        = 80
+	AuthorizationDenied          = 123
 )
 
 // Authentication Choices defined in RFC 4511
@@ -122,6 +123,12 @@ const Version3 = 3
 // WhoamIOID - OID defined for whoami in RFC 4532
 const WhoamIOID = "1.3.6.1.4.1.4203.1.11.3"
 
+// PagedResultsOID - OID defined for the paged results control in RFC 2696
+const PagedResultsOID = "1.2.840.113556.1.4.319"
+
+// ProxiedAuthzOID - OID defined for the proxied authorization control in RFC 4370
+const ProxiedAuthzOID = "2.16.840.1.113730.3.4.18"
+
 // Scopes defined in RFC 4511
 const (
 	BaseObject   = 0
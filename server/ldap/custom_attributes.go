@@ -0,0 +1,118 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"gorm.io/gorm"
+)
+
+// customAttributes returns the mappings of the custom attributes defined for
+// users or groups, private attributes are only returned if private is true
+func customAttributes(db *gorm.DB, entries string, private bool) ([]attributeMapping, error) {
+	catalog := []models.Attribute{}
+	if err := db.Session(&gorm.Session{NewDB: true}).Order("id").Find(&catalog).Error; err != nil {
+		return nil, err
+	}
+
+	mappings := []attributeMapping{}
+	for _, a := range catalog {
+		if !a.AppliesToEntries(entries) || (a.IsPrivate() && !private) {
+			continue
+		}
+		id := a.ID
+		mappings = append(mappings, attributeMapping{
+			name:   *a.Name,
+			values: func(e *entrySource) []string { return e.customValues(id) },
+		})
+	}
+	return mappings, nil
+}
+
+// customValues returns the values of a custom attribute of an entry
+func (e *entrySource) customValues(id uint32) []string {
+	var stored []models.AttributeValue
+	switch {
+	case e.user != nil:
+		stored = e.user.Attributes
+	case e.group != nil:
+		stored = e.group.Attributes
+	}
+
+	values := []string{}
+	for _, v := range stored {
+		if v.AttributeID == id && v.Value != nil {
+			values = append(values, *v.Value)
+		}
+	}
+	return values
+}
+
+// customCriteria adds the condition of a custom attribute e.g
+// (telephoneNumber=+34*) to a query. As it happens with other attributes
+// we don't know, undefined attributes and those that can't be read don't
+// filter entries
+func customCriteria(db *gorm.DB, filter string, entries string, index int, private bool) {
+	name, value, ok := strings.Cut(filter, "=")
+	if !ok {
+		return
+	}
+
+	var a models.Attribute
+	err := db.Session(&gorm.Session{NewDB: true}).Where("name_folded = ?", models.FoldIdentity(name)).Take(&a).Error
+	if err != nil || !a.AppliesToEntries(entries) || (a.IsPrivate() && !private) {
+		return
+	}
+
+	column := "user_id"
+	if entries == models.AttributeForGroups {
+		column = "group_id"
+	}
+
+	values := db.Session(&gorm.Session{NewDB: true}).Model(&models.AttributeValue{}).
+		Select(column).
+		Where("attribute_id = ?", a.ID)
+	switch {
+	case value == "*":
+		// Presence filter, any value matches
+	case strings.Contains(value, "*"):
+		values = values.Where("value_folded LIKE ?", strings.Replace(a.FoldValue(value), "*", "%", -1))
+	default:
+		values = values.Where("value_folded = ?", a.FoldValue(value))
+	}
+
+	if index == 0 {
+		db.Where("id IN (?)", values)
+	} else {
+		db.Or("id IN (?)", values)
+	}
+}
+
+// privilegedBind checks if the bound user is a manager or a readonly
+// account, only they can read private custom attributes as it happens in
+// our REST API
+func privilegedBind(settings types.LDAPSettings, boundDN string) bool {
+	var u models.User
+	username, ok := dnUsername(settings, boundDN)
+	if !ok || settings.DB.Where("username_folded = ?", models.FoldIdentity(username)).Take(&u).Error != nil {
+		return false
+	}
+	return (u.Manager != nil && *u.Manager) || (u.Readonly != nil && *u.Readonly)
+}
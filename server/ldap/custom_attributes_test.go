@@ -0,0 +1,154 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomAttributes(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60017")
+	defer testCleanUp(dbPath.String())
+
+	// Attribute catalog
+	define := func(name string, syntax string, visibility string, appliesTo string, multiValued bool) {
+		a := models.Attribute{Name: &name, Syntax: &syntax, Visibility: &visibility, AppliesTo: &appliesTo, MultiValued: &multiValued}
+		if err := settings.DB.Create(&a).Error; err != nil {
+			t.Fatalf("could not define attribute %s - %v", name, err)
+		}
+	}
+	define("telephoneNumber", "telephoneNumber", models.AttributePublic, models.AttributeForUsers, true)
+	define("employeeNumber", "integer", models.AttributePrivate, models.AttributeForUsers, false)
+	define("departmentNumber", "directoryString", models.AttributePublic, models.AttributeForAll, false)
+
+	set := func(userID *uint32, groupID *uint32, attributes map[string][]string) {
+		entries := models.AttributeForUsers
+		if groupID != nil {
+			entries = models.AttributeForGroups
+		}
+		changes, err := models.PrepareAttributeChanges(settings.DB, attributes, entries)
+		if err != nil {
+			t.Fatalf("could not prepare attribute values - %v", err)
+		}
+		if err := models.ApplyAttributeChanges(settings.DB, changes, userID, groupID); err != nil {
+			t.Fatalf("could not set attribute values - %v", err)
+		}
+	}
+	saul, kim, test := uint32(3), uint32(4), uint32(1)
+	set(&saul, nil, map[string][]string{"telephoneNumber": {"+34 600 000 000", "+34 600 000 001"}, "employeeNumber": {"42"}})
+	set(&kim, nil, map[string][]string{"telephoneNumber": {"+34 611 111 111"}, "departmentNumber": {"D10"}})
+	set(nil, &test, map[string][]string{"departmentNumber": {"D10"}})
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60017")
+
+	connect := func(dn string) *ldapClient.Conn {
+		c, err := net.Dial("tcp", "127.0.0.1:60017")
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		conn := ldapClient.NewConn(c, false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		if err := conn.Bind(dn, "test"); err != nil {
+			t.Fatalf("could not bind - %v", err)
+		}
+		return conn
+	}
+	searchConn := connect("cn=search,dc=example,dc=org")
+	defer searchConn.Close()
+	kimConn := connect("uid=kim,ou=Users,dc=example,dc=org")
+	defer kimConn.Close()
+
+	search := func(t *testing.T, conn *ldapClient.Conn, baseDN string, filter string, attributes []string) []*ldapClient.Entry {
+		searchRequest := ldapClient.NewSearchRequest(baseDN, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, attributes, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return sr.Entries
+	}
+
+	names := func(entries []*ldapClient.Entry, attribute string) []string {
+		values := []string{}
+		for _, entry := range entries {
+			values = append(values, entry.GetAttributeValue(attribute))
+		}
+		return values
+	}
+
+	t.Run("custom attributes are served", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(uid=saul)", []string{"telephoneNumber", "employeeNumber"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, []string{"+34 600 000 000", "+34 600 000 001"}, entries[0].GetAttributeValues("telephoneNumber"))
+		assert.Equal(t, []string{"42"}, entries[0].GetAttributeValues("employeeNumber"))
+	})
+
+	t.Run("custom attributes are user attributes", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(uid=kim)", []string{"*"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, []string{"+34 611 111 111"}, entries[0].GetAttributeValues("telephoneNumber"))
+		assert.Equal(t, []string{"D10"}, entries[0].GetAttributeValues("departmentNumber"))
+	})
+
+	t.Run("private attributes are not served to plain users", func(t *testing.T) {
+		entries := search(t, kimConn, "ou=Users,dc=example,dc=org", "(uid=saul)", []string{"telephoneNumber", "employeeNumber"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, []string{"+34 600 000 000", "+34 600 000 001"}, entries[0].GetAttributeValues("telephoneNumber"))
+		assert.Empty(t, entries[0].GetAttributeValues("employeeNumber"))
+	})
+
+	t.Run("telephone numbers match ignoring spaces", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(telephoneNumber=+34600000001)", []string{"uid"})
+		assert.Equal(t, []string{"saul"}, names(entries, "uid"))
+	})
+
+	t.Run("substring filters on custom attributes", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(&(objectClass=*)(telephoneNumber=+34 611*))", []string{"uid"})
+		assert.Equal(t, []string{"kim"}, names(entries, "uid"))
+	})
+
+	t.Run("presence filters on custom attributes", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(telephoneNumber=*)", []string{"uid"})
+		assert.Equal(t, []string{"saul", "kim"}, names(entries, "uid"))
+	})
+
+	t.Run("private attributes filter entries for privileged accounts", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Users,dc=example,dc=org", "(employeeNumber=42)", []string{"uid"})
+		assert.Equal(t, []string{"saul"}, names(entries, "uid"))
+	})
+
+	t.Run("groups are filtered by custom attributes ignoring case", func(t *testing.T) {
+		entries := search(t, searchConn, "ou=Groups,dc=example,dc=org", "(departmentNumber=d10)", []string{"cn", "departmentNumber"})
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, "test", entries[0].GetAttributeValue("cn"))
+		assert.Equal(t, "D10", entries[0].GetAttributeValue("departmentNumber"))
+	})
+}
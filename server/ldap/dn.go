@@ -0,0 +1,330 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// AttributeTypeAndValue - an attribute assertion in a RDN e.g uid=alice
+type AttributeTypeAndValue struct {
+	Type  string
+	Value string
+}
+
+// RDN - relative distinguished name, one or more attribute assertions
+// joined with + e.g cn=alice+uid=alice
+type RDN []AttributeTypeAndValue
+
+// DN - distinguished name as defined in RFC 4514, the first RDN is the
+// leftmost one
+type DN []RDN
+
+// ParseDN parses the string representation of a distinguished name
+// (RFC 4514). Escaped characters, hex pairs and #hexstring values are
+// decoded and whitespace around types and values is ignored
+func ParseDN(s string) (DN, error) {
+	dn := DN{}
+	if strings.TrimSpace(s) == "" {
+		return dn, nil
+	}
+
+	rdn := RDN{}
+	for i := 0; ; {
+		attrType, next, err := parseAttributeType(s, i)
+		if err != nil {
+			return nil, err
+		}
+		value, next, err := parseAttributeValue(s, next)
+		if err != nil {
+			return nil, err
+		}
+		rdn = append(rdn, AttributeTypeAndValue{Type: attrType, Value: value})
+
+		if next == len(s) {
+			dn = append(dn, rdn)
+			return dn, nil
+		}
+
+		switch s[next] {
+		case '+':
+		case ',', ';':
+			dn = append(dn, rdn)
+			rdn = RDN{}
+		default:
+			return nil, fmt.Errorf("unexpected character %q in DN %s", s[next], s)
+		}
+		i = next + 1
+	}
+}
+
+// parseAttributeType reads an attribute type and the = that follows it
+func parseAttributeType(s string, i int) (string, int, error) {
+	end := strings.IndexByte(s[i:], '=')
+	if end < 0 {
+		return "", 0, fmt.Errorf("missing = in DN %s", s)
+	}
+	attrType := strings.TrimSpace(s[i : i+end])
+	if attrType == "" {
+		return "", 0, fmt.Errorf("empty attribute type in DN %s", s)
+	}
+	for j, c := range attrType {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && (j == 0 || (c != '-' && c != '.')) {
+			return "", 0, fmt.Errorf("wrong attribute type %s in DN %s", attrType, s)
+		}
+	}
+	return attrType, i + end + 1, nil
+}
+
+// parseAttributeValue reads an attribute value until the next unescaped
+// separator, it returns the decoded value and the separator position
+func parseAttributeValue(s string, i int) (string, int, error) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+
+	// #hexstring holds the BER encoding of the value
+	if i < len(s) && s[i] == '#' {
+		end := i + 1
+		for end < len(s) && !strings.ContainsRune(",+; ", rune(s[end])) {
+			end++
+		}
+		value, err := decodeHexValue(s[i+1 : end])
+		if err != nil {
+			return "", 0, fmt.Errorf("wrong hex value in DN %s: %v", s, err)
+		}
+		for end < len(s) && s[end] == ' ' {
+			end++
+		}
+		return value, end, nil
+	}
+
+	value := []byte{}
+	// Trailing spaces are ignored unless they are escaped
+	significant := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ',' || c == '+' || c == ';':
+			v, err := parsedValue(s, value[:significant])
+			return v, i, err
+		case c == '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("wrong escape sequence in DN %s", s)
+			}
+			if strings.IndexByte(" \"#+,;<=>\\", s[i+1]) >= 0 {
+				value = append(value, s[i+1])
+				i++
+			} else {
+				if i+2 >= len(s) {
+					return "", 0, fmt.Errorf("wrong escape sequence in DN %s", s)
+				}
+				b, err := hex.DecodeString(s[i+1 : i+3])
+				if err != nil {
+					return "", 0, fmt.Errorf("wrong escape sequence in DN %s", s)
+				}
+				value = append(value, b...)
+				i += 2
+			}
+			significant = len(value)
+		case c == '"' || c == '<' || c == '>' || c == 0:
+			return "", 0, fmt.Errorf("character %q must be escaped in DN %s", c, s)
+		default:
+			value = append(value, c)
+			if c != ' ' {
+				significant = len(value)
+			}
+		}
+	}
+	v, err := parsedValue(s, value[:significant])
+	return v, len(s), err
+}
+
+// parsedValue checks that a decoded value is valid UTF-8
+func parsedValue(s string, value []byte) (string, error) {
+	if !utf8.Valid(value) {
+		return "", fmt.Errorf("value is not valid UTF-8 in DN %s", s)
+	}
+	return string(value), nil
+}
+
+// decodeHexValue decodes the BER encoded string of a #hexstring value
+func decodeHexValue(h string) (string, error) {
+	data, err := hex.DecodeString(h)
+	if err != nil {
+		return "", err
+	}
+	p, err := ber.DecodePacketErr(data)
+	if err != nil {
+		return "", err
+	}
+	if p.ClassType != ber.ClassUniversal || p.TagType != ber.TypePrimitive {
+		return "", fmt.Errorf("value is not a string")
+	}
+	return p.Data.String(), nil
+}
+
+// EscapeDNValue escapes an attribute value so it can be used in the string
+// representation of a DN (RFC 4514 section 2.4)
+func EscapeDNValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte("\"+,;<>\\", c) >= 0,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(value)-1 && c == ' ':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString("\\00")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// String returns the string representation of a RDN
+func (r RDN) String() string {
+	attrs := []string{}
+	for _, a := range r {
+		attrs = append(attrs, a.Type+"="+EscapeDNValue(a.Value))
+	}
+	return strings.Join(attrs, "+")
+}
+
+// String returns the string representation of a DN
+func (d DN) String() string {
+	rdns := []string{}
+	for _, r := range d {
+		rdns = append(rdns, r.String())
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Normalize returns a canonical form of the DN used to compare names:
+// types and values are lowercased, insignificant spaces are removed and
+// the assertions of multi-valued RDNs are sorted
+func (d DN) Normalize() string {
+	rdns := []string{}
+	for _, r := range d {
+		attrs := []string{}
+		for _, a := range r {
+			value := strings.Join(strings.Fields(strings.ToLower(a.Value)), " ")
+			attrs = append(attrs, strings.ToLower(a.Type)+"="+EscapeDNValue(value))
+		}
+		sort.Strings(attrs)
+		rdns = append(rdns, strings.Join(attrs, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Equal checks if two DNs name the same entry
+func (d DN) Equal(other DN) bool {
+	return d.Normalize() == other.Normalize()
+}
+
+// IsDescendantOf checks if a DN is under another DN in the tree
+func (d DN) IsDescendantOf(ancestor DN) bool {
+	return len(d) > len(ancestor) && d[len(d)-len(ancestor):].Equal(ancestor)
+}
+
+// Parent returns the DN of the entry that holds this one
+func (d DN) Parent() DN {
+	if len(d) == 0 {
+		return DN{}
+	}
+	return d[1:]
+}
+
+// normalizeDN returns the canonical form of a DN string, names that can't
+// be parsed are only lowercased
+func normalizeDN(dn string) string {
+	parsed, err := ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return parsed.Normalize()
+}
+
+// equalDN checks if two DN strings name the same entry
+func equalDN(a string, b string) bool {
+	return normalizeDN(a) == normalizeDN(b)
+}
+
+// childValue returns the value of a DN whose RDN is attrType=value and
+// whose parent is the given DN e.g uid=alice below ou=Users
+func childValue(dn string, parent string, attrType string) (string, bool) {
+	d, err := ParseDN(dn)
+	if err != nil || len(d) == 0 || len(d[0]) != 1 || !strings.EqualFold(d[0][0].Type, attrType) {
+		return "", false
+	}
+	p, err := ParseDN(parent)
+	if err != nil || !d.Parent().Equal(p) {
+		return "", false
+	}
+	return d[0][0].Value, true
+}
+
+// usersDN returns the DN of the organizational unit holding our users
+func usersDN(domain string) string {
+	return "ou=Users," + domain
+}
+
+// groupsDN returns the DN of the organizational unit holding our groups
+func groupsDN(domain string) string {
+	return "ou=Groups," + domain
+}
+
+// servicesDN returns the DN of the organizational unit holding our service
+// accounts
+func servicesDN(domain string) string {
+	return "ou=Services," + domain
+}
+
+// userDN returns the distinguished name of a user
+func userDN(domain string, username string) string {
+	return "uid=" + EscapeDNValue(username) + "," + usersDN(domain)
+}
+
+// groupDN returns the distinguished name of a group
+func groupDN(domain string, name string) string {
+	return "cn=" + EscapeDNValue(name) + "," + groupsDN(domain)
+}
+
+// serviceAccountDN returns the distinguished name of a service account
+func serviceAccountDN(domain string, name string) string {
+	return "cn=" + EscapeDNValue(name) + "," + servicesDN(domain)
+}
+
+// accountDN returns the DN used for the account that created or updated
+// an entry, the admin account lives at the top of our tree
+func accountDN(domain string, username string) string {
+	if username == "admin" {
+		return "cn=admin," + domain
+	}
+	return userDN(domain, username)
+}
@@ -0,0 +1,254 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDN(t *testing.T) {
+	testCases := []struct {
+		name       string
+		dn         string
+		want       DN
+		normalized string
+		errors     bool
+	}{
+		{
+			name:       "Simple DN",
+			dn:         "uid=saul,ou=Users,dc=example,dc=org",
+			want:       DN{{{"uid", "saul"}}, {{"ou", "Users"}}, {{"dc", "example"}}, {{"dc", "org"}}},
+			normalized: "uid=saul,ou=users,dc=example,dc=org",
+		},
+		{
+			name:       "Case and whitespace",
+			dn:         " UID = Saul ,  OU=Users ,DC=Example,DC=org ",
+			want:       DN{{{"UID", "Saul"}}, {{"OU", "Users"}}, {{"DC", "Example"}}, {{"DC", "org"}}},
+			normalized: "uid=saul,ou=users,dc=example,dc=org",
+		},
+		{
+			name:       "Escaped special characters",
+			dn:         `cn=Doe\, John \+ \"Jr\" \<x\>\;\\,dc=org`,
+			want:       DN{{{"cn", `Doe, John + "Jr" <x>;\`}}, {{"dc", "org"}}},
+			normalized: `cn=doe\, john \+ \"jr\" \<x\>\;\\,dc=org`,
+		},
+		{
+			name:       "Hex pairs and UTF-8",
+			dn:         `cn=Lu\C4\8Di\c4\87,dc=org`,
+			want:       DN{{{"cn", "Lučić"}}, {{"dc", "org"}}},
+			normalized: "cn=lučić,dc=org",
+		},
+		{
+			name:       "Escaped leading and trailing spaces",
+			dn:         `cn=\ saul\ ,dc=org`,
+			want:       DN{{{"cn", " saul "}}, {{"dc", "org"}}},
+			normalized: "cn=saul,dc=org",
+		},
+		{
+			name:       "Multi-valued RDN",
+			dn:         "uid=saul+cn=Saul Goodman,dc=org",
+			want:       DN{{{"uid", "saul"}, {"cn", "Saul Goodman"}}, {{"dc", "org"}}},
+			normalized: "cn=saul goodman+uid=saul,dc=org",
+		},
+		{
+			name:       "Hex string value",
+			dn:         "cn=#04046a6f686e,dc=org",
+			want:       DN{{{"cn", "john"}}, {{"dc", "org"}}},
+			normalized: "cn=john,dc=org",
+		},
+		{
+			name:       "Empty DN",
+			dn:         "",
+			want:       DN{},
+			normalized: "",
+		},
+		{
+			name:   "Missing equals sign",
+			dn:     "saul,dc=org",
+			errors: true,
+		},
+		{
+			name:   "Unescaped quote",
+			dn:     `cn=a"b,dc=org`,
+			errors: true,
+		},
+		{
+			name:   "Wrong hex pair",
+			dn:     `cn=a\zz,dc=org`,
+			errors: true,
+		},
+		{
+			name:   "Invalid UTF-8",
+			dn:     `cn=a\ff,dc=org`,
+			errors: true,
+		},
+		{
+			name:   "Empty attribute type",
+			dn:     "=saul,dc=org",
+			errors: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dn, err := ParseDN(tc.dn)
+			if tc.errors {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, dn)
+			assert.Equal(t, tc.normalized, dn.Normalize())
+
+			// The string representation must parse to the same DN
+			again, err := ParseDN(dn.String())
+			assert.NoError(t, err)
+			assert.Equal(t, dn, again)
+		})
+	}
+}
+
+func TestEscapeDNValue(t *testing.T) {
+	assert.Equal(t, "saul", EscapeDNValue("saul"))
+	assert.Equal(t, `Doe\, John`, EscapeDNValue("Doe, John"))
+	assert.Equal(t, `\#1\+2\;\<3\>\"4\"\\`, EscapeDNValue(`#1+2;<3>"4"\`))
+	assert.Equal(t, `\ saul\ `, EscapeDNValue(" saul "))
+	assert.Equal(t, `a\00b`, EscapeDNValue("a\x00b"))
+}
+
+func TestDNComparison(t *testing.T) {
+	user, _ := ParseDN("uid=saul,ou=Users,dc=example,dc=org")
+	domain, _ := ParseDN("DC=Example, DC=Org")
+	assert.True(t, user.IsDescendantOf(domain))
+	assert.False(t, domain.IsDescendantOf(domain))
+	assert.False(t, domain.IsDescendantOf(user))
+	assert.True(t, equalDN("ou=users,dc=example,dc=org", user.Parent().String()))
+
+	username, ok := childValue(`uid=Doe\, John,OU=Users,dc=example,dc=org`, "ou=Users,dc=example,dc=org", "uid")
+	assert.True(t, ok)
+	assert.Equal(t, "Doe, John", username)
+	_, ok = childValue("uid=saul,ou=Groups,dc=example,dc=org", "ou=Users,dc=example,dc=org", "uid")
+	assert.False(t, ok)
+	_, ok = childValue("uid=saul+cn=saul,ou=Users,dc=example,dc=org", "ou=Users,dc=example,dc=org", "uid")
+	assert.False(t, ok)
+}
+
+func TestDNEscaping(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60013")
+	defer testCleanUp(dbPath.String())
+
+	// Names with characters that must be escaped in DNs
+	if err := settings.DB.Model(&models.User{}).Where("username = ?", "kim").Update("username", "wexler, kim").Error; err != nil {
+		t.Fatalf("could not rename user - %v", err)
+	}
+	if err := settings.DB.Model(&models.Group{}).Where("name = ?", "test2").Update("name", "dev+ops").Error; err != nil {
+		t.Fatalf("could not rename group - %v", err)
+	}
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60013")
+
+	connect := func(t *testing.T) *ldapClient.Conn {
+		c, err := net.Dial("tcp", "127.0.0.1:60013")
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		conn := ldapClient.NewConn(c, false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		return conn
+	}
+
+	t.Run("bind with escaped DNs", func(t *testing.T) {
+		for _, dn := range []string{
+			`uid=wexler\, kim,ou=Users,dc=example,dc=org`,
+			`uid=wexler\2c kim,ou=Users,dc=example,dc=org`,
+			`UID=wexler\, kim , OU=users, DC=Example, DC=org`,
+		} {
+			conn := connect(t)
+			assert.NoError(t, conn.Bind(dn, "test"), dn)
+			conn.Close()
+		}
+
+		conn := connect(t)
+		defer conn.Close()
+		err := conn.Bind("uid=wexler, kim,ou=Users,dc=example,dc=org", "test")
+		assert.True(t, ldapClient.IsErrorWithCode(err, InvalidCredentials))
+	})
+
+	conn := connect(t)
+	defer conn.Close()
+	if err := conn.Bind("cn=admin,dc=example,dc=org", "test"); err != nil {
+		t.Fatalf("could not bind as admin - %v", err)
+	}
+
+	search := func(base string, filter string, attributes []string) (*ldapClient.SearchResult, error) {
+		searchRequest := ldapClient.NewSearchRequest(base, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, attributes, nil)
+		return conn.Search(searchRequest)
+	}
+
+	t.Run("user entry", func(t *testing.T) {
+		sr, err := search(`uid=wexler\, kim,OU=Users,dc=example,dc=org`, "(objectClass=*)", []string{"memberOf", "entryDN"})
+		assert.NoError(t, err)
+		if assert.Len(t, sr.Entries, 1) {
+			entry := sr.Entries[0]
+			assert.Equal(t, `uid=wexler\, kim,ou=Users,dc=example,dc=org`, entry.DN)
+			assert.Equal(t, []string{entry.DN}, entry.GetAttributeValues("entryDN"))
+			assert.ElementsMatch(t, []string{"cn=test,ou=Groups,dc=example,dc=org", `cn=dev\+ops,ou=Groups,dc=example,dc=org`}, entry.GetAttributeValues("memberOf"))
+		}
+	})
+
+	t.Run("group entry", func(t *testing.T) {
+		sr, err := search(`cn=dev\+ops,ou=Groups,dc=example,dc=org`, "(objectClass=*)", []string{"member"})
+		assert.NoError(t, err)
+		if assert.Len(t, sr.Entries, 1) {
+			assert.Equal(t, `cn=dev\+ops,ou=Groups,dc=example,dc=org`, sr.Entries[0].DN)
+			assert.Equal(t, []string{`uid=wexler\, kim,ou=Users,dc=example,dc=org`}, sr.Entries[0].GetAttributeValues("member"))
+		}
+	})
+
+	t.Run("memberOf filter", func(t *testing.T) {
+		sr, err := search("ou=Users,dc=example,dc=org", `(memberOf=CN=dev\5c+ops,ou=groups,dc=example,dc=org)`, []string{"uid"})
+		assert.NoError(t, err)
+		if assert.Len(t, sr.Entries, 1) {
+			assert.Equal(t, `uid=wexler\, kim,ou=Users,dc=example,dc=org`, sr.Entries[0].DN)
+		}
+	})
+
+	t.Run("base DN values are not patterns", func(t *testing.T) {
+		for _, base := range []string{
+			"uid=*,ou=Users,dc=example,dc=org",
+			"uid=%,ou=Users,dc=example,dc=org",
+			"cn=*,ou=Groups,dc=example,dc=org",
+			"cn=t%,ou=Groups,dc=example,dc=org",
+		} {
+			sr, err := search(base, "(objectClass=*)", []string{})
+			assert.NoError(t, err, base)
+			assert.Empty(t, sr.Entries, base)
+		}
+	})
+
+	t.Run("invalid base DN", func(t *testing.T) {
+		_, err := search("uid=saul,ou=Users,dc=example,=org", "(objectClass=*)", []string{})
+		assert.True(t, ldapClient.IsErrorWithCode(err, InvalidDNSyntax))
+	})
+}
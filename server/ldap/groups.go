@@ -1,7 +1,6 @@
 package ldap
 
 import (
-	"fmt"
 	"regexp"
 	"strings"
 
@@ -14,134 +13,152 @@ type groupQueryParams struct {
 	db             *gorm.DB
 	filter         string
 	originalFilter string
-	attributes     string
+	attributes     attributeSelection
 	id             int64
 	domain         string
 	limit          int
 	offset         int
 	guacamole      bool
+	private        bool
+	custom         []attributeMapping
+	name           string
 }
 
-func groupEntry(group models.Group, params groupQueryParams) map[string][]string {
-	attrs := make(map[string]string)
-	for _, a := range strings.Split(params.attributes, " ") {
-		attrs[a] = a
-	}
-
-	_, operational := attrs["+"]
-
-	values := map[string][]string{}
-
-	_, ok := attrs["structuralObjectClass"]
-	if ok || operational {
-		values["structuralObjectClass"] = []string{"groupOfNames"}
-	}
-
-	_, ok = attrs["entryUUID"]
-	if ok || operational {
-		values["entryUUID"] = []string{*group.UUID}
-	}
-
-	_, ok = attrs["creatorsName"]
-	if ok || operational {
-		creator := *group.CreatedBy
-		createdBy := ""
-		if creator == "admin" {
-			createdBy = fmt.Sprintf("cn=admin,%s", params.domain)
-		} else {
-			createdBy = fmt.Sprintf("uid=%s,ou=Users,%s", creator, params.domain)
-		}
-		values["creatorsName"] = []string{createdBy}
-	}
-
-	_, ok = attrs["createTimestamp"]
-	if ok || operational {
-		values["createTimestamp"] = []string{group.CreatedAt.Format("20060102150405Z")}
-	}
-
-	_, ok = attrs["creatorsName"]
-	if ok || operational {
-		modifier := *group.UpdatedBy
-		updatedBy := ""
-		if modifier == "admin" {
-			updatedBy = fmt.Sprintf("cn=admin,%s", params.domain)
-		} else {
-			updatedBy = fmt.Sprintf("uid=%s,ou=Users,%s", modifier, params.domain)
-		}
-		values["modifiersName"] = []string{updatedBy}
-	}
-
-	_, ok = attrs["modifyTimestamp"]
-	if ok || operational {
-		values["modifyTimestamp"] = []string{group.UpdatedAt.Format("20060102150405Z")}
-	}
-
-	if params.attributes == "ALL" || attrs["cn"] != "" || attrs["groupOfNames"] != "" || operational {
-		values["cn"] = []string{*group.Name}
-	}
-
-	_, ok = attrs["objectClass"]
-	if params.attributes == "ALL" || ok || operational {
-		if group.GuacamoleConfigParameters != nil && group.GuacamoleConfigProtocol != nil && params.guacamole {
-			values["objectClass"] = []string{"groupOfNames", "guacConfigGroup"}
-		} else {
-			values["objectClass"] = []string{"groupOfNames"}
-		}
-	}
-
-	_, ok = attrs["entryDN"]
-	if ok || operational {
-		values["entryDN"] = []string{fmt.Sprintf("cn=%s,ou=Groups,%s", *group.Name, params.domain)}
-	}
-
-	_, ok = attrs["subschemaSubentry"]
-	if ok || operational {
-		values["subschemaSubentry"] = []string{"cn=Subschema"}
-	}
-
-	_, ok = attrs["hasSubordinates"]
-	if ok || operational {
-		values["hasSubordinates"] = []string{"FALSE"}
-	}
-
-	_, ok = attrs["member"]
-	if params.attributes == "ALL" || ok || attrs["groupOfNames"] != "" || operational {
-		members := []string{}
-		for _, member := range group.Members {
-			members = append(members, fmt.Sprintf("uid=%s,ou=Users,%s", *member.Username, params.domain))
-		}
-		values["member"] = members
-	}
-
-	_, ok = attrs["uid"]
-	if params.attributes == "ALL" || ok || attrs["groupOfNames"] != "" || operational {
-		uids := []string{}
-		for _, member := range group.Members {
-			uids = append(uids, *member.Username)
-		}
-		values["uid"] = uids
-	}
+// guacamoleGroup checks if a group is an Apache Guacamole configuration
+func guacamoleGroup(e *entrySource) bool {
+	return e.guacamole && e.group.GuacamoleConfigParameters != nil && e.group.GuacamoleConfigProtocol != nil
+}
 
-	_, ok = attrs["guacConfigProtocol"]
-	if (params.attributes == "ALL" || ok || attrs["groupOfNames"] != "" || attrs["guacConfigGroup"] != "" || operational) && params.guacamole && group.GuacamoleConfigParameters != nil && group.GuacamoleConfigProtocol != nil {
-		values["guacConfigProtocol"] = []string{*group.GuacamoleConfigProtocol}
-	}
+// groupAttributes - attributes of group entries
+var groupAttributes = append([]attributeMapping{
+	{
+		name:          "objectClass",
+		objectClasses: []string{"top"},
+		values: func(e *entrySource) []string {
+			classes := []string{"groupOfNames"}
+			if e.group.GIDNumber != nil {
+				classes = append(classes, "posixGroup")
+			}
+			if guacamoleGroup(e) {
+				classes = append(classes, "guacConfigGroup")
+			}
+			return classes
+		},
+	},
+	{
+		name:          "cn",
+		aliases:       []string{"commonName"},
+		objectClasses: []string{"groupOfNames", "posixGroup"},
+		values:        func(e *entrySource) []string { return stringValue(e.group.Name) },
+	},
+	{
+		name:          "description",
+		objectClasses: []string{"groupOfNames", "posixGroup"},
+		values:        func(e *entrySource) []string { return stringValue(e.group.Description) },
+	},
+	{
+		name:          "member",
+		objectClasses: []string{"groupOfNames"},
+		values: func(e *entrySource) []string {
+			members := []string{}
+			for _, member := range e.group.Members {
+				members = append(members, userDN(e.domain, *member.Username))
+			}
+			for _, member := range e.group.MemberGroups {
+				members = append(members, groupDN(e.domain, *member.Name))
+			}
+			return members
+		},
+	},
+	{
+		// Usernames of the members for clients that don't read DNs
+		name:          "uid",
+		objectClasses: []string{"groupOfNames"},
+		values: func(e *entrySource) []string {
+			uids := []string{}
+			for _, member := range e.group.Members {
+				uids = append(uids, *member.Username)
+			}
+			return uids
+		},
+	},
+	{
+		name:          "gidNumber",
+		objectClasses: []string{"posixGroup"},
+		values:        func(e *entrySource) []string { return numberValue(e.group.GIDNumber) },
+	},
+	{
+		name:          "memberUid",
+		objectClasses: []string{"posixGroup"},
+		values: func(e *entrySource) []string {
+			if e.group.GIDNumber == nil {
+				return nil
+			}
+			uids := []string{}
+			for _, member := range e.group.Members {
+				uids = append(uids, *member.Username)
+			}
+			return uids
+		},
+	},
+	{
+		name:          "guacConfigProtocol",
+		objectClasses: []string{"guacConfigGroup"},
+		values: func(e *entrySource) []string {
+			if !guacamoleGroup(e) {
+				return nil
+			}
+			return []string{*e.group.GuacamoleConfigProtocol}
+		},
+	},
+	{
+		name:          "guacConfigParameter",
+		objectClasses: []string{"guacConfigGroup"},
+		values: func(e *entrySource) []string {
+			if !guacamoleGroup(e) {
+				return nil
+			}
+			return strings.Split(*e.group.GuacamoleConfigParameters, ",")
+		},
+	},
+}, operationalAttributes...)
 
-	_, ok = attrs["guacConfigParameter"]
-	if (params.attributes == "ALL" || ok || attrs["groupOfNames"] != "" || attrs["guacConfigGroup"] != "" || operational) && params.guacamole && group.GuacamoleConfigParameters != nil && group.GuacamoleConfigProtocol != nil {
-		parameters := strings.Split(*group.GuacamoleConfigParameters, ",")
-		values["guacConfigParameter"] = parameters
+func groupEntry(group models.Group, params groupQueryParams) map[string][]string {
+	e := entrySource{
+		dn:         groupDN(params.domain, *group.Name),
+		structural: "groupOfNames",
+		uuid:       group.UUID,
+		createdBy:  group.CreatedBy,
+		createdAt:  group.CreatedAt,
+		updatedBy:  group.UpdatedBy,
+		updatedAt:  group.UpdatedAt,
+		domain:     params.domain,
+		guacamole:  params.guacamole,
+		group:      &group,
 	}
-
-	return values
+	return params.attributes.entryValues(append(groupAttributes[:len(groupAttributes):len(groupAttributes)], params.custom...), &e)
 }
 
 func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int, int64) {
 	var r []*ber.Packet
 	groups := []models.Group{}
 
-	params.db = params.db.Preload("Members").Model(&models.Group{})
-	analyzeGroupsCriteria(params.db, params.filter, false, "", 0, params.domain)
+	custom, customErr := customAttributes(params.db, models.AttributeForGroups, params.private)
+	if customErr != nil {
+		return nil, &ServerError{
+			Msg:  "could not retrieve information from database",
+			Code: Other,
+		}, 0, 0
+	}
+	params.custom = custom
+
+	params.db = params.db.Preload("Members").Preload("MemberGroups").Preload("Attributes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Model(&models.Group{})
+	analyzeGroupsCriteria(params.db, params.filter, false, "", 0, params.domain, params.private)
+	if params.name != "" {
+		params.db.Where("name_folded = ?", models.FoldIdentity(params.name))
+	}
 
 	allResults := params.db.Find(&groups)
 	if allResults.Error != nil {
@@ -171,8 +188,37 @@ func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int,
 	filterInGuacConfigGroup, _ := regexp.Compile(`&\(objectClass=guacConfigGroup\)`)
 	includeGuacConfigGroup := filterInGuacConfigGroup.FindStringSubmatch(params.originalFilter) != nil
 
+	// Memberships through nested groups
+	withMember, chainErr := groupsWithMemberInChain(params.db, params.domain, inChainValues(params.originalFilter, "member"))
+	nestedIn, nestedErr := groupsInChain(params.db, params.domain, inChainValues(params.originalFilter, "memberOf"), false)
+	if chainErr != nil || nestedErr != nil {
+		return nil, &ServerError{
+			Msg:  "could not retrieve information from database",
+			Code: Other,
+		}, 0, 0
+	}
+	chained := intersectIDs(withMember, nestedIn)
+
 	filterUser, _ := regexp.Compile("uid=([A-Za-z.0-9-]+)")
-	if filterUser.MatchString(params.originalFilter) {
+	if chained != nil {
+		for _, group := range groups {
+			if !chained[group.ID] {
+				continue
+			}
+			// If query contains !(objectClass=guacConfigGroup) it means that a Guacamole query has been used to exclude those groups
+			if excludeGuacConfigGroup && group.GuacamoleConfigParameters != nil && group.GuacamoleConfigProtocol != nil {
+				continue
+			}
+			// If query contains &(objectClass=guacConfigGroup) it means that a Guacamole query has been used to include those groups
+			if includeGuacConfigGroup && (group.GuacamoleConfigProtocol == nil || group.GuacamoleConfigParameters == nil) {
+				continue
+			}
+			dn := groupDN(params.domain, *group.Name)
+			values := groupEntry(group, params)
+			e := encodeSearchResultEntry(params.id, values, dn)
+			r = append(r, e)
+		}
+	} else if filterUser.MatchString(params.originalFilter) {
 		matches := filterUser.FindStringSubmatch(params.originalFilter)
 		if matches != nil {
 			for _, group := range groups {
@@ -182,7 +228,7 @@ func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int,
 				}
 				filteredMembers := []*models.User{}
 				for _, member := range group.Members {
-					if *member.Username == matches[1] {
+					if models.FoldIdentity(*member.Username) == models.FoldIdentity(matches[1]) {
 						// If query contains &(objectClass=guacConfigGroup) it means that a Guacamole query has been used to include those groups
 						if includeGuacConfigGroup && (group.GuacamoleConfigProtocol == nil || group.GuacamoleConfigParameters == nil) {
 							continue
@@ -194,7 +240,7 @@ func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int,
 					continue
 				}
 				group.Members = filteredMembers
-				dn := fmt.Sprintf("cn=%s,ou=Groups,%s", *group.Name, params.domain)
+				dn := groupDN(params.domain, *group.Name)
 				values := groupEntry(group, params)
 				e := encodeSearchResultEntry(params.id, values, dn)
 				r = append(r, e)
@@ -206,7 +252,7 @@ func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int,
 			if excludeGuacConfigGroup && group.GuacamoleConfigParameters != nil && group.GuacamoleConfigProtocol != nil {
 				continue
 			}
-			dn := fmt.Sprintf("cn=%s,ou=Groups,%s", *group.Name, params.domain)
+			dn := groupDN(params.domain, *group.Name)
 			values := groupEntry(group, params)
 			e := encodeSearchResultEntry(params.id, values, dn)
 			r = append(r, e)
@@ -216,17 +262,34 @@ func getGroupsFromDB(params groupQueryParams) ([]*ber.Packet, *ServerError, int,
 	return r, nil, len(groups), totalResults
 }
 
-func analyzeGroupsCriteria(db *gorm.DB, filter string, boolean bool, booleanOperator string, index int, domain string) {
+// intersectIDs returns the ids in both sets, a nil set doesn't filter ids
+func intersectIDs(a map[uint32]bool, b map[uint32]bool) map[uint32]bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	ids := map[uint32]bool{}
+	for id := range a {
+		if b[id] {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+func analyzeGroupsCriteria(db *gorm.DB, filter string, boolean bool, booleanOperator string, index int, domain string, private bool) {
 
 	if boolean {
 
-		re := regexp.MustCompile(`\(\|(.*)\)|\(\&(.*)\)|\(\!(.*)\)|\(([a-zA-Z=\ \.*]*)\)*`)
+		re := regexp.MustCompile(`\(\|(.*)\)|\(\&(.*)\)|\(\!(.*)\)|\(([a-zA-Z0-9=\ \.*@+_,:'/\-]*)\)*`)
 		submatchall := re.FindAllString(filter, -1)
 
 		for index, element := range submatchall {
 			element = strings.TrimPrefix(element, "(")
 			element = strings.TrimSuffix(element, ")")
-			analyzeGroupsCriteria(db, element, false, booleanOperator, index, domain)
+			analyzeGroupsCriteria(db, element, false, booleanOperator, index, domain, private)
 		}
 
 	} else {
@@ -234,41 +297,59 @@ func analyzeGroupsCriteria(db *gorm.DB, filter string, boolean bool, booleanOper
 		case strings.HasPrefix(filter, "(") && strings.HasSuffix(filter, ")"):
 			element := strings.TrimPrefix(filter, "(")
 			element = strings.TrimSuffix(element, ")")
-			analyzeGroupsCriteria(db, element, false, "", 0, domain)
+			analyzeGroupsCriteria(db, element, false, "", 0, domain, private)
 		case strings.HasPrefix(filter, "&"):
 			element := strings.TrimPrefix(filter, "&")
-			analyzeGroupsCriteria(db, element, true, "and", 0, domain)
+			analyzeGroupsCriteria(db, element, true, "and", 0, domain, private)
 		case strings.HasPrefix(filter, "|"):
 			element := strings.TrimPrefix(filter, "|")
-			analyzeGroupsCriteria(db, element, true, "or", 0, domain)
+			analyzeGroupsCriteria(db, element, true, "or", 0, domain, private)
 		case strings.HasPrefix(filter, "!"):
 			element := strings.TrimPrefix(filter, "!")
-			analyzeGroupsCriteria(db, element, true, "not", 0, domain)
-		case strings.HasPrefix(filter, "entryDN=cn=") && strings.HasSuffix(filter, fmt.Sprintf(",ou=Groups,%s", domain)):
-			element := strings.TrimPrefix(filter, "entryDN=cn=")
-			element = strings.TrimSuffix(element, fmt.Sprintf(",ou=Groups,%s", domain))
+			analyzeGroupsCriteria(db, element, true, "not", 0, domain, private)
+		case strings.HasPrefix(filter, "entryDN="):
+			element, ok := childValue(strings.TrimPrefix(filter, "entryDN="), groupsDN(domain), "cn")
+			if !ok {
+				break
+			}
 			if index == 0 {
-				db.Where("name = ?", element)
+				db.Where("name_folded = ?", models.FoldIdentity(element))
 			} else {
-				db.Or("name = ?", element)
+				db.Or("name_folded = ?", models.FoldIdentity(element))
+			}
+		case strings.HasPrefix(filter, "gidNumber="):
+			numberCriteria(db, "gid_number", strings.TrimPrefix(filter, "gidNumber="), index)
+		case strings.HasPrefix(filter, "memberUid="):
+			element := strings.TrimPrefix(filter, "memberUid=")
+			members := db.Session(&gorm.Session{NewDB: true}).Table("group_members").
+				Select("group_members.group_id").
+				Joins("JOIN users ON users.id = group_members.user_id").
+				Where("users.username_folded = ?", models.FoldIdentity(element))
+			if index == 0 {
+				db.Where("id IN (?)", members)
+			} else {
+				db.Or("id IN (?)", members)
 			}
 		case strings.HasPrefix(filter, "cn="):
 			element := strings.TrimPrefix(filter, "cn=")
 			if strings.Contains(element, "*") {
 				element = strings.Replace(element, "*", "%", -1)
 				if index == 0 {
-					db.Where("name LIKE ?", element)
+					db.Where("name_folded LIKE ?", models.FoldIdentity(element))
 				} else {
-					db.Or("name LIKE ?", element)
+					db.Or("name_folded LIKE ?", models.FoldIdentity(element))
 				}
 			} else {
 				element = strings.Replace(element, "*", "%", -1)
 				if index == 0 {
-					db.Where("name = ?", element)
+					db.Where("name_folded = ?", models.FoldIdentity(element))
 				} else {
-					db.Or("name = ?", element)
+					db.Or("name_folded = ?", models.FoldIdentity(element))
 				}
 			}
+
+		default:
+			customCriteria(db, filter, models.AttributeForGroups, index, private)
 		}
 	}
 }
@@ -1,9 +1,20 @@
 package ldap
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -12,8 +23,10 @@ import (
 	"github.com/doncicuto/glim/models"
 	"github.com/doncicuto/glim/server/db"
 	"github.com/doncicuto/glim/types"
+	ber "github.com/go-asn1-ber/asn1-ber"
 	ldapClient "github.com/go-ldap/ldap"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
 	"gorm.io/gorm"
 )
 
@@ -48,7 +61,7 @@ func newTestDatabase(dbPath string) (*gorm.DB, error) {
 	var dbInit = types.DBInit{
 		AdminPasswd:   "test",
 		SearchPasswd:  "test",
-		Users:         "saul,kim,mike",
+		Users:         "search,saul,kim,mike",
 		DefaultPasswd: "test",
 		UseSqlite:     true,
 	}
@@ -58,6 +71,17 @@ func newTestDatabase(dbPath string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// The search bind account is a service account, tests use a readonly
+	// user with the same name to cover the read-only role
+	err = newDb.Model(&models.User{}).Where("username = ?", "search").Updates(map[string]interface{}{
+		"given_name": "Read-Only",
+		"surname":    "Account",
+		"readonly":   true,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
 	// Create group test
 	err = addGroup(newDb, "test", "Test", "saul,kim")
 	if err != nil {
@@ -170,3 +194,198 @@ func runSearchTests(t *testing.T, tc SearchTestCase) {
 		}
 	})
 }
+
+type testPKI struct {
+	caFile   string
+	certFile string
+	keyFile  string
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("could not write %s - %v", path, err)
+	}
+}
+
+// newTestPKI creates a CA and a server certificate for 127.0.0.1 in dir
+func newTestPKI(t *testing.T, dir string) *testPKI {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("could not create pki directory - %v", err)
+	}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Glim Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("could not create CA certificate - %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	pki := &testPKI{
+		caFile:   dir + "/ca.pem",
+		certFile: dir + "/server.pem",
+		keyFile:  dir + "/server.key",
+		ca:       ca,
+		caKey:    caKey,
+	}
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+
+	serverCert := pki.issue(t, x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	writePEM(t, pki.certFile, "CERTIFICATE", serverCert.Certificate[0])
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	writePEM(t, pki.keyFile, "PRIVATE KEY", keyDER)
+
+	return pki
+}
+
+// issue signs a certificate with our test CA
+func (pki *testPKI) issue(t *testing.T, template x509.Certificate) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if template.ExtKeyUsage == nil {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, pki.ca, &key.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatalf("could not create certificate - %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// dialTLS connects to our test server with an optional client certificate
+func (pki *testPKI) dialTLS(t *testing.T, addr string, cert *tls.Certificate) net.Conn {
+	pool := x509.NewCertPool()
+	pool.AddCert(pki.ca)
+	config := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	c, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		t.Fatalf("error connecting to %s: %v", addr, err)
+	}
+	return c
+}
+
+// saslBind sends a SASL bind request and returns the result code and the
+// diagnostic message from the bind response
+func saslBind(t *testing.T, c net.Conn, id int64, mechanism string, credentials *string) (int64, string) {
+	return sendRequest(t, c, saslBindPacket(id, mechanism, credentials))
+}
+
+// saslBindStep sends a step of a SASL bind and returns the result code and
+// the server SASL credentials from the bind response
+func saslBindStep(t *testing.T, c net.Conn, id int64, mechanism string, credentials string) (int64, string) {
+	if _, err := c.Write(saslBindPacket(id, mechanism, &credentials).Bytes()); err != nil {
+		t.Fatalf("could not send request - %v", err)
+	}
+	response, err := ber.ReadPacket(c)
+	if err != nil {
+		t.Fatalf("could not read response - %v", err)
+	}
+	op := response.Children[1]
+	code, _ := ber.ParseInt64(op.Children[0].Data.Bytes())
+	if len(op.Children) < 4 {
+		return code, ""
+	}
+	return code, ber.DecodeString(op.Children[3].Data.Bytes())
+}
+
+// scramClientFinal computes the SCRAM-SHA-256 client-final-message for a
+// server-first-message and the signature the server must answer with
+func scramClientFinal(t *testing.T, password string, clientFirstBare string, serverFirst string) (string, string) {
+	_, attributes, err := scramAttributes(serverFirst)
+	if err != nil {
+		t.Fatalf("wrong server-first message - %v", err)
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil {
+		t.Fatalf("wrong salt - %v", err)
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil {
+		t.Fatalf("wrong iterations - %v", err)
+	}
+
+	withoutProof := "c=biws,r=" + attributes["r"]
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := models.ScramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	clientSignature := models.ScramHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverSignature := models.ScramHMAC(models.ScramHMAC(saltedPassword, "Server Key"), authMessage)
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof),
+		"v=" + base64.StdEncoding.EncodeToString(serverSignature)
+}
+
+func saslBindPacket(id int64, mechanism string, credentials *string) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, BindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+	auth := ber.Encode(ber.ClassContext, ber.TypeConstructed, Sasl, nil, "SASL Credentials")
+	auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, mechanism, "Mechanism"))
+	if credentials != nil {
+		auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, *credentials, "Credentials"))
+	}
+	request.AppendChild(auth)
+	packet.AppendChild(request)
+	return packet
+}
+
+// whoami sends a whoami extended request and returns the authorization identity
+func whoami(t *testing.T, c net.Conn, id int64) string {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ExtendedRequest, nil, "Extended Request")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, WhoamIOID, "Request Name"))
+	packet.AppendChild(request)
+
+	if _, err := c.Write(packet.Bytes()); err != nil {
+		t.Fatalf("could not send request - %v", err)
+	}
+	response, err := ber.ReadPacket(c)
+	if err != nil {
+		t.Fatalf("could not read response - %v", err)
+	}
+	if len(response.Children) < 3 {
+		return ""
+	}
+	return ber.DecodeString(response.Children[len(response.Children)-1].Data.Bytes())
+}
+
+func sendRequest(t *testing.T, c net.Conn, packet *ber.Packet) (int64, string) {
+	if _, err := c.Write(packet.Bytes()); err != nil {
+		t.Fatalf("could not send request - %v", err)
+	}
+	response, err := ber.ReadPacket(c)
+	if err != nil {
+		t.Fatalf("could not read response - %v", err)
+	}
+	op := response.Children[1]
+	code, _ := ber.ParseInt64(op.Children[0].Data.Bytes())
+	return code, ber.DecodeString(op.Children[2].Data.Bytes())
+}
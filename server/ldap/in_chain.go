@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"github.com/doncicuto/glim/models"
+	"gorm.io/gorm"
+)
+
+// matchingRuleInChain is the LDAP_MATCHING_RULE_IN_CHAIN rule that matches
+// memberships through nested groups in extensible filters
+const matchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// inChainValues returns the DNs of the in-chain assertions for an attribute
+// e.g (memberOf:1.2.840.113556.1.4.1941:=cn=admins,ou=Groups,dc=example,dc=org)
+func inChainValues(filter string, attribute string) []string {
+	return filterValues(filter, attribute+":"+matchingRuleInChain+":")
+}
+
+// groupIDFromDN returns the id of the group with the given DN
+func groupIDFromDN(db *gorm.DB, domain string, dn string) (uint32, bool, error) {
+	name, ok := childValue(dn, groupsDN(domain), "cn")
+	if !ok {
+		return 0, false, nil
+	}
+
+	ids := []uint32{}
+	err := db.Session(&gorm.Session{NewDB: true}).Model(&models.Group{}).
+		Where("name_folded = ?", models.FoldIdentity(name)).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, false, err
+	}
+	return ids[0], true, nil
+}
+
+// userGroupIDs returns the ids of the groups a user with the given DN is a
+// direct member of
+func userGroupIDs(db *gorm.DB, domain string, dn string) ([]uint32, bool, error) {
+	username, ok := childValue(dn, usersDN(domain), "uid")
+	if !ok {
+		return nil, false, nil
+	}
+
+	ids := []uint32{}
+	err := db.Session(&gorm.Session{NewDB: true}).Table("group_members").
+		Joins("JOIN users ON users.id = group_members.user_id").
+		Where("users.username_folded = ?", models.FoldIdentity(username)).
+		Pluck("group_members.group_id", &ids).Error
+	return ids, err == nil, err
+}
+
+// groupsInChain returns the ids of the groups nested at any depth in the
+// groups with the given DNs. If includeSelf is true the groups themselves
+// are included. A nil map is returned if there are no DNs
+func groupsInChain(db *gorm.DB, domain string, dns []string, includeSelf bool) (map[uint32]bool, error) {
+	if len(dns) == 0 {
+		return nil, nil
+	}
+
+	groups := map[uint32]bool{}
+	for _, dn := range dns {
+		id, ok, err := groupIDFromDN(db, domain, dn)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		nested, err := models.NestedGroupIDs(db, []uint32{id})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nested {
+			if includeSelf || n != id {
+				groups[n] = true
+			}
+		}
+	}
+	return groups, nil
+}
+
+// groupsWithMemberInChain returns the ids of the groups that have the users
+// or groups with the given DNs as members, directly or through nested
+// groups. A nil map is returned if there are no DNs
+func groupsWithMemberInChain(db *gorm.DB, domain string, dns []string) (map[uint32]bool, error) {
+	if len(dns) == 0 {
+		return nil, nil
+	}
+
+	groups := map[uint32]bool{}
+	for _, dn := range dns {
+		direct, ok, err := userGroupIDs(db, domain, dn)
+		if err != nil {
+			return nil, err
+		}
+
+		exclude := uint32(0)
+		if !ok {
+			id, ok, err := groupIDFromDN(db, domain, dn)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			// A group is not a member of itself
+			direct, exclude = []uint32{id}, id
+		}
+
+		parents, err := models.ParentGroupIDs(db, direct)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range parents {
+			if id != exclude {
+				groups[id] = true
+			}
+		}
+	}
+	return groups, nil
+}
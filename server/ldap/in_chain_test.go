@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInChainMatchingRule(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60016")
+	defer testCleanUp(dbPath.String())
+
+	// Group staff has mike and test2 as members and is nested in group all
+	nest := func(parent string, member string) {
+		p, m := models.Group{}, models.Group{}
+		if err := settings.DB.Where("name = ?", parent).Take(&p).Error; err != nil {
+			t.Fatalf("could not find group %s - %v", parent, err)
+		}
+		if err := settings.DB.Where("name = ?", member).Take(&m).Error; err != nil {
+			t.Fatalf("could not find group %s - %v", member, err)
+		}
+		if err := settings.DB.Model(&p).Association("MemberGroups").Append(&m); err != nil {
+			t.Fatalf("could not nest group %s in %s - %v", member, parent, err)
+		}
+	}
+	if err := addGroup(settings.DB, "staff", "Staff", "mike"); err != nil {
+		t.Fatalf("could not create group staff - %v", err)
+	}
+	if err := addGroup(settings.DB, "all", "All", ""); err != nil {
+		t.Fatalf("could not create group all - %v", err)
+	}
+	nest("staff", "test2")
+	nest("all", "staff")
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60016")
+
+	c, err := net.Dial("tcp", "127.0.0.1:60016")
+	if err != nil {
+		t.Fatalf("error connecting to localhost tcp: %v", err)
+	}
+	conn := ldapClient.NewConn(c, false)
+	conn.SetTimeout(3000 * time.Millisecond)
+	conn.Start()
+	defer conn.Close()
+	if err := conn.Bind("cn=search,dc=example,dc=org", "test"); err != nil {
+		t.Fatalf("could not bind - %v", err)
+	}
+
+	search := func(t *testing.T, baseDN string, filter string, attribute string) []string {
+		searchRequest := ldapClient.NewSearchRequest(baseDN, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, []string{attribute}, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		values := []string{}
+		for _, entry := range sr.Entries {
+			values = append(values, entry.GetAttributeValue(attribute))
+		}
+		return values
+	}
+
+	t.Run("users in group all through nested groups", func(t *testing.T) {
+		users := search(t, "ou=Users,dc=example,dc=org", "(memberOf:1.2.840.113556.1.4.1941:=cn=all,ou=Groups,dc=example,dc=org)", "uid")
+		assert.Equal(t, []string{"kim", "mike"}, users)
+	})
+
+	t.Run("saul is not effectively in group all", func(t *testing.T) {
+		users := search(t, "ou=Users,dc=example,dc=org", "(&(uid=saul)(memberOf:1.2.840.113556.1.4.1941:=cn=all,ou=Groups,dc=example,dc=org))", "uid")
+		assert.Empty(t, users)
+	})
+
+	t.Run("kim is effectively in group all", func(t *testing.T) {
+		users := search(t, "ou=Users,dc=example,dc=org", "(&(uid=kim)(memberOf:1.2.840.113556.1.4.1941:=cn=all,ou=Groups,dc=example,dc=org))", "uid")
+		assert.Equal(t, []string{"kim"}, users)
+	})
+
+	t.Run("direct memberOf doesn't follow nested groups", func(t *testing.T) {
+		users := search(t, "ou=Users,dc=example,dc=org", "(memberOf=cn=all,ou=Groups,dc=example,dc=org)", "uid")
+		assert.Empty(t, users)
+	})
+
+	t.Run("groups of kim through nested groups", func(t *testing.T) {
+		groups := search(t, "ou=Groups,dc=example,dc=org", "(member:1.2.840.113556.1.4.1941:=uid=kim,ou=Users,dc=example,dc=org)", "cn")
+		assert.Equal(t, []string{"test", "test2", "staff", "all"}, groups)
+	})
+
+	t.Run("groups containing test2", func(t *testing.T) {
+		groups := search(t, "ou=Groups,dc=example,dc=org", "(member:1.2.840.113556.1.4.1941:=cn=test2,ou=Groups,dc=example,dc=org)", "cn")
+		assert.Equal(t, []string{"staff", "all"}, groups)
+	})
+
+	t.Run("groups nested in all", func(t *testing.T) {
+		groups := search(t, "ou=Groups,dc=example,dc=org", "(memberOf:1.2.840.113556.1.4.1941:=cn=all,ou=Groups,dc=example,dc=org)", "cn")
+		assert.Equal(t, []string{"test2", "staff"}, groups)
+	})
+
+	t.Run("nested groups are members", func(t *testing.T) {
+		searchRequest := ldapClient.NewSearchRequest("cn=staff,ou=Groups,dc=example,dc=org", ldapClient.ScopeBaseObject, ldapClient.DerefAlways, 0, 0, false, "(objectClass=*)", []string{"member"}, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) || !assert.Len(t, sr.Entries, 1) {
+			return
+		}
+		assert.Equal(t, []string{"uid=mike,ou=Users,dc=example,dc=org", "cn=test2,ou=Groups,dc=example,dc=org"}, sr.Entries[0].GetAttributeValues("member"))
+	})
+}
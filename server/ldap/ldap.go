@@ -32,6 +32,9 @@ type Message struct {
 	PagedResultsSize        int64
 	PagedResultsCookie      string
 	PagedResultsCriticality bool
+	ProxiedAuthz            bool
+	ProxiedAuthzID          string
+	ProxiedAuthzCriticality bool
 }
 
 func messageID(p *ber.Packet) (int64, error) {
@@ -109,7 +112,7 @@ func control(p *ber.Packet, message *Message) error {
 	controlType := p.Children[0].Value.(string)
 
 	//https://www.ietf.org/rfc/rfc2696.txt
-	if controlType == "1.2.840.113556.1.4.319" {
+	if controlType == PagedResultsOID {
 		message.Paging = true
 		npIndex := 1
 		pagedResults := ""
@@ -131,6 +134,21 @@ func control(p *ber.Packet, message *Message) error {
 		return nil
 	}
 
+	//https://www.rfc-editor.org/rfc/rfc4370
+	if controlType == ProxiedAuthzOID {
+		message.ProxiedAuthz = true
+		valueIndex := 1
+		if p.Children[1].Tag == ber.TagBoolean {
+			message.ProxiedAuthzCriticality, _ = p.Children[1].Value.(bool)
+			valueIndex = 2
+		}
+		if len(p.Children) > valueIndex {
+			message.ProxiedAuthzID = p.Children[valueIndex].Data.String()
+		}
+		printLog(fmt.Sprintf("proxied authorization control found: %s", message.ProxiedAuthzID))
+		return nil
+	}
+
 	return nil
 }
 
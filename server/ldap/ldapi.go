@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/doncicuto/glim/server/peercred"
+	"github.com/doncicuto/glim/types"
+)
+
+// DefaultLDAPISocketMode - permissions of our ldapi socket
+const DefaultLDAPISocketMode = 0660
+
+const ldapiPrefix = "ldapi:"
+
+// ldapiAddress identifies a local client in our logs
+func ldapiAddress(peer peercred.Credentials) string {
+	return ldapiPrefix + peer.String()
+}
+
+// isLDAPI checks if a client is connected to our ldapi socket
+func isLDAPI(remoteAddr string) bool {
+	return strings.HasPrefix(remoteAddr, ldapiPrefix)
+}
+
+// listenLDAPI creates our Unix domain socket, removing a socket left by a
+// previous run
+func listenLDAPI(settings types.LDAPSettings) (net.Listener, error) {
+	if info, err := os.Lstat(settings.LDAPISocket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and it's not a socket", settings.LDAPISocket)
+		}
+		if err := os.Remove(settings.LDAPISocket); err != nil {
+			return nil, fmt.Errorf("could not remove old socket %s", settings.LDAPISocket)
+		}
+	}
+
+	l, err := net.Listen("unix", settings.LDAPISocket)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen in socket %s: %v", settings.LDAPISocket, err)
+	}
+
+	mode := settings.LDAPISocketMode
+	if mode == 0 {
+		mode = DefaultLDAPISocketMode
+	}
+	if err := os.Chmod(settings.LDAPISocket, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("could not set permissions of socket %s", settings.LDAPISocket)
+	}
+	return l, nil
+}
+
+// serveLDAPI handles connections to our ldapi socket until it's closed.
+// Network policies don't apply to local clients
+func serveLDAPI(l net.Listener, settings types.LDAPSettings) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				printLog(fmt.Sprintf("an error occurred accepting ldapi connections: %v", err))
+			}
+			return
+		}
+		go handleConnection(c, settings)
+	}
+}
@@ -0,0 +1,118 @@
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLDAPI(t *testing.T) {
+	dbPath := uuid.New()
+	db, err := newTestDatabase(dbPath.String())
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+	defer testCleanUp(dbPath.String())
+
+	// Our test process is mapped to saul
+	socket := fmt.Sprintf("/tmp/%s.sock", dbPath.String())
+	settings := testSettings(db, "127.0.0.1:60010")
+	settings.LDAPISocket = socket
+	if err := settings.PeerCredMapping.Add(fmt.Sprintf("%d=saul", os.Getuid())); err != nil {
+		t.Fatalf("could not parse ldapi mapping - %v", err)
+	}
+
+	// Network policies don't apply to local clients
+	if err := settings.NetworkPolicies.Add("user:allow:10.0.0.0/24"); err != nil {
+		t.Fatalf("could not parse network rule - %v", err)
+	}
+
+	l, err := listenLDAPI(settings)
+	if err != nil {
+		t.Fatalf("could not initialize socket - %v", err)
+	}
+	defer l.Close()
+	go serveLDAPI(l, settings)
+
+	dial := func() net.Conn {
+		c, err := net.Dial("unix", socket)
+		if err != nil {
+			t.Fatalf("error connecting to %s: %v", socket, err)
+		}
+		return c
+	}
+
+	t.Run("ldapi socket permissions", func(t *testing.T) {
+		info, err := os.Stat(socket)
+		if err != nil {
+			t.Fatalf("could not stat socket - %v", err)
+		}
+		assert.Equal(t, os.FileMode(DefaultLDAPISocketMode), info.Mode().Perm())
+	})
+
+	t.Run("SASL EXTERNAL with mapped peer credentials", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		code, _ := saslBind(t, c, 1, "EXTERNAL", nil)
+		assert.Equal(t, int64(Success), code)
+		assert.Equal(t, "dn:uid=saul,ou=Users,dc=example,dc=org", whoami(t, c, 2))
+	})
+
+	t.Run("SASL EXTERNAL with another authorization identity", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		authzID := "u:kim"
+		code, msg := saslBind(t, c, 1, "EXTERNAL", &authzID)
+		assert.Equal(t, int64(InvalidCredentials), code)
+		assert.Equal(t, "authorization identity does not match the peer credentials", msg)
+	})
+
+	t.Run("Simple bind over ldapi", func(t *testing.T) {
+		conn := ldapClient.NewConn(dial(), false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		defer conn.Close()
+		assert.NoError(t, conn.Bind("uid=kim,ou=Users,dc=example,dc=org", "test"))
+	})
+
+	t.Run("SASL EXTERNAL with peer credentials not mapped", func(t *testing.T) {
+		other := testSettings(db, "127.0.0.1:60010")
+		other.LDAPISocket = fmt.Sprintf("/tmp/%s-other.sock", dbPath.String())
+		if err := other.PeerCredMapping.Add(fmt.Sprintf("%d=saul", os.Getuid()+1)); err != nil {
+			t.Fatalf("could not parse ldapi mapping - %v", err)
+		}
+		ol, err := listenLDAPI(other)
+		if err != nil {
+			t.Fatalf("could not initialize socket - %v", err)
+		}
+		defer ol.Close()
+		go serveLDAPI(ol, other)
+
+		c, err := net.Dial("unix", other.LDAPISocket)
+		if err != nil {
+			t.Fatalf("error connecting to %s: %v", other.LDAPISocket, err)
+		}
+		defer c.Close()
+		code, _ := saslBind(t, c, 1, "EXTERNAL", nil)
+		assert.Equal(t, int64(InvalidCredentials), code)
+	})
+
+	t.Run("ldapi socket path used by a file", func(t *testing.T) {
+		file := fmt.Sprintf("/tmp/%s-file.sock", dbPath.String())
+		if err := os.WriteFile(file, []byte{}, 0600); err != nil {
+			t.Fatalf("could not create file - %v", err)
+		}
+		defer os.Remove(file)
+
+		other := testSettings(db, "127.0.0.1:60010")
+		other.LDAPISocket = file
+		_, err := listenLDAPI(other)
+		assert.EqualError(t, err, fmt.Sprintf("%s exists and it's not a socket", file))
+	})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/totp"
+	"github.com/doncicuto/glim/types"
+)
+
+// OTP policies for LDAP simple binds
+const (
+	// OTPPolicyRequired - users must append a TOTP code to their password
+	OTPPolicyRequired = "required"
+	// OTPPolicyOptional - users with TOTP enrolled may append a code to their password
+	OTPPolicyOptional = "optional"
+	// OTPPolicyDisabled - passwords are never split, useful if passwords contain the separator
+	OTPPolicyDisabled = "disabled"
+)
+
+// DefaultOTPSeparator separates the password from the TOTP code e.g password+123456
+const DefaultOTPSeparator = "+"
+
+var errWrongCredentials = errors.New("wrong username or password")
+
+// ValidOTPPolicy checks if we know the OTP policy
+func ValidOTPPolicy(policy string) bool {
+	return policy == OTPPolicyRequired || policy == OTPPolicyOptional || policy == OTPPolicyDisabled
+}
+
+// ParseApplication parses an LDAP application definition using the
+// name:policy:cidr[,cidr...] format e.g vpn:required:10.0.0.0/8,192.168.1.10/32
+func ParseApplication(definition string) (types.LDAPApplication, error) {
+	app := types.LDAPApplication{}
+
+	parts := strings.SplitN(definition, ":", 3)
+	if len(parts) != 3 {
+		return app, fmt.Errorf("wrong application definition %s, expected name:policy:cidr[,cidr...]", definition)
+	}
+
+	app.Name = strings.TrimSpace(parts[0])
+	if app.Name == "" {
+		return app, fmt.Errorf("wrong application definition %s, name is required", definition)
+	}
+
+	app.OTPPolicy = strings.TrimSpace(parts[1])
+	if !ValidOTPPolicy(app.OTPPolicy) {
+		return app, fmt.Errorf("wrong OTP policy %s for application %s", app.OTPPolicy, app.Name)
+	}
+
+	for _, cidr := range strings.Split(parts[2], ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return app, fmt.Errorf("wrong network %s for application %s", cidr, app.Name)
+		}
+		app.Networks = append(app.Networks, network)
+	}
+
+	return app, nil
+}
+
+// clientApplication returns the first application whose networks contain
+// the client address or nil if the client doesn't belong to any application
+func clientApplication(settings types.LDAPSettings, remoteAddr string) *types.LDAPApplication {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	for i, app := range settings.Applications {
+		for _, network := range app.Networks {
+			if network.Contains(ip) {
+				return &settings.Applications[i]
+			}
+		}
+	}
+	return nil
+}
+
+// otpPolicy returns the OTP policy that applies to a bind request
+// coming from remoteAddr for a given user
+func otpPolicy(settings types.LDAPSettings, u *models.User, remoteAddr string) string {
+	policy := settings.OTPPolicy
+	if app := clientApplication(settings, remoteAddr); app != nil {
+		policy = app.OTPPolicy
+	}
+	if !ValidOTPPolicy(policy) {
+		policy = OTPPolicyOptional
+	}
+
+	// Users may require an OTP code for their own binds unless the
+	// application can't send it
+	if policy == OTPPolicyOptional && u.LDAPRequireOTP != nil && *u.LDAPRequireOTP {
+		policy = OTPPolicyRequired
+	}
+	return policy
+}
+
+// verifyBindPassword checks a simple bind password which may carry a TOTP
+// code appended after the OTP separator
+func verifyBindPassword(settings types.LDAPSettings, u *models.User, pass string, remoteAddr string) (string, error) {
+	policy := otpPolicy(settings, u, remoteAddr)
+
+	if policy == OTPPolicyDisabled || !totp.Enabled(u) {
+		// Users requiring an OTP code can't bind until they enroll
+		if policy == OTPPolicyRequired {
+			return "", fmt.Errorf("OTP code required but user has not enrolled TOTP")
+		}
+		if err := models.VerifyPassword(*u.Password, pass); err != nil {
+			return "", errWrongCredentials
+		}
+		return pass, nil
+	}
+
+	separator := settings.OTPSeparator
+	if separator == "" {
+		separator = DefaultOTPSeparator
+	}
+
+	// password+123456
+	if i := strings.LastIndex(pass, separator); i >= 0 {
+		password, code := pass[:i], pass[i+len(separator):]
+		if len(code) == totp.Digits && models.VerifyPassword(*u.Password, password) == nil {
+			if err := totp.VerifyCode(settings.KV, settings.TOTPSecretKey, u, code); err != nil {
+				return "", fmt.Errorf("wrong OTP code")
+			}
+			return password, nil
+		}
+	}
+
+	if policy == OTPPolicyRequired {
+		return "", fmt.Errorf("OTP code required")
+	}
+
+	if err := models.VerifyPassword(*u.Password, pass); err != nil {
+		return "", errWrongCredentials
+	}
+	return pass, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// searchAccess tells which entries a search may return. A nil access
+// allows every entry, that's the case of searches without proxied
+// authorization. Entries can be allowed one by one or with every entry
+// held by an organizational unit in subtrees
+type searchAccess struct {
+	dns      map[string]bool
+	subtrees map[string]bool
+}
+
+// allows checks if an entry can be returned
+func (a *searchAccess) allows(dn string) bool {
+	if a == nil || a.dns[normalizeDN(dn)] {
+		return true
+	}
+	parsed, err := ParseDN(dn)
+	return err == nil && len(parsed) > 0 && a.subtrees[parsed.Parent().Normalize()]
+}
+
+// visible removes the entries that can't be returned from search results
+func (a *searchAccess) visible(packets []*ber.Packet) []*ber.Packet {
+	if a == nil {
+		return packets
+	}
+
+	r := []*ber.Packet{}
+	for _, p := range packets {
+		if len(p.Children) > 1 && p.Children[1].Tag == SearchResultEntry && len(p.Children[1].Children) > 0 {
+			if !a.allows(p.Children[1].Children[0].Data.String()) {
+				continue
+			}
+		}
+		r = append(r, p)
+	}
+	return r
+}
+
+// dnUsername returns the username in a user's DN, uid=username,ou=Users
+// or cn=username followed by our domain
+func dnUsername(settings types.LDAPSettings, dn string) (string, bool) {
+	if username, ok := childValue(dn, usersDN(settings.Domain), "uid"); ok {
+		return username, true
+	}
+	return childValue(dn, settings.Domain, "cn")
+}
+
+// authzIDUsername returns the username of an authorization identity,
+// dn:<dn> or u:<username> as defined in RFC 4513 section 5.2.1.8
+func authzIDUsername(settings types.LDAPSettings, authzID string) (string, bool) {
+	if dn, ok := strings.CutPrefix(authzID, "dn:"); ok {
+		return dnUsername(settings, dn)
+	}
+	if username, ok := strings.CutPrefix(authzID, "u:"); ok && username != "" {
+		return username, true
+	}
+	return "", false
+}
+
+// userSearchAccess returns what a user can read, mirroring the REST API
+// roles: managers and readonly accounts read every entry while plain users
+// read their own entry and the groups they are members of
+func userSearchAccess(settings types.LDAPSettings, u *models.User) *searchAccess {
+	if (u.Manager != nil && *u.Manager) || (u.Readonly != nil && *u.Readonly) {
+		return nil
+	}
+
+	access := searchAccess{dns: map[string]bool{
+		normalizeDN(settings.Domain):                      true,
+		normalizeDN(usersDN(settings.Domain)):             true,
+		normalizeDN(groupsDN(settings.Domain)):            true,
+		normalizeDN(userDN(settings.Domain, *u.Username)): true,
+	}}
+	for _, group := range u.MemberOf {
+		access.dns[normalizeDN(groupDN(settings.Domain, *group.Name))] = true
+	}
+	return &access
+}
+
+// proxyAuthzAccount returns the DN of the bound account if it's a user or
+// a service account with the proxy authorization right that is not locked
+func proxyAuthzAccount(settings types.LDAPSettings, boundDN string) (string, bool) {
+	if name, ok := childValue(boundDN, servicesDN(settings.Domain), "cn"); ok {
+		s, err := findServiceAccount(settings, name)
+		if err != nil || s.ProxyAuthz == nil || !*s.ProxyAuthz || (s.Locked != nil && *s.Locked) {
+			return "", false
+		}
+		return serviceAccountDN(settings.Domain, *s.Name), true
+	}
+
+	var proxy models.User
+	username, ok := dnUsername(settings, boundDN)
+	if !ok || settings.DB.Where("username_folded = ?", models.FoldIdentity(username)).Take(&proxy).Error != nil ||
+		proxy.ProxyAuthz == nil || !*proxy.ProxyAuthz ||
+		(proxy.Locked != nil && *proxy.Locked) {
+		return "", false
+	}
+	return userDN(settings.Domain, *proxy.Username), true
+}
+
+// proxiedAuthorization checks the proxied authorization control (RFC 4370)
+// of a request. Only accounts with the proxy authorization right can use it
+// and the request is evaluated with the access of the proxied user
+func proxiedAuthorization(settings types.LDAPSettings, boundDN string, message *Message) (*searchAccess, *ServerError) {
+	if !message.ProxiedAuthz {
+		return nil, nil
+	}
+
+	if !message.ProxiedAuthzCriticality {
+		return nil, &ServerError{
+			Msg:  "proxied authorization control must be critical",
+			Code: ProtocolError,
+		}
+	}
+
+	// The bound account must have the proxy authorization right
+	proxyDN, ok := proxyAuthzAccount(settings, boundDN)
+	if !ok {
+		return nil, &ServerError{
+			Msg:  "proxied authorization not allowed",
+			Code: AuthorizationDenied,
+		}
+	}
+
+	// Anonymous access is not available so the proxied identity must be a user
+	proxiedUsername, ok := authzIDUsername(settings, message.ProxiedAuthzID)
+	if !ok {
+		return nil, &ServerError{
+			Msg:  "wrong proxied authorization identity",
+			Code: AuthorizationDenied,
+		}
+	}
+
+	var proxied models.User
+	if settings.DB.Preload("MemberOf").Where("username_folded = ?", models.FoldIdentity(proxiedUsername)).Take(&proxied).Error != nil ||
+		(proxied.Locked != nil && *proxied.Locked) {
+		return nil, &ServerError{
+			Msg:  "proxied authorization identity is not valid",
+			Code: AuthorizationDenied,
+		}
+	}
+
+	printLog(fmt.Sprintf("proxied authorization: %s acting as %s", proxyDN, userDN(settings.Domain, *proxied.Username)))
+	return userSearchAccess(settings, &proxied), nil
+}
+
+// proxiedAuthorizationNotSupported rejects the proxied authorization
+// control in operations it doesn't apply to e.g binds
+func proxiedAuthorizationNotSupported(message *Message) *ServerError {
+	if message.ProxiedAuthz && message.ProxiedAuthzCriticality {
+		return &ServerError{
+			Msg:  "proxied authorization control not supported for this operation",
+			Code: UnavailableCriticalExtension,
+		}
+	}
+	return nil
+}
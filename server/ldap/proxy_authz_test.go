@@ -0,0 +1,175 @@
+package ldap
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxiedAuthorization(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60011")
+	defer testCleanUp(dbPath.String())
+
+	// saul is the service account of our web portal
+	if err := settings.DB.Model(&models.User{}).Where("username = ?", "saul").Update("proxy_authz", true).Error; err != nil {
+		t.Fatalf("could not grant proxy authorization right - %v", err)
+	}
+
+	// Service accounts can hold the proxy authorization right too
+	newServiceAccount := func(name string, s models.ServiceAccount) {
+		hash, err := models.Hash(name + "-secret")
+		if err != nil {
+			t.Fatalf("could not hash password - %v", err)
+		}
+		hashed := string(hash)
+		s.Name = &name
+		s.Password = &hashed
+		if err := settings.DB.Create(&s).Error; err != nil {
+			t.Fatalf("could not create service account %s - %v", name, err)
+		}
+	}
+	trueValue := true
+	newServiceAccount("portal", models.ServiceAccount{ProxyAuthz: &trueValue})
+	newServiceAccount("wiki", models.ServiceAccount{})
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60011")
+
+	connect := func(username string, password string) *ldapClient.Conn {
+		c, err := net.Dial("tcp", "127.0.0.1:60011")
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		conn := ldapClient.NewConn(c, false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		conn.Bind(username, password)
+		return conn
+	}
+
+	search := func(conn *ldapClient.Conn, base string, filter string, control ldapClient.Control) ([]string, error) {
+		controls := []ldapClient.Control{}
+		if control != nil {
+			controls = append(controls, control)
+		}
+		searchRequest := ldapClient.NewSearchRequest(base, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, []string{}, controls)
+		sr, err := conn.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+		dns := []string{}
+		for _, entry := range sr.Entries {
+			dns = append(dns, entry.DN)
+		}
+		sort.Strings(dns)
+		return dns, nil
+	}
+
+	proxiedAs := func(authzID string) ldapClient.Control {
+		return ldapClient.NewControlString(ProxiedAuthzOID, true, authzID)
+	}
+
+	portal := connect("uid=saul,ou=Users,dc=example,dc=org", "test")
+	defer portal.Close()
+
+	t.Run("search without proxied authorization", func(t *testing.T) {
+		dns, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"uid=admin,ou=Users,dc=example,dc=org", "uid=kim,ou=Users,dc=example,dc=org", "uid=mike,ou=Users,dc=example,dc=org", "uid=saul,ou=Users,dc=example,dc=org", "uid=search,ou=Users,dc=example,dc=org"}, dns)
+	})
+
+	t.Run("plain user can only read its own entry", func(t *testing.T) {
+		dns, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:kim"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"uid=kim,ou=Users,dc=example,dc=org"}, dns)
+	})
+
+	t.Run("plain user can read its groups", func(t *testing.T) {
+		dns, err := search(portal, "ou=Groups,dc=example,dc=org", "(cn=*)", proxiedAs("dn:uid=kim,ou=Users,dc=example,dc=org"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cn=test,ou=Groups,dc=example,dc=org", "cn=test2,ou=Groups,dc=example,dc=org"}, dns)
+
+		dns, err = search(portal, "ou=Groups,dc=example,dc=org", "(cn=*)", proxiedAs("u:mike"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, dns)
+	})
+
+	t.Run("manager can read every entry", func(t *testing.T) {
+		dns, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("dn:cn=admin,dc=example,dc=org"))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(dns))
+	})
+
+	t.Run("proxied user must exist", func(t *testing.T) {
+		_, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:walter"))
+		assert.True(t, ldapClient.IsErrorWithCode(err, AuthorizationDenied))
+	})
+
+	t.Run("anonymous proxied identity is not allowed", func(t *testing.T) {
+		_, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs(""))
+		assert.True(t, ldapClient.IsErrorWithCode(err, AuthorizationDenied))
+	})
+
+	t.Run("control must be critical", func(t *testing.T) {
+		_, err := search(portal, "ou=Users,dc=example,dc=org", "(uid=*)", ldapClient.NewControlString(ProxiedAuthzOID, false, "u:kim"))
+		assert.True(t, ldapClient.IsErrorWithCode(err, ProtocolError))
+	})
+
+	t.Run("accounts without proxy authorization right", func(t *testing.T) {
+		conn := connect("uid=kim,ou=Users,dc=example,dc=org", "test")
+		defer conn.Close()
+		_, err := search(conn, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:mike"))
+		assert.True(t, ldapClient.IsErrorWithCode(err, AuthorizationDenied))
+	})
+
+	t.Run("failed bind can't use proxy authorization right", func(t *testing.T) {
+		conn := connect("uid=saul,ou=Users,dc=example,dc=org", "wrong")
+		defer conn.Close()
+		_, err := search(conn, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:kim"))
+		assert.True(t, ldapClient.IsErrorWithCode(err, AuthorizationDenied))
+	})
+
+	t.Run("service account with proxy authorization right", func(t *testing.T) {
+		conn := connect("cn=portal,ou=Services,dc=example,dc=org", "portal-secret")
+		defer conn.Close()
+		dns, err := search(conn, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:kim"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"uid=kim,ou=Users,dc=example,dc=org"}, dns)
+	})
+
+	t.Run("service account without proxy authorization right", func(t *testing.T) {
+		conn := connect("cn=wiki,ou=Services,dc=example,dc=org", "wiki-secret")
+		defer conn.Close()
+		_, err := search(conn, "ou=Users,dc=example,dc=org", "(uid=*)", proxiedAs("u:kim"))
+		assert.True(t, ldapClient.IsErrorWithCode(err, AuthorizationDenied))
+	})
+
+	t.Run("control not supported in binds", func(t *testing.T) {
+		_, err := portal.SimpleBind(&ldapClient.SimpleBindRequest{
+			Username: "uid=saul,ou=Users,dc=example,dc=org",
+			Password: "test",
+			Controls: []ldapClient.Control{proxiedAs("u:kim")},
+		})
+		assert.True(t, ldapClient.IsErrorWithCode(err, UnavailableCriticalExtension))
+	})
+}
@@ -79,14 +79,6 @@ func decodeBase64(base64 string) ([]byte, error) {
 	return decoded, nil
 }
 
-func encodeOctetBinaryString(value []byte, description string) *ber.Packet {
-	binaryString := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, description)
-	binaryString.Value = value
-	binaryString.Data.Write(value)
-	binaryString.ByteValue = value
-	return binaryString
-}
-
 func encodeExtendedResponse(messageID int64, resultCode int64, name string, value string) *ber.Packet {
 	// LDAP Message envelope
 	r := responseHeader(messageID)
@@ -131,6 +123,24 @@ func encodeBindResponse(messageID int64, resultCode int64, msg string) *ber.Pack
 	return r
 }
 
+// encodeSASLBindResponse - bind response carrying SASL server credentials
+func encodeSASLBindResponse(messageID int64, resultCode int64, msg string, serverCreds string) *ber.Packet {
+	// LDAP Message envelope
+	r := responseHeader(messageID)
+
+	// Response packet
+	bp := encodeResponseType(BindResponse)
+	bp.AppendChild(encodeResultCode(resultCode))
+	bp.AppendChild(encodeOctetString("", "MatchedDN"))
+	bp.AppendChild(encodeOctetString(msg, "DiagnosticMessage"))
+	if serverCreds != "" {
+		// serverSaslCreds    [7] OCTET STRING OPTIONAL
+		bp.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, serverCreds, "serverSaslCreds"))
+	}
+	r.AppendChild(bp)
+	return r
+}
+
 func encodeSearchResultEntry(messageID int64, values map[string][]string, objectName string) *ber.Packet {
 	// LDAP Message envelope
 	r := responseHeader(messageID)
@@ -142,14 +152,7 @@ func encodeSearchResultEntry(messageID int64, values map[string][]string, object
 		al.AppendChild(encodeOctetString(k, "PartialAttributeType"))
 		vs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "PartialAttributeValues")
 		for _, value := range v {
-			if k == "jpegPhoto" || k == "jpegphoto" {
-				jpeg, err := decodeBase64(value)
-				if err == nil {
-					vs.AppendChild(encodeOctetBinaryString(jpeg, "PartialAttributeValue"))
-				}
-			} else {
-				vs.AppendChild(encodeOctetString(value, "PartialAttributeValue"))
-			}
+			vs.AppendChild(encodeOctetString(value, "PartialAttributeValue"))
 		}
 		al.AppendChild(vs)
 		a.AppendChild(al)
@@ -0,0 +1,248 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/doncicuto/glim/server/peercred"
+	"github.com/doncicuto/glim/types"
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// SASL mechanisms supported by Glim
+const (
+	// SASLExternal - authentication with TLS client certificates or ldapi
+	// peer credentials (RFC 4422)
+	SASLExternal = "EXTERNAL"
+	// SASLPlain - username and password authentication (RFC 4616)
+	SASLPlain = "PLAIN"
+	// SASLScramSHA256 - challenge-response authentication (RFC 7677)
+	SASLScramSHA256 = "SCRAM-SHA-256"
+)
+
+// saslCredentials are the SaslCredentials sent in a bind request as
+// defined in RFC 4511 section 4.2
+type saslCredentials struct {
+	Mechanism   string
+	Credentials string
+}
+
+// externalIdentity is the identity established outside LDAP that SASL
+// EXTERNAL binds use: a verified TLS client certificate or the peer
+// credentials of a process connected to our ldapi socket
+type externalIdentity struct {
+	cert *x509.Certificate
+	peer *peercred.Credentials
+}
+
+// saslBindState keeps the SASL bind in progress on a connection. Multi-step
+// mechanisms answer with saslBindInProgress until the exchange completes
+type saslBindState struct {
+	mechanism string
+	scram     *scramExchange
+}
+
+// reset aborts the SASL bind in progress, if any
+func (s *saslBindState) reset() {
+	if s != nil {
+		*s = saslBindState{}
+	}
+}
+
+func isSASLBind(p *ber.Packet) bool {
+	return p.ClassType == ber.ClassContext && p.Tag == Sasl && p.TagType == ber.TypeConstructed
+}
+
+func bindSASLCredentials(p *ber.Packet) (*saslCredentials, *ServerError) {
+	if len(p.Children) < 1 || len(p.Children) > 2 {
+		return nil, &ServerError{
+			Msg:  "wrong SASL credentials definition",
+			Code: ProtocolError,
+		}
+	}
+
+	for _, child := range p.Children {
+		if child.ClassType != ber.ClassUniversal ||
+			child.TagType != ber.TypePrimitive ||
+			child.Tag != ber.TagOctetString {
+			return nil, &ServerError{
+				Msg:  "wrong SASL credentials definition",
+				Code: ProtocolError,
+			}
+		}
+	}
+
+	creds := saslCredentials{Mechanism: ber.DecodeString(p.Children[0].ByteValue)}
+	if len(p.Children) == 2 {
+		creds.Credentials = ber.DecodeString(p.Children[1].ByteValue)
+	}
+	return &creds, nil
+}
+
+// saslMechanisms returns the SASL mechanisms available with our settings
+func saslMechanisms(settings types.LDAPSettings) []string {
+	mechanisms := []string{}
+	certificates := settings.ClientCertMapping != nil && settings.ClientCertMode != "" && settings.ClientCertMode != clientcert.ModeNone
+	ldapi := settings.LDAPISocket != "" && !settings.PeerCredMapping.Empty()
+	if certificates || ldapi {
+		mechanisms = append(mechanisms, SASLExternal)
+	}
+	return append(mechanisms, SASLPlain, SASLScramSHA256)
+}
+
+// rootDSE returns the root DSE entry (RFC 4512 section 5.1) so clients can
+// discover our naming context and supported features
+func rootDSE(id int64, settings types.LDAPSettings) []*ber.Packet {
+	values := map[string][]string{
+		"objectClass":          {"top"},
+		"namingContexts":       {settings.Domain},
+		"supportedLDAPVersion": {fmt.Sprintf("%d", Version3)},
+		"supportedExtension":   {WhoamIOID},
+		"supportedControl":     {PagedResultsOID, ProxiedAuthzOID},
+	}
+	if mechanisms := saslMechanisms(settings); len(mechanisms) > 0 {
+		values["supportedSASLMechanisms"] = mechanisms
+	}
+
+	return []*ber.Packet{
+		encodeSearchResultEntry(id, values, ""),
+		encodeSearchResultDone(searchResultDoneParams{messageID: id, resultCode: Success}),
+	}
+}
+
+// authzIDMatches checks if a SASL authorization identity (dn:<dn>,
+// u:<username> or a bare username) is the identity of the authenticated
+// user. Glim doesn't support proxy authorization so it can't be anyone else
+func authzIDMatches(settings types.LDAPSettings, authzID string, username string) bool {
+	return authzID == "" ||
+		(strings.HasPrefix(authzID, "dn:") && equalDN(authzID[len("dn:"):], userDN(settings.Domain, username))) ||
+		authzID == "u:"+username ||
+		authzID == username
+}
+
+// handleSASLBind authenticates a bind using a SASL mechanism, it returns the
+// bind response and the DN of the authenticated user
+func handleSASLBind(id int64, settings types.LDAPSettings, remoteAddr string, external *externalIdentity, state *saslBindState, creds *saslCredentials) (*ber.Packet, string, error) {
+	mechanism := strings.ToUpper(creds.Mechanism)
+
+	// A bind with another mechanism aborts the SASL bind in progress
+	if state.mechanism != mechanism {
+		state.reset()
+	}
+
+	supported := false
+	for _, m := range saslMechanisms(settings) {
+		if m == mechanism {
+			supported = true
+		}
+	}
+	if !supported {
+		return encodeBindResponse(id, AuthMethodNotSupported, "SASL mechanism not supported"), "", fmt.Errorf("SASL mechanism %s not supported client %s", creds.Mechanism, remoteAddr)
+	}
+
+	printLog(fmt.Sprintf("bind SASL mechanism: %s client %s", mechanism, remoteAddr))
+
+	switch mechanism {
+	case SASLExternal:
+		return saslExternal(id, settings, remoteAddr, external, creds)
+	case SASLPlain:
+		return saslPlain(id, settings, remoteAddr, creds)
+	case SASLScramSHA256:
+		return saslScram(id, settings, remoteAddr, state, creds)
+	}
+	return encodeBindResponse(id, AuthMethodNotSupported, "SASL mechanism not supported"), "", fmt.Errorf("SASL mechanism %s not supported client %s", creds.Mechanism, remoteAddr)
+}
+
+// saslPlain authenticates the authzid NUL authcid NUL passwd message
+// defined in RFC 4616. The password is checked like a simple bind's one so
+// OTP codes and app passwords are accepted too
+func saslPlain(id int64, settings types.LDAPSettings, remoteAddr string, creds *saslCredentials) (*ber.Packet, string, error) {
+	message := strings.Split(creds.Credentials, "\x00")
+	if len(message) != 3 || message[1] == "" {
+		return encodeBindResponse(id, InvalidCredentials, "wrong SASL PLAIN message"), "", fmt.Errorf("wrong SASL PLAIN message client %s", remoteAddr)
+	}
+	authzID, username, pass := message[0], message[1], message[2]
+
+	if !authzIDMatches(settings, authzID, username) {
+		return encodeBindResponse(id, InvalidCredentials, "authorization identity does not match the authentication identity"), "", fmt.Errorf("authorization identity %s does not match %s client %s", authzID, username, remoteAddr)
+	}
+
+	printLog(fmt.Sprintf("bind SASL PLAIN username: %s client %s", username, remoteAddr))
+	r, err := passwordBind(id, settings, remoteAddr, username, pass)
+	if err != nil {
+		return r, "", err
+	}
+	return r, userDN(settings.Domain, username), nil
+}
+
+// saslExternal authenticates the user a verified TLS client certificate or
+// the peer credentials of a local ldapi client are mapped to. Clients may
+// send an authorization identity (dn:... or u:...) but it must be the
+// identity of that user
+func saslExternal(id int64, settings types.LDAPSettings, remoteAddr string, external *externalIdentity, creds *saslCredentials) (*ber.Packet, string, error) {
+	var identity, source, mismatch string
+	var ok, byEmail bool
+
+	switch {
+	case external.peer != nil:
+		source = fmt.Sprintf("peer credentials %s", external.peer)
+		mismatch = "authorization identity does not match the peer credentials"
+		identity, ok = settings.PeerCredMapping.Identity(*external.peer)
+	case external.cert != nil:
+		source = fmt.Sprintf("client certificate %s", external.cert.Subject)
+		mismatch = "authorization identity does not match the client certificate"
+		identity, ok = settings.ClientCertMapping.Identity(external.cert)
+		byEmail = settings.ClientCertMapping.ByEmail()
+	default:
+		return encodeBindResponse(id, InappropriateAuthentication, "a valid client certificate is required"), "", fmt.Errorf("SASL EXTERNAL bind without client certificate client %s", remoteAddr)
+	}
+
+	if !ok {
+		return encodeBindResponse(id, InvalidCredentials, ""), "", fmt.Errorf("no user mapped to %s client %s", source, remoteAddr)
+	}
+
+	var dbUser models.User
+	query := settings.DB.Where("username_folded = ?", models.FoldIdentity(identity))
+	if byEmail {
+		query = settings.DB.Where("email_folded = ?", models.FoldIdentity(identity))
+	}
+	if err := query.Take(&dbUser).Error; err != nil {
+		return encodeBindResponse(id, InvalidCredentials, ""), "", fmt.Errorf("%s map to unknown user %s client %s", source, identity, remoteAddr)
+	}
+
+	if dbUser.Locked != nil && *dbUser.Locked {
+		return encodeBindResponse(id, InvalidCredentials, ""), "", fmt.Errorf("account %s is locked client %s", *dbUser.Username, remoteAddr)
+	}
+
+	dn := userDN(settings.Domain, *dbUser.Username)
+	if !authzIDMatches(settings, creds.Credentials, *dbUser.Username) {
+		return encodeBindResponse(id, InvalidCredentials, mismatch), "", fmt.Errorf("authorization identity %s does not match %s client %s", creds.Credentials, source, remoteAddr)
+	}
+
+	// Check if the client network is allowed to bind with this account
+	if operation, ok := bindAllowed(settings, &dbUser, remoteAddr); !ok {
+		return encodeBindResponse(id, InsufficientAccessRights, "access from your network is not allowed"), "", fmt.Errorf("%s bind rejected by network policy client %s", operation, remoteAddr)
+	}
+
+	printLog(fmt.Sprintf("success: %s mapped to %s client %s", source, dn, remoteAddr))
+	return encodeBindResponse(id, Success, ""), dn, nil
+}
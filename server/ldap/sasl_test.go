@@ -0,0 +1,295 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/doncicuto/glim/types"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSASLExternal(t *testing.T) {
+	dbPath := uuid.New()
+	db, err := newTestDatabase(dbPath.String())
+	if err != nil {
+		t.Fatalf("could not initialize db - %v", err)
+	}
+	defer testCleanUp(dbPath.String())
+
+	pkiDir := fmt.Sprintf("/tmp/%s-pki", dbPath.String())
+	pki := newTestPKI(t, pkiDir)
+	defer os.RemoveAll(pkiDir)
+
+	// Client certificates common names are usernames
+	mapping, err := clientcert.ParseMapping("cn")
+	if err != nil {
+		t.Fatalf("could not parse mapping - %v", err)
+	}
+	settings := testSettings(db, "127.0.0.1:60008")
+	settings.TLSDisabled = false
+	settings.TLSCert = pki.certFile
+	settings.TLSKey = pki.keyFile
+	settings.ClientCertMode = clientcert.ModeRequest
+	settings.ClientCA = pki.caFile
+	settings.ClientCertMapping = mapping
+
+	config, err := tlsConfig(settings)
+	if err != nil {
+		t.Fatalf("could not load TLS configuration - %v", err)
+	}
+	l, err := tls.Listen("tcp", settings.Address, config)
+	if err != nil {
+		t.Fatalf("could not initialize socket - %v", err)
+	}
+	defer l.Close()
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+
+	waitForTestServer(t, "127.0.0.1:60008")
+
+	saulCert := pki.issue(t, x509.Certificate{Subject: pkix.Name{CommonName: "saul"}})
+	unknownCert := pki.issue(t, x509.Certificate{Subject: pkix.Name{CommonName: "walter"}})
+
+	t.Run("SASL EXTERNAL with a mapped certificate", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", &saulCert)
+		defer c.Close()
+		code, _ := saslBind(t, c, 1, "EXTERNAL", nil)
+		assert.Equal(t, int64(Success), code)
+		assert.Equal(t, "dn:uid=saul,ou=Users,dc=example,dc=org", whoami(t, c, 2))
+	})
+
+	t.Run("SASL EXTERNAL with the certificate's authorization identity", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", &saulCert)
+		defer c.Close()
+		authzID := "dn:uid=saul,ou=Users,dc=example,dc=org"
+		code, _ := saslBind(t, c, 1, "EXTERNAL", &authzID)
+		assert.Equal(t, int64(Success), code)
+	})
+
+	t.Run("SASL EXTERNAL with another authorization identity", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", &saulCert)
+		defer c.Close()
+		authzID := "u:kim"
+		code, msg := saslBind(t, c, 1, "EXTERNAL", &authzID)
+		assert.Equal(t, int64(InvalidCredentials), code)
+		assert.Equal(t, "authorization identity does not match the client certificate", msg)
+	})
+
+	t.Run("SASL EXTERNAL with a certificate not mapped to a user", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", &unknownCert)
+		defer c.Close()
+		code, _ := saslBind(t, c, 1, "EXTERNAL", nil)
+		assert.Equal(t, int64(InvalidCredentials), code)
+	})
+
+	t.Run("SASL EXTERNAL without certificate", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", nil)
+		defer c.Close()
+		code, msg := saslBind(t, c, 1, "EXTERNAL", nil)
+		assert.Equal(t, int64(InappropriateAuthentication), code)
+		assert.Equal(t, "a valid client certificate is required", msg)
+	})
+
+	t.Run("Unsupported SASL mechanism", func(t *testing.T) {
+		c := pki.dialTLS(t, "127.0.0.1:60008", &saulCert)
+		defer c.Close()
+		code, msg := saslBind(t, c, 1, "GSSAPI", nil)
+		assert.Equal(t, int64(AuthMethodNotSupported), code)
+		assert.Equal(t, "SASL mechanism not supported", msg)
+	})
+
+	t.Run("Root DSE advertises SASL mechanisms", func(t *testing.T) {
+		conn := ldapClient.NewConn(pki.dialTLS(t, "127.0.0.1:60008", nil), true)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		defer conn.Close()
+
+		searchRequest := ldapClient.NewSearchRequest("", ldapClient.ScopeBaseObject, ldapClient.DerefAlways, 0, 0, false, "(objectClass=*)", []string{"supportedSASLMechanisms"}, nil)
+		sr, err := conn.Search(searchRequest)
+		if err != nil {
+			t.Fatalf("could not search root DSE - %v", err)
+		}
+		assert.Equal(t, 1, len(sr.Entries))
+		assert.Equal(t, []string{"EXTERNAL", "PLAIN", "SCRAM-SHA-256"}, sr.Entries[0].GetAttributeValues("supportedSASLMechanisms"))
+	})
+}
+
+func TestSASLPasswordMechanisms(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60009")
+	defer testCleanUp(dbPath.String())
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60009")
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", "127.0.0.1:60009")
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		return c
+	}
+
+	// scramBind runs a SCRAM-SHA-256 exchange and returns the result code
+	scramBind := func(t *testing.T, c net.Conn, username string, password string) int64 {
+		clientFirstBare := "n=" + username + ",r=rOprNGfwEbeRWgbNEkqO"
+		code, serverFirst := saslBindStep(t, c, 1, "SCRAM-SHA-256", "n,,"+clientFirstBare)
+		if !assert.Equal(t, int64(SaslBindInProgress), code) {
+			return code
+		}
+		assert.True(t, strings.HasPrefix(serverFirst, "r=rOprNGfwEbeRWgbNEkqO"), serverFirst)
+
+		clientFinal, serverSignature := scramClientFinal(t, password, clientFirstBare, serverFirst)
+		code, serverFinal := saslBindStep(t, c, 2, "SCRAM-SHA-256", clientFinal)
+		if code == Success {
+			assert.Equal(t, serverSignature, serverFinal)
+		}
+		return code
+	}
+
+	t.Run("SASL PLAIN with valid credentials", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		credentials := "\x00saul\x00test"
+		code, _ := saslBind(t, c, 1, "PLAIN", &credentials)
+		assert.Equal(t, int64(Success), code)
+		assert.Equal(t, "dn:uid=saul,ou=Users,dc=example,dc=org", whoami(t, c, 2))
+	})
+
+	t.Run("SASL PLAIN with the user's authorization identity", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		credentials := "u:saul\x00saul\x00test"
+		code, _ := saslBind(t, c, 1, "PLAIN", &credentials)
+		assert.Equal(t, int64(Success), code)
+	})
+
+	t.Run("SASL PLAIN with another authorization identity", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		credentials := "kim\x00saul\x00test"
+		code, msg := saslBind(t, c, 1, "PLAIN", &credentials)
+		assert.Equal(t, int64(InvalidCredentials), code)
+		assert.Equal(t, "authorization identity does not match the authentication identity", msg)
+	})
+
+	t.Run("SASL PLAIN with wrong password", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		credentials := "\x00saul\x00wrong"
+		code, _ := saslBind(t, c, 1, "PLAIN", &credentials)
+		assert.Equal(t, int64(InvalidCredentials), code)
+		assert.Equal(t, "dn:", whoami(t, c, 2))
+	})
+
+	t.Run("SASL PLAIN with wrong message", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		credentials := "saul"
+		code, msg := saslBind(t, c, 1, "PLAIN", &credentials)
+		assert.Equal(t, int64(InvalidCredentials), code)
+		assert.Equal(t, "wrong SASL PLAIN message", msg)
+	})
+
+	t.Run("SASL SCRAM-SHA-256 with valid credentials", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		assert.Equal(t, int64(Success), scramBind(t, c, "saul", "test"))
+		assert.Equal(t, "dn:uid=saul,ou=Users,dc=example,dc=org", whoami(t, c, 3))
+	})
+
+	t.Run("SASL SCRAM-SHA-256 with wrong password", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		assert.Equal(t, int64(InvalidCredentials), scramBind(t, c, "saul", "wrong"))
+		assert.Equal(t, "dn:", whoami(t, c, 3))
+	})
+
+	t.Run("SASL SCRAM-SHA-256 with unknown user", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		assert.Equal(t, int64(InvalidCredentials), scramBind(t, c, "walter", "test"))
+	})
+
+	t.Run("SASL SCRAM-SHA-256 with channel binding", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		code, serverCreds := saslBindStep(t, c, 1, "SCRAM-SHA-256", "p=tls-unique,,n=saul,r=rOprNGfwEbeRWgbNEkqO")
+		assert.Equal(t, int64(InappropriateAuthentication), code)
+		assert.Equal(t, "e=channel-bindings-not-supported", serverCreds)
+	})
+
+	t.Run("SASL SCRAM-SHA-256 client-final message without exchange", func(t *testing.T) {
+		c := dial()
+		defer c.Close()
+		code, _ := saslBindStep(t, c, 1, "SCRAM-SHA-256", "c=biws,r=rOprNGfwEbeRWgbNEkqO,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")
+		assert.Equal(t, int64(InvalidCredentials), code)
+	})
+
+	t.Run("SASL SCRAM-SHA-256 credentials created after a password bind", func(t *testing.T) {
+		// Users created before SCRAM-SHA-256 support have no credentials
+		if err := settings.DB.Model(&models.User{}).Where("username = ?", "mike").Update("scram_sha256", nil).Error; err != nil {
+			t.Fatalf("could not remove SCRAM-SHA-256 credentials - %v", err)
+		}
+
+		c := dial()
+		defer c.Close()
+		assert.Equal(t, int64(InvalidCredentials), scramBind(t, c, "mike", "test"))
+
+		credentials := "\x00mike\x00test"
+		code, _ := saslBind(t, c, 3, "PLAIN", &credentials)
+		assert.Equal(t, int64(Success), code)
+
+		assert.Equal(t, int64(Success), scramBind(t, c, "mike", "test"))
+	})
+}
+
+func TestSCRAMFakeSalt(t *testing.T) {
+	settings := types.LDAPSettings{Domain: "dc=example,dc=org", TOTPSecretKey: "secret"}
+	salt := scramFakeCredentials(settings, "nobody").Salt
+
+	assert.Equal(t, salt, scramFakeCredentials(settings, "nobody").Salt)
+	assert.NotEqual(t, salt, scramFakeCredentials(settings, "somebody").Salt)
+	assert.NotEqual(t, models.ScramHMAC([]byte(settings.Domain), "nobody")[:16], salt)
+
+	// Clients that know the domain can't compute the salt
+	settings.TOTPSecretKey = "other"
+	assert.NotEqual(t, salt, scramFakeCredentials(settings, "nobody").Salt)
+	settings.TOTPSecretKey = ""
+	assert.NotEqual(t, salt, scramFakeCredentials(settings, "nobody").Salt)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// scramExchange is a SCRAM-SHA-256 exchange (RFC 5802) waiting for the
+// client-final-message
+type scramExchange struct {
+	username        string
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+	credentials     *models.ScramCredentials
+	// failure is set when the user can't authenticate, the exchange goes on
+	// with fake credentials so clients can't tell if the user exists
+	failure   error
+	rateLimit bool
+}
+
+// saslScram runs a step of a SCRAM-SHA-256 bind
+func saslScram(id int64, settings types.LDAPSettings, remoteAddr string, state *saslBindState, creds *saslCredentials) (*ber.Packet, string, error) {
+	if state.scram == nil {
+		return scramServerFirst(id, settings, remoteAddr, state, creds)
+	}
+
+	exchange := state.scram
+	state.reset()
+	return scramServerFinal(id, settings, remoteAddr, exchange, creds)
+}
+
+// scramAttributes parses the attr=value pairs of a SCRAM message
+func scramAttributes(message string) ([]string, map[string]string, error) {
+	names := []string{}
+	attributes := map[string]string{}
+	for _, attr := range strings.Split(message, ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			return nil, nil, errors.New("wrong SCRAM-SHA-256 message")
+		}
+		names = append(names, attr[:1])
+		attributes[attr[:1]] = attr[2:]
+	}
+	return names, attributes, nil
+}
+
+// scramUsername decodes the =2C and =3D escaped characters of a saslname
+func scramUsername(name string) string {
+	return strings.NewReplacer("=2C", ",", "=3D", "=").Replace(name)
+}
+
+// scramFakeKey keys fake salts when the server has no secret key set
+var scramFakeKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// scramFakeCredentials returns credentials for users that can't
+// authenticate. The salt must be the same for every request for a username
+// and clients must not be able to compute it, or they could tell which
+// usernames exist
+func scramFakeCredentials(settings types.LDAPSettings, username string) *models.ScramCredentials {
+	key := scramFakeKey
+	if settings.TOTPSecretKey != "" {
+		key = []byte(settings.TOTPSecretKey)
+	}
+	salt := models.ScramHMAC(key, "SCRAM fake salt "+username)[:16]
+	return &models.ScramCredentials{Iterations: models.ScramSHA256Iterations, Salt: salt}
+}
+
+// scramServerFirst handles the client-first-message: gs2-header followed by
+// n=<username>,r=<client nonce>
+func scramServerFirst(id int64, settings types.LDAPSettings, remoteAddr string, state *saslBindState, creds *saslCredentials) (*ber.Packet, string, error) {
+	parts := strings.SplitN(creds.Credentials, ",", 3)
+	if len(parts) != 3 {
+		return encodeBindResponse(id, InvalidCredentials, "wrong SCRAM-SHA-256 message"), "", fmt.Errorf("wrong SCRAM-SHA-256 client-first message client %s", remoteAddr)
+	}
+
+	// Channel binding is not supported
+	if strings.HasPrefix(parts[0], "p=") {
+		return encodeSASLBindResponse(id, InappropriateAuthentication, "channel binding not supported", "e=channel-bindings-not-supported"), "", fmt.Errorf("SCRAM-SHA-256 channel binding not supported client %s", remoteAddr)
+	}
+
+	names, attributes, err := scramAttributes(parts[2])
+	if err != nil || (parts[0] != "n" && parts[0] != "y") || len(names) < 2 || names[0] != "n" || names[1] != "r" || attributes["n"] == "" || attributes["r"] == "" {
+		return encodeBindResponse(id, InvalidCredentials, "wrong SCRAM-SHA-256 message"), "", fmt.Errorf("wrong SCRAM-SHA-256 client-first message client %s", remoteAddr)
+	}
+
+	username := scramUsername(attributes["n"])
+	authzID := strings.TrimPrefix(parts[1], "a=")
+	if !authzIDMatches(settings, scramUsername(authzID), username) {
+		return encodeBindResponse(id, InvalidCredentials, "authorization identity does not match the authentication identity"), "", fmt.Errorf("authorization identity %s does not match %s client %s", authzID, username, remoteAddr)
+	}
+
+	printLog(fmt.Sprintf("bind SASL SCRAM-SHA-256 username: %s client %s", username, remoteAddr))
+
+	// Failed binds are throttled by source IP and username
+	keys := bindRateLimitKeys(remoteAddr, username)
+	if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+		return encodeBindResponse(id, Busy, "too many failed attempts, please try again later"), "", fmt.Errorf("too many failed attempts, bind throttled for %v client %s", wait.Round(time.Second), remoteAddr)
+	}
+
+	exchange := scramExchange{
+		username:        username,
+		gs2Header:       parts[0] + "," + parts[1] + ",",
+		clientFirstBare: parts[2],
+	}
+
+	var dbUser models.User
+	if err := settings.DB.Where("username_folded = ?", models.FoldIdentity(username)).Take(&dbUser).Error; err != nil {
+		exchange.failure = fmt.Errorf("wrong username or password client %s", remoteAddr)
+		exchange.rateLimit = true
+	} else if operation, ok := bindAllowed(settings, &dbUser, remoteAddr); !ok {
+		return encodeBindResponse(id, InsufficientAccessRights, "access from your network is not allowed"), "", fmt.Errorf("%s bind rejected by network policy client %s", operation, remoteAddr)
+	} else if dbUser.Locked != nil && *dbUser.Locked {
+		exchange.failure = fmt.Errorf("account %s is locked client %s", username, remoteAddr)
+	} else if otpPolicy(settings, &dbUser, remoteAddr) == OTPPolicyRequired {
+		exchange.failure = fmt.Errorf("OTP code required, SCRAM-SHA-256 can't be used client %s", remoteAddr)
+	} else if dbUser.ScramSHA256 == nil || *dbUser.ScramSHA256 == "" {
+		exchange.failure = fmt.Errorf("user %s has no SCRAM-SHA-256 credentials yet, a password bind or change is required client %s", username, remoteAddr)
+	} else if exchange.credentials, err = models.ParseScramSHA256(*dbUser.ScramSHA256); err != nil {
+		exchange.failure = fmt.Errorf("%v client %s", err, remoteAddr)
+	}
+	if exchange.credentials == nil {
+		exchange.credentials = scramFakeCredentials(settings, username)
+	}
+
+	serverNonce := make([]byte, 18)
+	if _, err := rand.Read(serverNonce); err != nil {
+		return encodeBindResponse(id, Other, ""), "", err
+	}
+	exchange.nonce = attributes["r"] + base64.StdEncoding.EncodeToString(serverNonce)
+	exchange.serverFirst = fmt.Sprintf("r=%s,s=%s,i=%d",
+		exchange.nonce,
+		base64.StdEncoding.EncodeToString(exchange.credentials.Salt),
+		exchange.credentials.Iterations)
+
+	state.mechanism = SASLScramSHA256
+	state.scram = &exchange
+	return encodeSASLBindResponse(id, SaslBindInProgress, "", exchange.serverFirst), "", nil
+}
+
+// scramServerFinal handles the client-final-message c=<channel binding>,
+// r=<nonce>,p=<proof> and verifies the client proof
+func scramServerFinal(id int64, settings types.LDAPSettings, remoteAddr string, exchange *scramExchange, creds *saslCredentials) (*ber.Packet, string, error) {
+	i := strings.LastIndex(creds.Credentials, ",p=")
+	if i < 0 {
+		return encodeBindResponse(id, InvalidCredentials, "wrong SCRAM-SHA-256 message"), "", fmt.Errorf("wrong SCRAM-SHA-256 client-final message client %s", remoteAddr)
+	}
+	withoutProof := creds.Credentials[:i]
+
+	names, attributes, err := scramAttributes(withoutProof)
+	if err != nil || len(names) < 2 || names[0] != "c" || names[1] != "r" {
+		return encodeBindResponse(id, InvalidCredentials, "wrong SCRAM-SHA-256 message"), "", fmt.Errorf("wrong SCRAM-SHA-256 client-final message client %s", remoteAddr)
+	}
+
+	if attributes["c"] != base64.StdEncoding.EncodeToString([]byte(exchange.gs2Header)) {
+		return encodeSASLBindResponse(id, InvalidCredentials, "", "e=channel-bindings-dont-match"), "", fmt.Errorf("SCRAM-SHA-256 channel binding doesn't match client %s", remoteAddr)
+	}
+
+	if attributes["r"] != exchange.nonce {
+		return encodeSASLBindResponse(id, InvalidCredentials, "", "e=other-error"), "", fmt.Errorf("SCRAM-SHA-256 nonce doesn't match client %s", remoteAddr)
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(creds.Credentials[i+len(",p="):])
+	if err != nil || len(proof) != sha256.Size {
+		return encodeSASLBindResponse(id, InvalidCredentials, "", "e=invalid-encoding"), "", fmt.Errorf("wrong SCRAM-SHA-256 client proof client %s", remoteAddr)
+	}
+
+	keys := bindRateLimitKeys(remoteAddr, exchange.username)
+	if exchange.failure != nil {
+		if exchange.rateLimit {
+			settings.RateLimiter.Fail(keys...)
+		}
+		return encodeSASLBindResponse(id, InvalidCredentials, "", "e=invalid-proof"), "", exchange.failure
+	}
+
+	// ClientKey = ClientProof XOR HMAC(StoredKey, AuthMessage) and
+	// StoredKey = H(ClientKey)
+	authMessage := exchange.clientFirstBare + "," + exchange.serverFirst + "," + withoutProof
+	clientSignature := models.ScramHMAC(exchange.credentials.StoredKey, authMessage)
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], exchange.credentials.StoredKey) != 1 {
+		settings.RateLimiter.Fail(keys...)
+		return encodeSASLBindResponse(id, InvalidCredentials, "", "e=invalid-proof"), "", fmt.Errorf("%v client %s", errWrongCredentials, remoteAddr)
+	}
+
+	// The server signature proves the client that we know its credentials
+	serverSignature := models.ScramHMAC(exchange.credentials.ServerKey, authMessage)
+	dn := userDN(settings.Domain, exchange.username)
+	printLog(fmt.Sprintf("success: valid SCRAM-SHA-256 proof provided for %s client %s", dn, remoteAddr))
+	return encodeSASLBindResponse(id, Success, "", "v="+base64.StdEncoding.EncodeToString(serverSignature)), dn, nil
+}
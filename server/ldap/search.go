@@ -3,7 +3,6 @@ package ldap
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +10,7 @@ import (
 	"github.com/doncicuto/glim/types"
 	ber "github.com/go-asn1-ber/asn1-ber"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func searchSize(p *ber.Packet, searchLimit int, pagedResultSize int64) (int, *ServerError) {
@@ -87,6 +87,49 @@ func searchFilter(p *ber.Packet) (string, *ServerError) {
 	return filter, nil
 }
 
+// filterValues returns the values of the equality assertions for an
+// attribute found in a decoded search filter e.g (memberOf=cn=devel,...)
+func filterValues(filter string, attribute string) []string {
+	values := []string{}
+	prefix := strings.ToLower("(" + attribute + "=")
+	lower := strings.ToLower(filter)
+	for i := strings.Index(lower, prefix); i >= 0; {
+		start := i + len(prefix)
+		end := strings.IndexByte(filter[start:], ')')
+		if end < 0 {
+			break
+		}
+		values = append(values, filter[start:start+end])
+
+		next := strings.Index(lower[start+end:], prefix)
+		if next < 0 {
+			break
+		}
+		i = start + end + next
+	}
+	return values
+}
+
+// numberCriteria adds the condition of a numeric attribute e.g uidNumber to
+// a query. Presence filters match any number and wrong numbers match nothing
+func numberCriteria(db *gorm.DB, column string, value string, index int) {
+	query, args := fmt.Sprintf("%s IS NOT NULL", column), []interface{}{}
+	if value != "*" {
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			query = "1 = 0"
+		} else {
+			query, args = fmt.Sprintf("%s = ?", column), []interface{}{n}
+		}
+	}
+
+	if index == 0 {
+		db.Where(query, args...)
+	} else {
+		db.Or(query, args...)
+	}
+}
+
 func decodeAssertionValue(p *ber.Packet) (string, *ServerError) {
 	filter := ""
 	if p.Tag == ber.TagOctetString {
@@ -128,6 +171,43 @@ func decodeSubstringFilter(p *ber.Packet) (string, *ServerError) {
 	return filter, nil
 }
 
+// decodeExtensibleMatch decodes a MatchingRuleAssertion as defined in
+// RFC 4515 e.g (memberOf:1.2.840.113556.1.4.1941:=cn=devel,...)
+func decodeExtensibleMatch(p *ber.Packet) (string, *ServerError) {
+	var matchingRule, attribute, value string
+	hasValue, dnAttributes := false, false
+
+	for _, c := range p.Children {
+		switch c.Tag {
+		case 1:
+			matchingRule = c.Data.String()
+		case 2:
+			attribute = c.Data.String()
+		case 3:
+			value, hasValue = c.Data.String(), true
+		case 4:
+			dnAttributes = len(c.Data.Bytes()) > 0 && c.Data.Bytes()[0] != 0
+		}
+	}
+
+	// The value is required and a matching rule is needed if there's no type
+	if !hasValue || (attribute == "" && matchingRule == "") {
+		return "", &ServerError{
+			Msg:  "wrong search filter definition",
+			Code: ProtocolError,
+		}
+	}
+
+	filter := "(" + attribute
+	if dnAttributes {
+		filter += ":dn"
+	}
+	if matchingRule != "" {
+		filter += ":" + matchingRule
+	}
+	return filter + ":=" + value + ")", nil
+}
+
 func decodeFilters(p *ber.Packet) (string, *ServerError) {
 	filter := ""
 
@@ -205,6 +285,12 @@ func decodeFilters(p *ber.Packet) (string, *ServerError) {
 
 	case FilterPresent:
 		filter = fmt.Sprintf("(%v=*)", p.Data)
+	case FilterExtensibleMatch:
+		df, err := decodeExtensibleMatch(p)
+		if err != nil {
+			return "", err
+		}
+		filter += df
 	default:
 		printLog(fmt.Sprintf("substring %v, %v", p.Tag, p.TagType))
 	}
@@ -212,28 +298,24 @@ func decodeFilters(p *ber.Packet) (string, *ServerError) {
 	return filter, nil
 }
 
-func searchAttributes(p *ber.Packet) (string, *ServerError) {
-	var attributes []string
+func searchAttributes(p *ber.Packet) ([]string, *ServerError) {
+	attributes := []string{}
 
 	// &{{0 32 16} <nil> []  [] }
 	if p.ClassType != ber.ClassUniversal ||
 		p.TagType != ber.TypeConstructed ||
 		p.Tag != ber.TagSequence {
-		return "", &ServerError{
+		return nil, &ServerError{
 			Msg:  "wrong attributes definition",
 			Code: ProtocolError,
 		}
 	}
 
-	if len(p.Children) == 0 {
-		return "ALL", nil
-	}
-
 	for _, att := range p.Children {
-		attributes = append(attributes, att.Value.(string))
+		attributes = append(attributes, att.Data.String())
 	}
 
-	return strings.Join(attributes, " "), nil
+	return attributes, nil
 }
 
 func baseObject(p *ber.Packet) (string, *ServerError) {
@@ -277,7 +359,7 @@ func searchScope(p *ber.Packet) (int64, *ServerError) {
 }
 
 // HandleSearchRequest - TODO comment
-func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.Packet, error) {
+func HandleSearchRequest(message *Message, settings types.LDAPSettings, boundDN string) ([]*ber.Packet, error) {
 
 	// Defined in https://www.rfc-editor.org/rfc/rfc4511#section-4.5.1
 	var offset = 0
@@ -291,6 +373,47 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 	id := message.ID
 	p := message.Request
 
+	// Searches with proxied authorization return what the proxied user can read
+	access, authzErr := proxiedAuthorization(settings, boundDN, message)
+	if authzErr != nil {
+		p := encodeSearchResultDone(searchResultDoneParams{
+			messageID:    id,
+			resultCode:   authzErr.Code,
+			msg:          authzErr.Msg,
+			paging:       message.PagedResultsSize > 0,
+			totalResults: 0,
+			criticality:  message.PagedResultsCriticality,
+			cookie:       cookie,
+		})
+		r = append(r, p)
+		return r, fmt.Errorf("%s requested by %s", authzErr.Msg, boundDN)
+	}
+
+	// Private custom attributes are only served to managers and readonly
+	// accounts, with proxied authorization the proxied user must be one of them
+	private := access == nil && (message.ProxiedAuthz || privilegedBind(settings, boundDN))
+
+	// Service accounts read what their own search permissions allow unless
+	// they act as a proxied user
+	if account := boundServiceAccount(settings, boundDN); account != nil && !message.ProxiedAuthz {
+		serviceAccess, serviceErr := serviceSearchAccess(settings, account)
+		if serviceErr != nil {
+			p := encodeSearchResultDone(searchResultDoneParams{
+				messageID:    id,
+				resultCode:   Other,
+				msg:          "could not retrieve information from database",
+				paging:       message.PagedResultsSize > 0,
+				totalResults: 0,
+				criticality:  message.PagedResultsCriticality,
+				cookie:       cookie,
+			})
+			r = append(r, p)
+			return r, serviceErr
+		}
+		access = serviceAccess
+		private = account.ReadPrivate != nil && *account.ReadPrivate
+	}
+
 	// Paging
 	if message.Paging && message.PagedResultsCookie != "" {
 		val, found, err := settings.KV.Get(message.PagedResultsCookie)
@@ -343,9 +466,30 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 	}
 	printLog(fmt.Sprintf("search base object: %s", b))
 
+	// Root DSE
+	if b == "" {
+		return rootDSE(id, settings), nil
+	}
+
 	//Check if base object is valid
-	reg, _ := regexp.Compile(fmt.Sprintf("%s$", settings.Domain))
-	if !reg.MatchString(b) {
+	base, dnErr := ParseDN(b)
+	if dnErr != nil {
+		p := encodeSearchResultDone(searchResultDoneParams{
+			messageID:    id,
+			resultCode:   InvalidDNSyntax,
+			msg:          "wrong base object DN",
+			paging:       message.PagedResultsSize > 0,
+			totalResults: 0,
+			criticality:  message.PagedResultsCriticality,
+			cookie:       cookie,
+		})
+		r = append(r, p)
+		return r, dnErr
+	}
+
+	domain, _ := ParseDN(settings.Domain)
+	isDomain := base.Equal(domain)
+	if !isDomain && !base.IsDescendantOf(domain) {
 		p := encodeSearchResultDone(searchResultDoneParams{
 			messageID:    id,
 			resultCode:   NoSuchObject,
@@ -456,25 +600,20 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 		r = append(r, p)
 		return r, errors.New(err.Msg)
 	}
-	attrs := make(map[string]string)
-	for _, a := range strings.Split(a, " ") {
-		attrs[a] = a
-	}
-	printLog(fmt.Sprintf("search attributes: %s", a))
+	printLog(fmt.Sprintf("search attributes: %s", strings.Join(a, " ")))
+	attributes := newAttributeSelection(a, t)
 
 	/* RFC 4511 - The results of the Search operation are returned as zero or more
 	    SearchResultEntry and/or SearchResultReference messages, followed by
 		a single SearchResultDone message */
 
-	regBase, _ := regexp.Compile(fmt.Sprintf("^ou=users,%s$", settings.Domain))
-
-	if (b == settings.Domain && strings.Contains(f, "objectClass=*")) || regBase.MatchString(strings.ToLower(b)) {
+	if (isDomain && strings.Contains(f, "objectClass=*")) || equalDN(b, usersDN(settings.Domain)) {
 		if (f == "(objectclass=*)" && !message.Paging) || (f == "(objectclass=*)" && message.Paging && offset == 0) {
-			ouUsers := fmt.Sprintf("ou=Users,%s", settings.Domain)
-			values := map[string][]string{
+			ouUsers := usersDN(settings.Domain)
+			values := attributes.staticValues(map[string][]string{
 				"objectClass": {"organizationalUnit", "top"},
 				"ou":          {"Users"},
-			}
+			})
 			e := encodeSearchResultEntry(id, values, ouUsers)
 			r = append(r, e)
 		}
@@ -483,11 +622,12 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 			db:             settings.DB,
 			filter:         f,
 			originalFilter: f,
-			attributes:     a,
+			attributes:     attributes,
 			messageID:      id,
 			domain:         settings.Domain,
 			limit:          n,
 			offset:         offset,
+			private:        private,
 		}
 
 		users, err, nResults, totalResults = getUsersFromDB(params)
@@ -497,38 +637,34 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 		r = append(r, users...)
 	}
 
-	regBase, _ = regexp.Compile(fmt.Sprintf("^uid=([A-Za-z.0-9-]+),ou=users,%s$", settings.Domain))
-	if regBase.MatchString(strings.ToLower(b)) {
-		matches := regBase.FindStringSubmatch(strings.ToLower(b))
-		if matches != nil {
-			params := userQueryParams{
-				db:             settings.DB,
-				filter:         fmt.Sprintf("uid=%s", matches[1]),
-				originalFilter: f,
-				attributes:     a,
-				messageID:      id,
-				domain:         settings.Domain,
-				limit:          n,
-				offset:         offset,
-			}
-
-			users, err, nResults, totalResults = getUsersFromDB(params)
-			if err != nil {
-				return r, errors.New(err.Msg)
-			}
+	if username, ok := childValue(b, usersDN(settings.Domain), "uid"); ok {
+		params := userQueryParams{
+			db:             settings.DB,
+			username:       username,
+			originalFilter: f,
+			attributes:     attributes,
+			messageID:      id,
+			domain:         settings.Domain,
+			limit:          n,
+			offset:         offset,
+			private:        private,
+		}
 
-			r = append(r, users...)
+		users, err, nResults, totalResults = getUsersFromDB(params)
+		if err != nil {
+			return r, errors.New(err.Msg)
 		}
+
+		r = append(r, users...)
 	}
 
-	regBase, _ = regexp.Compile(fmt.Sprintf("^ou=groups,%s$", settings.Domain))
-	if (b == settings.Domain && strings.Contains(f, "objectClass=*")) || regBase.MatchString(strings.ToLower(b)) {
+	if (isDomain && strings.Contains(f, "objectClass=*")) || equalDN(b, groupsDN(settings.Domain)) {
 		if (f == "(objectclass=*)" && !message.Paging) || (f == "(objectclass=*)" && message.Paging && offset == 0) {
-			ouGroups := fmt.Sprintf("ou=Groups,%s", settings.Domain)
-			values := map[string][]string{
+			ouGroups := groupsDN(settings.Domain)
+			values := attributes.staticValues(map[string][]string{
 				"objectClass": {"organizationalUnit", "top"},
 				"ou":          {"Groups"},
-			}
+			})
 			e := encodeSearchResultEntry(id, values, ouGroups)
 			r = append(r, e)
 		}
@@ -537,12 +673,13 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 			db:             settings.DB,
 			filter:         f,
 			originalFilter: f,
-			attributes:     a,
+			attributes:     attributes,
 			id:             id,
 			domain:         settings.Domain,
 			limit:          n,
 			offset:         offset,
 			guacamole:      settings.Guacamole,
+			private:        private,
 		}
 
 		groups, err, nResults, totalResults = getGroupsFromDB(params)
@@ -552,31 +689,29 @@ func HandleSearchRequest(message *Message, settings types.LDAPSettings) ([]*ber.
 		r = append(r, groups...)
 	}
 
-	regBase, _ = regexp.Compile(fmt.Sprintf("^cn=([A-Za-z.0-9-]+),ou=groups,%s$", settings.Domain))
-	if regBase.MatchString(strings.ToLower(b)) {
-		matches := regBase.FindStringSubmatch(strings.ToLower(b))
-		if matches != nil {
-
-			params := groupQueryParams{
-				db:             settings.DB,
-				filter:         fmt.Sprintf("cn=%s", matches[1]),
-				originalFilter: f,
-				attributes:     a,
-				id:             id,
-				domain:         settings.Domain,
-				limit:          n,
-				offset:         offset,
-				guacamole:      settings.Guacamole,
-			}
+	if name, ok := childValue(b, groupsDN(settings.Domain), "cn"); ok {
+		params := groupQueryParams{
+			db:             settings.DB,
+			name:           name,
+			originalFilter: f,
+			attributes:     attributes,
+			id:             id,
+			domain:         settings.Domain,
+			limit:          n,
+			offset:         offset,
+			guacamole:      settings.Guacamole,
+			private:        private,
+		}
 
-			groups, err, nResults, totalResults = getGroupsFromDB(params)
-			if err != nil {
-				return r, errors.New(err.Msg)
-			}
-			r = append(r, groups...)
+		groups, err, nResults, totalResults = getGroupsFromDB(params)
+		if err != nil {
+			return r, errors.New(err.Msg)
 		}
+		r = append(r, groups...)
 	}
 
+	r = access.visible(r)
+
 	// Paging
 	if message.Paging {
 		// More results?
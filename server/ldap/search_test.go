@@ -55,7 +55,7 @@ func TestSearchOperation(t *testing.T) {
 			filter:     "(objectclass=*)",
 			attributes: []string{},
 			controls:   nil,
-			numEntries: 4,
+			numEntries: 6,
 		},
 		{
 			name:       "Search groups successful",
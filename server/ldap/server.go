@@ -18,6 +18,7 @@ package ldap
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
@@ -25,6 +26,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/doncicuto/glim/server/peercred"
 	"github.com/doncicuto/glim/types"
 	ber "github.com/go-asn1-ber/asn1-ber"
 	"github.com/labstack/gommon/log"
@@ -42,7 +45,29 @@ func handleConnection(c net.Conn, settings types.LDAPSettings) {
 
 	var username = ""
 	remoteAddress := c.RemoteAddr().String()
+
+	// Local processes connected to our ldapi socket are identified by
+	// their peer credentials
+	peer, err := peercred.Get(c)
+	if err != nil {
+		printLog(fmt.Sprintf("could not get ldapi peer credentials: %v", err))
+		return
+	}
+	if peer != nil {
+		remoteAddress = ldapiAddress(*peer)
+	}
 	printLog(fmt.Sprintf("serving LDAPS connection from %s", remoteAddress))
+
+	// Verified TLS client certificate used by SASL EXTERNAL binds
+	cert, err := peerCertificate(c)
+	if err != nil {
+		printLog(fmt.Sprintf("TLS handshake failed: %v client %s", err, remoteAddress))
+		return
+	}
+	external := externalIdentity{cert: cert, peer: peer}
+
+	// SASL bind in progress on this connection
+	var sasl saslBindState
 L:
 	for {
 		p, err := ber.ReadPacket(c)
@@ -63,10 +88,13 @@ L:
 		switch message.Op {
 		case BindRequest:
 			printLog(fmt.Sprintf("bind requested by client: %s", remoteAddress))
-			p, n, err := HandleBind(message, settings, remoteAddress)
-			username = n
+			p, n, err := HandleBind(message, settings, remoteAddress, &external, &sasl)
+			// A failed bind leaves the connection unauthenticated
+			username = ""
 			if err != nil {
 				printLog(err.Error())
+			} else {
+				username = n
 			}
 			_, err = c.Write(p.Bytes())
 			if err != nil {
@@ -83,7 +111,7 @@ L:
 			}
 		case SearchRequest:
 			printLog(fmt.Sprintf("search requested by client %s", remoteAddress))
-			p, err := HandleSearchRequest(message, settings)
+			p, err := HandleSearchRequest(message, settings, username)
 			if err != nil {
 				printLog(err.Error())
 			}
@@ -113,6 +141,37 @@ L:
 	}
 }
 
+// peerCertificate completes the TLS handshake and returns the client
+// certificate verified with our client CA, if any
+func peerCertificate(c net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := c.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, nil
+	}
+	return chains[0][0], nil
+}
+
+// tlsConfig returns the TLS configuration for our LDAPS server, client
+// certificates are requested if enabled
+func tlsConfig(settings types.LDAPSettings) (*tls.Config, error) {
+	cer, err := tls.LoadX509KeyPair(settings.TLSCert, settings.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate and private key pair")
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cer}}
+	if err := clientcert.ConfigureTLS(config, settings.ClientCertMode, settings.ClientCA); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 func waitForShutdown(l net.Listener, ch chan bool) {
 	for range ch {
 		log.SetHeader("${time_rfc3339} [Glim] ⇨")
@@ -145,16 +204,15 @@ func Server(wg *sync.WaitGroup, shutdownChannel chan bool, settings types.LDAPSe
 		log.Printf("starting LDAP server in address %s...", addr)
 		defer l.Close()
 	} else {
-		// Load server certificate and private key
-		cer, err := tls.LoadX509KeyPair(settings.TLSCert, settings.TLSKey)
+		// Load server certificate, private key and client CA
+		config, err := tlsConfig(settings)
 		if err != nil {
 			log.SetHeader("${time_rfc3339} [Glim] ⇨")
-			log.Fatal("could not load server certificate and private key pair")
+			log.Fatal(err.Error())
 			return
 		}
 
 		// Start TLS listener
-		config := &tls.Config{Certificates: []tls.Certificate{cer}}
 		l, err = tls.Listen("tcp", addr, config)
 		if err != nil {
 			log.SetHeader("${time_rfc3339} [Glim] ⇨")
@@ -166,6 +224,20 @@ func Server(wg *sync.WaitGroup, shutdownChannel chan bool, settings types.LDAPSe
 		defer l.Close()
 	}
 
+	// Local clients may connect to our ldapi socket too
+	if settings.LDAPISocket != "" {
+		ldapi, err := listenLDAPI(settings)
+		if err != nil {
+			log.SetHeader("${time_rfc3339} [Glim] ⇨")
+			log.Fatal(err.Error())
+			return
+		}
+		log.SetHeader("${time_rfc3339} [Glim] ⇨")
+		log.Printf("starting LDAP server in socket %s...", settings.LDAPISocket)
+		defer ldapi.Close()
+		go serveLDAPI(ldapi, settings)
+	}
+
 	// Handle LDAP connections in a for loop
 	for {
 		// Wait for shutdown signals and close our TLS listener
@@ -183,6 +255,13 @@ func Server(wg *sync.WaitGroup, shutdownChannel chan bool, settings types.LDAPSe
 			return
 		}
 
+		// Reject clients that are not allowed to reach our server
+		if !settings.NetworkPolicies.Anonymous.Allows(c.RemoteAddr().String()) {
+			printLog(fmt.Sprintf("connection rejected by network policy client %s", c.RemoteAddr().String()))
+			c.Close()
+			continue
+		}
+
 		// Handle our server connection
 		go handleConnection(c, settings)
 	}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/doncicuto/glim/types"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"gorm.io/gorm"
+)
+
+// findServiceAccount returns the service account with a case-folded name
+func findServiceAccount(settings types.LDAPSettings, name string) (*models.ServiceAccount, error) {
+	var s models.ServiceAccount
+	err := settings.DB.Preload("Groups").Where("name_folded = ?", models.FoldIdentity(name)).Take(&s).Error
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// verifyServiceAccountPassword checks a bind password against the current
+// password of a service account and the previous one during the grace
+// period that follows a rotation
+func verifyServiceAccountPassword(s *models.ServiceAccount, pass string) (bool, error) {
+	if models.VerifyPassword(*s.Password, pass) == nil {
+		return true, nil
+	}
+	if s.PreviousPasswordValid() && models.VerifyPassword(*s.PreviousPassword, pass) == nil {
+		return false, nil
+	}
+	return false, errWrongCredentials
+}
+
+// serviceAccountBind authenticates a service account with a simple bind to
+// its cn=name,ou=Services DN. Service accounts don't use OTP codes or app
+// passwords, their passwords are generated and rotated by managers
+func serviceAccountBind(id int64, settings types.LDAPSettings, remoteAddr string, name string, pass string) (*ber.Packet, error) {
+	dn := serviceAccountDN(settings.Domain, name)
+
+	// Failed binds are throttled by source IP and service account DN
+	keys := bindRateLimitKeys(remoteAddr, dn)
+	if wait, err := settings.RateLimiter.Blocked(keys...); err == nil && wait > 0 {
+		return encodeBindResponse(id, Busy, "too many failed attempts, please try again later"), fmt.Errorf("too many failed attempts, bind throttled for %v client %s", wait.Round(time.Second), remoteAddr)
+	}
+
+	s, err := findServiceAccount(settings, name)
+	if err != nil {
+		settings.RateLimiter.Fail(keys...)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return encodeBindResponse(id, InvalidCredentials, ""), fmt.Errorf("wrong service account %s client %s", dn, remoteAddr)
+		}
+		return encodeBindResponse(id, Other, "could not retrieve information from database"), err
+	}
+
+	// Check if the client network is allowed to bind
+	if !isLDAPI(remoteAddr) && !settings.NetworkPolicies.Operation(netpolicy.User).Allows(remoteAddr) {
+		return encodeBindResponse(id, InsufficientAccessRights, "access from your network is not allowed"), fmt.Errorf("%s bind rejected by network policy client %s", netpolicy.User, remoteAddr)
+	}
+
+	current, err := verifyServiceAccountPassword(s, pass)
+	if err != nil {
+		settings.RateLimiter.Fail(keys...)
+		return encodeBindResponse(id, InvalidCredentials, ""), fmt.Errorf("%v service account %s client %s", err, dn, remoteAddr)
+	}
+
+	if s.Locked != nil && *s.Locked {
+		return encodeBindResponse(id, InvalidCredentials, ""), fmt.Errorf("service account %s is locked client %s", dn, remoteAddr)
+	}
+
+	updates := map[string]interface{}{"last_bind_at": time.Now()}
+
+	// Upgrade stored password hash if our hashing policy has changed
+	if current && models.NeedsRehash(*s.Password) {
+		if hash, err := models.Hash(pass); err == nil {
+			updates["password"] = string(hash)
+		}
+	}
+	if err := settings.DB.Model(&models.ServiceAccount{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+		printLog(fmt.Sprintf("could not update service account %d after bind: %v", s.ID, err))
+	}
+
+	if !current {
+		printLog(fmt.Sprintf("service account %s used its previous password client %s", dn, remoteAddr))
+	}
+
+	printLog("success: valid service account credentials provided")
+	return encodeBindResponse(id, Success, ""), nil
+}
+
+// movedToServices checks if a cn=name DN below our domain names a service
+// account instead of a user, as readonly users were migrated to ou=Services
+func movedToServices(settings types.LDAPSettings, name string) bool {
+	if settings.DB.Where("username_folded = ?", models.FoldIdentity(name)).Take(&models.User{}).Error == nil {
+		return false
+	}
+	_, err := findServiceAccount(settings, name)
+	return err == nil
+}
+
+// boundServiceAccount returns the service account of a bound DN or nil if
+// the connection is not bound to a service account
+func boundServiceAccount(settings types.LDAPSettings, boundDN string) *models.ServiceAccount {
+	name, ok := childValue(boundDN, servicesDN(settings.Domain), "cn")
+	if !ok {
+		return nil
+	}
+	s, err := findServiceAccount(settings, name)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// serviceSearchAccess returns what a service account can read. Accounts
+// restricted to some groups read those groups, the groups nested in them
+// and their members
+func serviceSearchAccess(settings types.LDAPSettings, s *models.ServiceAccount) (*searchAccess, error) {
+	searchUsers := s.SearchUsers == nil || *s.SearchUsers
+	searchGroups := s.SearchGroups == nil || *s.SearchGroups
+
+	access := searchAccess{
+		dns:      map[string]bool{normalizeDN(settings.Domain): true},
+		subtrees: map[string]bool{},
+	}
+	if searchUsers {
+		access.dns[normalizeDN(usersDN(settings.Domain))] = true
+	}
+	if searchGroups {
+		access.dns[normalizeDN(groupsDN(settings.Domain))] = true
+	}
+
+	if s.GroupsOnly == nil || !*s.GroupsOnly {
+		if searchUsers {
+			access.subtrees[normalizeDN(usersDN(settings.Domain))] = true
+		}
+		if searchGroups {
+			access.subtrees[normalizeDN(groupsDN(settings.Domain))] = true
+		}
+		return &access, nil
+	}
+
+	ids := []uint32{}
+	for _, group := range s.Groups {
+		ids = append(ids, group.ID)
+	}
+	nested, err := models.NestedGroupIDs(settings.DB, ids)
+	if err != nil || len(nested) == 0 {
+		return &access, err
+	}
+
+	if searchGroups {
+		names := []string{}
+		if err := settings.DB.Model(&models.Group{}).Where("id IN ?", nested).Pluck("name", &names).Error; err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			access.dns[normalizeDN(groupDN(settings.Domain, name))] = true
+		}
+	}
+
+	if searchUsers {
+		usernames := []string{}
+		members := settings.DB.Table("group_members").Select("user_id").Where("group_id IN ?", nested)
+		if err := settings.DB.Model(&models.User{}).Where("id IN (?)", members).Pluck("username", &usernames).Error; err != nil {
+			return nil, err
+		}
+		for _, username := range usernames {
+			access.dns[normalizeDN(userDN(settings.Domain, username))] = true
+		}
+	}
+
+	return &access, nil
+}
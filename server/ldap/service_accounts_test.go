@@ -0,0 +1,214 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	ldapClient "github.com/go-ldap/ldap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	dbPath := uuid.New()
+	l, settings := testSetup(t, dbPath.String(), false, "127.0.0.1:60018")
+	defer testCleanUp(dbPath.String())
+
+	// Private attribute only served to accounts that can read private values
+	name, syntax, visibility, appliesTo := "employeeNumber", "integer", models.AttributePrivate, models.AttributeForUsers
+	if err := settings.DB.Create(&models.Attribute{Name: &name, Syntax: &syntax, Visibility: &visibility, AppliesTo: &appliesTo}).Error; err != nil {
+		t.Fatalf("could not define attribute - %v", err)
+	}
+	changes, err := models.PrepareAttributeChanges(settings.DB, map[string][]string{"employeeNumber": {"42"}}, models.AttributeForUsers)
+	if err != nil {
+		t.Fatalf("could not prepare attribute values - %v", err)
+	}
+	saul := uint32(3)
+	if err := models.ApplyAttributeChanges(settings.DB, changes, &saul, nil); err != nil {
+		t.Fatalf("could not set attribute values - %v", err)
+	}
+
+	newServiceAccount := func(name string, password string, s models.ServiceAccount) *models.ServiceAccount {
+		hash, err := models.Hash(password)
+		if err != nil {
+			t.Fatalf("could not hash password - %v", err)
+		}
+		hashed := string(hash)
+		s.Name = &name
+		s.Password = &hashed
+		if err := settings.DB.Create(&s).Error; err != nil {
+			t.Fatalf("could not create service account %s - %v", name, err)
+		}
+		return &s
+	}
+
+	trueValue, falseValue := true, false
+	var test2 models.Group
+	if err := settings.DB.Where("name = ?", "test2").Take(&test2).Error; err != nil {
+		t.Fatalf("could not find group - %v", err)
+	}
+	newServiceAccount("nextcloud", "nextcloud-secret", models.ServiceAccount{})
+	newServiceAccount("wiki", "wiki-secret", models.ServiceAccount{GroupsOnly: &trueValue, Groups: []*models.Group{&test2}})
+	newServiceAccount("directory", "directory-secret", models.ServiceAccount{SearchGroups: &falseValue, ReadPrivate: &trueValue})
+	newServiceAccount("disabled", "disabled-secret", models.ServiceAccount{Locked: &trueValue})
+	rotated := newServiceAccount("rotated", "new-secret", models.ServiceAccount{})
+
+	previous, err := models.Hash("old-secret")
+	if err != nil {
+		t.Fatalf("could not hash password - %v", err)
+	}
+	settings.DB.Model(rotated).Updates(map[string]interface{}{
+		"previous_password":            string(previous),
+		"previous_password_expires_at": time.Now().Add(time.Hour),
+	})
+
+	// Launch testing servers
+	go func() {
+		for {
+			// Accept new connections
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Handle our server connection
+			go handleConnection(c, settings)
+		}
+	}()
+	defer l.Close()
+
+	waitForTestServer(t, "127.0.0.1:60018")
+
+	connect := func(t *testing.T, dn string, password string) (*ldapClient.Conn, error) {
+		c, err := net.Dial("tcp", "127.0.0.1:60018")
+		if err != nil {
+			t.Fatalf("error connecting to localhost tcp: %v", err)
+		}
+		conn := ldapClient.NewConn(c, false)
+		conn.SetTimeout(3000 * time.Millisecond)
+		conn.Start()
+		return conn, conn.Bind(dn, password)
+	}
+
+	search := func(t *testing.T, conn *ldapClient.Conn, baseDN string, filter string, attributes []string) []*ldapClient.Entry {
+		searchRequest := ldapClient.NewSearchRequest(baseDN, ldapClient.ScopeWholeSubtree, ldapClient.DerefAlways, 0, 0, false, filter, attributes, nil)
+		sr, err := conn.Search(searchRequest)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return sr.Entries
+	}
+
+	names := func(entries []*ldapClient.Entry, attribute string) []string {
+		values := []string{}
+		for _, entry := range entries {
+			values = append(values, entry.GetAttributeValue(attribute))
+		}
+		return values
+	}
+
+	t.Run("service accounts bind with their DN", func(t *testing.T) {
+		conn, err := connect(t, "cn=nextcloud,ou=Services,dc=example,dc=org", "nextcloud-secret")
+		defer conn.Close()
+		assert.NoError(t, err)
+	})
+
+	t.Run("service account names are matched ignoring case", func(t *testing.T) {
+		conn, err := connect(t, "CN=NextCloud,OU=services,DC=example,DC=org", "nextcloud-secret")
+		defer conn.Close()
+		assert.NoError(t, err)
+	})
+
+	t.Run("service accounts migrated from readonly users keep their DN", func(t *testing.T) {
+		conn, err := connect(t, "cn=wiki,dc=example,dc=org", "wiki-secret")
+		defer conn.Close()
+		if !assert.NoError(t, err) {
+			return
+		}
+		groups := search(t, conn, "ou=Groups,dc=example,dc=org", "(cn=*)", []string{"cn"})
+		assert.Equal(t, []string{"test2"}, names(groups, "cn"))
+	})
+
+	t.Run("wrong service account password", func(t *testing.T) {
+		conn, err := connect(t, "cn=nextcloud,ou=Services,dc=example,dc=org", "test")
+		defer conn.Close()
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown service account", func(t *testing.T) {
+		conn, err := connect(t, "cn=saul,ou=Services,dc=example,dc=org", "test")
+		defer conn.Close()
+		assert.Error(t, err)
+	})
+
+	t.Run("service accounts are not users", func(t *testing.T) {
+		conn, err := connect(t, "uid=nextcloud,ou=Users,dc=example,dc=org", "nextcloud-secret")
+		defer conn.Close()
+		assert.Error(t, err)
+	})
+
+	t.Run("locked service accounts can't bind", func(t *testing.T) {
+		conn, err := connect(t, "cn=disabled,ou=Services,dc=example,dc=org", "disabled-secret")
+		defer conn.Close()
+		assert.Error(t, err)
+	})
+
+	t.Run("previous password works during the grace period", func(t *testing.T) {
+		conn, err := connect(t, "cn=rotated,ou=Services,dc=example,dc=org", "old-secret")
+		conn.Close()
+		assert.NoError(t, err)
+
+		conn, err = connect(t, "cn=rotated,ou=Services,dc=example,dc=org", "new-secret")
+		conn.Close()
+		assert.NoError(t, err)
+	})
+
+	t.Run("previous password stops working after the grace period", func(t *testing.T) {
+		settings.DB.Model(rotated).Update("previous_password_expires_at", time.Now().Add(-time.Minute))
+		conn, err := connect(t, "cn=rotated,ou=Services,dc=example,dc=org", "old-secret")
+		defer conn.Close()
+		assert.Error(t, err)
+	})
+
+	t.Run("service accounts search users and groups", func(t *testing.T) {
+		conn, err := connect(t, "cn=nextcloud,ou=Services,dc=example,dc=org", "nextcloud-secret")
+		defer conn.Close()
+		if !assert.NoError(t, err) {
+			return
+		}
+		users := search(t, conn, "ou=Users,dc=example,dc=org", "(uid=*)", []string{"uid", "employeeNumber"})
+		assert.Equal(t, []string{"admin", "search", "saul", "kim", "mike"}, names(users, "uid"))
+		assert.Equal(t, []string{"", "", "", "", ""}, names(users, "employeeNumber"))
+
+		groups := search(t, conn, "ou=Groups,dc=example,dc=org", "(cn=*)", []string{"cn"})
+		assert.Equal(t, []string{"test", "test2"}, names(groups, "cn"))
+	})
+
+	t.Run("service accounts restricted to groups", func(t *testing.T) {
+		conn, err := connect(t, "cn=wiki,ou=Services,dc=example,dc=org", "wiki-secret")
+		defer conn.Close()
+		if !assert.NoError(t, err) {
+			return
+		}
+		users := search(t, conn, "ou=Users,dc=example,dc=org", "(uid=*)", []string{"uid"})
+		assert.Equal(t, []string{"kim"}, names(users, "uid"))
+
+		groups := search(t, conn, "ou=Groups,dc=example,dc=org", "(cn=*)", []string{"cn"})
+		assert.Equal(t, []string{"test2"}, names(groups, "cn"))
+	})
+
+	t.Run("service accounts without group search permission", func(t *testing.T) {
+		conn, err := connect(t, "cn=directory,ou=Services,dc=example,dc=org", "directory-secret")
+		defer conn.Close()
+		if !assert.NoError(t, err) {
+			return
+		}
+		groups := search(t, conn, "ou=Groups,dc=example,dc=org", "(cn=*)", []string{"cn"})
+		assert.Empty(t, groups)
+
+		users := search(t, conn, "ou=Users,dc=example,dc=org", "(employeeNumber=42)", []string{"uid", "employeeNumber"})
+		assert.Equal(t, []string{"saul"}, names(users, "uid"))
+		assert.Equal(t, []string{"42"}, names(users, "employeeNumber"))
+	})
+}
@@ -1,7 +1,6 @@
 package ldap
 
 import (
-	"fmt"
 	"regexp"
 	"strings"
 
@@ -14,175 +13,169 @@ type userQueryParams struct {
 	db             *gorm.DB
 	filter         string
 	originalFilter string
-	attributes     string
+	attributes     attributeSelection
 	messageID      int64
 	domain         string
 	limit          int
 	offset         int
+	private        bool
+	username       string
 }
 
-func userEntry(user models.User, attributes string, domain string) map[string][]string {
-	attrs := make(map[string]string)
-	for _, a := range strings.Split(attributes, " ") {
-		attrs[a] = a
-	}
-
-	_, operational := attrs["+"]
-
-	values := map[string][]string{}
-
-	_, ok := attrs["structuralObjectClass"]
-	if ok || operational {
-		values["structuralObjectClass"] = []string{"inetOrgPerson"}
-	}
-
-	_, ok = attrs["entryUUID"]
-	if ok || operational {
-		values["entryUUID"] = []string{*user.UUID}
-	}
-
-	_, ok = attrs["creatorsName"]
-	if ok || operational {
-		creator := *user.CreatedBy
-		createdBy := ""
-		if creator == "admin" {
-			createdBy = fmt.Sprintf("cn=admin,%s", domain)
-		} else {
-			createdBy = fmt.Sprintf("uid=%s,ou=Users,%s", creator, domain)
-		}
-		values["creatorsName"] = []string{createdBy}
-	}
-
-	_, ok = attrs["createTimestamp"]
-	if ok || operational {
-		values["createTimestamp"] = []string{user.CreatedAt.Format("20060102150405Z")}
-	}
-
-	_, ok = attrs["creatorsName"]
-	if ok || operational {
-		modifier := *user.UpdatedBy
-		updatedBy := ""
-		if modifier == "admin" {
-			updatedBy = fmt.Sprintf("cn=admin,%s", domain)
-		} else {
-			updatedBy = fmt.Sprintf("uid=%s,ou=Users,%s", modifier, domain)
-		}
-		values["modifiersName"] = []string{updatedBy}
-	}
-
-	_, ok = attrs["modifyTimestamp"]
-	if ok || operational {
-		values["modifyTimestamp"] = []string{user.UpdatedAt.Format("20060102150405Z")}
-	}
-
-	_, ok = attrs["objectClass"]
-	if attributes == "ALL" || ok || operational {
-		values["objectClass"] = []string{"top", "person", "inetOrgPerson", "organizationalPerson", "ldapPublicKey", "posixAccount"}
-	}
-
-	if attributes == "ALL" || attrs["uid"] != "" || attrs["inetOrgPerson"] != "" || operational {
-		if user.Username != nil {
-			values["uid"] = []string{*user.Username}
-		}
-	}
-
-	if attributes == "ALL" || attrs["cn"] != "" || attrs["inetOrgPerson"] != "" || operational {
-		if user.GivenName != nil && user.Surname != nil {
-			values["cn"] = []string{*user.Name}
-		}
-	}
-
-	_, ok = attrs["sn"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.Surname != nil {
-			values["sn"] = []string{*user.Surname}
-		}
-	}
-
-	_, ok = attrs["givenName"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.GivenName != nil {
-			values["givenName"] = []string{*user.GivenName}
-		}
-	}
-
-	_, ok = attrs["mail"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.Email != nil {
-			values["mail"] = []string{*user.Email}
-		}
-	}
-
-	_, ok = attrs["SshPublicKey"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.SSHPublicKey != nil {
-			values["SshPublicKey"] = []string{*user.SSHPublicKey}
-		}
-	}
-
-	_, ok = attrs["jpegPhoto"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.JPEGPhoto != nil {
-			values["jpegPhoto"] = []string{*user.JPEGPhoto}
-		}
-	}
-
-	_, ok = attrs["jpegphoto"]
-	if attributes == "ALL" || ok || attrs["inetOrgPerson"] != "" || operational {
-		if user.JPEGPhoto != nil {
-			values["jpegphoto"] = []string{*user.JPEGPhoto}
-		}
-	}
-	_, ok = attrs["memberof"]
-	if attributes == "ALL" || ok {
-		groups := []string{}
-		for _, memberOf := range user.MemberOf {
-			groups = append(groups, fmt.Sprintf("cn=%s,ou=Groups,dc=example,dc=org", *memberOf.Name))
-		}
-
-		values["memberof"] = groups
+// userAttributes - attributes of user entries
+var userAttributes = append([]attributeMapping{
+	{
+		name:          "objectClass",
+		objectClasses: []string{"top"},
+		values: func(e *entrySource) []string {
+			return []string{"top", "person", "inetOrgPerson", "organizationalPerson", "ldapPublicKey", "posixAccount"}
+		},
+	},
+	{
+		name:          "uid",
+		aliases:       []string{"userid"},
+		objectClasses: []string{"inetOrgPerson", "posixAccount"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.Username) },
+	},
+	{
+		name:          "cn",
+		aliases:       []string{"commonName"},
+		objectClasses: []string{"person", "posixAccount"},
+		values: func(e *entrySource) []string {
+			if e.user.GivenName == nil || e.user.Surname == nil {
+				return nil
+			}
+			return stringValue(e.user.Name)
+		},
+	},
+	{
+		name:          "sn",
+		aliases:       []string{"surname"},
+		objectClasses: []string{"person"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.Surname) },
+	},
+	{
+		name:          "givenName",
+		aliases:       []string{"gn"},
+		objectClasses: []string{"inetOrgPerson"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.GivenName) },
+	},
+	{
+		name:          "mail",
+		aliases:       []string{"email", "rfc822Mailbox"},
+		objectClasses: []string{"inetOrgPerson"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.Email) },
+	},
+	{
+		name:          "sshPublicKey",
+		objectClasses: []string{"ldapPublicKey"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.SSHPublicKey) },
+	},
+	{
+		name:          "uidNumber",
+		objectClasses: []string{"posixAccount"},
+		values:        func(e *entrySource) []string { return numberValue(e.user.UIDNumber) },
+	},
+	{
+		name:          "gidNumber",
+		objectClasses: []string{"posixAccount"},
+		values:        func(e *entrySource) []string { return numberValue(e.user.GIDNumber) },
+	},
+	{
+		name:          "homeDirectory",
+		objectClasses: []string{"posixAccount"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.HomeDirectory) },
+	},
+	{
+		name:          "loginShell",
+		objectClasses: []string{"posixAccount"},
+		values:        func(e *entrySource) []string { return stringValue(e.user.LoginShell) },
+	},
+	{
+		name:          "jpegPhoto",
+		binary:        true,
+		objectClasses: []string{"inetOrgPerson"},
+		values: func(e *entrySource) []string {
+			// Photos are stored base64 encoded
+			if e.user.JPEGPhoto == nil {
+				return nil
+			}
+			jpeg, err := decodeBase64(*e.user.JPEGPhoto)
+			if err != nil || len(jpeg) == 0 {
+				return nil
+			}
+			return []string{string(jpeg)}
+		},
+	},
+	{
+		name: "memberOf",
+		values: func(e *entrySource) []string {
+			groups := []string{}
+			for _, memberOf := range e.user.MemberOf {
+				groups = append(groups, groupDN(e.domain, *memberOf.Name))
+			}
+			return groups
+		},
+	},
+}, operationalAttributes...)
+
+func userEntry(user models.User, attributes attributeSelection, domain string, custom ...attributeMapping) map[string][]string {
+	e := entrySource{
+		dn:         userDN(domain, *user.Username),
+		structural: "inetOrgPerson",
+		uuid:       user.UUID,
+		createdBy:  user.CreatedBy,
+		createdAt:  user.CreatedAt,
+		updatedBy:  user.UpdatedBy,
+		updatedAt:  user.UpdatedAt,
+		domain:     domain,
+		user:       &user,
 	}
+	return attributes.entryValues(append(userAttributes[:len(userAttributes):len(userAttributes)], custom...), &e)
+}
 
-	_, ok = attrs["memberOf"]
-	if attributes == "ALL" || ok {
-		groups := []string{}
-		for _, memberOf := range user.MemberOf {
-			groups = append(groups, fmt.Sprintf("cn=%s,ou=Groups,dc=example,dc=org", *memberOf.Name))
-		}
-
-		_, ok = attrs["memberof"]
-		if attributes == "ALL" || ok {
-			delete(values, "memberof")
+// memberOfDN checks if a user is a direct member of a group with one of
+// the given DNs
+func memberOfDN(user models.User, dns []string, domain string) bool {
+	for _, group := range user.MemberOf {
+		for _, dn := range dns {
+			if equalDN(dn, groupDN(domain, *group.Name)) {
+				return true
+			}
 		}
-		values["memberOf"] = groups
 	}
+	return false
+}
 
-	_, ok = attrs["entryDN"]
-	if ok || operational {
-		if user.Username != nil {
-			values["entryDN"] = []string{fmt.Sprintf("uid=%s,ou=Users,%s", *user.Username, domain)}
+// memberOfIDs checks if a user is a direct member of a group in ids
+func memberOfIDs(user models.User, ids map[uint32]bool) bool {
+	for _, group := range user.MemberOf {
+		if ids[group.ID] {
+			return true
 		}
 	}
-
-	_, ok = attrs["subschemaSubentry"]
-	if ok || operational {
-		values["subschemaSubentry"] = []string{"cn=Subschema"}
-	}
-
-	_, ok = attrs["hasSubordinates"]
-	if ok || operational {
-		values["hasSubordinates"] = []string{"FALSE"}
-	}
-
-	return values
+	return false
 }
 
 func getUsersFromDB(params userQueryParams) ([]*ber.Packet, *ServerError, int, int64) {
 	var r []*ber.Packet
 	users := []models.User{}
 
-	params.db = params.db.Preload("MemberOf").Model(&models.User{})
-	analyzeUsersCriteria(params.db, params.filter, false, "", 0)
+	custom, customErr := customAttributes(params.db, models.AttributeForUsers, params.private)
+	if customErr != nil {
+		return nil, &ServerError{
+			Msg:  "could not retrieve information from database",
+			Code: Other,
+		}, 0, 0
+	}
+
+	params.db = params.db.Preload("MemberOf").Preload("Attributes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Model(&models.User{})
+	analyzeUsersCriteria(params.db, params.filter, false, "", 0, params.private)
+	if params.username != "" {
+		params.db.Where("username_folded = ?", models.FoldIdentity(params.username))
+	}
 
 	allResults := params.db.Find(&users)
 	if allResults.Error != nil {
@@ -207,50 +200,43 @@ func getUsersFromDB(params userQueryParams) ([]*ber.Packet, *ServerError, int, i
 		}, 0, 0
 	}
 
-	filterGroup, _ := regexp.Compile(fmt.Sprintf("member[oO]f=cn=([A-Za-z.0-9-]+),ou=Groups,%s", params.domain))
-	matches := []string{}
-	if filterGroup.MatchString(params.originalFilter) {
-		matches = filterGroup.FindAllString(params.originalFilter, -1)
+	matches := filterValues(params.originalFilter, "memberOf")
+
+	// Memberships through nested groups
+	chained, chainErr := groupsInChain(params.db, params.domain, inChainValues(params.originalFilter, "memberOf"), true)
+	if chainErr != nil {
+		return nil, &ServerError{
+			Msg:  "could not retrieve information from database",
+			Code: Other,
+		}, 0, 0
 	}
 
 	for _, user := range users {
-		if *user.Username != "admin" && !*user.Readonly {
-			if len(matches) > 0 {
-			GroupsLoop:
-				for _, group := range user.MemberOf {
-					for _, match := range matches {
-						if fmt.Sprintf("memberOf=cn=%s,ou=Groups,%s", *group.Name, params.domain) == match || fmt.Sprintf("memberof=cn=%s,ou=Groups,%s", *group.Name, params.domain) == match {
-							dn := fmt.Sprintf("uid=%s,ou=Users,%s", *user.Username, params.domain)
-							values := userEntry(user, params.attributes, params.domain)
-							e := encodeSearchResultEntry(params.messageID, values, dn)
-							r = append(r, e)
-							break GroupsLoop
-						}
-					}
-				}
-			} else {
-				dn := fmt.Sprintf("uid=%s,ou=Users,%s", *user.Username, params.domain)
-				values := userEntry(user, params.attributes, params.domain)
-				e := encodeSearchResultEntry(params.messageID, values, dn)
-				r = append(r, e)
-			}
+		if len(matches) > 0 && !memberOfDN(user, matches, params.domain) {
+			continue
 		}
-
+		if chained != nil && !memberOfIDs(user, chained) {
+			continue
+		}
+		dn := userDN(params.domain, *user.Username)
+		values := userEntry(user, params.attributes, params.domain, custom...)
+		e := encodeSearchResultEntry(params.messageID, values, dn)
+		r = append(r, e)
 	}
 
 	return r, nil, len(users), totalResults
 }
 
-func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOperator string, index int) {
+func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOperator string, index int, private bool) {
 	if boolean {
 
-		re := regexp.MustCompile(`\(\|(.*)\)|\(\&(.*)\)|\(\!(.*)\)|\(([a-zA-Z=\ \.*]*)\)*`)
+		re := regexp.MustCompile(`\(\|(.*)\)|\(\&(.*)\)|\(\!(.*)\)|\(([a-zA-Z0-9=\ \.*@+_,:'/\-]*)\)*`)
 		submatchall := re.FindAllString(filter, -1)
 
 		for index, element := range submatchall {
 			element = strings.TrimPrefix(element, "(")
 			element = strings.TrimSuffix(element, ")")
-			analyzeUsersCriteria(db, element, false, booleanOperator, index)
+			analyzeUsersCriteria(db, element, false, booleanOperator, index, private)
 		}
 
 	} else {
@@ -258,34 +244,34 @@ func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOpera
 		case strings.HasPrefix(filter, "(") && strings.HasSuffix(filter, ")"):
 			element := strings.TrimPrefix(filter, "(")
 			element = strings.TrimSuffix(element, ")")
-			analyzeUsersCriteria(db, element, false, "", 0)
+			analyzeUsersCriteria(db, element, false, "", 0, private)
 
 		case strings.HasPrefix(filter, "&"):
 			element := strings.TrimPrefix(filter, "&")
-			analyzeUsersCriteria(db, element, true, "and", 0)
+			analyzeUsersCriteria(db, element, true, "and", 0, private)
 
 		case strings.HasPrefix(filter, "|"):
 			element := strings.TrimPrefix(filter, "|")
-			analyzeUsersCriteria(db, element, true, "or", 0)
+			analyzeUsersCriteria(db, element, true, "or", 0, private)
 
 		case strings.HasPrefix(filter, "!"):
 			element := strings.TrimPrefix(filter, "!")
-			analyzeUsersCriteria(db, element, true, "not", 0)
+			analyzeUsersCriteria(db, element, true, "not", 0, private)
 
 		case strings.HasPrefix(filter, "uid="):
 			element := strings.TrimPrefix(filter, "uid=")
 			if strings.Contains(element, "*") {
 				element = strings.Replace(element, "*", "%", -1)
 				if index == 0 {
-					db.Where("username LIKE ?", element)
+					db.Where("username_folded LIKE ?", models.FoldIdentity(element))
 				} else {
-					db.Or("username LIKE ?", element)
+					db.Or("username_folded LIKE ?", models.FoldIdentity(element))
 				}
 			} else {
 				if index == 0 {
-					db.Where("username = ?", element)
+					db.Where("username_folded = ?", models.FoldIdentity(element))
 				} else {
-					db.Or("username = ?", element)
+					db.Or("username_folded = ?", models.FoldIdentity(element))
 				}
 			}
 
@@ -294,15 +280,15 @@ func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOpera
 			if strings.Contains(element, "*") {
 				element = strings.Replace(element, "*", "%", -1)
 				if index == 0 {
-					db.Where("email LIKE ?", element)
+					db.Where("email_folded LIKE ?", models.FoldIdentity(element))
 				} else {
-					db.Or("email LIKE ?", element)
+					db.Or("email_folded LIKE ?", models.FoldIdentity(element))
 				}
 			} else {
 				if index == 0 {
-					db.Where("email = ?", element)
+					db.Where("email_folded = ?", models.FoldIdentity(element))
 				} else {
-					db.Or("email = ?", element)
+					db.Or("email_folded = ?", models.FoldIdentity(element))
 				}
 			}
 
@@ -311,18 +297,24 @@ func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOpera
 			if strings.Contains(element, "*") {
 				element = strings.Replace(element, "*", "%", -1)
 				if index == 0 {
-					db.Where("email LIKE ?", element)
+					db.Where("email_folded LIKE ?", models.FoldIdentity(element))
 				} else {
-					db.Or("email LIKE ?", element)
+					db.Or("email_folded LIKE ?", models.FoldIdentity(element))
 				}
 			} else {
 				if index == 0 {
-					db.Where("email = ?", element)
+					db.Where("email_folded = ?", models.FoldIdentity(element))
 				} else {
-					db.Or("email = ?", element)
+					db.Or("email_folded = ?", models.FoldIdentity(element))
 				}
 			}
 
+		case strings.HasPrefix(filter, "uidNumber="):
+			numberCriteria(db, "uid_number", strings.TrimPrefix(filter, "uidNumber="), index)
+
+		case strings.HasPrefix(filter, "gidNumber="):
+			numberCriteria(db, "gid_number", strings.TrimPrefix(filter, "gidNumber="), index)
+
 		case strings.HasPrefix(filter, "sn="):
 			element := strings.TrimPrefix(filter, "sn=")
 			if strings.Contains(element, "*") {
@@ -407,6 +399,9 @@ func analyzeUsersCriteria(db *gorm.DB, filter string, boolean bool, booleanOpera
 					db.Or("jpeg_photo = ?", element)
 				}
 			}
+
+		default:
+			customCriteria(db, filter, models.AttributeForUsers, index, private)
 		}
 
 	}
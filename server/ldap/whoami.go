@@ -12,6 +12,10 @@ func HandleExtRequest(message *Message, username string) (*ber.Packet, error) {
 
 	id := message.ID
 	p := message.Request
+
+	if err := proxiedAuthorizationNotSupported(message); err != nil {
+		return encodeExtendedResponse(id, err.Code, "", ""), errors.New(err.Msg)
+	}
 	n, err := requestName(p[0])
 	if err != nil {
 		return encodeExtendedResponse(id, err.Code, "", ""), errors.New(err.Msg)
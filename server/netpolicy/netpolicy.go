@@ -0,0 +1,176 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netpolicy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Operations a network policy can be applied to
+const (
+	// Anonymous - reaching the server, i.e accepting LDAP connections or
+	// serving unauthenticated REST endpoints like login
+	Anonymous = "anonymous"
+	// User - LDAP binds and authenticated REST endpoints
+	User = "user"
+	// Manager - LDAP binds with manager accounts and REST endpoints that
+	// require manager permissions
+	Manager = "manager"
+)
+
+// Actions for a network rule
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Policy decides if a client address may perform an operation. Denied
+// networks take precedence, if no allowed networks are set any address
+// not denied is allowed
+type Policy struct {
+	Allowed []*net.IPNet
+	Denied  []*net.IPNet
+}
+
+// Policies are the network policies for every operation
+type Policies struct {
+	Anonymous Policy
+	User      Policy
+	Manager   Policy
+}
+
+// Host returns the IP address from a host:port address
+func Host(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// parseNetwork parses a CIDR or a single IP address
+func parseNetwork(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("wrong network %s", s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("wrong network %s", s)
+	}
+	return network, nil
+}
+
+// ParseNetworks parses a list of CIDRs or single IP addresses
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, s := range list {
+		network, err := parseNetwork(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Add parses a rule using the operation:action:cidr[,cidr...] format
+// e.g manager:allow:10.0.0.0/24,192.168.1.10 and adds it to the policies
+func (p *Policies) Add(definition string) error {
+	parts := strings.SplitN(definition, ":", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("wrong network rule %s, expected operation:action:cidr[,cidr...]", definition)
+	}
+
+	var policy *Policy
+	switch strings.TrimSpace(parts[0]) {
+	case Anonymous:
+		policy = &p.Anonymous
+	case User:
+		policy = &p.User
+	case Manager:
+		policy = &p.Manager
+	default:
+		return fmt.Errorf("wrong operation %s in network rule %s, expected anonymous, user or manager", parts[0], definition)
+	}
+
+	action := strings.TrimSpace(parts[1])
+	if action != Allow && action != Deny {
+		return fmt.Errorf("wrong action %s in network rule %s, expected allow or deny", parts[1], definition)
+	}
+
+	for _, cidr := range strings.Split(parts[2], ",") {
+		network, err := parseNetwork(cidr)
+		if err != nil {
+			return fmt.Errorf("%v in network rule %s", err, definition)
+		}
+		if action == Allow {
+			policy.Allowed = append(policy.Allowed, network)
+		} else {
+			policy.Denied = append(policy.Denied, network)
+		}
+	}
+	return nil
+}
+
+// Allows checks if a client address is allowed by the policy, the address
+// may include a port
+func (p Policy) Allows(addr string) bool {
+	ip := net.ParseIP(Host(addr))
+	if ip == nil {
+		return len(p.Allowed) == 0 && len(p.Denied) == 0
+	}
+
+	for _, network := range p.Denied {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	for _, network := range p.Allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Operation returns the policy for an operation
+func (p Policies) Operation(operation string) Policy {
+	switch operation {
+	case User:
+		return p.User
+	case Manager:
+		return p.Manager
+	}
+	return p.Anonymous
+}
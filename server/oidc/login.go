@@ -0,0 +1,77 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"html/template"
+	"io"
+)
+
+// loginTemplate is the minimal login page shown by the authorization endpoint
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Glim - Sign in</title>
+<style>
+body { font-family: sans-serif; background: #f4f4f5; display: flex; justify-content: center; padding-top: 10vh; }
+form { background: #fff; padding: 2em; border-radius: 6px; box-shadow: 0 1px 3px rgba(0,0,0,.2); width: 20em; }
+label, input { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .3em 0 1em; padding: .5em; }
+button { width: 100%; padding: .6em; }
+.error { color: #b91c1c; }
+</style>
+</head>
+<body>
+<form method="post">
+<h2>Sign in to {{.ClientName}}</h2>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<label for="username">Username</label>
+<input id="username" name="username" value="{{.Username}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<label for="totp_code">Two-factor authentication code (if enabled)</label>
+<input id="totp_code" name="totp_code" inputmode="numeric" autocomplete="one-time-code">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="login_token" value="{{.LoginToken}}">
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// LoginPage - data shown in the login page
+type LoginPage struct {
+	ClientName string
+	Username   string
+	Error      string
+	LoginToken string
+	Request    AuthorizationRequest
+}
+
+// RenderLoginPage writes the login page
+func RenderLoginPage(w io.Writer, page LoginPage) error {
+	return loginTemplate.Execute(w, page)
+}
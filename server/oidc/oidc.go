@@ -0,0 +1,235 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/doncicuto/glim/models"
+)
+
+// Endpoint paths served by the OIDC provider
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	JWKSPath          = "/.well-known/jwks.json"
+	AuthorizationPath = "/oidc/authorize"
+	TokenPath         = "/oidc/token"
+	UserInfoPath      = "/oidc/userinfo"
+	IntrospectionPath = "/oidc/introspect"
+	RevocationPath    = "/oidc/revoke"
+)
+
+// CodeChallengeMethod is the only PKCE method we accept
+const CodeChallengeMethod = "S256"
+
+// CodeExpiry is the number of seconds an authorization code can be used
+const CodeExpiry = 60
+
+// LoginTokenCookie is the cookie that ties a login form to the browser it
+// was shown to
+const LoginTokenCookie = "glim_oidc_login"
+
+// LoginTokenExpiry is the number of seconds a login form can be submitted
+const LoginTokenExpiry = 600
+
+// Scopes supported by the OIDC provider
+var Scopes = []string{"openid", "profile", "email", "groups"}
+
+// Discovery - OpenID Provider metadata as described in OpenID Connect Discovery 1.0
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// NewDiscovery returns the metadata for an issuer
+func NewDiscovery(issuer string, algorithm string) Discovery {
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + AuthorizationPath,
+		TokenEndpoint:                     issuer + TokenPath,
+		UserInfoEndpoint:                  issuer + UserInfoPath,
+		JWKSURI:                           issuer + JWKSPath,
+		IntrospectionEndpoint:             issuer + IntrospectionPath,
+		RevocationEndpoint:                issuer + RevocationPath,
+		ScopesSupported:                   Scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeMethod},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "given_name", "family_name", "preferred_username", "email", "groups"},
+	}
+}
+
+// AuthorizationRequest - parameters of an authorization request that we
+// keep with the authorization code until it's exchanged for tokens
+type AuthorizationRequest struct {
+	ClientID            string `json:"client_id" form:"client_id" query:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" query:"redirect_uri"`
+	ResponseType        string `json:"response_type" form:"response_type" query:"response_type"`
+	Scope               string `json:"scope" form:"scope" query:"scope"`
+	State               string `json:"state" form:"state" query:"state"`
+	Nonce               string `json:"nonce" form:"nonce" query:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method" query:"code_challenge_method"`
+	UID                 uint32 `json:"uid" form:"-" query:"-"`
+	AuthTime            int64  `json:"auth_time" form:"-" query:"-"`
+}
+
+// TokenResponse - response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   uint   `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// IntrospectionResponse - token information as described in RFC 7662
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// Error - OAuth 2.0 error response
+type Error struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// CodeKey returns the key-value store key for an authorization code
+func CodeKey(code string) string {
+	return fmt.Sprintf("oidc-code-%s", code)
+}
+
+// LoginTokenKey returns the key-value store key for a login form token
+func LoginTokenKey(token string) string {
+	return fmt.Sprintf("oidc-login-%s", token)
+}
+
+// Fingerprint returns a hash of the parameters sent by the client, a login
+// form token can only be used with the request it was issued for
+func (r AuthorizationRequest) Fingerprint() string {
+	params := []string{r.ClientID, r.RedirectURI, r.ResponseType, r.Scope, r.State, r.Nonce, r.CodeChallenge, r.CodeChallengeMethod}
+	sum := sha256.Sum256([]byte(strings.Join(params, "\n")))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// GenerateCode returns a new random authorization code
+func GenerateCode() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against its S256 challenge
+func VerifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// HasScope checks if a space-separated list of scopes contains a scope
+func HasScope(scopes string, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterScopes removes the scopes we don't support
+func FilterScopes(scopes string) string {
+	filtered := []string{}
+	for _, s := range strings.Fields(scopes) {
+		for _, supported := range Scopes {
+			if s == supported && !HasScope(strings.Join(filtered, " "), s) {
+				filtered = append(filtered, s)
+			}
+		}
+	}
+	return strings.Join(filtered, " ")
+}
+
+// UserClaims returns the claims about a user granted by the scopes. Groups
+// are taken from User.MemberOf so it must be preloaded
+func UserClaims(u *models.User, scopes string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	claims["sub"] = fmt.Sprintf("%d", u.ID)
+
+	if HasScope(scopes, "profile") {
+		claims["preferred_username"] = stringValue(u.Username)
+		claims["name"] = stringValue(u.Name)
+		claims["given_name"] = stringValue(u.GivenName)
+		claims["family_name"] = stringValue(u.Surname)
+	}
+
+	if HasScope(scopes, "email") {
+		claims["email"] = stringValue(u.Email)
+	}
+
+	if HasScope(scopes, "groups") {
+		groups := []string{}
+		for _, g := range u.MemberOf {
+			groups = append(groups, stringValue(g.Name))
+		}
+		claims["groups"] = groups
+	}
+
+	return claims
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
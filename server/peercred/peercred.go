@@ -0,0 +1,124 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peercred
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ErrNotSupported - peer credentials can't be read on this platform
+var ErrNotSupported = errors.New("peer credentials are not supported on this platform")
+
+// Credentials of the process connected to a Unix domain socket
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// String returns a description of the credentials for our logs
+func (c Credentials) String() string {
+	return fmt.Sprintf("pid=%d,uid=%d,gid=%d", c.PID, c.UID, c.GID)
+}
+
+// Mapping tells us which Glim user a local OS user or group is. Users are
+// checked before groups
+type Mapping struct {
+	Users  map[uint32]string
+	Groups map[uint32]string
+}
+
+// Add parses a rule defined as user=username or @group=username where user
+// and group are OS names or numeric ids e.g root=admin or @backup=backup
+func (m *Mapping) Add(rule string) error {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[0] == "@" || parts[1] == "" {
+		return fmt.Errorf("wrong ldapi mapping rule %s, expected user=username or @group=username", rule)
+	}
+
+	if group, ok := strings.CutPrefix(parts[0], "@"); ok {
+		gid, err := lookupGroup(group)
+		if err != nil {
+			return err
+		}
+		if m.Groups == nil {
+			m.Groups = map[uint32]string{}
+		}
+		m.Groups[gid] = parts[1]
+		return nil
+	}
+
+	uid, err := lookupUser(parts[0])
+	if err != nil {
+		return err
+	}
+	if m.Users == nil {
+		m.Users = map[uint32]string{}
+	}
+	m.Users[uid] = parts[1]
+	return nil
+}
+
+// Empty checks if there are no rules
+func (m Mapping) Empty() bool {
+	return len(m.Users) == 0 && len(m.Groups) == 0
+}
+
+// Identity returns the Glim username of a peer
+func (m Mapping) Identity(c Credentials) (string, bool) {
+	if username, ok := m.Users[c.UID]; ok {
+		return username, true
+	}
+	if username, ok := m.Groups[c.GID]; ok {
+		return username, true
+	}
+	return "", false
+}
+
+func lookupUser(name string) (uint32, error) {
+	if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(uid), nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown OS user %s", name)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("OS user %s has no numeric uid", name)
+	}
+	return uint32(uid), nil
+}
+
+func lookupGroup(name string) (uint32, error) {
+	if gid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown OS group %s", name)
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("OS group %s has no numeric gid", name)
+	}
+	return uint32(gid), nil
+}
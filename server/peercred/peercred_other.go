@@ -0,0 +1,29 @@
+//go:build !linux
+
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peercred
+
+import "net"
+
+// Get reads the credentials of a Unix domain socket connection
+func Get(c net.Conn) (*Credentials, error) {
+	if _, ok := c.(*net.UnixConn); !ok {
+		return nil, nil
+	}
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store is the part of Glim's key-value store used to keep the failed
+// attempts counters, so limits are shared by instances using Redis
+type Store interface {
+	Get(k string) (v string, found bool, err error)
+	Set(k string, v string, expiration time.Duration) error
+	Increment(k string, expiration time.Duration) (count int64, err error)
+}
+
+// Limiter throttles authentication attempts. Every key (source IP, username)
+// is allowed a burst of failed attempts in a window, once the burst is
+// exceeded attempts are rejected until a new window has passed
+type Limiter struct {
+	store  Store
+	burst  int64
+	window time.Duration
+}
+
+// New creates a limiter, a nil limiter is returned if burst or window are
+// not positive as rate limiting is disabled
+func New(store Store, burst int, window time.Duration) *Limiter {
+	if store == nil || burst <= 0 || window <= 0 {
+		return nil
+	}
+	return &Limiter{store: store, burst: int64(burst), window: window}
+}
+
+// IPKey returns the key used to throttle a source IP address
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// UserKey returns the key used to throttle a username
+func UserKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func counterKey(key string) string {
+	return "ratelimit-" + key
+}
+
+func blockKey(key string) string {
+	return "ratelimit-block-" + key
+}
+
+// Blocked returns how long we have to wait before trying again if any of
+// the keys is being throttled, zero means that the attempt is allowed
+func (l *Limiter) Blocked(keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	if l == nil {
+		return wait, nil
+	}
+
+	for _, key := range keys {
+		val, found, err := l.store.Get(blockKey(key))
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			continue
+		}
+		until, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			continue
+		}
+		if remaining := time.Until(time.Unix(until, 0)); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for every key, keys exceeding the burst
+// are blocked for a window
+func (l *Limiter) Fail(keys ...string) error {
+	if l == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		count, err := l.store.Increment(counterKey(key), l.window)
+		if err != nil {
+			return err
+		}
+		if count >= l.burst {
+			until := time.Now().Add(l.window).Unix()
+			if err := l.store.Set(blockKey(key), strconv.FormatInt(until, 10), l.window); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
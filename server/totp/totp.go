@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits of a TOTP code
+	Digits = 6
+	// Period is the number of seconds a TOTP code is valid
+	Period = 30
+	// Skew is the number of periods before and after the current one that we accept
+	Skew = 1
+	// Issuer is shown by authenticator apps next to the account name
+	Issuer = "Glim"
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a new random base32 encoded secret (160 bits, as recommended by RFC 4226)
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(secret), nil
+}
+
+// Counter returns the RFC 6238 time step for a given time
+func Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / Period
+}
+
+// Code computes the RFC 4226 HOTP code for a base32 secret and a counter
+func Code(secret string, counter uint64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("wrong TOTP secret: %v", err)
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate checks a code against a secret at a given time. It returns the
+// counter that matched so callers can prevent that code from being used again
+func Validate(secret string, code string, t time.Time) (uint64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Counter(t)
+	for i := -Skew; i <= Skew; i++ {
+		counter := uint64(int64(current) + int64(i))
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth:// URI that authenticator apps read from QR codes
+func ProvisioningURI(secret string, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", Issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", Digits))
+	v.Set("period", fmt.Sprintf("%d", Period))
+
+	label := url.PathEscape(fmt.Sprintf("%s:%s", Issuer, account))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
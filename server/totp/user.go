@@ -0,0 +1,178 @@
+/*
+Copyright © 2022 Miguel Ángel Álvarez Cabrerizo <mcabrerizo@sologitops.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doncicuto/glim/models"
+	"github.com/doncicuto/glim/types"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodes is the number of recovery codes generated on enrollment
+const RecoveryCodes = 10
+
+// ErrInvalidCode is returned when neither a TOTP code nor a recovery code matches
+var ErrInvalidCode = errors.New("wrong two-factor authentication code")
+
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// recoveryCodeLength is the number of characters in a recovery code, about
+// 79 bits of entropy so a plain SHA-256 hash is enough to store them
+const recoveryCodeLength = 16
+
+// randomRecoveryCode picks characters from the recovery alphabet using
+// rejection sampling so every character is equally likely
+func randomRecoveryCode() (string, error) {
+	limit := 256 - 256%len(recoveryAlphabet)
+	code := make([]byte, 0, recoveryCodeLength)
+	buf := make([]byte, recoveryCodeLength)
+
+	for len(code) < recoveryCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit || len(code) == recoveryCodeLength {
+				continue
+			}
+			code = append(code, recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+		}
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s", code[:4], code[4:8], code[8:12], code[12:]), nil
+}
+
+// hashRecoveryCode returns the hex-encoded SHA-256 hash of a recovery code.
+// Codes are random and long so a slow password hash isn't needed and failed
+// logins stay cheap
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes creates a list of single-use recovery codes and
+// a comma-separated list of their hashes to be stored in the database
+func GenerateRecoveryCodes() ([]string, string, error) {
+	codes := []string{}
+	hashes := []string{}
+
+	for i := 0; i < RecoveryCodes; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, "", err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, strings.Join(hashes, ","), nil
+}
+
+// Enabled tells us if a user has finished the TOTP enrollment
+func Enabled(u *models.User) bool {
+	return u.TOTPEnabled != nil && *u.TOTPEnabled && u.TOTPSecret != nil && *u.TOTPSecret != ""
+}
+
+// Required tells us if a user is a member of a group that requires
+// two-factor authentication. MemberOf must have been preloaded
+func Required(u *models.User) bool {
+	for _, g := range u.MemberOf {
+		if g.RequireMFA != nil && *g.RequireMFA {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCode checks the TOTP secret stored for a user (encrypted with key)
+// against a code. Accepted codes are remembered in the key-value store so
+// they can't be replayed while they're still valid
+func VerifyCode(kv types.Store, key string, u *models.User, code string) error {
+	if u.TOTPSecret == nil || *u.TOTPSecret == "" {
+		return ErrInvalidCode
+	}
+
+	secret, err := Decrypt(key, *u.TOTPSecret)
+	if err != nil {
+		return err
+	}
+
+	counter, ok := Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	// The counter is incremented atomically so only the first of several
+	// concurrent requests using the same code is accepted
+	replayKey := fmt.Sprintf("totp-%d-%d", u.ID, counter)
+	uses, err := kv.Increment(replayKey, time.Duration((2*Skew+1)*Period)*time.Second)
+	if err != nil {
+		return err
+	}
+	if uses > 1 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// Verify accepts either a TOTP code or one of the user's recovery codes.
+// Recovery codes are removed from the database once used
+func Verify(db *gorm.DB, kv types.Store, key string, u *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidCode
+	}
+
+	if len(code) == Digits {
+		return VerifyCode(kv, key, u, code)
+	}
+
+	if u.TOTPRecoveryCodes == nil || *u.TOTPRecoveryCodes == "" {
+		return ErrInvalidCode
+	}
+
+	hashed := hashRecoveryCode(code)
+	hashes := strings.Split(*u.TOTPRecoveryCodes, ",")
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(hashed)) == 1 {
+			// The update only succeeds if nobody used a code since we read
+			// them, so a code can't be redeemed twice by concurrent logins
+			remaining := strings.Join(append(hashes[:i:i], hashes[i+1:]...), ",")
+			result := db.Model(&models.User{}).Where("id = ? AND totp_recovery_codes = ?", u.ID, *u.TOTPRecoveryCodes).Update("totp_recovery_codes", remaining)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInvalidCode
+			}
+			u.TOTPRecoveryCodes = &remaining
+			return nil
+		}
+	}
+
+	return ErrInvalidCode
+}
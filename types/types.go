@@ -17,8 +17,15 @@ limitations under the License.
 package types
 
 import (
+	"net"
+	"os"
 	"time"
 
+	"github.com/doncicuto/glim/server/clientcert"
+	"github.com/doncicuto/glim/server/jwks"
+	"github.com/doncicuto/glim/server/netpolicy"
+	"github.com/doncicuto/glim/server/peercred"
+	"github.com/doncicuto/glim/server/ratelimit"
 	"gorm.io/gorm"
 )
 
@@ -36,9 +43,24 @@ type TokenAuthentication struct {
 	Tokens
 }
 
+// Session - login session tracked in the key-value store. It follows the
+// refresh/access token pair issued by a login through its refreshes
+type Session struct {
+	ID            string    `json:"id"`
+	UID           uint32    `json:"uid"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"user_agent"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastRefreshAt time.Time `json:"last_refresh_at"`
+	JTI           string    `json:"-"`
+	AJTI          string    `json:"-"`
+	Current       bool      `json:"current,omitempty"`
+}
+
 type LoginBody struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"`
 }
 
 type APISettings struct {
@@ -52,25 +74,62 @@ type APISettings struct {
 	RefreshTokenExpiry uint
 	MaxDaysWoRelogin   int
 	Guacamole          bool
+	TOTPSecretKey      string
+	Keys               *jwks.KeySet
+	OIDCIssuer         string
+	RateLimiter        *ratelimit.Limiter
+	NetworkPolicies    netpolicy.Policies
+	TrustedProxies     []*net.IPNet
+	ClientCertMode     string
+	ClientCA           string
+	ClientCertMapping  *clientcert.Mapping
 }
 
 type LDAPSettings struct {
-	DB          *gorm.DB
-	KV          Store
-	TLSDisabled bool
-	TLSCert     string
-	TLSKey      string
-	Address     string
-	Domain      string
-	SizeLimit   int
-	Guacamole   bool
+	DB                *gorm.DB
+	KV                Store
+	TLSDisabled       bool
+	TLSCert           string
+	TLSKey            string
+	Address           string
+	Domain            string
+	SizeLimit         int
+	Guacamole         bool
+	TOTPSecretKey     string
+	OTPSeparator      string
+	OTPPolicy         string
+	Applications      []LDAPApplication
+	RateLimiter       *ratelimit.Limiter
+	NetworkPolicies   netpolicy.Policies
+	ClientCertMode    string
+	ClientCA          string
+	ClientCertMapping *clientcert.Mapping
+	LDAPISocket       string
+	LDAPISocketMode   os.FileMode
+	PeerCredMapping   peercred.Mapping
+	BindNameRules     []string
+	NetBIOSDomain     string
+}
+
+// LDAPApplication identifies the LDAP clients connecting from a set of
+// networks (e.g a VPN concentrator or a Wi-Fi controller) so we can apply
+// specific policies to their binds
+type LDAPApplication struct {
+	Name      string
+	Networks  []*net.IPNet
+	OTPPolicy string
 }
 
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"`
 }
 
+// TOTPCodeRequired is the error message sent by the REST API when a user
+// with two-factor authentication enabled logs in without a code
+const TOTPCodeRequired = "two-factor authentication code required"
+
 // RefreshToken - TODO comment
 type RefreshToken struct {
 	Token string `json:"refresh_token"`
@@ -107,6 +166,14 @@ type Store interface {
 	Get(k string) (v string, found bool, err error)
 	// Delete a key
 	Delete(k string) (err error)
+	// Take gets a value and deletes its key in one atomic step, so only one
+	// caller gets the value
+	Take(k string) (v string, found bool, err error)
+	// Keys returns the keys starting with a prefix
+	Keys(prefix string) (keys []string, err error)
+	// Increment atomically increments a counter, the expiration is only set
+	// when the counter is created
+	Increment(k string, expiration time.Duration) (count int64, err error)
 	// Close a connection with our key-value store
 	Close() error
 }
@@ -114,3 +181,23 @@ type Store interface {
 type GuacamoleSupport struct {
 	Enabled bool `json:"guac_enabled"`
 }
+
+type PasswordHashSettings struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+	RehashOnLogin bool
+}
+
+// POSIXSettings - ranges used to allocate uidNumber and gidNumber values,
+// the homeDirectory template and the default loginShell of new accounts
+type POSIXSettings struct {
+	UIDMin        uint32
+	UIDMax        uint32
+	GIDMin        uint32
+	GIDMax        uint32
+	HomeDirectory string
+	LoginShell    string
+}